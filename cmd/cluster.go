@@ -0,0 +1,13 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package cmd
+
+import (
+	clustercmd "github.com/michielvha/edgectl/cmd/cluster"
+)
+
+// Register the distro-independent cluster commands
+func init() {
+	rootCmd.AddCommand(clustercmd.Cmd)
+}
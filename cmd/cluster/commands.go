@@ -0,0 +1,409 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/michielvha/edgectl/pkg/bundle"
+	"github.com/michielvha/edgectl/pkg/cluster"
+	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/crypt"
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
+	"github.com/michielvha/edgectl/pkg/logger"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Inspect the clusters stored in the secret store and issue join credentials",
+	Long: `The "cluster" command shows the RKE2 and K3s clusters known to the secret store
+and issues join tickets and offline join bundles for nodes joining them, and
+short-lived kubeconfigs for users.
+
+Examples:
+  edgectl cluster list                              # List all clusters
+  edgectl cluster list --distro k3s -o json         # List K3s clusters as JSON
+  edgectl cluster describe --cluster-id my-cluster  # Show masters, VIP, load balancers and secrets
+  edgectl cluster join-ticket --cluster-id my-cluster --role agent --ttl 30m  # Single-use join ticket
+  edgectl cluster bundle export --cluster-id my-cluster -o join.age           # Offline join bundle
+  edgectl cluster kubeconfig issue --cluster-id my-cluster --user alice --group ops --ttl 24h -o alice.yaml
+`,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the clusters stored in the secret store",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("cluster list command executed")
+
+		distro, _ := cmd.Flags().GetString("distro")
+		output, _ := cmd.Flags().GetString("output")
+
+		distros := vault.Distros
+		if distro != "" {
+			distros = []string{distro}
+		}
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		summaries, err := cluster.List(cmd.Context(), store, distros)
+		if err != nil {
+			fmt.Printf("❌ Failed to list clusters: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := common.WriteOutput(os.Stdout, output, summaries, func(w io.Writer) error {
+			return writeListTable(w, summaries)
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Show the details of a cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("cluster describe command executed")
+
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		output, _ := cmd.Flags().GetString("output")
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		summary, err := cluster.Describe(cmd.Context(), store, distro, clusterID)
+		if err != nil {
+			fmt.Printf("❌ Failed to describe cluster: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := common.WriteOutput(os.Stdout, output, summary, func(w io.Writer) error {
+			return writeDescribeTable(w, summary)
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var joinTicketCmd = &cobra.Command{
+	Use:   "join-ticket",
+	Short: "Create a single-use, expiring ticket for a node to join a cluster",
+	Long: `Create a response-wrapped join ticket. The node redeems it once with
+'edgectl <distro> agent install --join-ticket <ticket>' (or 'server install') and needs no
+secret store credentials of its own. A ticket can't be redeemed twice and expires after --ttl.
+
+Agent tickets hold the agent token and the server address. Server tickets additionally hold a
+token with the cluster's server policy, valid for --ttl plus one hour, to register the server.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("cluster join-ticket command executed")
+
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		role, _ := cmd.Flags().GetString("role")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		output, _ := cmd.Flags().GetString("output")
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		ticket, err := store.CreateJoinTicket(cmd.Context(), distro, clusterID, role, ttl)
+		if err != nil {
+			fmt.Printf("❌ Failed to create join ticket: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := common.WriteOutput(os.Stdout, output, ticket, func(w io.Writer) error {
+			return writeJoinTicket(w, ticket)
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Manage offline join bundles",
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export an encrypted join bundle for agents that can't reach the secret store",
+	Long: `Export the agent token, server URL, VIP, CA hash and distro of a cluster into a
+file encrypted with age, using a passphrase or one or more age recipients. Agents install from it
+with 'edgectl <distro> agent install --bundle <file>' without contacting the secret store.
+
+The passphrase is read from --passphrase-file, the EDGECTL_BUNDLE_PASSPHRASE environment
+variable, or prompted for. Unlike a join ticket, a bundle can be used any number of times:
+it stays valid until the agent token is changed.
+
+Examples:
+  edgectl cluster bundle export --cluster-id my-cluster -o join.age
+  edgectl cluster bundle export --cluster-id my-cluster -o join.age --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("cluster bundle export command executed")
+
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		role, _ := cmd.Flags().GetString("role")
+		output, _ := cmd.Flags().GetString("output")
+		passphraseFile, _ := cmd.Flags().GetString("passphrase-file")
+		recipients, _ := cmd.Flags().GetStringSlice("recipient")
+		recipientFiles, _ := cmd.Flags().GetStringSlice("recipients-file")
+
+		passphrase := ""
+		if len(recipients) == 0 && len(recipientFiles) == 0 {
+			var err error
+			if passphrase, err = crypt.ResolvePassphrase(passphraseFile, "EDGECTL_BUNDLE_PASSPHRASE", true); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ageRecipients, err := crypt.Recipients(passphrase, recipients, recipientFiles)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		hostname, _ := os.Hostname()
+		b, err := bundle.Export(cmd.Context(), store, distro, clusterID, role, hostname)
+		if err != nil {
+			fmt.Printf("❌ Failed to export bundle: %v\n", err)
+			os.Exit(1)
+		}
+		sealed, err := bundle.Encode(b, ageRecipients)
+		if err != nil {
+			fmt.Printf("❌ Failed to export bundle: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(output, sealed, 0o600); err != nil {
+			fmt.Printf("❌ Failed to write bundle: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("📦 %s %s bundle for cluster %s (server %s)\n", b.Distro, b.Role, b.ClusterID, b.ServerURL)
+		fmt.Printf("✅ Join bundle written to %s\n", output)
+	},
+}
+
+var kubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "Issue kubeconfigs to users",
+}
+
+var kubeconfigIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Issue a short-lived kubeconfig that authenticates as a user",
+	Long: `Issue a kubeconfig with a client certificate for --user and --group, valid for --ttl,
+instead of sharing the cluster-admin kubeconfig. The API server sees the user and groups, so
+access is granted with RBAC bindings, shows up under the user's name in audit logs and ends
+when the certificate expires.
+
+The certificate is signed with the client CA the first server stored in the secret store, or
+with an OpenBao PKI engine when --pki-mount and --pki-role are given. The user has no access
+until it is granted, for example with:
+
+  kubectl create clusterrolebinding ops-view --clusterrole=view --group=ops
+
+Examples:
+  edgectl cluster kubeconfig issue --cluster-id my-cluster --user alice --group ops --ttl 24h -o alice.yaml
+  edgectl cluster kubeconfig issue --cluster-id my-cluster --user ci --ttl 1h > ci.yaml
+  edgectl cluster kubeconfig issue --cluster-id my-cluster --user bob --pki-mount pki --pki-role kubernetes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("cluster kubeconfig issue command executed")
+
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		user, _ := cmd.Flags().GetString("user")
+		groups, _ := cmd.Flags().GetStringSlice("group")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		output, _ := cmd.Flags().GetString("output")
+		pkiMount, _ := cmd.Flags().GetString("pki-mount")
+		pkiRole, _ := cmd.Flags().GetString("pki-role")
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		issued, err := cluster.IssueKubeconfig(cmd.Context(), store, cluster.IssueOptions{
+			Distro:    distro,
+			ClusterID: clusterID,
+			Identity:  kubeconfig.Identity{User: user, Groups: groups},
+			TTL:       ttl,
+			PKIMount:  pkiMount,
+			PKIRole:   pkiRole,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to issue kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Without --output the kubeconfig goes to stdout, so everything else goes to stderr
+		if output == "" {
+			_, _ = os.Stdout.Write(issued.Kubeconfig)
+		} else if err := os.WriteFile(output, issued.Kubeconfig, 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+
+		groupList := "none"
+		if len(issued.Groups) > 0 {
+			groupList = strings.Join(issued.Groups, ", ")
+		}
+		fmt.Fprintf(os.Stderr, "🪪 Issued kubeconfig for user %s (groups: %s) on cluster %s\n", issued.User, groupList, clusterID)
+		fmt.Fprintf(os.Stderr, "🔏 Certificate serial %s, expires %s\n", issued.SerialNumber, issued.NotAfter.Local().Format(time.DateTime))
+		if output != "" {
+			fmt.Fprintf(os.Stderr, "✅ Kubeconfig written to %s (context %s)\n", output, issued.Context)
+		}
+	},
+}
+
+// writeJoinTicket prints a ticket with the command to redeem it.
+func writeJoinTicket(w io.Writer, t *vault.JoinTicket) error {
+	_, _ = fmt.Fprintf(w, "🎟️ Join ticket for a %s %s of cluster %s (single use, expires %s):\n\n",
+		t.Distro, t.Role, t.ClusterID, t.ExpiresAt.Local().Format(time.DateTime))
+	_, _ = fmt.Fprintf(w, "  %s\n\n", t.Ticket)
+	_, err := fmt.Fprintf(w, "Redeem it on the node with:\n\n  edgectl %s %s install --join-ticket %s\n", t.Distro, t.Role, t.Ticket)
+	return err
+}
+
+// writeListTable prints one line per cluster.
+func writeListTable(w io.Writer, summaries []cluster.Summary) error {
+	if len(summaries) == 0 {
+		_, err := fmt.Fprintln(w, "No clusters found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DISTRO\tCLUSTER ID\tVIP\tMASTERS\tLB NODES\tTOKEN\tKUBECONFIG")
+	for _, s := range summaries {
+		if s.Error != "" {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\terror: %s\n", s.Distro, s.ClusterID, s.Error)
+			continue
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			s.Distro, s.ClusterID, orDash(s.VIP), len(s.Masters), len(s.LBNodes),
+			itemSummary(s.Token), itemSummary(s.Kubeconfig))
+	}
+	return tw.Flush()
+}
+
+// writeDescribeTable prints the details of a single cluster.
+func writeDescribeTable(w io.Writer, s *cluster.Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Cluster:\t%s (%s)\n", s.ClusterID, s.Distro)
+	_, _ = fmt.Fprintf(tw, "VIP:\t%s\n", orDash(s.VIP))
+	_, _ = fmt.Fprintf(tw, "Token:\t%s\n", itemSummary(s.Token))
+	_, _ = fmt.Fprintf(tw, "Kubeconfig:\t%s\n", itemSummary(s.Kubeconfig))
+
+	_, _ = fmt.Fprintf(tw, "\nMasters (%d):\n", len(s.Masters))
+	for _, m := range s.Masters {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", m.Hostname, orDash(m.IP))
+	}
+
+	_, _ = fmt.Fprintf(tw, "\nLoad balancers (%d):\n", len(s.LBNodes))
+	for _, n := range s.LBNodes {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", n.Hostname, strings.ToUpper(n.Role))
+	}
+	return tw.Flush()
+}
+
+// itemSummary renders an item's state with its last-updated time.
+func itemSummary(item cluster.ItemStatus) string {
+	if !item.Exists {
+		return "missing"
+	}
+	if item.UpdatedAt == nil || item.UpdatedAt.IsZero() {
+		return fmt.Sprintf("v%d", item.Version)
+	}
+	return fmt.Sprintf("v%d (%s)", item.Version, item.UpdatedAt.Local().Format(time.DateTime))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Initialize and register subcommands
+func init() {
+	// List command flags
+	listCmd.Flags().String("distro", "", "Only list clusters of this distribution (rke2 or k3s, default: all)")
+	listCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+
+	// Describe command flags
+	describeCmd.Flags().String("cluster-id", "", "The ID of the cluster to describe")
+	describeCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	describeCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+	_ = describeCmd.MarkFlagRequired("cluster-id")
+
+	// Join ticket command flags
+	joinTicketCmd.Flags().String("cluster-id", "", "The ID of the cluster to join")
+	joinTicketCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	joinTicketCmd.Flags().String("role", vault.PolicyRoleAgent, "Role of the joining node: agent or server")
+	joinTicketCmd.Flags().Duration("ttl", 30*time.Minute, "How long the ticket can be redeemed")
+	joinTicketCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+	_ = joinTicketCmd.MarkFlagRequired("cluster-id")
+
+	// Bundle export command flags
+	bundleExportCmd.Flags().String("cluster-id", "", "The ID of the cluster to join")
+	bundleExportCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	bundleExportCmd.Flags().String("role", vault.PolicyRoleAgent, "Role of the joining node (only agent is supported)")
+	bundleExportCmd.Flags().StringP("output", "o", "", "File to write the bundle to")
+	bundleExportCmd.Flags().String("passphrase-file", "", "File holding the passphrase to encrypt with")
+	bundleExportCmd.Flags().StringSlice("recipient", nil, "age recipient (age1...) to encrypt to, instead of a passphrase (repeatable)")
+	bundleExportCmd.Flags().StringSlice("recipients-file", nil, "File with age recipients, one per line (repeatable)")
+	_ = bundleExportCmd.MarkFlagRequired("cluster-id")
+	_ = bundleExportCmd.MarkFlagRequired("output")
+	bundleExportCmd.MarkFlagsMutuallyExclusive("passphrase-file", "recipient")
+	bundleExportCmd.MarkFlagsMutuallyExclusive("passphrase-file", "recipients-file")
+	bundleCmd.AddCommand(bundleExportCmd)
+
+	// Kubeconfig issue command flags
+	kubeconfigIssueCmd.Flags().String("cluster-id", "", "The ID of the cluster to issue a kubeconfig for")
+	kubeconfigIssueCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	kubeconfigIssueCmd.Flags().String("user", "", "Kubernetes user name (the certificate's common name)")
+	kubeconfigIssueCmd.Flags().StringSlice("group", nil, "Kubernetes group of the user (repeatable)")
+	kubeconfigIssueCmd.Flags().Duration("ttl", 24*time.Hour, "How long the kubeconfig is valid")
+	kubeconfigIssueCmd.Flags().StringP("output", "o", "", "File to write the kubeconfig to (default: stdout)")
+	kubeconfigIssueCmd.Flags().String("pki-mount", "", "Sign with the OpenBao PKI engine at this mount instead of the cluster's client CA")
+	kubeconfigIssueCmd.Flags().String("pki-role", "", "PKI role to sign with (required with --pki-mount)")
+	_ = kubeconfigIssueCmd.MarkFlagRequired("cluster-id")
+	_ = kubeconfigIssueCmd.MarkFlagRequired("user")
+	kubeconfigIssueCmd.MarkFlagsRequiredTogether("pki-mount", "pki-role")
+	kubeconfigCmd.AddCommand(kubeconfigIssueCmd)
+
+	// Register subcommands
+	Cmd.AddCommand(listCmd)
+	Cmd.AddCommand(describeCmd)
+	Cmd.AddCommand(joinTicketCmd)
+	Cmd.AddCommand(bundleCmd)
+	Cmd.AddCommand(kubeconfigCmd)
+}
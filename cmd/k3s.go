@@ -10,6 +10,7 @@ import (
 	k3slbcmd "github.com/michielvha/edgectl/cmd/k3s/lb"
 	k3sservercmd "github.com/michielvha/edgectl/cmd/k3s/server"
 	k3ssystemcmd "github.com/michielvha/edgectl/cmd/k3s/system"
+	k3stokencmd "github.com/michielvha/edgectl/cmd/k3s/token"
 )
 
 // k3sCmd represents the "k3s" command
@@ -25,6 +26,7 @@ Examples:
   edgectl k3s system purge          # Uninstall K3s
   edgectl k3s system kubeconfig     # Fetch kubeconfig from secret store
   edgectl k3s system bash           # Configure bash environment
+  edgectl k3s token rotate          # Rotate the cluster join token
 `,
 }
 
@@ -36,4 +38,5 @@ func init() {
 	k3sCmd.AddCommand(k3sagentcmd.Cmd)
 	k3sCmd.AddCommand(k3ssystemcmd.Cmd)
 	k3sCmd.AddCommand(k3slbcmd.Cmd)
+	k3sCmd.AddCommand(k3stokencmd.Cmd)
 }
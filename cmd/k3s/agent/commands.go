@@ -9,7 +9,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/michielvha/edgectl/pkg/bundle"
 	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/crypt"
 	"github.com/michielvha/edgectl/pkg/k3s/agent"
 	"github.com/michielvha/edgectl/pkg/logger"
 	"github.com/michielvha/edgectl/pkg/vault"
@@ -23,6 +25,8 @@ var Cmd = &cobra.Command{
 
 Examples:
   edgectl k3s agent install --cluster-id my-cluster  # Install K3s Agent
+  edgectl k3s agent install --join-ticket <ticket>  # Install K3s Agent with a join ticket
+  edgectl k3s agent install --bundle join.age       # Install K3s Agent from an offline join bundle
 `,
 }
 
@@ -41,13 +45,40 @@ var installCmd = &cobra.Command{
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		vip, _ := cmd.Flags().GetString("vip")
 		lbHostname, _ := cmd.Flags().GetString("lb-hostname")
+		ticket, _ := cmd.Flags().GetString("join-ticket")
+		bundlePath, _ := cmd.Flags().GetString("bundle")
 
-		store := vault.InitVaultClient()
-		if store == nil {
-			os.Exit(1)
+		var err error
+		switch {
+		case bundlePath != "":
+			// The bundle is served as a read-only secret store, so the install runs as usual
+			store, openErr := openBundle(cmd, bundlePath)
+			if openErr != nil {
+				fmt.Printf("❌ %v\n", openErr)
+				os.Exit(1)
+			}
+			if store.Bundle().Distro != "k3s" {
+				fmt.Printf("❌ The bundle is for a %s cluster, not K3s\n", store.Bundle().Distro)
+				os.Exit(1)
+			}
+			fmt.Printf("📦 Installing from join bundle for cluster %s\n", store.Bundle().ClusterID)
+			err = agent.Install(cmd.Context(), store, store.Bundle().ClusterID, vip, lbHostname)
+		case ticket != "":
+			// The ticket replaces the secret store credentials; it can only be redeemed once
+			creds, redeemErr := vault.RedeemJoinTicket(cmd.Context(), ticket, "k3s", vault.PolicyRoleAgent)
+			if redeemErr != nil {
+				fmt.Printf("❌ %v\n", redeemErr)
+				os.Exit(1)
+			}
+			fmt.Printf("🎟️ Join ticket redeemed for cluster %s\n", creds.ClusterID)
+			err = agent.InstallWithCredentials(creds, vip, lbHostname)
+		default:
+			store := vault.InitVaultClient(cmd.Context())
+			if store == nil || !vault.RunPreflight(cmd.Context(), store, "k3s", clusterID, vault.PolicyRoleAgent, "") {
+				os.Exit(1)
+			}
+			err = agent.Install(cmd.Context(), store, clusterID, vip, lbHostname)
 		}
-
-		err := agent.Install(store, clusterID, vip, lbHostname)
 		if err != nil {
 			fmt.Printf("❌ K3s agent install failed: %v\n", err)
 			os.Exit(1)
@@ -57,13 +88,38 @@ var installCmd = &cobra.Command{
 	},
 }
 
+// openBundle decrypts a join bundle with --identity, or the passphrase from --passphrase-file,
+// EDGECTL_BUNDLE_PASSPHRASE or a prompt.
+func openBundle(cmd *cobra.Command, path string) (*bundle.Store, error) {
+	identityFiles, _ := cmd.Flags().GetStringSlice("identity")
+	passphrase := ""
+	if len(identityFiles) == 0 {
+		file, _ := cmd.Flags().GetString("passphrase-file")
+		var err error
+		if passphrase, err = crypt.ResolvePassphrase(file, "EDGECTL_BUNDLE_PASSPHRASE", false); err != nil {
+			return nil, err
+		}
+	}
+	identities, err := crypt.Identities(passphrase, identityFiles)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.OpenStore(path, identities)
+}
+
 // Initialize command flags and register subcommands
 func init() {
 	// Install command flags
 	installCmd.Flags().String("cluster-id", "", "The ID of the cluster you want to join")
 	installCmd.Flags().String("vip", "", "Virtual IP fallback if VIP is not found in secret store")
 	installCmd.Flags().String("lb-hostname", "", "Load balancer hostname to resolve as VIP fallback (last resort)")
-	_ = installCmd.MarkFlagRequired("cluster-id")
+	installCmd.Flags().String("join-ticket", "", "Single-use join ticket (see 'edgectl cluster join-ticket'), used instead of secret store credentials")
+	installCmd.Flags().String("bundle", "", "Encrypted join bundle (see 'edgectl cluster bundle export'), used instead of the secret store")
+	installCmd.Flags().String("passphrase-file", "", "File holding the passphrase the bundle was encrypted with")
+	installCmd.Flags().StringSlice("identity", nil, "age identity file (private key) to decrypt the bundle with, instead of a passphrase (repeatable)")
+	installCmd.MarkFlagsOneRequired("cluster-id", "join-ticket", "bundle")
+	installCmd.MarkFlagsMutuallyExclusive("cluster-id", "join-ticket", "bundle")
+	installCmd.MarkFlagsMutuallyExclusive("passphrase-file", "identity")
 
 	// Register subcommands
 	Cmd.AddCommand(installCmd)
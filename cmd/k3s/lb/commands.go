@@ -23,6 +23,7 @@ var Cmd = &cobra.Command{
 
 Examples:
   edgectl k3s lb create --cluster-id my-cluster --vip 192.168.10.100  # Create a new load balancer
+  edgectl k3s lb create --cluster-id my-cluster --dry-run             # Preview the election and configs
   edgectl k3s lb status --cluster-id my-cluster                       # Check load balancer status
 `,
 }
@@ -30,28 +31,47 @@ Examples:
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a load balancer for K3s",
+	Long: `The "create" command elects this node MASTER or BACKUP, records it in the secret store
+and installs and configures HAProxy and Keepalived.
+
+With --dry-run the election runs against an in-memory copy of the cluster's records: the
+configuration files are printed instead of written, nothing is installed and the secret
+store is left unchanged.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Debug("k3s lb create command executed")
 
-		if common.CheckRoot() != nil {
-			os.Exit(1)
-		}
-
 		logger.Debug("Extracting values from command line arguments")
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		vip, _ := cmd.Flags().GetString("vip")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-		store := vault.InitVaultClient()
-		if store == nil {
+		if !dryRun && common.CheckRoot() != nil {
 			os.Exit(1)
 		}
 
-		err := lb.CreateLoadBalancer(store, clusterID, vip, "k3s")
+		store := openStore(cmd, clusterID, dryRun)
+		if client, ok := store.(*vault.Client); ok && !dryRun {
+			hostname, err := os.Hostname()
+			if err != nil {
+				fmt.Printf("❌ Failed to get hostname: %v\n", err)
+				os.Exit(1)
+			}
+			if !vault.RunPreflight(cmd.Context(), client, "k3s", clusterID, vault.PolicyRoleLB, hostname) {
+				os.Exit(1)
+			}
+		}
+		err := lb.CreateLoadBalancer(cmd.Context(), store, clusterID, vip, "k3s", lb.Options{DryRun: dryRun})
 		if err != nil {
 			fmt.Printf("❌ Failed to create load balancer: %v\n", err)
 			os.Exit(1)
 		}
 
+		if dryRun {
+			fmt.Println("ℹ️ Dry run: nothing installed or stored. Load balancers after the create:")
+			printStatus(cmd, store, clusterID)
+			return
+		}
+
 		fmt.Println("✅ K3s load balancer created successfully")
 	},
 }
@@ -64,27 +84,12 @@ var statusCmd = &cobra.Command{
 
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 
-		store := vault.InitVaultClient()
+		store := vault.InitVaultClient(cmd.Context())
 		if store == nil {
 			os.Exit(1)
 		}
 
-		vip, nodes, err := lb.GetStatus(store, "k3s", clusterID)
-		if err != nil {
-			fmt.Printf("❌ Failed to retrieve load balancer info: %v\n", err)
-			os.Exit(1)
-		}
-
-		fmt.Printf("ℹ️ K3s Load balancer VIP: %s\n", vip)
-		fmt.Println("ℹ️ Load balancer nodes:")
-
-		for _, node := range nodes {
-			role := "BACKUP"
-			if node.IsMain {
-				role = "MASTER"
-			}
-			fmt.Printf("  - %s (%s)\n", node.Hostname, role)
-		}
+		printStatus(cmd, store, clusterID)
 	},
 }
 
@@ -96,35 +101,77 @@ This includes disabling services (which also stops them) and removing configurat
 The HAProxy and Keepalived packages will remain installed.
 
 Example:
-  edgectl k3s lb cleanup --cluster-id my-cluster  # Clean up LB and remove from secret store`,
+  edgectl k3s lb cleanup --cluster-id my-cluster            # Clean up LB and remove from secret store
+  edgectl k3s lb cleanup --cluster-id my-cluster --dry-run  # Show what would be removed`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Debug("k3s lb cleanup command executed")
 
-		if common.CheckRoot() != nil {
-			os.Exit(1)
-		}
-
 		logger.Debug("Extracting values from command line arguments")
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-		store := vault.InitVaultClient()
-		if store == nil {
+		if !dryRun && common.CheckRoot() != nil {
 			os.Exit(1)
 		}
 
-		err := lb.CleanupLoadBalancer(store, "k3s", clusterID)
+		store := openStore(cmd, clusterID, dryRun)
+		err := lb.CleanupLoadBalancer(cmd.Context(), store, "k3s", clusterID, lb.Options{DryRun: dryRun})
 		if err != nil {
 			fmt.Printf("❌ Failed to clean up load balancer: %v\n", err)
 			os.Exit(1)
 		}
+
+		if dryRun {
+			fmt.Println("ℹ️ Dry run: nothing removed or stored. Load balancers after the cleanup:")
+			printStatus(cmd, store, clusterID)
+		}
 	},
 }
 
+// openStore connects to the secret store; for a dry run it returns an in-memory copy of the cluster instead.
+func openStore(cmd *cobra.Command, clusterID string, dryRun bool) vault.SecretStore {
+	store := vault.InitVaultClient(cmd.Context())
+	if store == nil {
+		os.Exit(1)
+	}
+	if !dryRun {
+		return store
+	}
+
+	preview, err := lb.DryRunStore(cmd.Context(), store, "k3s", clusterID)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	return preview
+}
+
+// printStatus prints the load balancer VIP and nodes of a cluster.
+func printStatus(cmd *cobra.Command, store vault.SecretStore, clusterID string) {
+	vip, nodes, err := lb.GetStatus(cmd.Context(), store, "k3s", clusterID)
+	if err != nil {
+		fmt.Printf("❌ Failed to retrieve load balancer info: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("ℹ️ K3s Load balancer VIP: %s\n", vip)
+	fmt.Println("ℹ️ Load balancer nodes:")
+
+	for _, node := range nodes {
+		role := "BACKUP"
+		if node.IsMain {
+			role = "MASTER"
+		}
+		fmt.Printf("  - %s (%s)\n", node.Hostname, role)
+	}
+}
+
 // Initialize command flags and register subcommands
 func init() {
 	// Create command flags
 	createCmd.Flags().String("cluster-id", "", "The ID of the cluster to create a load balancer for")
 	createCmd.Flags().String("vip", "", "Virtual IP address for the load balancer")
+	createCmd.Flags().Bool("dry-run", false, "Print the election result and configuration without installing or storing anything")
 	_ = createCmd.MarkFlagRequired("cluster-id")
 
 	// Status command flags
@@ -133,6 +180,7 @@ func init() {
 
 	// Cleanup command flags
 	cleanupCmd.Flags().String("cluster-id", "", "The ID of the cluster to clean up the load balancer for")
+	cleanupCmd.Flags().Bool("dry-run", false, "Show what would be removed without changing the node or the secret store")
 	_ = cleanupCmd.MarkFlagRequired("cluster-id")
 
 	// Register subcommands
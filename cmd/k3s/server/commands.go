@@ -24,6 +24,7 @@ var Cmd = &cobra.Command{
 Examples:
   edgectl k3s server install                            # Install new K3s Server
   edgectl k3s server install --cluster-id my-cluster    # Join existing K3s cluster as server
+  edgectl k3s server install --join-ticket <ticket>      # Join with a single-use join ticket
 `,
 }
 
@@ -43,13 +44,36 @@ var installCmd = &cobra.Command{
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		isExisting := cmd.Flags().Changed("cluster-id")
 		vip, _ := cmd.Flags().GetString("vip")
+		apiPort, _ := cmd.Flags().GetInt("api-port")
+		ticket, _ := cmd.Flags().GetString("join-ticket")
 
-		store := vault.InitVaultClient()
-		if store == nil {
+		var client *vault.Client
+		if ticket != "" {
+			// The ticket carries a short-lived store token scoped to the cluster it joins
+			creds, err := vault.RedeemJoinTicket(cmd.Context(), ticket, "k3s", vault.PolicyRoleServer)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("🎟️ Join ticket redeemed for cluster %s\n", creds.ClusterID)
+			if client, err = vault.NewClientFromCredentials(cmd.Context(), vault.LoadConfig(), creds); err != nil {
+				fmt.Printf("❌ Failed to connect to secret store with the join ticket: %v\n", err)
+				os.Exit(1)
+			}
+			defer client.Close()
+			clusterID, isExisting = creds.ClusterID, true
+		} else {
+			client = vault.InitVaultClient(cmd.Context())
+			if client == nil {
+				os.Exit(1)
+			}
+		}
+
+		if !vault.RunPreflight(cmd.Context(), client, "k3s", clusterID, vault.PolicyRoleServer, "") {
 			os.Exit(1)
 		}
 
-		err := server.Install(store, clusterID, isExisting, vip)
+		err := server.Install(cmd.Context(), client, clusterID, isExisting, vip, apiPort)
 		if err != nil {
 			fmt.Printf("❌ K3s server install failed: %v\n", err)
 			os.Exit(1)
@@ -62,8 +86,11 @@ var installCmd = &cobra.Command{
 // Initialize command flags and register subcommands
 func init() {
 	// Install command flags
-	installCmd.Flags().String("cluster-id", "", "The clusterID required to join an existing cluster")
-	installCmd.Flags().String("vip", "", "Virtual IP to use for the load balancer (used for TLS SANs)")
+	installCmd.Flags().String("cluster-id", "", "Cluster ID to join; if it has not been initialized yet, one server bootstraps it")
+	installCmd.Flags().String("vip", "", "Virtual IP to use for the load balancer (used for TLS SANs), without port")
+	installCmd.Flags().Int("api-port", 0, "Port the load balancer serves the API on, used in the kubeconfig stored for a new cluster (default: the API server port, 6443)")
+	installCmd.Flags().String("join-ticket", "", "Single-use join ticket (see 'edgectl cluster join-ticket') to join an existing cluster with")
+	installCmd.MarkFlagsMutuallyExclusive("cluster-id", "join-ticket")
 
 	// Register subcommands
 	Cmd.AddCommand(installCmd)
@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
 	"github.com/michielvha/edgectl/pkg/logger"
 	"github.com/michielvha/edgectl/pkg/vault"
 )
@@ -58,12 +59,12 @@ If --cluster-id is provided, also removes all cluster data from the secret store
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		if clusterID != "" {
 			fmt.Printf("🔄 Removing cluster data from secret store for %s...\n", clusterID)
-			vaultClient := vault.InitVaultClient()
+			vaultClient := vault.InitVaultClient(cmd.Context())
 			if vaultClient == nil {
 				fmt.Println("⚠️  Could not connect to secret store — skipping remote cleanup")
 				return
 			}
-			if err := vaultClient.DeleteClusterData("k3s", clusterID); err != nil {
+			if err := vaultClient.DeleteClusterData(cmd.Context(), "k3s", clusterID); err != nil {
 				fmt.Printf("⚠️  Secret store cleanup completed with warnings: %v\n", err)
 			} else {
 				fmt.Println("✅ Cluster data removed from secret store")
@@ -75,25 +76,59 @@ If --cluster-id is provided, also removes all cluster data from the secret store
 var kubeconfigCmd = &cobra.Command{
 	Use:   "kubeconfig",
 	Short: "Fetch kubeconfig from the secret store and store it on the host",
+	Long: `Fetches the kubeconfig of a cluster from the secret store and saves it on the host.
+
+The cluster, user and context are named after the cluster ID (or --context-name for the context).
+When the destination exists they are merged into it, replacing the entries of an earlier fetch and
+keeping every other cluster; the previous file is kept as <output>.bak. Use --merge=false to
+replace the file instead.
+
+Examples:
+  edgectl k3s system kubeconfig --cluster-id k3s-abc12345
+  edgectl k3s system kubeconfig --cluster-id k3s-abc12345 --context-name edge-site-1 --switch-context
+  edgectl k3s system kubeconfig --cluster-id k3s-abc12345 --output ./kubeconfig --merge=false`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Debug("k3s system kubeconfig command executed")
 
 		logger.Debug("Extracting values from command line arguments")
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		outputPath, _ := cmd.Flags().GetString("output")
+		version, _ := cmd.Flags().GetInt("version")
+		merge, _ := cmd.Flags().GetBool("merge")
+		contextName, _ := cmd.Flags().GetString("context-name")
+		switchContext, _ := cmd.Flags().GetBool("switch-context")
 
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
 			os.Exit(1)
 		}
 
-		err := vaultClient.RetrieveKubeConfig("k3s", clusterID, outputPath)
+		record, err := vaultClient.RetrieveKubeconfigRecordVersion(cmd.Context(), "k3s", clusterID, version)
+		if err != nil {
+			fmt.Printf("❌ Failed to retrieve kubeconfig for cluster %s: %v\n", clusterID, err)
+			os.Exit(1)
+		}
+
+		result, err := kubeconfig.Save(outputPath, []byte(record.Kubeconfig), kubeconfig.SaveOptions{
+			MergeOptions: kubeconfig.MergeOptions{Name: clusterID, ContextName: contextName, SwitchContext: switchContext},
+			Replace:      !merge,
+		})
 		if err != nil {
-			fmt.Printf("❌ Failed to retrieve kubeconfig: %v\n", err)
+			fmt.Printf("❌ Failed to save kubeconfig: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("✅ Kubeconfig successfully written to: %s\n", outputPath)
+		if result.Backup != "" {
+			fmt.Printf("💾 Previous kubeconfig saved to: %s\n", result.Backup)
+		}
+		if result.Merged {
+			fmt.Printf("✅ Kubeconfig merged into %s as context %s\n", outputPath, result.Context)
+			if !switchContext {
+				fmt.Printf("   Switch to it with: kubectl config use-context %s\n", result.Context)
+			}
+		} else {
+			fmt.Printf("✅ Kubeconfig successfully written to: %s (context %s)\n", outputPath, result.Context)
+		}
 
 		// Configure bash shell to use the kubeconfig
 		common.RunBashFunction("k3s-bash.sh", "setup_kubectl_bash_env")
@@ -119,6 +154,10 @@ func init() {
 	kubeconfigCmd.Flags().String("cluster-id", "", "The ID of the cluster to fetch the kubeconfig for")
 	homeBasedKubeconfig := filepath.Join(userHomeDir, ".kube", "config")
 	kubeconfigCmd.Flags().String("output", homeBasedKubeconfig, "Destination path to store the kubeconfig")
+	kubeconfigCmd.Flags().Int("version", 0, "Kubeconfig version to fetch, see 'edgectl secrets history' (default: current)")
+	kubeconfigCmd.Flags().Bool("merge", true, "Merge into the destination if it exists, keeping its other clusters (--merge=false replaces it)")
+	kubeconfigCmd.Flags().String("context-name", "", "Name of the kubeconfig context (default: the cluster ID)")
+	kubeconfigCmd.Flags().Bool("switch-context", false, "Make the fetched cluster the current context")
 
 	_ = kubeconfigCmd.MarkFlagRequired("cluster-id")
 
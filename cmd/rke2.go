@@ -12,6 +12,7 @@ import (
 	lbcmd "github.com/michielvha/edgectl/cmd/rke2/lb"
 	servercmd "github.com/michielvha/edgectl/cmd/rke2/server"
 	systemcmd "github.com/michielvha/edgectl/cmd/rke2/system"
+	tokencmd "github.com/michielvha/edgectl/cmd/rke2/token"
 )
 
 // rke2Cmd represents the "rke2" command
@@ -27,6 +28,7 @@ Examples:
   edgectl rke2 system purge          # Uninstall RKE2
   edgectl rke2 system kubeconfig     # Fetch kubeconfig from secret store
   edgectl rke2 system bash           # Configure bash environment
+  edgectl rke2 token rotate          # Rotate the cluster join token
 `,
 }
 
@@ -40,4 +42,5 @@ func init() {
 	rke2Cmd.AddCommand(agentcmd.Cmd)
 	rke2Cmd.AddCommand(systemcmd.Cmd)
 	rke2Cmd.AddCommand(lbcmd.Cmd)
+	rke2Cmd.AddCommand(tokencmd.Cmd)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
 	"github.com/michielvha/edgectl/pkg/logger"
 	"github.com/michielvha/edgectl/pkg/vault"
 )
@@ -57,12 +58,12 @@ If --cluster-id is provided, also removes all cluster data from the secret store
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		if clusterID != "" {
 			fmt.Printf("🔄 Removing cluster data from secret store for %s...\n", clusterID)
-			vaultClient := vault.InitVaultClient()
+			vaultClient := vault.InitVaultClient(cmd.Context())
 			if vaultClient == nil {
 				fmt.Println("⚠️  Could not connect to secret store — skipping remote cleanup")
 				return
 			}
-			if err := vaultClient.DeleteClusterData("rke2", clusterID); err != nil {
+			if err := vaultClient.DeleteClusterData(cmd.Context(), "rke2", clusterID); err != nil {
 				fmt.Printf("⚠️  Secret store cleanup completed with warnings: %v\n", err)
 			} else {
 				fmt.Println("✅ Cluster data removed from secret store")
@@ -74,25 +75,59 @@ If --cluster-id is provided, also removes all cluster data from the secret store
 var kubeconfigCmd = &cobra.Command{
 	Use:   "kubeconfig",
 	Short: "Fetch kubeconfig from the secret store and store it on the host",
+	Long: `Fetches the kubeconfig of a cluster from the secret store and saves it on the host.
+
+The cluster, user and context are named after the cluster ID (or --context-name for the context).
+When the destination exists they are merged into it, replacing the entries of an earlier fetch and
+keeping every other cluster; the previous file is kept as <output>.bak. Use --merge=false to
+replace the file instead.
+
+Examples:
+  edgectl rke2 system kubeconfig --cluster-id rke2-abc12345
+  edgectl rke2 system kubeconfig --cluster-id rke2-abc12345 --context-name edge-site-1 --switch-context
+  edgectl rke2 system kubeconfig --cluster-id rke2-abc12345 --output ./kubeconfig --merge=false`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Debug("system kubeconfig command executed")
 
 		logger.Debug("Extracting values from command line arguments")
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		outputPath, _ := cmd.Flags().GetString("output")
+		version, _ := cmd.Flags().GetInt("version")
+		merge, _ := cmd.Flags().GetBool("merge")
+		contextName, _ := cmd.Flags().GetString("context-name")
+		switchContext, _ := cmd.Flags().GetBool("switch-context")
 
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
 			os.Exit(1)
 		}
 
-		err := vaultClient.RetrieveKubeConfig("rke2", clusterID, outputPath)
+		record, err := vaultClient.RetrieveKubeconfigRecordVersion(cmd.Context(), "rke2", clusterID, version)
+		if err != nil {
+			fmt.Printf("❌ Failed to retrieve kubeconfig for cluster %s: %v\n", clusterID, err)
+			os.Exit(1)
+		}
+
+		result, err := kubeconfig.Save(outputPath, []byte(record.Kubeconfig), kubeconfig.SaveOptions{
+			MergeOptions: kubeconfig.MergeOptions{Name: clusterID, ContextName: contextName, SwitchContext: switchContext},
+			Replace:      !merge,
+		})
 		if err != nil {
-			fmt.Printf("❌ Failed to retrieve kubeconfig: %v\n", err)
+			fmt.Printf("❌ Failed to save kubeconfig: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("✅ Kubeconfig successfully written to: %s\n", outputPath)
+		if result.Backup != "" {
+			fmt.Printf("💾 Previous kubeconfig saved to: %s\n", result.Backup)
+		}
+		if result.Merged {
+			fmt.Printf("✅ Kubeconfig merged into %s as context %s\n", outputPath, result.Context)
+			if !switchContext {
+				fmt.Printf("   Switch to it with: kubectl config use-context %s\n", result.Context)
+			}
+		} else {
+			fmt.Printf("✅ Kubeconfig successfully written to: %s (context %s)\n", outputPath, result.Context)
+		}
 
 		// Configure bash shell to use the kubeconfig
 		common.RunBashFunction("rke2-bash.sh", "setup_kubectl_bash_env")
@@ -119,6 +154,10 @@ func init() {
 	// Set default output path for kubeconfig generated from userHomeDir
 	homeBasedKubeconfig := filepath.Join(userHomeDir, ".kube", "config")
 	kubeconfigCmd.Flags().String("output", homeBasedKubeconfig, "Destination path to store the kubeconfig")
+	kubeconfigCmd.Flags().Int("version", 0, "Kubeconfig version to fetch, see 'edgectl secrets history' (default: current)")
+	kubeconfigCmd.Flags().Bool("merge", true, "Merge into the destination if it exists, keeping its other clusters (--merge=false replaces it)")
+	kubeconfigCmd.Flags().String("context-name", "", "Name of the kubeconfig context (default: the cluster ID)")
+	kubeconfigCmd.Flags().Bool("switch-context", false, "Make the fetched cluster the current context")
 
 	_ = kubeconfigCmd.MarkFlagRequired("cluster-id")
 
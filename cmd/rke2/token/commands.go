@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package token
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/logger"
+	"github.com/michielvha/edgectl/pkg/rke2/server"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+var Cmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage the RKE2 join token",
+	Long: `The "token" command manages the join token of an RKE2 cluster.
+
+Examples:
+  edgectl rke2 token rotate --cluster-id my-cluster    # Rotate the join token (run on a server)
+`,
+}
+
+// rotateCmd represents the "token rotate" command
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the cluster join token",
+	Long: `Rotates the join token of an RKE2 cluster. Run this on one of the cluster's servers.
+
+The token is rotated with "rke2 token rotate", the new token is stored in the secret store
+(recording the rotation time and host), and the token in this server's config file is updated.
+The other servers registered in the secret store are listed without checking their config files,
+so the token can be updated there before they are restarted. Agents aren't registered and can't be
+listed; only those that joined with the server token instead of the agent token are affected. Restart rke2-server on this host to finish.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger.Debug("token rotate command executed")
+
+		// Check if user is root
+		if common.CheckRoot() != nil {
+			os.Exit(1)
+		}
+
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		newToken, _ := cmd.Flags().GetString("new-token")
+
+		store := vault.InitVaultClient(cmd.Context())
+		if store == nil {
+			os.Exit(1)
+		}
+
+		report, err := server.RotateToken(cmd.Context(), store, clusterID, newToken)
+		if err != nil {
+			fmt.Printf("❌ Token rotation failed: %v\n", err)
+			if report != nil && report.TokenFile != "" {
+				// The server already switched, so the new token must not get lost
+				fmt.Printf("⚠️  The new token is active on this server and was saved to %s (readable by root only).\n", report.TokenFile)
+				fmt.Printf("   Store it and then delete the file:\n   edgectl secrets upload --distro rke2 --cluster-id %s --token \"$(cat %s)\" && rm %s\n", clusterID, report.TokenFile, report.TokenFile)
+			}
+			os.Exit(1)
+		}
+
+		for _, file := range report.UpdatedFiles {
+			fmt.Printf("📝 Updated token in %s\n", file)
+		}
+		if len(report.OtherServers) > 0 {
+			fmt.Println("⚠️  Update the token in /etc/rancher/rke2/config.yaml on the other registered servers (not checked):")
+			for _, host := range report.OtherServers {
+				fmt.Printf("   - %s\n", host)
+			}
+		}
+		fmt.Println("ℹ️  Agents aren't registered in the secret store and can't be listed. Agents that joined with the")
+		fmt.Println("   server token instead of the agent token need the new token as well")
+		fmt.Println("✅ Join token rotated, restart rke2-server to apply it: systemctl restart rke2-server")
+	},
+}
+
+// Initialize command flags and register subcommands
+func init() {
+	rotateCmd.Flags().String("cluster-id", "", "Cluster ID whose join token to rotate")
+	rotateCmd.Flags().String("new-token", "", "New token secret (default: randomly generated)")
+	_ = rotateCmd.MarkFlagRequired("cluster-id")
+
+	Cmd.AddCommand(rotateCmd)
+}
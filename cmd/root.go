@@ -4,8 +4,11 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -47,8 +50,18 @@ and interacting with secure secrets storage — all tailored for edge environmen
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Ctrl-C (or SIGTERM) cancels the command context, aborting in-flight secret store requests;
+// a second Ctrl-C terminates immediately.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore default signal handling so a second Ctrl-C kills the process
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -72,6 +85,25 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Error binding verbose environment variable: %v\n", err)
 	}
 
+	// TLS settings for the OpenBao connection, also read from the config file (secretstore.tls.*)
+	// and the BAO_* environment variables
+	rootCmd.PersistentFlags().String("tls-ca-cert", "", "CA bundle (PEM) that signed the secret store certificate")
+	rootCmd.PersistentFlags().String("tls-client-cert", "", "Client certificate (PEM) for mutual TLS with the secret store")
+	rootCmd.PersistentFlags().String("tls-client-key", "", "Private key (PEM) of the client certificate")
+	rootCmd.PersistentFlags().String("tls-server-name", "", "Name to verify the secret store certificate against")
+	rootCmd.PersistentFlags().Bool("tls-skip-verify", false, "Don't verify the secret store certificate (testing only)")
+	for flag, key := range map[string]string{
+		"tls-ca-cert":     "secretstore.tls.ca_cert",
+		"tls-client-cert": "secretstore.tls.client_cert",
+		"tls-client-key":  "secretstore.tls.client_key",
+		"tls-server-name": "secretstore.tls.server_name",
+		"tls-skip-verify": "secretstore.tls.skip_verify",
+	} {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error binding %s flag: %v\n", flag, err)
+		}
+	}
+
 	// Cobra also supports local flags, which will only run when this action is called directly
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
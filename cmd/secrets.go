@@ -4,10 +4,21 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/michielvha/edgectl/pkg/backup"
+	"github.com/michielvha/edgectl/pkg/common"
+	"github.com/michielvha/edgectl/pkg/crypt"
+	"github.com/michielvha/edgectl/pkg/logger"
 	"github.com/michielvha/edgectl/pkg/vault"
 )
 
@@ -19,36 +30,55 @@ var secretsGetCmd = &cobra.Command{
 	Short: "Get a secret value from the secret store",
 	Long: `Retrieve a specific key from a KV v2 path.
 
-Example:
-  edgectl secrets get --path kv/data/<distro>/my-cluster/token --key token`,
+The path is either given in full with --path, or resolved from --distro, --cluster-id
+and --item using the configured KV mount and prefix.
+
+Without --key every key is printed; -o json or yaml prints the secret (or the value of
+--key) as a document that 'secrets put --from-file' accepts.
+
+Examples:
+  edgectl secrets get --path kv/data/rke2/my-cluster/token --key join_token
+  edgectl secrets get --cluster-id my-cluster --item token --key join_token
+  edgectl secrets get --cluster-id my-cluster --item masters --version 2 -o yaml`,
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
-			return
+			os.Exit(1)
 		}
 
-		path, _ := cmd.Flags().GetString("path")
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
 		key, _ := cmd.Flags().GetString("key")
+		version, _ := cmd.Flags().GetInt("version")
+		output, _ := cmd.Flags().GetString("output")
 
-		data, err := vaultClient.RetrieveSecret(path)
+		data, err := vaultClient.RetrieveSecretVersion(cmd.Context(), path, version)
 		if err != nil {
 			fmt.Printf("❌ Failed to read secret: %v\n", err)
-			return
+			os.Exit(1)
 		}
 
+		var value interface{} = data
+		table := func(w io.Writer) error { return writeSecretTable(w, data) }
 		if key != "" {
 			val, ok := data[key]
 			if !ok {
 				fmt.Printf("❌ Key '%s' not found at path '%s'\n", key, path)
-				return
+				os.Exit(1)
 			}
-			fmt.Printf("%v\n", val)
-		} else {
-			// Print all keys
-			for k, v := range data {
-				fmt.Printf("%s: %v\n", k, v)
+			value = val
+			table = func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, formatSecretValue(val))
+				return err
 			}
 		}
+		if err := common.WriteOutput(os.Stdout, output, value, table); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -58,30 +88,806 @@ var secretsSetCmd = &cobra.Command{
 	Short: "Set a secret value in the secret store",
 	Long: `Store a key-value pair at a KV v2 path.
 
+The path is either given in full with --path, or resolved from --distro, --cluster-id
+and --item using the configured KV mount and prefix.
+
+The secret is replaced by one holding only this key. Use put to store several keys at
+once, or patch to change a key and keep the others.
+
 Example:
   edgectl secrets set --path kv/data/myapp/config --key api_url --value https://example.com`,
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
-			return
+			os.Exit(1)
 		}
 
-		path, _ := cmd.Flags().GetString("path")
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
 		key, _ := cmd.Flags().GetString("key")
 		value, _ := cmd.Flags().GetString("value")
 
-		err := vaultClient.StoreSecret(path, map[string]interface{}{
+		err = vaultClient.StoreSecret(cmd.Context(), path, map[string]interface{}{
 			key: value,
 		})
 		if err != nil {
 			fmt.Printf("❌ Failed to store secret: %v\n", err)
-			return
+			os.Exit(1)
 		}
 
 		fmt.Printf("✅ Stored '%s' at '%s'\n", key, path)
 	},
 }
 
+// Store several keys at a KV v2 path, replacing the secret
+var secretsPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Store a secret with one or more keys, replacing its current keys",
+	Long: `Store a secret read from a JSON or YAML file (--from-file, '-' for stdin) and/or
+key=value pairs (--from-literal, repeatable) as a new version. Literals override keys of the file.
+
+Like set, put replaces the whole secret: keys of the current version that aren't given are
+dropped from the new version. Use patch to change some keys and keep the others.
+
+Examples:
+  edgectl secrets put --path kv/data/myapp/config --from-file config.yaml
+  edgectl secrets put --path kv/data/myapp/config --from-literal api_url=https://example.com --from-literal retries=3
+  edgectl secrets get --path kv/data/myapp/config -o json | edgectl secrets put --path kv/data/myapp/copy --from-file -`,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := readSecretInput(cmd)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := vaultClient.StoreSecret(cmd.Context(), path, data); err != nil {
+			fmt.Printf("❌ Failed to store secret: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Stored %d key(s) at '%s'\n", len(data), path)
+	},
+}
+
+// Merge keys into an existing secret
+var secretsPatchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "Add, change or remove keys of a secret and keep the others",
+	Long: `Merge keys into an existing secret and store the result as a new version. Keys are read
+like for put; a key set to null in the file, or given with --remove, is removed. All other keys
+of the current version are kept.
+
+The write uses check-and-set, so a concurrent change is re-read and patched instead of lost.
+
+Examples:
+  edgectl secrets patch --path kv/data/myapp/config --from-literal retries=5
+  edgectl secrets patch --path kv/data/myapp/config --from-file changes.json --remove legacy_url`,
+	Run: func(cmd *cobra.Command, args []string) {
+		remove, _ := cmd.Flags().GetStringArray("remove")
+		data := map[string]interface{}{}
+		if cmd.Flags().Changed("from-file") || cmd.Flags().Changed("from-literal") {
+			var err error
+			if data, err = readSecretInput(cmd); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		for _, key := range remove {
+			data[key] = nil
+		}
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := vaultClient.PatchSecret(cmd.Context(), path, data); err != nil {
+			fmt.Printf("❌ Failed to patch secret: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Patched %d key(s) at '%s'\n", len(data), path)
+	},
+}
+
+// List the keys under a KV v2 path
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the keys under a path of the secret store",
+	Long: `List the secrets and directories (ending in '/') directly under a KV v2 path.
+
+The path is given with --path as a data or metadata path, or resolved from --distro and
+--cluster-id. Without either, the root of the configured KV mount and prefix is listed.
+
+Examples:
+  edgectl secrets list
+  edgectl secrets list --path kv/data/myapp
+  edgectl secrets list --distro k3s --cluster-id my-cluster -o json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		distro, _ := cmd.Flags().GetString("distro")
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		var path string
+		switch p, _ := cmd.Flags().GetString("path"); {
+		case p != "":
+			var err error
+			if path, err = vault.ListingPath(p); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		case clusterID != "":
+			path = vaultClient.Paths().Metadata(distro, clusterID)
+		case cmd.Flags().Changed("distro"):
+			path = vaultClient.Paths().Metadata(distro)
+		default:
+			path = vaultClient.Paths().Metadata()
+		}
+
+		keys, err := vaultClient.ListKeys(cmd.Context(), path)
+		if err != nil {
+			fmt.Printf("❌ Failed to list keys: %v\n", err)
+			os.Exit(1)
+		}
+		sort.Strings(keys)
+
+		if err := common.WriteOutput(os.Stdout, output, keys, func(w io.Writer) error {
+			if len(keys) == 0 {
+				_, err := fmt.Fprintf(w, "No keys under %s\n", path)
+				return err
+			}
+			for _, key := range keys {
+				_, _ = fmt.Fprintln(w, key)
+			}
+			return nil
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// Delete a secret at a KV v2 path
+var secretsDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete a secret from the secret store",
+	Long: `Delete the current version of a secret. Earlier versions are kept and can be restored
+with rollback; see 'edgectl secrets history'.
+
+With --all-versions the secret is removed with its whole history and can't be restored.
+
+Examples:
+  edgectl secrets delete --path kv/data/myapp/config
+  edgectl secrets delete --cluster-id my-cluster --item lb/old-lb-node --all-versions`,
+	Run: func(cmd *cobra.Command, args []string) {
+		allVersions, _ := cmd.Flags().GetBool("all-versions")
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		target := path
+		if allVersions {
+			if target, err = vault.MetadataPath(path); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := vaultClient.DeleteSecret(cmd.Context(), target); err != nil {
+			fmt.Printf("❌ Failed to delete secret: %v\n", err)
+			os.Exit(1)
+		}
+
+		if allVersions {
+			fmt.Printf("🗑️ Removed '%s' with all its versions\n", path)
+		} else {
+			fmt.Printf("🗑️ Deleted the current version of '%s'\n", path)
+		}
+	},
+}
+
+// readSecretInput builds secret data from --from-file and --from-literal; literals override keys of the file.
+func readSecretInput(cmd *cobra.Command) (map[string]interface{}, error) {
+	file, _ := cmd.Flags().GetString("from-file")
+	literals, _ := cmd.Flags().GetStringArray("from-literal")
+
+	data := map[string]interface{}{}
+	if file != "" {
+		var raw []byte
+		var err error
+		if file == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(file) //nolint:gosec // path comes from trusted CLI input
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", file, err)
+		}
+		if data, err = vault.ParseSecretData(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	pairs, err := vault.ParseLiterals(literals)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range pairs {
+		data[k] = v
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no keys given (use --from-file or --from-literal)")
+	}
+	return data, nil
+}
+
+// addSecretInputFlags registers the flags used by readSecretInput.
+func addSecretInputFlags(cmd *cobra.Command) {
+	cmd.Flags().String("from-file", "", "JSON or YAML file with the keys to store ('-' reads stdin)")
+	cmd.Flags().StringArray("from-literal", nil, "Key and value to store as key=value (repeatable)")
+}
+
+// writeSecretTable prints the keys of a secret in order with their values.
+func writeSecretTable(w io.Writer, data map[string]interface{}) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KEY\tVALUE")
+	for _, k := range keys {
+		// Multi-line values such as kubeconfigs would break the columns
+		value := strings.ReplaceAll(formatSecretValue(data[k]), "\n", `\n`)
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", k, value)
+	}
+	return tw.Flush()
+}
+
+// formatSecretValue renders a value as text: strings and numbers as they are, lists and maps as JSON.
+func formatSecretValue(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		if encoded, err := json.Marshal(v); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// resolveSecretPath returns the --path flag when set, otherwise the KV v2 data path
+// built from --distro, --cluster-id and --item with the client's path layout.
+func resolveSecretPath(cmd *cobra.Command, paths vault.KVPaths) (string, error) {
+	if path, _ := cmd.Flags().GetString("path"); path != "" {
+		return path, nil
+	}
+
+	distro, _ := cmd.Flags().GetString("distro")
+	clusterID, _ := cmd.Flags().GetString("cluster-id")
+	item, _ := cmd.Flags().GetString("item")
+	if clusterID == "" || item == "" {
+		return "", fmt.Errorf("either --path or both --cluster-id and --item are required")
+	}
+	return paths.Data(distro, clusterID, item), nil
+}
+
+// addClusterPathFlags registers the flags used by resolveSecretPath.
+func addClusterPathFlags(cmd *cobra.Command) {
+	cmd.Flags().String("path", "", "Full KV v2 path (e.g. kv/data/myapp/config)")
+	cmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s), used with --cluster-id")
+	cmd.Flags().String("cluster-id", "", "Cluster ID, used with --item instead of --path")
+	cmd.Flags().String("item", "", "Cluster item (e.g. token, agent-token, kubeconfig, masters, lb/<hostname>), used with --cluster-id")
+	cmd.MarkFlagsOneRequired("path", "cluster-id")
+	cmd.MarkFlagsMutuallyExclusive("path", "cluster-id")
+}
+
+// --- Status command ---
+
+var secretsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check the secret store and the credentials edgectl uses with it",
+	Long: `Check the configured secret store: its address, whether it is initialized and sealed,
+the server version, the lifetime and policies of the token and whether the KV mount exists
+and is KV version 2.
+
+The same checks run as a preflight before 'server install', 'agent install' and 'lb create'.
+Exits with status 1 if a problem is found.
+
+Examples:
+  edgectl secrets status
+  edgectl secrets status -o json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		status := vault.CheckStatus(cmd.Context())
+		if err := common.WriteOutput(os.Stdout, output, status, func(w io.Writer) error {
+			return writeStatusTable(w, status)
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if status.Err() != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// writeStatusTable prints a secret store status, followed by its warnings and problems.
+func writeStatusTable(w io.Writer, s *vault.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Backend:\t%s\n", s.Backend)
+	if s.Address != "" {
+		_, _ = fmt.Fprintf(tw, "Address:\t%s\n", s.Address)
+	}
+	// Only a server that answered has a version and seal status
+	if s.Version != "" {
+		_, _ = fmt.Fprintf(tw, "Version:\t%s\n", s.Version)
+		_, _ = fmt.Fprintf(tw, "Initialized:\t%v\n", s.Initialized)
+		_, _ = fmt.Fprintf(tw, "Sealed:\t%v\n", s.Sealed)
+	}
+	if t := s.Token; t != nil {
+		ttl := "never expires"
+		if t.ExpiresAt != nil {
+			ttl = fmt.Sprintf("%s (expires %s)", time.Until(*t.ExpiresAt).Round(time.Second), t.ExpiresAt.Local().Format(time.DateTime))
+		}
+		if t.DisplayName != "" {
+			_, _ = fmt.Fprintf(tw, "Token:\t%s\n", t.DisplayName)
+		}
+		_, _ = fmt.Fprintf(tw, "Token TTL:\t%s\n", ttl)
+		_, _ = fmt.Fprintf(tw, "Token renewable:\t%v\n", t.Renewable)
+		_, _ = fmt.Fprintf(tw, "Token policies:\t%s\n", strings.Join(t.Policies, ", "))
+	}
+	if kv := s.KV; kv != nil && kv.Type != "" {
+		_, _ = fmt.Fprintf(tw, "KV mount:\t%s (%s, version %s)\n", kv.Path, kv.Type, kv.Version)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range s.Warnings {
+		_, _ = fmt.Fprintf(w, "⚠️ %s\n", warning)
+	}
+	for _, problem := range s.Problems {
+		_, _ = fmt.Fprintf(w, "❌ %s\n", problem)
+	}
+	if len(s.Problems) == 0 {
+		_, err := fmt.Fprintln(w, "✅ The secret store is ready")
+		return err
+	}
+	return nil
+}
+
+// --- Version history commands ---
+
+var secretsHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the stored versions of a secret",
+	Long: `List the KV v2 versions of a secret with their creation time and status.
+
+Any listed version that isn't deleted or destroyed can be read with --version on
+get/fetch and restored with rollback.
+
+Examples:
+  edgectl secrets history --cluster-id my-cluster --item kubeconfig
+  edgectl secrets history --distro k3s --cluster-id my-cluster --item lb/lb-node-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		versions, err := vaultClient.SecretHistory(cmd.Context(), path)
+		if err != nil {
+			fmt.Printf("❌ Failed to read history: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("📜 History of %s\n", path)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tCREATED\tSTATUS")
+		for _, v := range versions {
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", v.Version, v.CreatedTime.Local().Format(time.DateTime), versionStatus(v))
+		}
+		_ = w.Flush()
+	},
+}
+
+var secretsRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore an earlier version of a secret",
+	Long: `Restore an earlier KV v2 version of a secret by writing it as the new current version.
+
+History is kept: the restored data becomes a new version, and the version it replaces
+can itself be rolled back to later. Use "edgectl secrets history" to find the version.
+
+Examples:
+  edgectl secrets rollback --cluster-id my-cluster --item kubeconfig --version 3
+  edgectl secrets rollback --cluster-id my-cluster --item token --version 1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		path, err := resolveSecretPath(cmd, vaultClient.Paths())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		version, _ := cmd.Flags().GetInt("version")
+
+		fmt.Printf("⏪ Restoring version %d of %s...\n", version, path)
+		newVersion, err := vaultClient.RollbackSecret(cmd.Context(), path, version)
+		if err != nil {
+			fmt.Printf("❌ Rollback failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Version %d restored as version %d\n", version, newVersion)
+	},
+}
+
+// versionStatus describes whether a secret version is current, readable, deleted or destroyed.
+func versionStatus(v vault.SecretVersion) string {
+	switch {
+	case v.Destroyed:
+		return "destroyed"
+	case v.Deleted():
+		return "deleted " + v.DeletionTime.Local().Format(time.DateTime)
+	case v.Current:
+		return "current"
+	}
+	return "available"
+}
+
+// --- Backup commands ---
+
+var secretsBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export cluster data into an encrypted backup file",
+	Long: `Export the token, kubeconfig, masters and load balancer records of one or all clusters
+into a single file encrypted with age, using a passphrase or one or more age recipients.
+
+The passphrase is read from --passphrase-file, the EDGECTL_BACKUP_PASSPHRASE environment
+variable, or prompted for. The file can also be decrypted with the age CLI.
+
+Examples:
+  edgectl secrets backup --cluster-id my-cluster -o my-cluster.age
+  edgectl secrets backup --all -o edgectl-backup.age --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		output, _ := cmd.Flags().GetString("output")
+		recipients, _ := cmd.Flags().GetStringSlice("recipient")
+		recipientFiles, _ := cmd.Flags().GetStringSlice("recipients-file")
+
+		passphrase := ""
+		if len(recipients) == 0 && len(recipientFiles) == 0 {
+			var err error
+			if passphrase, err = resolvePassphrase(cmd, true); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ageRecipients, err := crypt.Recipients(passphrase, recipients, recipientFiles)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		sel := backup.Selection{Distros: vault.Distros, ClusterID: clusterID}
+		if distro != "" {
+			sel.Distros = []string{distro}
+		}
+		hostname, _ := os.Hostname()
+		archive, err := backup.Create(cmd.Context(), vaultClient, sel, hostname)
+		if err != nil {
+			fmt.Printf("❌ Backup failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		sealed, err := backup.Encode(archive, ageRecipients)
+		if err != nil {
+			fmt.Printf("❌ Backup failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(output, sealed, 0o600); err != nil {
+			fmt.Printf("❌ Failed to write backup: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, c := range archive.Clusters {
+			fmt.Printf("📦 %s/%s: %d item(s)\n", c.Distro, c.ClusterID, len(c.Items))
+		}
+		fmt.Printf("✅ Backup of %d cluster(s) written to %s\n", len(archive.Clusters), output)
+	},
+}
+
+var secretsRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore cluster data from an encrypted backup file",
+	Long: `Write the clusters of a backup file back into the secret store.
+
+Clusters that already exist are refused unless --force is given. A backup of a single
+cluster can be restored under another cluster ID, and any backup into another KV mount.
+
+Examples:
+  edgectl secrets restore -i my-cluster.age
+  edgectl secrets restore -i my-cluster.age --cluster-id my-cluster-copy --mount edge
+  edgectl secrets restore -i edgectl-backup.age --identity ~/.config/age/key.txt --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, _ := cmd.Flags().GetString("input")
+		identityFiles, _ := cmd.Flags().GetStringSlice("identity")
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		mount, _ := cmd.Flags().GetString("mount")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		sealed, err := os.ReadFile(input) //nolint:gosec // path comes from trusted CLI input
+		if err != nil {
+			fmt.Printf("❌ Failed to read backup: %v\n", err)
+			os.Exit(1)
+		}
+
+		passphrase := ""
+		if len(identityFiles) == 0 {
+			if passphrase, err = resolvePassphrase(cmd, false); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		identities, err := crypt.Identities(passphrase, identityFiles)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		archive, err := backup.Decode(sealed, identities)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("ℹ️ Backup of %d cluster(s) from %s by %s\n", len(archive.Clusters), archive.CreatedAt, archive.CreatedBy)
+
+		if dryRun {
+			for _, c := range archive.Clusters {
+				fmt.Printf("📦 %s/%s: %d item(s)\n", c.Distro, c.ClusterID, len(c.Items))
+			}
+			fmt.Println("ℹ️ Dry run: nothing restored")
+			return
+		}
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		restored, err := backup.Restore(cmd.Context(), vaultClient, archive, backup.RestoreOptions{ClusterID: clusterID, Mount: mount, Force: force})
+		for _, c := range restored {
+			fmt.Printf("📦 %s/%s: %d item(s) restored\n", c.Distro, c.ClusterID, c.Items)
+		}
+		if err != nil {
+			fmt.Printf("❌ Restore failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Restored %d cluster(s)\n", len(restored))
+	},
+}
+
+// resolvePassphrase returns the backup passphrase from --passphrase-file or EDGECTL_BACKUP_PASSPHRASE,
+// prompting for it on a terminal otherwise. confirm asks for the passphrase twice.
+func resolvePassphrase(cmd *cobra.Command, confirm bool) (string, error) {
+	file, _ := cmd.Flags().GetString("passphrase-file")
+	return crypt.ResolvePassphrase(file, "EDGECTL_BACKUP_PASSPHRASE", confirm)
+}
+
+// --- Maintenance commands ---
+
+var secretsMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate stored cluster data to the current layout and schema",
+	Long: `Detect cluster data stored in an older layout or schema and rewrite it.
+
+K3s clusters created before the distro path segment was introduced are moved from
+rke2/<cluster-id>/ to k3s/<cluster-id>/, and records without the current schema version
+are rewritten with it. When done, a migration marker is stored under edgectl/migration.
+
+Examples:
+  edgectl secrets migrate --dry-run   # Show what would change
+  edgectl secrets migrate             # Apply the changes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if marker, err := vault.ReadMigrationMarker(cmd.Context(), vaultClient); err != nil {
+			logger.Warn("Could not read migration marker: %v", err)
+		} else if marker != nil {
+			fmt.Printf("ℹ️ Last migration: schema version %d on %s by %s\n", marker.SchemaVersion, marker.MigratedAt, marker.MigratedBy)
+		}
+
+		fmt.Println("🔎 Scanning stored cluster data...")
+		plan, err := vault.PlanMigration(cmd.Context(), vaultClient)
+		if err != nil {
+			fmt.Printf("❌ Failed to plan migration: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(plan.Changes) == 0 {
+			fmt.Printf("✅ All cluster data is at schema version %d, nothing to migrate\n", vault.CurrentSchemaVersion)
+		}
+		for _, change := range plan.Changes {
+			if change.Action == vault.MigrationMove {
+				fmt.Printf("📦 move %s -> %s\n", change.From, change.To)
+			} else {
+				fmt.Printf("🔄 upgrade %s\n", change.From)
+			}
+			for _, line := range change.Diff() {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+
+		if dryRun {
+			fmt.Printf("ℹ️ Dry run: %d change(s) not applied\n", len(plan.Changes))
+			return
+		}
+
+		hostname, _ := os.Hostname()
+		if _, err := vault.ApplyMigration(cmd.Context(), vaultClient, plan, hostname); err != nil {
+			fmt.Printf("❌ Migration failed: %v\n", err)
+			fmt.Println("ℹ️ Records are written before legacy copies are removed; re-run the command to finish")
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Migrated %d record(s) to schema version %d\n", len(plan.Changes), vault.CurrentSchemaVersion)
+	},
+}
+
+// --- Policy commands ---
+
+var secretsPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage least-privilege access for cluster nodes",
+}
+
+var secretsPolicyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Write a cluster-scoped policy for a node role and mint credentials for it",
+	Long: `Write an OpenBao policy that only grants a node role access to one cluster's paths,
+and mint short-lived credentials carrying only that policy.
+
+Roles:
+  server  read and write everything of the cluster
+  agent   read the agent token and the masters
+  lb      read the masters and load balancers, write its own lb entry (needs --hostname)
+
+Credentials are a token (--auth token, the default) or an AppRole role_id/secret_id pair
+(--auth approle); both expire after --ttl. Use --auth none to only write the policy, and
+--dry-run to print it without writing anything.
+
+Examples:
+  edgectl secrets policy create --cluster-id my-cluster --role agent --ttl 30m
+  edgectl secrets policy create --cluster-id my-cluster --role lb --hostname lb-1 --auth approle
+  edgectl secrets policy create --cluster-id my-cluster --role server --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterID, _ := cmd.Flags().GetString("cluster-id")
+		distro, _ := cmd.Flags().GetString("distro")
+		role, _ := cmd.Flags().GetString("role")
+		hostname, _ := cmd.Flags().GetString("hostname")
+		authMethod, _ := cmd.Flags().GetString("auth")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		appRoleMount, _ := cmd.Flags().GetString("approle-mount")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		output, _ := cmd.Flags().GetString("output")
+
+		if authMethod != vault.AuthMethodToken && authMethod != vault.AuthMethodAppRole && authMethod != "none" {
+			fmt.Printf("❌ Unsupported --auth %q (expected token, approle or none)\n", authMethod)
+			os.Exit(1)
+		}
+		if ttl <= 0 {
+			fmt.Println("❌ --ttl must be positive")
+			os.Exit(1)
+		}
+
+		// The policy only depends on the configured path layout, so a dry run needs no connection
+		policy, err := vault.NewClusterPolicy(vault.LoadConfig().KV, distro, clusterID, role, hostname)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if dryRun {
+			fmt.Printf("🔍 Policy %s (dry run, nothing written):\n\n%s", policy.Name, policy.Rules)
+			return
+		}
+
+		vaultClient := vault.InitVaultClient(cmd.Context())
+		if vaultClient == nil {
+			os.Exit(1)
+		}
+
+		if err := vaultClient.WritePolicy(cmd.Context(), policy); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if output == common.OutputTable {
+			fmt.Printf("✅ Policy %s written\n", policy.Name)
+		}
+
+		var creds *vault.ScopedCredentials
+		switch authMethod {
+		case vault.AuthMethodToken:
+			creds, err = vaultClient.CreateScopedToken(cmd.Context(), policy.Name, ttl)
+		case vault.AuthMethodAppRole:
+			creds, err = vaultClient.CreateAppRoleCredentials(cmd.Context(), appRoleMount, policy.Name, ttl)
+		default:
+			return
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := common.WriteOutput(os.Stdout, output, creds, func(w io.Writer) error {
+			return writeCredentials(w, creds)
+		}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// writeCredentials prints minted credentials with the settings a node needs to use them.
+func writeCredentials(w io.Writer, creds *vault.ScopedCredentials) error {
+	expires := creds.ExpiresAt.Local().Format(time.RFC3339)
+	if creds.Method == vault.AuthMethodAppRole {
+		_, err := fmt.Fprintf(w, "🔑 AppRole %s (secret_id expires %s)\n   role_id:   %s\n   secret_id: %s\n"+
+			"   Use it on the node with BAO_AUTH_METHOD=approle, BAO_ROLE_ID and BAO_SECRET_ID\n",
+			creds.RoleName, expires, creds.RoleID, creds.SecretID)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "🔑 Token (expires %s, accessor %s)\n   %s\n   Use it on the node with BAO_TOKEN\n",
+		expires, creds.Accessor, creds.Token)
+	return err
+}
+
 // --- RKE2-specific convenience commands ---
 
 var secretsUploadCmd = &cobra.Command{
@@ -90,19 +896,25 @@ var secretsUploadCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("🔐 Uploading token to secret store...")
 
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
-			return
+			os.Exit(1)
 		}
 
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		token, _ := cmd.Flags().GetString("token")
 		distro, _ := cmd.Flags().GetString("distro")
+		agent, _ := cmd.Flags().GetBool("agent")
 
-		err := vaultClient.StoreJoinToken(distro, clusterID, token)
+		var err error
+		if agent {
+			err = vaultClient.StoreAgentToken(cmd.Context(), distro, clusterID, token)
+		} else {
+			err = vaultClient.StoreJoinToken(cmd.Context(), distro, clusterID, token)
+		}
 		if err != nil {
 			fmt.Printf("❌ Failed to store token: %v\n", err)
-			return
+			os.Exit(1)
 		}
 
 		fmt.Println("✅ Token successfully stored in secret store.")
@@ -115,20 +927,37 @@ var secretsFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("🔎 Fetching token from secret store...")
 
-		vaultClient := vault.InitVaultClient()
+		vaultClient := vault.InitVaultClient(cmd.Context())
 		if vaultClient == nil {
-			return
+			os.Exit(1)
 		}
 
 		clusterID, _ := cmd.Flags().GetString("cluster-id")
 		distro, _ := cmd.Flags().GetString("distro")
-		token, err := vaultClient.RetrieveJoinToken(distro, clusterID)
+		version, _ := cmd.Flags().GetInt("version")
+		agent, _ := cmd.Flags().GetBool("agent")
+
+		if agent {
+			if version != 0 {
+				fmt.Println("❌ --version can't be combined with --agent; use 'secrets get --item agent-token --version'")
+				os.Exit(1)
+			}
+			token, err := vaultClient.RetrieveAgentToken(cmd.Context(), distro, clusterID)
+			if err != nil {
+				fmt.Printf("❌ Failed to retrieve agent token: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✅ Retrieved agent token: %s\n", token.Token)
+			return
+		}
+
+		token, err := vaultClient.RetrieveJoinTokenVersion(cmd.Context(), distro, clusterID, version)
 		if err != nil {
 			fmt.Printf("❌ Failed to retrieve token: %v\n", err)
-			return
+			os.Exit(1)
 		}
 
-		fmt.Printf("✅ Retrieved token: %s\n", token)
+		fmt.Printf("✅ Retrieved token: %s\n", token.Token)
 	},
 }
 
@@ -140,30 +969,120 @@ func init() {
 	}
 
 	// get flags
-	secretsGetCmd.Flags().String("path", "", "KV v2 path (e.g. kv/data/myapp/config)")
+	addClusterPathFlags(secretsGetCmd)
 	secretsGetCmd.Flags().String("key", "", "Specific key to retrieve (omit to list all keys)")
-	_ = secretsGetCmd.MarkFlagRequired("path")
+	secretsGetCmd.Flags().Int("version", 0, "Version to retrieve (default: current)")
+	secretsGetCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
 
 	// set flags
-	secretsSetCmd.Flags().String("path", "", "KV v2 path (e.g. kv/data/myapp/config)")
+	addClusterPathFlags(secretsSetCmd)
 	secretsSetCmd.Flags().String("key", "", "Key to store")
 	secretsSetCmd.Flags().String("value", "", "Value to store")
-	_ = secretsSetCmd.MarkFlagRequired("path")
 	_ = secretsSetCmd.MarkFlagRequired("key")
 	_ = secretsSetCmd.MarkFlagRequired("value")
 
+	// put flags
+	addClusterPathFlags(secretsPutCmd)
+	addSecretInputFlags(secretsPutCmd)
+	secretsPutCmd.MarkFlagsOneRequired("from-file", "from-literal")
+
+	// patch flags
+	addClusterPathFlags(secretsPatchCmd)
+	addSecretInputFlags(secretsPatchCmd)
+	secretsPatchCmd.Flags().StringArray("remove", nil, "Key to remove (repeatable)")
+	secretsPatchCmd.MarkFlagsOneRequired("from-file", "from-literal", "remove")
+
+	// list flags
+	secretsListCmd.Flags().String("path", "", "KV v2 data or metadata path to list (e.g. kv/data/myapp)")
+	secretsListCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s) to list the clusters of, or used with --cluster-id")
+	secretsListCmd.Flags().String("cluster-id", "", "Cluster ID to list the items of, instead of --path")
+	secretsListCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+	secretsListCmd.MarkFlagsMutuallyExclusive("path", "cluster-id")
+	secretsListCmd.MarkFlagsMutuallyExclusive("path", "distro")
+
+	// delete flags
+	addClusterPathFlags(secretsDeleteCmd)
+	secretsDeleteCmd.Flags().Bool("all-versions", false, "Remove the secret with all its versions instead of only the current version")
+
+	// status flags
+	secretsStatusCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+
 	// upload flags
 	secretsUploadCmd.Flags().String("cluster-id", "test-cluster", "Cluster ID to store the token under")
 	secretsUploadCmd.Flags().String("token", "dummy-token", "The token to upload")
 	secretsUploadCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	secretsUploadCmd.Flags().Bool("agent", false, "Upload the agent-only token instead of the server join token")
 
 	// fetch flags
 	secretsFetchCmd.Flags().String("cluster-id", "test-cluster", "Cluster ID to fetch the token from")
 	secretsFetchCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	secretsFetchCmd.Flags().Int("version", 0, "Token version to fetch (default: current)")
+	secretsFetchCmd.Flags().Bool("agent", false, "Fetch the agent-only token instead of the server join token")
+
+	// history flags
+	addClusterPathFlags(secretsHistoryCmd)
+
+	// rollback flags
+	addClusterPathFlags(secretsRollbackCmd)
+	secretsRollbackCmd.Flags().Int("version", 0, "Version to restore")
+	_ = secretsRollbackCmd.MarkFlagRequired("version")
+
+	// backup flags
+	secretsBackupCmd.Flags().String("cluster-id", "", "Cluster to back up")
+	secretsBackupCmd.Flags().Bool("all", false, "Back up all clusters")
+	secretsBackupCmd.Flags().String("distro", "", "Only back up clusters of this distribution (rke2 or k3s, default: all)")
+	secretsBackupCmd.Flags().StringP("output", "o", "", "Backup file to write")
+	secretsBackupCmd.Flags().String("passphrase-file", "", "File holding the passphrase to encrypt with")
+	secretsBackupCmd.Flags().StringSlice("recipient", nil, "age recipient (age1...) to encrypt to, instead of a passphrase (repeatable)")
+	secretsBackupCmd.Flags().StringSlice("recipients-file", nil, "File with age recipients, one per line (repeatable)")
+	secretsBackupCmd.MarkFlagsOneRequired("cluster-id", "all")
+	secretsBackupCmd.MarkFlagsMutuallyExclusive("cluster-id", "all")
+	secretsBackupCmd.MarkFlagsMutuallyExclusive("passphrase-file", "recipient")
+	secretsBackupCmd.MarkFlagsMutuallyExclusive("passphrase-file", "recipients-file")
+	_ = secretsBackupCmd.MarkFlagRequired("output")
+
+	// restore flags
+	secretsRestoreCmd.Flags().StringP("input", "i", "", "Backup file to restore")
+	secretsRestoreCmd.Flags().String("passphrase-file", "", "File holding the passphrase the backup was encrypted with")
+	secretsRestoreCmd.Flags().StringSlice("identity", nil, "age identity file (private key) to decrypt with, instead of a passphrase (repeatable)")
+	secretsRestoreCmd.Flags().String("cluster-id", "", "Restore the backed up cluster under this ID (single-cluster backups only)")
+	secretsRestoreCmd.Flags().String("mount", "", "Restore into this KV v2 mount instead of the configured one")
+	secretsRestoreCmd.Flags().Bool("force", false, "Overwrite clusters that already exist")
+	secretsRestoreCmd.Flags().Bool("dry-run", false, "Decrypt and list the backup without restoring it")
+	secretsRestoreCmd.MarkFlagsMutuallyExclusive("passphrase-file", "identity")
+	_ = secretsRestoreCmd.MarkFlagRequired("input")
+
+	// migrate flags
+	secretsMigrateCmd.Flags().Bool("dry-run", false, "Show the changes without writing them")
+
+	// policy create flags
+	secretsPolicyCreateCmd.Flags().String("cluster-id", "", "Cluster ID the policy is scoped to")
+	secretsPolicyCreateCmd.Flags().String("distro", "rke2", "Cluster distribution (rke2 or k3s)")
+	secretsPolicyCreateCmd.Flags().String("role", "", "Node role: server, agent or lb")
+	secretsPolicyCreateCmd.Flags().String("hostname", "", "Hostname of the load balancer (lb role only)")
+	secretsPolicyCreateCmd.Flags().String("auth", vault.AuthMethodToken, "Credentials to mint: token, approle or none")
+	secretsPolicyCreateCmd.Flags().Duration("ttl", time.Hour, "Lifetime of the minted credentials")
+	secretsPolicyCreateCmd.Flags().String("approle-mount", "", "AppRole auth mount (default: approle)")
+	secretsPolicyCreateCmd.Flags().Bool("dry-run", false, "Print the policy without writing it or minting credentials")
+	secretsPolicyCreateCmd.Flags().StringP("output", "o", common.OutputTable, "Output format: table, json or yaml")
+	_ = secretsPolicyCreateCmd.MarkFlagRequired("cluster-id")
+	_ = secretsPolicyCreateCmd.MarkFlagRequired("role")
 
 	secretsCmd.AddCommand(secretsGetCmd)
 	secretsCmd.AddCommand(secretsSetCmd)
+	secretsCmd.AddCommand(secretsPutCmd)
+	secretsCmd.AddCommand(secretsPatchCmd)
+	secretsCmd.AddCommand(secretsListCmd)
+	secretsCmd.AddCommand(secretsDeleteCmd)
+	secretsCmd.AddCommand(secretsStatusCmd)
 	secretsCmd.AddCommand(secretsUploadCmd)
 	secretsCmd.AddCommand(secretsFetchCmd)
+	secretsCmd.AddCommand(secretsHistoryCmd)
+	secretsCmd.AddCommand(secretsRollbackCmd)
+	secretsCmd.AddCommand(secretsBackupCmd)
+	secretsCmd.AddCommand(secretsRestoreCmd)
+	secretsCmd.AddCommand(secretsMigrateCmd)
+	secretsPolicyCmd.AddCommand(secretsPolicyCreateCmd)
+	secretsCmd.AddCommand(secretsPolicyCmd)
 	rootCmd.AddCommand(secretsCmd)
 }
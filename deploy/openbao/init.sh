@@ -1,8 +1,9 @@
 #!/usr/bin/env bash
 # Initialize OpenBao, unseal, and enable the KV v2 engine.
-# Run once after the first `docker compose up -d`.
+# Run once after the first `docker compose up -d`, from the directory of the compose
+# file (deploy/openbao, or deploy/openbao/tls for the TLS variant).
 #
-# Usage: ./init.sh
+# Usage: ./init.sh    (or ../init.sh from tls/)
 set -euo pipefail
 
 DC="docker compose exec openbao"
@@ -35,5 +36,9 @@ echo "KV v2 engine enabled at kv/."
 echo ""
 echo "OpenBao is ready. Set these on your host:"
 echo ""
-echo "  export VAULT_ADDR=\"http://127.0.0.1:8200\""
+ADDR=$($DC printenv BAO_ADDR | tr -d '\r')
+echo "  export VAULT_ADDR=\"$ADDR\""
+if [[ "$ADDR" == https://* ]]; then
+    echo "  export BAO_CACERT=\"$(pwd)/certs/ca.pem\""
+fi
 echo "  export BAO_TOKEN=\"$ROOT_TOKEN\""
@@ -0,0 +1,21 @@
+storage "raft" {
+  path    = "/openbao/file"
+  node_id = "node1"
+}
+
+listener "tcp" {
+  address       = "0.0.0.0:8200"
+  tls_cert_file = "/openbao/tls/server.pem"
+  tls_key_file  = "/openbao/tls/server-key.pem"
+
+  # Mutual TLS: uncomment to only accept clients presenting a certificate signed by the CA
+  # (edgectl --tls-client-cert/--tls-client-key or secretstore.tls.client_cert/client_key).
+  # tls_client_ca_file                 = "/openbao/tls/ca.pem"
+  # tls_require_and_verify_client_cert = true
+}
+
+cluster_addr      = "https://127.0.0.1:8201"
+api_addr          = "https://0.0.0.0:8200"
+default_lease_ttl = "168h"
+max_lease_ttl     = "720h"
+ui = true
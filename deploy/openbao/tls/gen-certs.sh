@@ -0,0 +1,50 @@
+#!/usr/bin/env bash
+# Generate a CA, a server certificate and a client certificate (for mutual TLS) in certs/.
+# Run once before the first `docker compose up -d`. An existing CA is kept, so the
+# certificates can be reissued (e.g. with more names) without redistributing ca.pem.
+#
+# Usage: ./gen-certs.sh [SAN ...]
+#   e.g. ./gen-certs.sh DNS:bao.example.com IP:10.0.0.5
+# The server certificate always covers localhost, openbao and 127.0.0.1.
+set -euo pipefail
+
+cd "$(dirname "$0")"
+mkdir -p certs
+cd certs
+
+if [ -f ca.pem ]; then
+    echo "Keeping the existing CA in certs/ca.pem."
+else
+    openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 3650 \
+        -subj "/CN=edgectl OpenBao CA" -keyout ca-key.pem -out ca.pem 2> /dev/null
+    echo "Created a CA in certs/ca.pem."
+fi
+
+SANS="DNS:localhost,DNS:openbao,IP:127.0.0.1"
+for SAN in "$@"; do
+    SANS="$SANS,$SAN"
+done
+
+# issue NAME COMMON_NAME EXTENSIONS
+issue() {
+    openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+        -subj "/CN=$2" -keyout "$1-key.pem" -out "$1.csr" 2> /dev/null
+    openssl x509 -req -in "$1.csr" -CA ca.pem -CAkey ca-key.pem -CAcreateserial -days 825 \
+        -extfile <(printf '%b\n' "$3") -out "$1.pem" 2> /dev/null
+    rm "$1.csr"
+}
+
+issue server openbao "subjectAltName=$SANS\nextendedKeyUsage=serverAuth"
+issue client edgectl "extendedKeyUsage=clientAuth"
+
+# The openbao user in the container must be able to read the server key
+chmod 644 server-key.pem client-key.pem
+chmod 600 ca-key.pem
+
+echo "Issued certs/server.pem ($SANS) and certs/client.pem."
+echo ""
+echo "Point edgectl at the CA (and the client certificate when mutual TLS is enabled):"
+echo ""
+echo "  export BAO_CACERT=\"$(pwd)/ca.pem\""
+echo "  export BAO_CLIENT_CERT=\"$(pwd)/client.pem\""
+echo "  export BAO_CLIENT_KEY=\"$(pwd)/client-key.pem\""
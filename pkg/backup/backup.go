@@ -0,0 +1,248 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package backup exports cluster data from the secret store into an encrypted archive and restores it.
+
+An archive holds the current version of every item of the selected clusters (token, kubeconfig,
+masters, lb/<hostname>); locks are skipped. Items are stored relative to their cluster, so an
+archive can be restored under another cluster ID or into another KV mount:
+- Create: Reads the selected clusters into an Archive
+- Restore: Writes an Archive back into the secret store
+- Encode / Decode: Serialize an Archive and encrypt/decrypt it with age (see pkg/crypt)
+*/
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/cluster"
+	"github.com/michielvha/edgectl/pkg/crypt"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// FormatVersion is the archive format written by Create; Decode rejects newer formats.
+const FormatVersion = 1
+
+// now is a package-level variable so tests can inject a fixed clock.
+var now = time.Now
+
+// Archive is the decrypted content of a backup file.
+type Archive struct {
+	FormatVersion int    `json:"format_version"`
+	CreatedAt     string `json:"created_at"`
+	CreatedBy     string `json:"created_by"`
+	// Mount and Prefix record where the data was read from; restores use the target store's layout
+	Mount    string    `json:"mount"`
+	Prefix   string    `json:"prefix,omitempty"`
+	Clusters []Cluster `json:"clusters"`
+}
+
+// Cluster holds the items of one cluster, keyed by their path relative to the cluster (e.g. "lb/lb-1").
+type Cluster struct {
+	Distro    string                            `json:"distro"`
+	ClusterID string                            `json:"cluster_id"`
+	Items     map[string]map[string]interface{} `json:"items"`
+}
+
+// Selection picks the clusters to back up: one cluster when ClusterID is set, else every
+// cluster of Distros.
+type Selection struct {
+	Distros   []string
+	ClusterID string
+}
+
+// Create reads the current version of every item of the selected clusters.
+// ErrNotFound is returned when a selected cluster (or, with no ClusterID, every distro) is empty.
+func Create(ctx context.Context, store vault.SecretStore, sel Selection, createdBy string) (*Archive, error) {
+	paths := store.Paths()
+	archive := &Archive{
+		FormatVersion: FormatVersion,
+		CreatedAt:     now().UTC().Format(time.RFC3339),
+		CreatedBy:     createdBy,
+		Mount:         paths.Mount,
+		Prefix:        paths.Prefix,
+		Clusters:      []Cluster{},
+	}
+
+	for _, distro := range sel.Distros {
+		ids := []string{sel.ClusterID}
+		if sel.ClusterID == "" {
+			var err error
+			if ids, err = cluster.IDs(ctx, store, distro); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range ids {
+			items, err := readItems(ctx, store, distro, id, "")
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				continue
+			}
+			archive.Clusters = append(archive.Clusters, Cluster{Distro: distro, ClusterID: id, Items: items})
+		}
+	}
+
+	if len(archive.Clusters) == 0 {
+		if sel.ClusterID != "" {
+			return nil, fmt.Errorf("%w for cluster %s", vault.ErrNotFound, sel.ClusterID)
+		}
+		return nil, fmt.Errorf("%w: no clusters to back up", vault.ErrNotFound)
+	}
+	return archive, nil
+}
+
+// readItems walks the items under <distro>/<cluster-id>/<dir>, skipping locks.
+func readItems(ctx context.Context, store vault.SecretStore, distro, clusterID, dir string) (map[string]map[string]interface{}, error) {
+	paths := store.Paths()
+	keys, err := store.ListKeys(ctx, paths.Metadata(distro, clusterID, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[string]map[string]interface{}{}
+	for _, key := range keys {
+		item := strings.TrimPrefix(dir+"/"+key, "/")
+		if strings.HasSuffix(key, "/") {
+			if item == "locks/" {
+				continue
+			}
+			nested, err := readItems(ctx, store, distro, clusterID, strings.TrimSuffix(item, "/"))
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range nested {
+				items[k] = v
+			}
+			continue
+		}
+
+		data, err := store.RetrieveSecret(ctx, paths.Data(distro, clusterID, item))
+		if errors.Is(err, vault.ErrNotFound) {
+			// Soft-deleted items are still listed, but have nothing to back up
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items[item] = data
+	}
+	return items, nil
+}
+
+// RestoreOptions controls where an archive is restored.
+type RestoreOptions struct {
+	// ClusterID restores the (single) cluster of the archive under another ID
+	ClusterID string
+	// Mount writes into another KV v2 mount than the store's configured one
+	Mount string
+	// Force overwrites clusters that already exist in the store
+	Force bool
+}
+
+// RestoredCluster reports where a cluster of the archive was written.
+type RestoredCluster struct {
+	Distro    string
+	ClusterID string
+	Items     int
+}
+
+// Restore writes every item of the archive back into the store. Existing clusters are refused
+// unless opts.Force is set; they are all checked before anything is written.
+func Restore(ctx context.Context, store vault.SecretStore, archive *Archive, opts RestoreOptions) ([]RestoredCluster, error) {
+	if opts.ClusterID != "" && len(archive.Clusters) != 1 {
+		return nil, fmt.Errorf("a new cluster ID can only be given for an archive with a single cluster (this one has %d)", len(archive.Clusters))
+	}
+
+	paths := store.Paths()
+	if opts.Mount != "" {
+		paths.Mount = opts.Mount
+	}
+
+	targetID := func(c Cluster) string {
+		if opts.ClusterID != "" {
+			return opts.ClusterID
+		}
+		return c.ClusterID
+	}
+
+	if !opts.Force {
+		for _, c := range archive.Clusters {
+			keys, err := store.ListKeys(ctx, paths.Metadata(c.Distro, targetID(c)))
+			if err != nil {
+				return nil, err
+			}
+			if len(keys) > 0 {
+				return nil, fmt.Errorf("%s cluster %s already exists in the secret store (use force to overwrite)", c.Distro, targetID(c))
+			}
+		}
+	}
+
+	restored := make([]RestoredCluster, 0, len(archive.Clusters))
+	for _, c := range archive.Clusters {
+		id := targetID(c)
+
+		items := make([]string, 0, len(c.Items))
+		for item := range c.Items {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+
+		for _, item := range items {
+			data := c.Items[item]
+			if (item == "token" || item == "agent-token") && id != c.ClusterID {
+				data = renameToken(data, id)
+			}
+			if err := store.StoreSecret(ctx, paths.Data(c.Distro, id, item), data); err != nil {
+				return restored, err
+			}
+		}
+		restored = append(restored, RestoredCluster{Distro: c.Distro, ClusterID: id, Items: len(items)})
+	}
+	return restored, nil
+}
+
+// renameToken returns a copy of a join or agent token record pointing at the new cluster ID.
+func renameToken(data map[string]interface{}, clusterID string) map[string]interface{} {
+	renamed := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		renamed[k] = v
+	}
+	renamed["cluster"] = clusterID
+	return renamed
+}
+
+// Encode serializes an archive and encrypts it to recipients.
+func Encode(archive *Archive, recipients []age.Recipient) ([]byte, error) {
+	raw, err := json.Marshal(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+	return crypt.Seal(raw, recipients)
+}
+
+// Decode decrypts a backup file with identities and parses the archive.
+func Decode(data []byte, identities []age.Identity) (*Archive, error) {
+	raw, err := crypt.Open(data, identities)
+	if err != nil {
+		return nil, err
+	}
+	archive := &Archive{}
+	if err := json.Unmarshal(raw, archive); err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+	if archive.FormatVersion == 0 || archive.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d (this edgectl supports up to %d)", archive.FormatVersion, FormatVersion)
+	}
+	return archive, nil
+}
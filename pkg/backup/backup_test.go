@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// newMapStore returns a MockStore whose generic CRUD operations are backed by a map of
+// data paths, with ListKeys accepting the matching metadata paths.
+func newMapStore(secrets map[string]map[string]interface{}) *vault.MockStore {
+	return &vault.MockStore{
+		StoreSecretFunc: func(ctx context.Context, path string, data map[string]interface{}) error {
+			secrets[path] = data
+			return nil
+		},
+		RetrieveSecretFunc: func(ctx context.Context, path string) (map[string]interface{}, error) {
+			data, ok := secrets[path]
+			if !ok {
+				return nil, vault.ErrNotFound
+			}
+			return data, nil
+		},
+		ListKeysFunc: func(ctx context.Context, path string) ([]string, error) {
+			prefix := strings.Replace(path, "/metadata/", "/data/", 1) + "/"
+			seen := map[string]bool{}
+			keys := []string{}
+			for p := range secrets {
+				rest, ok := strings.CutPrefix(p, prefix)
+				if !ok {
+					continue
+				}
+				key, _, isDir := strings.Cut(rest, "/")
+				if isDir {
+					key += "/"
+				}
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			return keys, nil
+		},
+	}
+}
+
+func testSecrets() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"kv/data/rke2/alpha/token":            {"schema_version": 1, "join_token": "K10alpha", "cluster": "alpha"},
+		"kv/data/rke2/alpha/masters":          {"schema_version": 1, "hosts": []interface{}{"m1"}},
+		"kv/data/rke2/alpha/lb/lb1":           {"schema_version": 1, "hostname": "lb1", "is_main": true},
+		"kv/data/rke2/alpha/locks/bootstrap":  {"holder": "m1"},
+		"kv/data/k3s/beta/kubeconfig":         {"schema_version": 1, "kubeconfig": "apiVersion: v1"},
+		"kv/data/other/unrelated/application": {"key": "value"},
+	}
+}
+
+func TestCreate_SingleCluster(t *testing.T) {
+	original := now
+	now = func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = original })
+
+	archive, err := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: []string{"rke2"}, ClusterID: "alpha"}, "admin-host")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if archive.CreatedAt != "2025-06-01T12:00:00Z" || archive.CreatedBy != "admin-host" || archive.Mount != "kv" {
+		t.Errorf("unexpected archive header: %+v", archive)
+	}
+	if len(archive.Clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d", len(archive.Clusters))
+	}
+	items := archive.Clusters[0].Items
+	if len(items) != 3 || items["lb/lb1"]["hostname"] != "lb1" || items["token"]["join_token"] != "K10alpha" {
+		t.Errorf("expected token, masters and lb/lb1 without locks, got %v", items)
+	}
+}
+
+func TestCreate_AllClusters(t *testing.T) {
+	archive, err := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: vault.Distros}, "admin-host")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(archive.Clusters) != 2 || archive.Clusters[0].ClusterID != "alpha" || archive.Clusters[1].ClusterID != "beta" {
+		t.Errorf("expected alpha and beta, got %+v", archive.Clusters)
+	}
+}
+
+func TestCreate_MissingCluster(t *testing.T) {
+	_, err := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: []string{"rke2"}, ClusterID: "missing"}, "admin-host")
+	if !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	archive, _ := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: vault.Distros}, "admin-host")
+
+	sealed, err := Encode(archive, []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(sealed), "K10alpha") {
+		t.Fatal("expected the backup to be encrypted")
+	}
+
+	decoded, err := Decode(sealed, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Clusters) != 2 || decoded.Clusters[0].Items["token"]["join_token"] != "K10alpha" {
+		t.Errorf("unexpected decoded archive: %+v", decoded)
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	if _, err := Decode(sealed, []age.Identity{other}); err == nil {
+		t.Error("expected decoding with another identity to fail")
+	}
+}
+
+func TestRestore_ToEmptyStore(t *testing.T) {
+	archive, _ := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: vault.Distros}, "admin-host")
+
+	target := map[string]map[string]interface{}{}
+	restored, err := Restore(t.Context(), newMapStore(target), archive, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(restored) != 2 || restored[0].Items != 3 || restored[1].Items != 1 {
+		t.Errorf("unexpected restore result: %+v", restored)
+	}
+	if target["kv/data/rke2/alpha/lb/lb1"]["hostname"] != "lb1" || target["kv/data/k3s/beta/kubeconfig"] == nil {
+		t.Errorf("expected items to be written, got %v", target)
+	}
+}
+
+func TestRestore_NewClusterIDAndMount(t *testing.T) {
+	archive, _ := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: []string{"rke2"}, ClusterID: "alpha"}, "admin-host")
+
+	target := map[string]map[string]interface{}{}
+	if _, err := Restore(t.Context(), newMapStore(target), archive, RestoreOptions{ClusterID: "gamma", Mount: "edge"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token := target["edge/data/rke2/gamma/token"]
+	if token == nil || token["cluster"] != "gamma" || token["join_token"] != "K10alpha" {
+		t.Errorf("expected the token under the new ID and mount, got %v", target)
+	}
+	if archive.Clusters[0].Items["token"]["cluster"] != "alpha" {
+		t.Error("expected the archive itself to be left unchanged")
+	}
+}
+
+func TestRestore_RefusesExistingClusterUnlessForced(t *testing.T) {
+	archive, _ := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: vault.Distros}, "admin-host")
+
+	target := map[string]map[string]interface{}{
+		"kv/data/k3s/beta/token": {"join_token": "K10current"},
+	}
+	store := newMapStore(target)
+	if _, err := Restore(t.Context(), store, archive, RestoreOptions{}); err == nil {
+		t.Fatal("expected an error for an existing cluster")
+	}
+	if len(target) != 1 {
+		t.Errorf("expected nothing to be written, got %v", target)
+	}
+
+	if _, err := Restore(t.Context(), store, archive, RestoreOptions{Force: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target["kv/data/k3s/beta/kubeconfig"] == nil {
+		t.Error("expected the forced restore to write the cluster")
+	}
+}
+
+func TestRestore_NewClusterIDNeedsSingleCluster(t *testing.T) {
+	archive, _ := Create(t.Context(), newMapStore(testSecrets()), Selection{Distros: vault.Distros}, "admin-host")
+	if _, err := Restore(t.Context(), newMapStore(map[string]map[string]interface{}{}), archive, RestoreOptions{ClusterID: "gamma"}); err == nil {
+		t.Error("expected an error renaming a multi-cluster archive")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package bundle exports the join credentials of a cluster into an encrypted file, so nodes at sites
+that can't reach the secret store can still join.
+
+A bundle holds what an agent needs to join: the agent token, the server URL and VIP, the cluster
+CA hash and the distro. It is encrypted with age (see pkg/crypt) like a backup. The install code
+reads it through Store, a read-only SecretStore, so an install from a bundle runs the same code
+as an install against the secret store:
+- Export: Reads the join credentials of a cluster into a Bundle
+- Encode / Decode: Serialize a Bundle and encrypt/decrypt it with age
+- Store / OpenStore: Serve a bundle as a SecretStore (see store.go)
+
+Only agent bundles exist: servers register themselves in the secret store during their install.
+*/
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/crypt"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// FormatVersion is the bundle format written by Export; Decode rejects newer formats.
+const FormatVersion = 1
+
+// now is a package-level variable so tests can inject a fixed clock.
+var now = time.Now
+
+// serverPorts are the ports agents register with, per distro.
+var serverPorts = map[string]string{"rke2": "9345", "k3s": "6443"}
+
+// Bundle is the decrypted content of a join bundle.
+type Bundle struct {
+	FormatVersion int    `json:"format_version"`
+	CreatedAt     string `json:"created_at"`
+	CreatedBy     string `json:"created_by"`
+	Distro        string `json:"distro"`
+	ClusterID     string `json:"cluster_id"`
+	Role          string `json:"role"`
+	// Token is the agent token of the cluster
+	Token string `json:"token"`
+	// ServerURL is the URL agents register with: the VIP, else the first server
+	ServerURL string `json:"server_url"`
+	VIP       string `json:"vip,omitempty"`
+	// CAHash is the hash of the cluster CA embedded in the token, empty for tokens without one
+	CAHash string `json:"ca_hash,omitempty"`
+}
+
+// Export reads the join credentials of a cluster into a bundle for role.
+func Export(ctx context.Context, store vault.SecretStore, distro, clusterID, role, createdBy string) (*Bundle, error) {
+	if role != vault.PolicyRoleAgent {
+		return nil, fmt.Errorf("unsupported role %q for a bundle: only agents can join without the secret store, servers register themselves in it", role)
+	}
+	port, ok := serverPorts[distro]
+	if !ok {
+		return nil, fmt.Errorf("unsupported distro %q", distro)
+	}
+
+	token, err := store.RetrieveAgentToken(ctx, distro, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve agent token: %w", err)
+	}
+	masters, err := store.RetrieveMasterInfo(ctx, distro, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve master node info: %w", err)
+	}
+	address := masters.VIP
+	if address == "" {
+		address = masters.FirstMasterIP()
+	}
+
+	return &Bundle{
+		FormatVersion: FormatVersion,
+		CreatedAt:     now().UTC().Format(time.RFC3339),
+		CreatedBy:     createdBy,
+		Distro:        distro,
+		ClusterID:     clusterID,
+		Role:          role,
+		Token:         token.Token,
+		ServerURL:     "https://" + net.JoinHostPort(address, port),
+		VIP:           masters.VIP,
+		CAHash:        caHash(token.Token),
+	}, nil
+}
+
+// ServerAddress returns the host of the server URL.
+func (b *Bundle) ServerAddress() string {
+	u, err := url.Parse(b.ServerURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Validate checks that a decoded bundle is complete and that the CA hash matches the token.
+func (b *Bundle) Validate() error {
+	switch {
+	case b.FormatVersion == 0 || b.FormatVersion > FormatVersion:
+		return fmt.Errorf("unsupported bundle format version %d (this edgectl supports up to %d)", b.FormatVersion, FormatVersion)
+	case b.Distro == "" || b.ClusterID == "" || b.Token == "":
+		return fmt.Errorf("invalid bundle: distro, cluster_id and token are required")
+	case b.Role != vault.PolicyRoleAgent:
+		return fmt.Errorf("invalid bundle: unsupported role %q", b.Role)
+	case b.ServerAddress() == "":
+		return fmt.Errorf("invalid bundle: server_url %q has no host", b.ServerURL)
+	case b.CAHash != caHash(b.Token):
+		return fmt.Errorf("invalid bundle: the CA hash doesn't match the token")
+	}
+	return nil
+}
+
+// caHash returns the CA hash of a full "K10<ca-hash>::<user>:<secret>" token.
+func caHash(token string) string {
+	prefix, _, ok := strings.Cut(token, "::")
+	if !ok || !strings.HasPrefix(prefix, "K10") {
+		return ""
+	}
+	return strings.TrimPrefix(prefix, "K10")
+}
+
+// Encode serializes a bundle and encrypts it to recipients.
+func Encode(b *Bundle, recipients []age.Recipient) ([]byte, error) {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	return crypt.Seal(raw, recipients)
+}
+
+// Decode decrypts a bundle file with identities, parses and validates it.
+func Decode(data []byte, identities []age.Identity) (*Bundle, error) {
+	raw, err := crypt.Open(data, identities)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{}
+	if err := json.Unmarshal(raw, b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
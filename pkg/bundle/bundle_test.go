@@ -0,0 +1,128 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+const testAgentToken = "K10cafe::node:agentsecret"
+
+func exportStore(vip string) *vault.MockStore {
+	return &vault.MockStore{
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+			return &vault.AgentToken{Token: testAgentToken, ClusterID: clusterID}, nil
+		},
+		RetrieveMasterInfoFunc: func(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+			return &vault.MasterSet{Hosts: []string{"m1"}, HostIPs: map[string]string{"m1": "10.0.0.1"}, VIP: vip}, nil
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		distro, vip, wantURL string
+	}{
+		{"rke2", "10.0.0.100", "https://10.0.0.100:9345"},
+		{"rke2", "", "https://10.0.0.1:9345"},
+		{"k3s", "fd00::100", "https://[fd00::100]:6443"},
+	}
+	for _, tt := range tests {
+		b, err := Export(t.Context(), exportStore(tt.vip), tt.distro, "c1", vault.PolicyRoleAgent, "admin-host")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if b.ServerURL != tt.wantURL || b.VIP != tt.vip {
+			t.Errorf("expected server URL %q and VIP %q, got %q and %q", tt.wantURL, tt.vip, b.ServerURL, b.VIP)
+		}
+		if b.Token != testAgentToken || b.CAHash != "cafe" || b.Distro != tt.distro || b.CreatedBy != "admin-host" {
+			t.Errorf("unexpected bundle: %+v", b)
+		}
+	}
+}
+
+func TestExport_OnlyAgents(t *testing.T) {
+	if _, err := Export(t.Context(), exportStore(""), "rke2", "c1", vault.PolicyRoleServer, "admin-host"); err == nil {
+		t.Error("expected an error for a server bundle")
+	}
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	b, _ := Export(t.Context(), exportStore("10.0.0.100"), "rke2", "c1", vault.PolicyRoleAgent, "admin-host")
+
+	sealed, err := Encode(b, []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(sealed), "agentsecret") {
+		t.Fatal("expected the bundle to be encrypted")
+	}
+
+	decoded, err := Decode(sealed, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *decoded != *b {
+		t.Errorf("expected %+v, got %+v", b, decoded)
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	if _, err := Decode(sealed, []age.Identity{other}); err == nil {
+		t.Error("expected decoding with another identity to fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Bundle{FormatVersion: 1, Distro: "rke2", ClusterID: "c1", Role: "agent", Token: testAgentToken, ServerURL: "https://10.0.0.1:9345", CAHash: "cafe"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]func(b *Bundle){
+		"newer format":     func(b *Bundle) { b.FormatVersion = 2 },
+		"no token":         func(b *Bundle) { b.Token = "" },
+		"server role":      func(b *Bundle) { b.Role = "server" },
+		"no server host":   func(b *Bundle) { b.ServerURL = "" },
+		"CA hash mismatch": func(b *Bundle) { b.CAHash = "beef" },
+		"token without CA": func(b *Bundle) { b.Token = "agentsecret" },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := valid
+			mutate(&b)
+			if err := b.Validate(); err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	b, _ := Export(t.Context(), exportStore(""), "rke2", "c1", vault.PolicyRoleAgent, "admin-host")
+	store := NewStore(b)
+
+	token, err := store.RetrieveAgentToken(t.Context(), "rke2", "c1")
+	if err != nil || token.Token != testAgentToken {
+		t.Errorf("expected the agent token, got %+v (%v)", token, err)
+	}
+	masters, err := store.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if err != nil || masters.VIP != "" || masters.FirstMasterIP() != "10.0.0.1" {
+		t.Errorf("expected the first server without VIP, got %+v (%v)", masters, err)
+	}
+
+	if _, err := store.RetrieveAgentToken(t.Context(), "rke2", "other"); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another cluster, got %v", err)
+	}
+	if _, err := store.RetrieveJoinToken(t.Context(), "rke2", "c1"); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the server token, got %v", err)
+	}
+	if err := store.StoreMasterInfo(t.Context(), "rke2", "c1", "m2", nil, ""); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
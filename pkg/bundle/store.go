@@ -0,0 +1,225 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// ErrReadOnly is returned (wrapped) by every write to a Store.
+var ErrReadOnly = errors.New("a join bundle is read-only")
+
+// Store is a read-only SecretStore serving the cluster of one bundle. The agent token and the
+// masters (assembled from the server URL and VIP) can be read; everything the bundle doesn't
+// hold is reported as vault.ErrNotFound, and writes fail with ErrReadOnly.
+type Store struct {
+	bundle *Bundle
+}
+
+// Compile-time check: *Store must satisfy vault.SecretStore.
+var _ vault.SecretStore = (*Store)(nil)
+
+// NewStore serves a decoded bundle.
+func NewStore(b *Bundle) *Store {
+	return &Store{bundle: b}
+}
+
+// OpenStore reads and decrypts the bundle file at path and serves it.
+func OpenStore(path string, identities []age.Identity) (*Store, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path comes from trusted CLI input
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	b, err := Decode(data, identities)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(b), nil
+}
+
+// Bundle returns the bundle the store serves.
+func (s *Store) Bundle() *Bundle {
+	return s.bundle
+}
+
+// check returns vault.ErrNotFound unless the request is for the bundle's cluster.
+func (s *Store) check(distro, clusterID string) error {
+	if distro != s.bundle.Distro || clusterID != s.bundle.ClusterID {
+		return fmt.Errorf("%w: the bundle holds %s cluster %s, not %s cluster %s", vault.ErrNotFound, s.bundle.Distro, s.bundle.ClusterID, distro, clusterID)
+	}
+	return nil
+}
+
+// notInBundle reports an item the bundle doesn't hold.
+func notInBundle(item string) error {
+	return fmt.Errorf("%w: the bundle holds no %s", vault.ErrNotFound, item)
+}
+
+// readOnly reports a write to the bundle.
+func readOnly(operation string) error {
+	return fmt.Errorf("%w: can't %s", ErrReadOnly, operation)
+}
+
+// Paths returns the default KV paths; a bundle isn't tied to a mount.
+func (s *Store) Paths() vault.KVPaths {
+	return vault.DefaultKVPaths()
+}
+
+func (s *Store) StoreSecret(ctx context.Context, fullVaultPath string, data map[string]interface{}) error {
+	return readOnly("store " + fullVaultPath)
+}
+
+func (s *Store) RetrieveSecret(ctx context.Context, fullVaultPath string) (map[string]interface{}, error) {
+	return nil, notInBundle(fullVaultPath)
+}
+
+func (s *Store) ListKeys(ctx context.Context, fullVaultPath string) ([]string, error) {
+	return nil, notInBundle(fullVaultPath)
+}
+
+func (s *Store) DeleteSecret(ctx context.Context, fullVaultPath string) error {
+	return readOnly("delete " + fullVaultPath)
+}
+
+func (s *Store) SecretHistory(ctx context.Context, fullVaultPath string) ([]vault.SecretVersion, error) {
+	return nil, notInBundle("version history")
+}
+
+func (s *Store) RetrieveSecretVersion(ctx context.Context, fullVaultPath string, version int) (map[string]interface{}, error) {
+	return nil, notInBundle("version history")
+}
+
+func (s *Store) RollbackSecret(ctx context.Context, fullVaultPath string, version int) (int, error) {
+	return 0, readOnly("roll back " + fullVaultPath)
+}
+
+func (s *Store) StoreJoinToken(ctx context.Context, distro, clusterID, token string) error {
+	return readOnly("store a join token")
+}
+
+// RetrieveJoinToken always fails: bundles only carry the agent token.
+func (s *Store) RetrieveJoinToken(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+	return nil, notInBundle("server token")
+}
+
+func (s *Store) RetrieveJoinTokenVersion(ctx context.Context, distro, clusterID string, version int) (*vault.JoinToken, error) {
+	return nil, notInBundle("server token")
+}
+
+func (s *Store) RotateJoinToken(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+	return readOnly("rotate the join token")
+}
+
+func (s *Store) StoreAgentToken(ctx context.Context, distro, clusterID, token string) error {
+	return readOnly("store an agent token")
+}
+
+func (s *Store) RetrieveAgentToken(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+	if err := s.check(distro, clusterID); err != nil {
+		return nil, err
+	}
+	return &vault.AgentToken{SchemaVersion: vault.CurrentSchemaVersion, Token: s.bundle.Token, ClusterID: s.bundle.ClusterID}, nil
+}
+
+func (s *Store) StoreMasterInfo(ctx context.Context, distro, clusterID, hostname string, hosts []string, vip string) error {
+	return readOnly("register a master")
+}
+
+// RetrieveMasterInfo returns the server of the bundle as the only master, with the bundle's VIP.
+func (s *Store) RetrieveMasterInfo(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+	if err := s.check(distro, clusterID); err != nil {
+		return nil, err
+	}
+	server := s.bundle.ServerAddress()
+	return &vault.MasterSet{
+		SchemaVersion: vault.CurrentSchemaVersion,
+		Hosts:         []string{server},
+		VIP:           s.bundle.VIP,
+		FirstIP:       server,
+	}, nil
+}
+
+func (s *Store) RetrieveFirstMasterIP(ctx context.Context, distro, clusterID string) (string, error) {
+	if err := s.check(distro, clusterID); err != nil {
+		return "", err
+	}
+	return s.bundle.ServerAddress(), nil
+}
+
+func (s *Store) StoreKubeConfig(ctx context.Context, distro, clusterID, kubeconfigPath, vip string, apiPort int) error {
+	return readOnly("store a kubeconfig")
+}
+
+func (s *Store) RetrieveKubeConfig(ctx context.Context, distro, clusterID, destinationPath string) error {
+	return notInBundle("kubeconfig")
+}
+
+func (s *Store) RetrieveKubeConfigVersion(ctx context.Context, distro, clusterID, destinationPath string, version int) error {
+	return notInBundle("kubeconfig")
+}
+
+func (s *Store) RetrieveKubeconfigRecord(ctx context.Context, distro, clusterID string) (*vault.KubeconfigRecord, error) {
+	return nil, notInBundle("kubeconfig")
+}
+
+func (s *Store) StoreClientCA(ctx context.Context, distro, clusterID, certPath, keyPath string) error {
+	return readOnly("store a client CA")
+}
+
+func (s *Store) RetrieveClientCA(ctx context.Context, distro, clusterID string) (*vault.ClientCARecord, error) {
+	return nil, notInBundle("client CA")
+}
+
+func (s *Store) StoreLBInfo(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error {
+	return readOnly("register a load balancer")
+}
+
+// RetrieveLBInfo returns no load balancer nodes, only the bundle's VIP.
+func (s *Store) RetrieveLBInfo(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+	if err := s.check(distro, clusterID); err != nil {
+		return nil, "", err
+	}
+	return nil, s.bundle.VIP, nil
+}
+
+func (s *Store) RemoveLBNode(ctx context.Context, distro, clusterID, hostname string) error {
+	return readOnly("remove a load balancer")
+}
+
+func (s *Store) AcquireLock(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+	return nil, readOnly("acquire lock " + name)
+}
+
+func (s *Store) ReleaseLock(ctx context.Context, lease *vault.Lease) error {
+	return readOnly("release a lock")
+}
+
+func (s *Store) RetrieveCluster(ctx context.Context, distro, clusterID string) (*vault.ClusterRecord, error) {
+	token, err := s.RetrieveAgentToken(ctx, distro, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	masters, _ := s.RetrieveMasterInfo(ctx, distro, clusterID)
+	return &vault.ClusterRecord{
+		SchemaVersion: vault.CurrentSchemaVersion,
+		Distro:        distro,
+		ClusterID:     clusterID,
+		AgentToken:    token,
+		Masters:       masters,
+		LBNodes:       []vault.LBNodeRecord{},
+		VIP:           s.bundle.VIP,
+	}, nil
+}
+
+func (s *Store) DeleteClusterData(ctx context.Context, distro, clusterID string) error {
+	return readOnly("delete cluster data")
+}
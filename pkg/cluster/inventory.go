@@ -0,0 +1,173 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package cluster provides cluster-level views over the data stored in the secret store.
+
+This file implements the cluster inventory:
+- List: Enumerates every cluster stored for the given distributions
+- Describe: Summarizes one cluster (masters, VIP, load balancers, token and kubeconfig state)
+- IDs: Lists the IDs of the clusters stored for a distribution
+
+Only metadata is read for the token and kubeconfig, so listing clusters doesn't require
+(or expose) access to the secrets themselves.
+*/
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// Summary describes one cluster stored in the secret store.
+type Summary struct {
+	Distro     string     `json:"distro" yaml:"distro"`
+	ClusterID  string     `json:"cluster_id" yaml:"cluster_id"`
+	VIP        string     `json:"vip,omitempty" yaml:"vip,omitempty"`
+	Masters    []Master   `json:"masters" yaml:"masters"`
+	LBNodes    []LBNode   `json:"lb_nodes" yaml:"lb_nodes"`
+	Token      ItemStatus `json:"token" yaml:"token"`
+	Kubeconfig ItemStatus `json:"kubeconfig" yaml:"kubeconfig"`
+	// Error is set by List when the cluster's records couldn't be read, instead of failing the whole listing
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Master is a control-plane node of a cluster.
+type Master struct {
+	Hostname string `json:"hostname" yaml:"hostname"`
+	IP       string `json:"ip,omitempty" yaml:"ip,omitempty"`
+}
+
+// LBNode is a load balancer node of a cluster with its keepalived role.
+type LBNode struct {
+	Hostname string `json:"hostname" yaml:"hostname"`
+	Role     string `json:"role" yaml:"role"`
+}
+
+// Load balancer roles, matching the keepalived states.
+const (
+	RoleMain   = "main"
+	RoleBackup = "backup"
+)
+
+// ItemStatus tells whether a secret item exists and when it was last written.
+type ItemStatus struct {
+	Exists    bool       `json:"exists" yaml:"exists"`
+	Version   int        `json:"version,omitempty" yaml:"version,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" yaml:"updated_at,omitempty"`
+}
+
+// List returns a summary of every cluster stored for distros, sorted by distro and cluster ID.
+// A cluster whose records can't be read is included with Error set.
+func List(ctx context.Context, store vault.SecretStore, distros []string) ([]Summary, error) {
+	summaries := []Summary{}
+	for _, distro := range distros {
+		ids, err := IDs(ctx, store, distro)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			summary, err := Describe(ctx, store, distro, id)
+			switch {
+			case errors.Is(err, vault.ErrNotFound):
+				// Only locks or deleted items left behind
+				continue
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				return nil, err
+			case err != nil:
+				summaries = append(summaries, Summary{Distro: distro, ClusterID: id, Masters: []Master{}, LBNodes: []LBNode{}, Error: err.Error()})
+				continue
+			}
+			summaries = append(summaries, *summary)
+		}
+	}
+	return summaries, nil
+}
+
+// Describe summarizes the records of one cluster. ErrNotFound is returned when none of
+// the masters, load balancer, token or kubeconfig items exist.
+func Describe(ctx context.Context, store vault.SecretStore, distro, clusterID string) (*Summary, error) {
+	summary := &Summary{Distro: distro, ClusterID: clusterID, Masters: []Master{}, LBNodes: []LBNode{}}
+
+	masters, err := store.RetrieveMasterInfo(ctx, distro, clusterID)
+	if err != nil && !errors.Is(err, vault.ErrNotFound) {
+		return nil, err
+	}
+	if masters != nil {
+		for _, host := range masters.Hosts {
+			summary.Masters = append(summary.Masters, Master{Hostname: host, IP: masters.HostIPs[host]})
+		}
+	}
+
+	lbNodes, lbVIP, err := store.RetrieveLBInfo(ctx, distro, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range lbNodes {
+		role := RoleBackup
+		if node.IsMain {
+			role = RoleMain
+		}
+		summary.LBNodes = append(summary.LBNodes, LBNode{Hostname: node.Hostname, Role: role})
+	}
+
+	// The load balancer VIP is authoritative; fall back to the one recorded with the masters
+	summary.VIP = lbVIP
+	if summary.VIP == "" && masters != nil {
+		summary.VIP = masters.VIP
+	}
+
+	paths := store.Paths()
+	if summary.Token, err = itemStatus(ctx, store, paths.Data(distro, clusterID, "token")); err != nil {
+		return nil, err
+	}
+	if summary.Kubeconfig, err = itemStatus(ctx, store, paths.Data(distro, clusterID, "kubeconfig")); err != nil {
+		return nil, err
+	}
+
+	if masters == nil && len(lbNodes) == 0 && !summary.Token.Exists && !summary.Kubeconfig.Exists {
+		return nil, fmt.Errorf("%w for %s cluster %s", vault.ErrNotFound, distro, clusterID)
+	}
+	return summary, nil
+}
+
+// IDs lists the IDs of the clusters stored under a distro, sorted.
+func IDs(ctx context.Context, store vault.SecretStore, distro string) ([]string, error) {
+	keys, err := store.ListKeys(ctx, store.Paths().Metadata(distro))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s clusters: %w", distro, err)
+	}
+	ids := []string{}
+	for _, key := range keys {
+		// Clusters are directories; a plain key directly under the distro isn't a cluster
+		if id, isDir := strings.CutSuffix(key, "/"); isDir && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// itemStatus reads the version metadata of an item. The item counts as existing when its
+// current version can be read, i.e. it was neither deleted nor destroyed.
+func itemStatus(ctx context.Context, store vault.SecretStore, path string) (ItemStatus, error) {
+	versions, err := store.SecretHistory(ctx, path)
+	if errors.Is(err, vault.ErrNotFound) {
+		return ItemStatus{}, nil
+	}
+	if err != nil {
+		return ItemStatus{}, err
+	}
+	for _, v := range versions {
+		if v.Current && !v.Deleted() {
+			updated := v.CreatedTime
+			return ItemStatus{Exists: true, Version: v.Version, UpdatedAt: &updated}, nil
+		}
+	}
+	return ItemStatus{}, nil
+}
@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// newInventoryStore returns a MockStore holding rke2 cluster "alpha" (masters, LB, token and
+// kubeconfig), k3s cluster "beta" (token only) and an rke2 directory with only a stale lock.
+func newInventoryStore() *vault.MockStore {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	return &vault.MockStore{
+		ListKeysFunc: func(ctx context.Context, path string) ([]string, error) {
+			switch path {
+			case "kv/metadata/rke2":
+				return []string{"stale/", "alpha/", "edgectl"}, nil
+			case "kv/metadata/k3s":
+				return []string{"beta/"}, nil
+			}
+			return []string{}, nil
+		},
+		RetrieveMasterInfoFunc: func(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+			if clusterID != "alpha" {
+				return nil, vault.ErrNotFound
+			}
+			return &vault.MasterSet{
+				Hosts:   []string{"m1", "m2"},
+				HostIPs: map[string]string{"m1": "10.0.0.1", "m2": "10.0.0.2"},
+				VIP:     "10.0.0.50",
+			}, nil
+		},
+		RetrieveLBInfoFunc: func(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+			if clusterID != "alpha" {
+				return nil, "", nil
+			}
+			return []vault.LBNodeRecord{
+				{Hostname: "lb1", VIP: "10.0.0.100", IsMain: true},
+				{Hostname: "lb2", VIP: "10.0.0.100"},
+			}, "10.0.0.100", nil
+		},
+		SecretHistoryFunc: func(ctx context.Context, path string) ([]vault.SecretVersion, error) {
+			switch path {
+			case "kv/data/rke2/alpha/token", "kv/data/k3s/beta/token":
+				return []vault.SecretVersion{{Version: 1, CreatedTime: created}, {Version: 2, CreatedTime: created.Add(time.Hour), Current: true}}, nil
+			case "kv/data/rke2/alpha/kubeconfig":
+				return []vault.SecretVersion{{Version: 1, CreatedTime: created, Current: true, DeletionTime: created}}, nil
+			}
+			return nil, vault.ErrNotFound
+		},
+	}
+}
+
+func TestList_EnumeratesClustersOfAllDistros(t *testing.T) {
+	summaries, err := List(t.Context(), newInventoryStore(), vault.Distros)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 clusters (stale lock-only directory skipped), got %+v", summaries)
+	}
+	if summaries[0].Distro != "rke2" || summaries[0].ClusterID != "alpha" {
+		t.Errorf("expected rke2/alpha first, got %s/%s", summaries[0].Distro, summaries[0].ClusterID)
+	}
+	if summaries[1].Distro != "k3s" || summaries[1].ClusterID != "beta" {
+		t.Errorf("expected k3s/beta second, got %s/%s", summaries[1].Distro, summaries[1].ClusterID)
+	}
+}
+
+func TestDescribe_SummarizesCluster(t *testing.T) {
+	summary, err := Describe(t.Context(), newInventoryStore(), "rke2", "alpha")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if summary.VIP != "10.0.0.100" {
+		t.Errorf("expected the LB VIP, got %s", summary.VIP)
+	}
+	if len(summary.Masters) != 2 || summary.Masters[1] != (Master{Hostname: "m2", IP: "10.0.0.2"}) {
+		t.Errorf("unexpected masters: %+v", summary.Masters)
+	}
+	if len(summary.LBNodes) != 2 || summary.LBNodes[0].Role != RoleMain || summary.LBNodes[1].Role != RoleBackup {
+		t.Errorf("unexpected LB nodes: %+v", summary.LBNodes)
+	}
+	if !summary.Token.Exists || summary.Token.Version != 2 || summary.Token.UpdatedAt == nil || summary.Token.UpdatedAt.Hour() != 13 {
+		t.Errorf("expected token version 2 updated at 13:00, got %+v", summary.Token)
+	}
+	if summary.Kubeconfig.Exists {
+		t.Errorf("expected a deleted kubeconfig to count as missing, got %+v", summary.Kubeconfig)
+	}
+}
+
+func TestDescribe_NotFound(t *testing.T) {
+	if _, err := Describe(t.Context(), newInventoryStore(), "rke2", "missing"); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestList_InvalidRecordDoesNotFailListing(t *testing.T) {
+	store := newInventoryStore()
+	store.RetrieveMasterInfoFunc = func(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+		if clusterID != "alpha" {
+			return nil, vault.ErrNotFound
+		}
+		return nil, &vault.ValidationError{Path: "kv/data/rke2/alpha/masters", Record: "masters", Reason: "hosts is empty"}
+	}
+
+	summaries, err := List(t.Context(), store, []string{"rke2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 1 || !strings.Contains(summaries[0].Error, "hosts is empty") {
+		t.Errorf("expected alpha to be listed with its error, got %+v", summaries)
+	}
+}
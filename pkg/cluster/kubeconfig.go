@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package cluster provides cluster-level views over the data stored in the secret store.
+
+This file implements issuing kubeconfigs to users:
+- IssueKubeconfig: Signs a short-lived client certificate for a user and wraps it in a kubeconfig
+
+The certificate is signed with the client CA a server uploaded during install or, when a PKI
+mount is given, by OpenBao's PKI engine so the CA key never leaves OpenBao. Either way the
+server address and CA bundle are taken from the admin kubeconfig stored for the cluster.
+*/
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// PKISigner signs certificate requests with an OpenBao PKI engine; implemented by *vault.Client.
+type PKISigner interface {
+	SignWithPKI(ctx context.Context, mount, role, csr string, ttl time.Duration) (*vault.PKICertificate, error)
+}
+
+// IssueOptions describes the kubeconfig to issue.
+type IssueOptions struct {
+	Distro    string
+	ClusterID string
+	kubeconfig.Identity
+	TTL time.Duration
+	// PKIMount and PKIRole select an OpenBao PKI engine to sign with instead of the stored client CA
+	PKIMount string
+	PKIRole  string
+}
+
+// IssuedKubeconfig is a kubeconfig issued to a user, with what is needed to audit it.
+type IssuedKubeconfig struct {
+	Kubeconfig   []byte
+	Context      string
+	User         string
+	Groups       []string
+	SerialNumber string
+	NotAfter     time.Time
+}
+
+// IssueKubeconfig signs a client certificate for opts.User and opts.Groups, valid for opts.TTL,
+// and returns a kubeconfig for the cluster that authenticates with it.
+func IssueKubeconfig(ctx context.Context, store vault.SecretStore, opts IssueOptions) (*IssuedKubeconfig, error) {
+	if strings.TrimSpace(opts.User) == "" {
+		return nil, fmt.Errorf("a user is required")
+	}
+	if opts.TTL <= 0 {
+		return nil, fmt.Errorf("the TTL must be positive, got %s", opts.TTL)
+	}
+	if opts.PKIMount != "" && opts.PKIRole == "" {
+		return nil, fmt.Errorf("a PKI role is required to sign with the PKI engine at '%s'", opts.PKIMount)
+	}
+
+	admin, err := store.RetrieveKubeconfigRecord(ctx, opts.Distro, opts.ClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the kubeconfig of cluster %s: %w", opts.ClusterID, err)
+	}
+
+	csr, key, err := kubeconfig.NewRequest(opts.Identity)
+	if err != nil {
+		return nil, err
+	}
+	var cert []byte
+	if opts.PKIMount != "" {
+		signer, ok := store.(PKISigner)
+		if !ok {
+			return nil, fmt.Errorf("the secret store can't sign certificates with a PKI engine")
+		}
+		signed, err := signer.SignWithPKI(ctx, opts.PKIMount, opts.PKIRole, string(csr), opts.TTL)
+		if err != nil {
+			return nil, err
+		}
+		cert = []byte(signed.Certificate)
+	} else {
+		ca, err := store.RetrieveClientCA(ctx, opts.Distro, opts.ClusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve the client CA of cluster %s: %w", opts.ClusterID, err)
+		}
+		if cert, err = kubeconfig.SignRequest([]byte(ca.Certificate), []byte(ca.Key), csr, opts.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	creds, err := kubeconfig.NewCredentials(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	data, contextName, err := kubeconfig.ForUser([]byte(admin.Kubeconfig), kubeconfig.UserOptions{
+		Name:        opts.ClusterID,
+		User:        opts.User,
+		Credentials: creds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &IssuedKubeconfig{
+		Kubeconfig:   data,
+		Context:      contextName,
+		User:         opts.User,
+		Groups:       opts.Groups,
+		SerialNumber: creds.SerialNumber,
+		NotAfter:     creds.NotAfter,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+const adminKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: c1
+  cluster:
+    certificate-authority-data: c2VydmVyLWNh
+    server: https://10.0.0.100:6443
+users:
+- name: c1
+  user:
+    client-certificate-data: YWRtaW4=
+    client-key-data: YWRtaW4ta2V5
+contexts:
+- name: c1
+  context: {cluster: c1, user: c1}
+current-context: c1
+`
+
+// writeClientCA writes a client CA to dir the way a server keeps it and returns the file paths.
+func writeClientCA(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rke2-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPath, keyPath := filepath.Join(dir, "client-ca.crt"), filepath.Join(dir, "client-ca.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// newIssueStore returns a memory store holding the admin kubeconfig and client CA of rke2 cluster c1.
+func newIssueStore(t *testing.T) *vault.Client {
+	t.Helper()
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "rke2.yaml")
+	if err := os.WriteFile(kubeconfigPath, []byte(adminKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreKubeConfig(t.Context(), "rke2", "c1", kubeconfigPath, "10.0.0.100", 0); err != nil {
+		t.Fatalf("StoreKubeConfig: %v", err)
+	}
+	certPath, keyPath := writeClientCA(t, dir)
+	if err := store.StoreClientCA(t.Context(), "rke2", "c1", certPath, keyPath); err != nil {
+		t.Fatalf("StoreClientCA: %v", err)
+	}
+	return store
+}
+
+func TestIssueKubeconfig_ClientCA(t *testing.T) {
+	issued, err := IssueKubeconfig(t.Context(), newIssueStore(t), IssueOptions{
+		Distro:    "rke2",
+		ClusterID: "c1",
+		Identity:  kubeconfig.Identity{User: "alice", Groups: []string{"ops"}},
+		TTL:       time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("IssueKubeconfig: %v", err)
+	}
+
+	if issued.Context != "alice@c1" || issued.SerialNumber == "" {
+		t.Errorf("unexpected result: %+v", issued)
+	}
+	if until := time.Until(issued.NotAfter); until <= 0 || until > time.Hour {
+		t.Errorf("expected the kubeconfig to expire within the TTL, got %s", until)
+	}
+	data := string(issued.Kubeconfig)
+	if !strings.Contains(data, "server: https://10.0.0.100:6443") || !strings.Contains(data, "c2VydmVyLWNh") {
+		t.Errorf("expected the cluster entry of the stored kubeconfig:\n%s", data)
+	}
+	if strings.Contains(data, "YWRtaW4") {
+		t.Errorf("expected the admin credentials to be left out:\n%s", data)
+	}
+}
+
+// pkiStore is a secret store with a PKI engine that signs with a CA and records what it was asked.
+type pkiStore struct {
+	*vault.MockStore
+	caCert, caKey []byte
+	mount, role   string
+}
+
+func (s *pkiStore) SignWithPKI(ctx context.Context, mount, role, csr string, ttl time.Duration) (*vault.PKICertificate, error) {
+	s.mount, s.role = mount, role
+	cert, err := kubeconfig.SignRequest(s.caCert, s.caKey, []byte(csr), ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &vault.PKICertificate{Certificate: string(cert)}, nil
+}
+
+func TestIssueKubeconfig_PKI(t *testing.T) {
+	certPath, keyPath := writeClientCA(t, t.TempDir())
+	caCert, _ := os.ReadFile(certPath)
+	caKey, _ := os.ReadFile(keyPath)
+
+	// RetrieveClientCA is left unset, so reading the client CA would panic
+	store := &pkiStore{MockStore: &vault.MockStore{
+		RetrieveKubeconfigRecordFunc: func(ctx context.Context, distro, clusterID string) (*vault.KubeconfigRecord, error) {
+			return &vault.KubeconfigRecord{Kubeconfig: adminKubeconfig}, nil
+		},
+	}, caCert: caCert, caKey: caKey}
+
+	issued, err := IssueKubeconfig(t.Context(), store, IssueOptions{
+		Distro:    "rke2",
+		ClusterID: "c1",
+		Identity:  kubeconfig.Identity{User: "bob"},
+		TTL:       time.Hour,
+		PKIMount:  "pki",
+		PKIRole:   "kubernetes",
+	})
+	if err != nil {
+		t.Fatalf("IssueKubeconfig: %v", err)
+	}
+	if store.mount != "pki" || store.role != "kubernetes" {
+		t.Errorf("expected a request to be signed by pki/kubernetes, got %q %q", store.mount, store.role)
+	}
+	if issued.Context != "bob@c1" || issued.SerialNumber == "" {
+		t.Errorf("unexpected result: %+v", issued)
+	}
+}
+
+func TestIssueKubeconfig_Errors(t *testing.T) {
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	tests := []struct {
+		name          string
+		store         vault.SecretStore
+		opts          IssueOptions
+		wantSubstring string
+	}{
+		{name: "no user", store: store, opts: IssueOptions{ClusterID: "c1", TTL: time.Hour}, wantSubstring: "user is required"},
+		{name: "no TTL", store: store, opts: IssueOptions{ClusterID: "c1", Identity: kubeconfig.Identity{User: "alice"}}, wantSubstring: "TTL"},
+		{name: "PKI without role", store: store, opts: IssueOptions{ClusterID: "c1", Identity: kubeconfig.Identity{User: "alice"}, TTL: time.Hour, PKIMount: "pki"}, wantSubstring: "PKI role"},
+		{name: "unknown cluster", store: store, opts: IssueOptions{Distro: "rke2", ClusterID: "c1", Identity: kubeconfig.Identity{User: "alice"}, TTL: time.Hour}, wantSubstring: "kubeconfig of cluster c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := IssueKubeconfig(t.Context(), tt.store, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantSubstring) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantSubstring, err)
+			}
+		})
+	}
+}
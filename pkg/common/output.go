@@ -0,0 +1,40 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Output formats accepted by the -o/--output flag of listing commands.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// WriteOutput renders v in the requested format: JSON and YAML are generated from the
+// value's struct tags, the table format is delegated to table.
+func WriteOutput(w io.Writer, format string, v interface{}, table func(w io.Writer) error) error {
+	switch format {
+	case OutputTable, "":
+		return table(w)
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case OutputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown output format %q (expected %s, %s or %s)", format, OutputTable, OutputJSON, OutputYAML)
+}
@@ -50,7 +50,8 @@ install_k3s_server() {
 
   # Install K3s
   echo "⬇️  Downloading and installing K3s..."
-  curl -sfL https://get.k3s.io | K3S_TOKEN="$K3S_TOKEN" K3S_URL="$K3S_URL" sudo -E sh -s - server \
+  # K3S_AGENT_TOKEN is the agent-only token; the installer stores it with the other K3S_* vars in k3s.service.env
+  curl -sfL https://get.k3s.io | K3S_TOKEN="$K3S_TOKEN" K3S_AGENT_TOKEN="$K3S_AGENT_TOKEN" K3S_URL="$K3S_URL" sudo -E sh -s - server \
     --write-kubeconfig-mode "0644" \
     --node-label "environment=production" \
     --node-label "arch=$ARCH" \
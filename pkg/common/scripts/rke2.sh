@@ -80,6 +80,8 @@ EOF
   # TODO: Decide to use long or shorthand syntax, check again if we cannot just add this above in the config.yaml, had some issues with it before but might not have been related to the way we create the config file.
   # Add token and server IP to config if they are set as environment variables - for secondary server installations.
   [ -n "$RKE2_TOKEN" ] && echo "token: \"$RKE2_TOKEN\"" | sudo tee -a /etc/rancher/rke2/config.yaml && echo "🔑 Added token to config"
+  # Agent-only token: agents join with it and can't register as a server. Identical on every server.
+  [ -n "$RKE2_AGENT_TOKEN" ] && echo "agent-token: \"$RKE2_AGENT_TOKEN\"" | sudo tee -a /etc/rancher/rke2/config.yaml > /dev/null && echo "🔑 Added agent token to config"
 
   if [ -n "$RKE2_SERVER_IP" ]; then
     echo "server: \"https://$RKE2_SERVER_IP:9345\"" | sudo tee -a /etc/rancher/rke2/config.yaml
@@ -0,0 +1,202 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package crypt encrypts files that leave the secret store, such as backups, with age.
+
+A file is encrypted either with a passphrase or to one or more age recipients (public keys,
+"age1..."), and is written ASCII-armored so it can be copied around as text. Files produced
+here can be decrypted with the age CLI, and files encrypted with `age -e` can be opened here:
+- Recipients / Identities: Build the age recipients and identities from CLI input
+- Seal: Encrypts a payload
+- Open: Decrypts a payload (armored or binary)
+- ResolvePassphrase: Reads a passphrase from a file or the environment, or prompts for it
+*/
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+// armorHeader starts every ASCII-armored age file.
+const armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+// scryptWorkFactor is the scrypt cost (log2) used for passphrase encryption. Tests can lower it.
+var scryptWorkFactor = 18
+
+// Recipients returns the age recipients to encrypt to: a passphrase, or recipient strings
+// ("age1...") and recipient files with one recipient per line. A passphrase can't be combined
+// with recipients, because age only allows a passphrase as the sole recipient.
+func Recipients(passphrase string, recipients, recipientFiles []string) ([]age.Recipient, error) {
+	if passphrase != "" {
+		if len(recipients) > 0 || len(recipientFiles) > 0 {
+			return nil, errors.New("a passphrase can't be combined with recipients")
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		r.SetWorkFactor(scryptWorkFactor)
+		return []age.Recipient{r}, nil
+	}
+
+	var parsed []age.Recipient
+	if len(recipients) > 0 {
+		rs, err := age.ParseRecipients(strings.NewReader(strings.Join(recipients, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient: %w", err)
+		}
+		parsed = append(parsed, rs...)
+	}
+	for _, file := range recipientFiles {
+		rs, err := parseFile(file, age.ParseRecipients)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients from '%s': %w", file, err)
+		}
+		parsed = append(parsed, rs...)
+	}
+
+	if len(parsed) == 0 {
+		return nil, errors.New("a passphrase or at least one recipient is required")
+	}
+	return parsed, nil
+}
+
+// Identities returns the age identities to decrypt with: a passphrase and/or identity files
+// holding private keys ("AGE-SECRET-KEY-..."), as generated by age-keygen.
+func Identities(passphrase string, identityFiles []string) ([]age.Identity, error) {
+	var identities []age.Identity
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, id)
+	}
+	for _, file := range identityFiles {
+		ids, err := parseFile(file, age.ParseIdentities)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identities from '%s': %w", file, err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	if len(identities) == 0 {
+		return nil, errors.New("a passphrase or at least one identity file is required")
+	}
+	return identities, nil
+}
+
+// Seal encrypts plaintext to recipients and returns the ASCII-armored ciphertext.
+func Seal(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Open decrypts an armored or binary age ciphertext with the first matching identity.
+func Open(ciphertext []byte, identities []age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(armorHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// ReadPassphraseFile reads a passphrase from the first line of a file, as used by --passphrase-file.
+func ReadPassphraseFile(path string) (string, error) {
+	f, err := os.Open(path) //nolint:gosec // path comes from trusted CLI input
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read passphrase file '%s': %w", path, err)
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file '%s' is empty", path)
+	}
+	return passphrase, nil
+}
+
+// ResolvePassphrase returns the passphrase from file (as used by --passphrase-file) or the
+// environment variable env, prompting for it on a terminal otherwise. confirm asks for the
+// passphrase twice.
+func ResolvePassphrase(file, env string, confirm bool) (string, error) {
+	if file != "" {
+		return ReadPassphraseFile(file)
+	}
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd()) //nolint:gosec // file descriptors fit in an int
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no passphrase given: use --passphrase-file, %s or an age key", env)
+	}
+	fmt.Print("🔑 Passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("passphrase is empty")
+	}
+	if confirm {
+		fmt.Print("🔑 Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if string(again) != string(passphrase) {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+// parseFile opens path and parses it with parse (age.ParseRecipients or age.ParseIdentities).
+func parseFile[T any](path string, parse func(io.Reader) ([]T, error)) ([]T, error) {
+	f, err := os.Open(path) //nolint:gosec // path comes from trusted CLI input
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
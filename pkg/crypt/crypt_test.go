@@ -0,0 +1,123 @@
+package crypt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func init() {
+	// Keep passphrase tests fast
+	scryptWorkFactor = 10
+}
+
+func TestSealOpen_Passphrase(t *testing.T) {
+	recipients, err := Recipients("correct horse", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sealed, err := Seal([]byte("secret data"), recipients)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(sealed), armorHeader) {
+		t.Errorf("expected armored output, got %q", sealed[:20])
+	}
+
+	identities, _ := Identities("correct horse", nil)
+	plaintext, err := Open(sealed, identities)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(plaintext) != "secret data" {
+		t.Errorf("unexpected plaintext %q", plaintext)
+	}
+
+	wrong, _ := Identities("wrong", nil)
+	if _, err := Open(sealed, wrong); err == nil {
+		t.Error("expected decrypting with the wrong passphrase to fail")
+	}
+}
+
+func TestSealOpen_RecipientAndIdentityFile(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate identity: %v", err)
+	}
+	other, _ := age.GenerateX25519Identity()
+
+	dir := t.TempDir()
+	recipientFile := filepath.Join(dir, "recipients.txt")
+	identityFile := filepath.Join(dir, "key.txt")
+	_ = os.WriteFile(recipientFile, []byte("# backup operators\n"+other.Recipient().String()+"\n"), 0o600)
+	_ = os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600)
+
+	recipients, err := Recipients("", []string{identity.Recipient().String()}, []string{recipientFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %d", len(recipients))
+	}
+	sealed, err := Seal([]byte("secret data"), recipients)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	identities, err := Identities("", []string{identityFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plaintext, err := Open(sealed, identities)
+	if err != nil || string(plaintext) != "secret data" {
+		t.Errorf("expected the file identity to decrypt, got %q, %v", plaintext, err)
+	}
+	if plaintext, err := Open(sealed, []age.Identity{other}); err != nil || string(plaintext) != "secret data" {
+		t.Errorf("expected the second recipient to decrypt, got %q, %v", plaintext, err)
+	}
+}
+
+func TestOpen_BinaryCiphertext(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	var buf bytes.Buffer
+	w, _ := age.Encrypt(&buf, identity.Recipient())
+	_, _ = w.Write([]byte("from age -e"))
+	_ = w.Close()
+
+	plaintext, err := Open(buf.Bytes(), []age.Identity{identity})
+	if err != nil || string(plaintext) != "from age -e" {
+		t.Errorf("expected binary age files to decrypt, got %q, %v", plaintext, err)
+	}
+}
+
+func TestRecipients_Errors(t *testing.T) {
+	if _, err := Recipients("", nil, nil); err == nil {
+		t.Error("expected an error without passphrase or recipients")
+	}
+	if _, err := Recipients("pass", []string{"age1xyz"}, nil); err == nil {
+		t.Error("expected an error combining a passphrase with recipients")
+	}
+	if _, err := Recipients("", []string{"not-a-recipient"}, nil); err == nil {
+		t.Error("expected an error for an invalid recipient")
+	}
+}
+
+func TestReadPassphraseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	_ = os.WriteFile(path, []byte("s3cret phrase\nignored\n"), 0o600)
+
+	passphrase, err := ReadPassphraseFile(path)
+	if err != nil || passphrase != "s3cret phrase" {
+		t.Errorf("expected first line, got %q, %v", passphrase, err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	_ = os.WriteFile(empty, nil, 0o600)
+	if _, err := ReadPassphraseFile(empty); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+}
@@ -4,6 +4,8 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -21,20 +23,66 @@ var lookupHost = net.LookupHost
 var clusterIDDir = "/etc/edgectl"
 
 // Install sets up the K3s agent on the host.
-// It fetches the join token from the secret store using the supplied clusterID.
-// VIP resolution priority: secret store > --vip flag > --lb-hostname flag (DNS resolved).
-func Install(store vault.SecretStore, clusterID, vip, lbHostname string) error {
-	if _, err := FetchToken(store, clusterID); err != nil {
+// It fetches the agent token from the secret store using the supplied clusterID.
+// VIP resolution priority: secret store > --vip flag > --lb-hostname flag (DNS resolved) > first server.
+// The store may also be a join bundle (see pkg/bundle), which serves the same records from a file.
+func Install(ctx context.Context, store vault.SecretStore, clusterID, vip, lbHostname string) error {
+	if err := vault.CheckVIP(vip); err != nil {
+		return err
+	}
+	if _, err := FetchToken(ctx, store, clusterID); err != nil {
 		return err
 	}
 
 	// Priority 1: fetch the VIP from Master Info in the secret store
-	_, storedVIP, _, err := store.RetrieveMasterInfo("k3s", clusterID)
-	if err == nil && storedVIP != "" {
-		vip = storedVIP
-		fmt.Printf("🔍 VIP fetched from secret store: %s\n", storedVIP)
+	firstServer := ""
+	masters, err := store.RetrieveMasterInfo(ctx, "k3s", clusterID)
+	switch {
+	case err == nil:
+		if masters.VIP != "" {
+			vip = masters.VIP
+			fmt.Printf("🔍 VIP fetched from secret store: %s\n", masters.VIP)
+		}
+		firstServer = masters.FirstMasterIP()
+	case !errors.Is(err, vault.ErrNotFound):
+		return fmt.Errorf("failed to retrieve the masters of cluster %s: %w", clusterID, err)
 	}
 
+	return install(vip, lbHostname, firstServer)
+}
+
+// InstallWithCredentials sets up the K3s agent with the credentials redeemed from a join ticket,
+// without access to the secret store. The server address of the ticket takes the place of the
+// secret store VIP; --vip and --lb-hostname remain the fallbacks.
+func InstallWithCredentials(creds *vault.JoinCredentials, vip, lbHostname string) error {
+	if err := vault.CheckVIP(vip); err != nil {
+		return err
+	}
+	vip, err := applyCredentials(creds, vip)
+	if err != nil {
+		return err
+	}
+	return install(vip, lbHostname, "")
+}
+
+// applyCredentials sets the token of a join ticket as env var and returns the VIP to use.
+func applyCredentials(creds *vault.JoinCredentials, vip string) (string, error) {
+	if err := creds.Check("k3s", vault.PolicyRoleAgent); err != nil {
+		return "", err
+	}
+	if err := setToken(creds.ClusterID, creds.Token); err != nil {
+		return "", err
+	}
+	if creds.ServerAddress != "" {
+		vip = creds.ServerAddress
+		fmt.Printf("🎟️ Server address from join ticket: %s\n", vip)
+	}
+	return vip, nil
+}
+
+// install resolves the VIP fallbacks and runs the installation script.
+// firstServer is the last resort, for clusters without a load balancer.
+func install(vip, lbHostname, firstServer string) error {
 	// Priority 2: --vip flag is already set via the parameter
 
 	// Priority 3: resolve --lb-hostname to an IP as fallback
@@ -47,12 +95,18 @@ func Install(store vault.SecretStore, clusterID, vip, lbHostname string) error {
 		fmt.Printf("🔍 Resolved LB hostname %s to %s\n", lbHostname, vip)
 	}
 
+	// Priority 4: register with the first server when the cluster has no VIP
+	if vip == "" && firstServer != "" {
+		vip = firstServer
+		fmt.Printf("🔍 No VIP configured, using the first server %s\n", vip)
+	}
+
 	installOptions := ""
 	if vip != "" {
 		installOptions = fmt.Sprintf("-l %s", vip)
 		fmt.Printf("🌐 Using VIP %s for load balancer TLS SANs\n", vip)
 	} else {
-		logger.Debug("No VIP found via secret store, --vip, or --lb-hostname, using default settings")
+		logger.Debug("No VIP found via secret store, --vip, --lb-hostname or the first server, using default settings")
 	}
 	// Run the installation script with options
 	common.RunBashFunction("k3s.sh", fmt.Sprintf("install_k3s_agent %s", installOptions))
@@ -60,23 +114,33 @@ func Install(store vault.SecretStore, clusterID, vip, lbHostname string) error {
 	return nil
 }
 
-// FetchToken fetches token from the secret store & sets as env variable
-func FetchToken(store vault.SecretStore, clusterID string) (string, error) {
-	token, err := store.RetrieveJoinToken("k3s", clusterID)
+// FetchToken fetches the agent token from the secret store & sets as env variable.
+// Agents only get the agent-only token, never the server token, so they can't join as a server.
+func FetchToken(ctx context.Context, store vault.SecretStore, clusterID string) (string, error) {
+	token, err := store.RetrieveAgentToken(ctx, "k3s", clusterID)
+	if errors.Is(err, vault.ErrNotFound) {
+		return "", fmt.Errorf("no agent token stored for cluster %s (clusters installed before agent tokens were introduced need one, see 'edgectl secrets upload --agent'): %w", clusterID, err)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve join token: %w", err)
+		return "", fmt.Errorf("failed to retrieve agent token: %w", err)
+	}
+
+	if err := setToken(clusterID, token.Token); err != nil {
+		return "", err
 	}
+	return token.Token, nil
+}
 
+// setToken writes the cluster-id file and sets the token as env var for the bash script to use.
+func setToken(clusterID, token string) error {
 	// ensure edgectl main directory exists
 	_ = os.MkdirAll(clusterIDDir, 0o750)
 
 	if err := os.WriteFile(clusterIDDir+"/cluster-id", []byte(clusterID), 0o600); err != nil {
-		return "", fmt.Errorf("failed to write cluster-id: %w", err)
+		return fmt.Errorf("failed to write cluster-id: %w", err)
 	}
 
-	// Set token as environment variable for the bash script to use
 	_ = os.Setenv("K3S_TOKEN", token)
 	fmt.Println("✅ Set K3S_TOKEN environment variable")
-
-	return token, nil
+	return nil
 }
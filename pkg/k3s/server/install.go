@@ -4,9 +4,12 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -19,37 +22,89 @@ import (
 // Tests can override this to use a temporary directory.
 var clusterIDDir = "/etc/edgectl"
 
+// bootstrapLock is the name of the lock servers race for when a cluster ID has not been initialized yet.
+const bootstrapLock = "bootstrap"
+
+// Bootstrap election timing. Tests can override these.
+var (
+	// bootstrapLockTTL bounds how long a server that crashed mid-bootstrap blocks the others
+	bootstrapLockTTL = 15 * time.Minute
+	// bootstrapRenewInterval is how often the bootstrapping server extends its lease while it installs
+	bootstrapRenewInterval = 5 * time.Minute
+	// bootstrapWaitTimeout is how long a server waits for another server to finish bootstrapping;
+	// it starts over whenever that server renews its lease
+	bootstrapWaitTimeout = 20 * time.Minute
+	// bootstrapPollInterval is how often a waiting server checks whether the cluster is ready to join
+	bootstrapPollInterval = 10 * time.Second
+)
+
 // Install sets up the K3s server on the host.
 // If `isExisting` is true, it pulls the token from the secret store using the supplied clusterID.
-// Otherwise, it generates a new clusterID and saves token + kubeconfig to the secret store.
+// When that cluster has not been initialized yet, the servers installing it race for a bootstrap
+// lock: the winner initializes the cluster under the supplied ID, the others wait and then join.
+// Otherwise, it generates a new clusterID and saves token, agent token and kubeconfig to the secret store.
+// New clusters get a separate agent token, so the server token is only handed to servers.
 // If `vip` is provided, it will be used in the TLS SANs for the server.
-func Install(store vault.SecretStore, clusterID string, isExisting bool, vip string) error {
+// The VIP is a host without port; `apiPort` is the port the kubeconfig of a new cluster uses on the VIP (0 keeps the API server port).
+func Install(ctx context.Context, store vault.SecretStore, clusterID string, isExisting bool, vip string, apiPort int) error {
+	if err := vault.CheckVIP(vip); err != nil {
+		return err
+	}
+
 	// Get current hostname
 	hostname, err := os.Hostname()
 	if err != nil {
 		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 
+	// A cluster ID nobody has initialized yet is bootstrapped by whichever server wins the election
+	if isExisting {
+		lease, err := claimBootstrap(ctx, store, clusterID, hostname)
+		if err != nil {
+			return err
+		}
+		if lease != nil {
+			fmt.Printf("🗳️ This server won the bootstrap election for cluster %s\n", clusterID)
+			isExisting = false
+			// Downloading and starting the server can outlast the lease on slow links
+			stopRenewal := renewBootstrap(ctx, store, lease)
+			defer func() {
+				stopRenewal()
+				releaseBootstrap(ctx, store, lease)
+			}()
+		}
+	}
+
+	// Agent-only token secret configured on a new cluster; joining servers get it from the secret store
+	var agentSecret string
+
 	// If the cluster ID was provided (existing cluster), fetch the join token
 	if isExisting {
-		if _, err := FetchTokenFromSecretStore(store, clusterID); err != nil {
+		if _, err := FetchTokenFromSecretStore(ctx, store, clusterID); err != nil {
 			return err
 		}
 
 		// For existing clusters, try to fetch the VIP from the secret store if none was provided
 		if vip == "" {
-			_, storedVIP, _, err := store.RetrieveMasterInfo("k3s", clusterID)
-			if err == nil && storedVIP != "" {
-				fmt.Printf("🔍 VIP fetched from secret store: %s\n", storedVIP)
-				vip = storedVIP
+			masters, err := store.RetrieveMasterInfo(ctx, "k3s", clusterID)
+			if err == nil && masters.VIP != "" {
+				fmt.Printf("🔍 VIP fetched from secret store: %s\n", masters.VIP)
+				vip = masters.VIP
 			}
 		}
 	} else {
-		// Generate a new cluster ID
-		clusterID = fmt.Sprintf("k3s-%s", uuid.New().String()[:8])
+		// Generate a new cluster ID unless we are bootstrapping a pre-assigned one
+		if clusterID == "" {
+			clusterID = fmt.Sprintf("k3s-%s", uuid.New().String()[:8])
+			fmt.Printf("🆔 Generated cluster ID: %s\n", clusterID)
+		}
 		_ = os.MkdirAll(clusterIDDir, 0o750)
 		_ = os.WriteFile(clusterIDDir+"/cluster-id", []byte(clusterID), 0o600)
-		fmt.Printf("🆔 Generated cluster ID: %s\n", clusterID)
+
+		if agentSecret, err = generateTokenSecret(); err != nil {
+			return err
+		}
+		_ = os.Setenv("K3S_AGENT_TOKEN", agentSecret)
 	}
 
 	// If a VIP was provided, use that in the TLS SANs
@@ -62,84 +117,215 @@ func Install(store vault.SecretStore, clusterID string, isExisting bool, vip str
 	// Run the installation script with options
 	common.RunBashFunction("k3s.sh", fmt.Sprintf("install_k3s_server %s", installOptions))
 
-	// If this is a new cluster, store token and kubeconfig in the secret store
+	// A new cluster is published to the secret store; a server joining one only registers itself
 	if !isExisting {
-		tokenBytes, err := os.ReadFile("/var/lib/rancher/k3s/server/node-token")
+		return publishCluster(ctx, store, clusterID, hostname, vip, apiPort, agentSecret)
+	}
+	return registerMaster(ctx, store, clusterID, hostname, vip)
+}
+
+// publishCluster stores the records of a cluster this server just bootstrapped. Waiting servers
+// treat the cluster as ready once its join token is stored and a first master is registered,
+// so the join token goes last. If any step fails, the master registration and join token are
+// removed again: the cluster then doesn't look ready and the next server to win the bootstrap
+// election starts over, instead of joining a server that never finished.
+func publishCluster(ctx context.Context, store vault.SecretStore, clusterID, hostname, vip string, apiPort int, agentSecret string) (err error) {
+	tokenBytes, err := os.ReadFile("/var/lib/rancher/k3s/server/node-token")
+	if err != nil {
+		return fmt.Errorf("failed to read generated node token: %w", err)
+	}
+	token := strings.TrimSpace(string(tokenBytes))
+
+	defer func() {
 		if err != nil {
-			return fmt.Errorf("failed to read generated node token: %w", err)
+			rollbackPublish(ctx, store, clusterID)
 		}
+	}()
 
-		token := strings.TrimSpace(string(tokenBytes))
-		if err := store.StoreJoinToken("k3s", clusterID, token); err != nil {
-			return fmt.Errorf("failed to store token in secret store: %w", err)
-		}
-		fmt.Printf("🔐 Token successfully stored in secret store for cluster %s\n", clusterID)
+	if err := store.StoreAgentToken(ctx, "k3s", clusterID, agentToken(token, agentSecret)); err != nil {
+		return fmt.Errorf("failed to store agent token in secret store: %w", err)
+	}
+	fmt.Printf("🔐 Agent token successfully stored in secret store for cluster %s\n", clusterID)
 
-		kubeconfigPath := "/etc/rancher/k3s/k3s.yaml"
-		if _, statErr := os.Stat(kubeconfigPath); os.IsNotExist(statErr) {
-			return fmt.Errorf("kubeconfig file not found at path: %s", kubeconfigPath)
-		}
+	// The client CA lets 'edgectl cluster kubeconfig issue' sign per-user certificates
+	tlsDir := "/var/lib/rancher/k3s/server/tls"
+	if err := store.StoreClientCA(ctx, "k3s", clusterID, tlsDir+"/client-ca.crt", tlsDir+"/client-ca.key"); err != nil {
+		return fmt.Errorf("failed to store client CA in secret store: %w", err)
+	}
+	fmt.Printf("🔐 Client CA successfully stored in secret store for cluster %s\n", clusterID)
 
-		err = store.StoreKubeConfig("k3s", clusterID, kubeconfigPath, vip)
-		if err != nil {
-			return fmt.Errorf("failed to store kubeconfig in secret store: %w", err)
+	kubeconfigPath := "/etc/rancher/k3s/k3s.yaml"
+	if _, statErr := os.Stat(kubeconfigPath); os.IsNotExist(statErr) {
+		return fmt.Errorf("kubeconfig file not found at path: %s", kubeconfigPath)
+	}
+	if err := store.StoreKubeConfig(ctx, "k3s", clusterID, kubeconfigPath, vip, apiPort); err != nil {
+		return fmt.Errorf("failed to store kubeconfig in secret store: %w", err)
+	}
+	fmt.Printf("🔐 Kubeconfig successfully stored in secret store for cluster %s\n", clusterID)
+
+	if err := registerMaster(ctx, store, clusterID, hostname, vip); err != nil {
+		return err
+	}
+
+	if err := store.StoreJoinToken(ctx, "k3s", clusterID, token); err != nil {
+		return fmt.Errorf("failed to store token in secret store: %w", err)
+	}
+	fmt.Printf("🔐 Token successfully stored in secret store for cluster %s\n", clusterID)
+	return nil
+}
+
+// rollbackPublish removes the records that mark a cluster as ready after its bootstrap failed.
+// The other records are overwritten by the server that bootstraps the cluster next.
+func rollbackPublish(ctx context.Context, store vault.SecretStore, clusterID string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, item := range []string{"token", "masters"} {
+		path := store.Paths().Metadata("k3s", clusterID, item)
+		if err := store.DeleteSecret(ctx, path); err != nil {
+			logger.Warn("Failed to roll back %s after the failed bootstrap, remove it before retrying: %v", path, err)
 		}
-		fmt.Printf("🔐 Kubeconfig successfully stored in secret store for cluster %s\n", clusterID)
 	}
+}
 
-	// Track master nodes in the secret store (for both new and existing clusters)
+// registerMaster adds this host to the cluster's master list. The secret store merges it into
+// the stored list atomically, so servers joining in parallel don't overwrite each other.
+func registerMaster(ctx context.Context, store vault.SecretStore, clusterID, hostname, vip string) error {
 	logger.Debug("Updating master node information in secret store")
+	if err := store.StoreMasterInfo(ctx, "k3s", clusterID, hostname, []string{hostname}, vip); err != nil {
+		return fmt.Errorf("failed to store master node info in secret store: %w", err)
+	}
 
-	// Try to get existing master nodes if any
-	var hosts []string
-	existingVIP := vip // Use provided VIP as default
+	masters, err := store.RetrieveMasterInfo(ctx, "k3s", clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to read back master node info from secret store: %w", err)
+	}
 
-	existingHosts, storedVIP, _, err := store.RetrieveMasterInfo("k3s", clusterID)
-	if err == nil {
-		hosts = existingHosts
-		if storedVIP != "" {
-			existingVIP = storedVIP
-		}
-		logger.Debug("%s", fmt.Sprintf("Found existing master nodes: %v", hosts))
-	} else {
-		hosts = []string{}
-		logger.Debug("No existing master nodes found, initializing new master list")
+	fmt.Printf("🔄 Master nodes updated in secret store: %d node(s) registered\n", len(masters.Hosts))
+	if masters.VIP != "" {
+		fmt.Printf("ℹ️ Load balancer VIP stored in secret store: %s\n", masters.VIP)
 	}
+	return nil
+}
+
+// claimBootstrap decides whether this server has to initialize the cluster identified by clusterID.
+// It returns a lease when this host won the bootstrap election, or nil when the cluster is ready
+// to be joined — either because it already existed or because another server finished bootstrapping it.
+// If the bootstrapping server gives up or crashes, its lock is released or expires and a waiting
+// server takes over. While it keeps renewing its lease, the others keep waiting.
+func claimBootstrap(ctx context.Context, store vault.SecretStore, clusterID, hostname string) (*vault.Lease, error) {
+	deadline := time.Now().Add(bootstrapWaitTimeout)
+	waiting := false
+	var heldUntil time.Time
 
-	// Add this host to the list if not already present
-	found := false
-	for _, h := range hosts {
-		if h == hostname {
-			found = true
-			break
+	for {
+		ready, err := clusterReady(ctx, store, clusterID)
+		if err != nil || ready {
+			return nil, err
+		}
+
+		lease, err := store.AcquireLock(ctx, "k3s", clusterID, bootstrapLock, hostname, bootstrapLockTTL)
+		if err == nil {
+			// The previous holder may have finished between our check and acquiring the lock
+			if ready, err := clusterReady(ctx, store, clusterID); err != nil || ready {
+				releaseBootstrap(ctx, store, lease)
+				return nil, err
+			}
+			return lease, nil
+		}
+		if !errors.Is(err, vault.ErrLockHeld) {
+			return nil, fmt.Errorf("failed to acquire bootstrap lock: %w", err)
+		}
+
+		// A renewed lease means the bootstrapping server is still installing
+		var held *vault.LockHeldError
+		if errors.As(err, &held) && held.ExpiresAt.After(heldUntil) {
+			if !heldUntil.IsZero() {
+				deadline = time.Now().Add(bootstrapWaitTimeout)
+			}
+			heldUntil = held.ExpiresAt
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for cluster %s to be bootstrapped: %w", clusterID, err)
+		}
+		if !waiting {
+			fmt.Printf("⏳ Cluster %s is being bootstrapped (%v), waiting to join...\n", clusterID, err)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(bootstrapPollInterval):
 		}
 	}
+}
 
-	if !found {
-		hosts = append(hosts, hostname)
-		logger.Debug("Added this host (%s) to master nodes list", hostname)
-	} else {
-		logger.Debug("This host (%s) is already in master nodes list", hostname)
+// clusterReady reports whether the cluster has been initialized: its join token is stored and
+// a first master is registered to join. The bootstrapping server stores the token last (see
+// publishCluster), so a cluster with only some of its records isn't ready to be joined.
+func clusterReady(ctx context.Context, store vault.SecretStore, clusterID string) (bool, error) {
+	if _, err := store.RetrieveJoinToken(ctx, "k3s", clusterID); err != nil {
+		if errors.Is(err, vault.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check for an existing join token: %w", err)
 	}
 
-	// Store updated master info with the VIP
-	err = store.StoreMasterInfo("k3s", clusterID, hostname, hosts, existingVIP)
+	firstMasterIP, err := store.RetrieveFirstMasterIP(ctx, "k3s", clusterID)
 	if err != nil {
-		return fmt.Errorf("failed to store master node info in secret store: %w", err)
+		if errors.Is(err, vault.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check for a registered master: %w", err)
 	}
+	return firstMasterIP != "", nil
+}
+
+// renewBootstrap extends the bootstrap lease every bootstrapRenewInterval until the returned
+// function is called, so the lock doesn't expire while this server is still installing.
+func renewBootstrap(ctx context.Context, store vault.SecretStore, lease *vault.Lease) func() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(bootstrapRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 
-	fmt.Printf("🔄 Master nodes updated in secret store: %d node(s) registered\n", len(hosts))
-	if existingVIP != "" {
-		fmt.Printf("ℹ️ Load balancer VIP stored in secret store: %s\n", existingVIP)
+			renewed, err := store.AcquireLock(ctx, lease.Distro, lease.ClusterID, lease.Name, lease.Holder, bootstrapLockTTL)
+			switch {
+			case errors.Is(err, vault.ErrLockHeld):
+				logger.Warn("Lost the bootstrap lock, another server may bootstrap the cluster too: %v", err)
+				return
+			case err != nil:
+				logger.Warn("Failed to renew the bootstrap lock, retrying: %v", err)
+			default:
+				logger.Debug("bootstrap lock renewed until %s", renewed.ExpiresAt.Format(time.RFC3339))
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
 	}
+}
 
-	return nil
+// releaseBootstrap gives up the bootstrap lock; failures only delay other servers until the lease expires.
+// The lock is released even when ctx was cancelled (e.g. Ctrl-C) so the others don't wait for the TTL.
+func releaseBootstrap(ctx context.Context, store vault.SecretStore, lease *vault.Lease) {
+	if err := store.ReleaseLock(context.WithoutCancel(ctx), lease); err != nil {
+		logger.Warn("Failed to release bootstrap lock (it expires at %s): %v", lease.ExpiresAt.Format(time.RFC3339), err)
+	}
 }
 
 // FetchTokenFromSecretStore fetches token from the secret store & sets as env var.
-// Also retrieves the first master's IP if joining an existing cluster.
-func FetchTokenFromSecretStore(store vault.SecretStore, clusterID string) (string, error) {
-	token, err := store.RetrieveJoinToken("k3s", clusterID)
+// Also retrieves the first master's IP to join; without one the install can't join the cluster.
+func FetchTokenFromSecretStore(ctx context.Context, store vault.SecretStore, clusterID string) (string, error) {
+	token, err := store.RetrieveJoinToken(ctx, "k3s", clusterID)
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve join token: %w", err)
 	}
@@ -152,17 +338,33 @@ func FetchTokenFromSecretStore(store vault.SecretStore, clusterID string) (strin
 	}
 
 	// Set token as environment variable for the bash script to use
-	_ = os.Setenv("K3S_TOKEN", token)
+	_ = os.Setenv("K3S_TOKEN", token.Token)
 	fmt.Println("✅ Set K3S_TOKEN environment variable")
 
-	// For additional master nodes, get the first master's IP
-	firstMasterIP, ipErr := store.RetrieveFirstMasterIP("k3s", clusterID)
-	if ipErr == nil && firstMasterIP != "" {
-		_ = os.Setenv("K3S_URL", fmt.Sprintf("https://%s:6443", firstMasterIP))
-		fmt.Printf("✅ Set K3S_URL environment variable: https://%s:6443\n", firstMasterIP)
-	} else if ipErr != nil {
-		logger.Debug("Could not find first master IP: %v", ipErr)
+	// Every server must be configured with the same agent token
+	agent, err := store.RetrieveAgentToken(ctx, "k3s", clusterID)
+	switch {
+	case err == nil:
+		_ = os.Setenv("K3S_AGENT_TOKEN", tokenSecret(agent.Token))
+		fmt.Println("✅ Set K3S_AGENT_TOKEN environment variable")
+	case errors.Is(err, vault.ErrNotFound):
+		// Clusters installed before agent tokens existed; agents can't join them until one is stored
+		logger.Warn("No agent token stored for cluster %s, agents can't join until one is configured", clusterID)
+	default:
+		return "", fmt.Errorf("failed to retrieve agent token: %w", err)
+	}
+
+	// A joining server must be pointed at an existing one; without it the install script
+	// bootstraps a second, separate cluster with the same token
+	firstMasterIP, err := store.RetrieveFirstMasterIP(ctx, "k3s", clusterID)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve the first master of cluster %s: %w", clusterID, err)
+	}
+	if firstMasterIP == "" {
+		return "", fmt.Errorf("no master is registered for cluster %s, so there is no server to join", clusterID)
 	}
+	_ = os.Setenv("K3S_URL", fmt.Sprintf("https://%s:6443", firstMasterIP))
+	fmt.Printf("✅ Set K3S_URL environment variable: https://%s:6443\n", firstMasterIP)
 
-	return token, nil
+	return token.Token, nil
 }
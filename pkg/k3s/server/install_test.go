@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/michielvha/edgectl/pkg/vault"
 )
@@ -19,18 +24,21 @@ func TestFetchTokenFromSecretStore_SetsEnvVars(t *testing.T) {
 	clusterIDDir = t.TempDir()
 
 	mock := &vault.MockStore{
-		RetrieveJoinTokenFunc: func(distro, clusterID string) (string, error) {
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
 			if clusterID != testClusterID {
 				t.Errorf("unexpected clusterID: %s", clusterID)
 			}
-			return testSecretToken, nil
+			return &vault.JoinToken{Token: testSecretToken}, nil
 		},
-		RetrieveFirstMasterIPFunc: func(distro, clusterID string) (string, error) {
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+			return &vault.AgentToken{Token: "K10abc123::node:agentsecret"}, nil
+		},
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
 			return "10.0.0.1", nil
 		},
 	}
 
-	token, err := FetchTokenFromSecretStore(mock, testClusterID)
+	token, err := FetchTokenFromSecretStore(t.Context(), mock, testClusterID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -42,39 +50,72 @@ func TestFetchTokenFromSecretStore_SetsEnvVars(t *testing.T) {
 	if got := os.Getenv("K3S_TOKEN"); got != testSecretToken {
 		t.Errorf("expected K3S_TOKEN=%q, got %q", testSecretToken, got)
 	}
+	if got := os.Getenv("K3S_AGENT_TOKEN"); got != "agentsecret" {
+		t.Errorf("expected K3S_AGENT_TOKEN='agentsecret', got %q", got)
+	}
 	if got := os.Getenv("K3S_URL"); got != "https://10.0.0.1:6443" {
 		t.Errorf("expected K3S_URL='https://10.0.0.1:6443', got %q", got)
 	}
 
 	t.Cleanup(func() {
-		os.Unsetenv("K3S_TOKEN") //nolint:errcheck // error irrelevant in test cleanup
-		os.Unsetenv("K3S_URL")   //nolint:errcheck // error irrelevant in test cleanup
+		os.Unsetenv("K3S_TOKEN")       //nolint:errcheck // error irrelevant in test cleanup
+		os.Unsetenv("K3S_AGENT_TOKEN") //nolint:errcheck // error irrelevant in test cleanup
+		os.Unsetenv("K3S_URL")         //nolint:errcheck // error irrelevant in test cleanup
 	})
 }
 
-// TestFetchTokenFromSecretStore_NoMasterIP verifies graceful handling
-// when no first master IP is available.
+// TestFetchTokenFromSecretStore_NoMasterIP verifies that a join without a first master to point
+// at fails, since the install would otherwise bootstrap a separate cluster with the same token.
 func TestFetchTokenFromSecretStore_NoMasterIP(t *testing.T) {
 	clusterIDDir = t.TempDir()
+	t.Cleanup(func() { os.Unsetenv("K3S_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
+
+	for name, firstMasterIP := range map[string]func() (string, error){
+		"lookup fails":      func() (string, error) { return "", fmt.Errorf("no master IP found") },
+		"no master":         func() (string, error) { return "", nil },
+		"no masters record": func() (string, error) { return "", fmt.Errorf("failed to retrieve master info: %w", vault.ErrNotFound) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := &vault.MockStore{
+				RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+					return &vault.JoinToken{Token: "token-abc"}, nil
+				},
+				RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+					return nil, vault.ErrNotFound
+				},
+				RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+					return firstMasterIP()
+				},
+			}
+
+			if _, err := FetchTokenFromSecretStore(t.Context(), mock, "cluster-1"); err == nil {
+				t.Error("expected an error without a first master to join")
+			}
+			if got := os.Getenv("K3S_URL"); got != "" {
+				t.Errorf("expected K3S_URL to stay unset, got %q", got)
+			}
+		})
+	}
+}
+
+// TestFetchTokenFromSecretStore_AgentTokenError verifies that failing to read the agent token
+// stops the install, since the server would otherwise be configured without it.
+func TestFetchTokenFromSecretStore_AgentTokenError(t *testing.T) {
+	clusterIDDir = t.TempDir()
+	t.Cleanup(func() { os.Unsetenv("K3S_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
 
 	mock := &vault.MockStore{
-		RetrieveJoinTokenFunc: func(distro, clusterID string) (string, error) {
-			return "token-abc", nil
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return &vault.JoinToken{Token: "token-abc"}, nil
 		},
-		RetrieveFirstMasterIPFunc: func(distro, clusterID string) (string, error) {
-			return "", fmt.Errorf("no master IP found")
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+			return nil, errors.New("permission denied")
 		},
 	}
 
-	token, err := FetchTokenFromSecretStore(mock, "cluster-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if token != "token-abc" {
-		t.Errorf("expected token 'token-abc', got %q", token)
+	if _, err := FetchTokenFromSecretStore(t.Context(), mock, "cluster-1"); err == nil {
+		t.Error("expected an error when the agent token can't be read")
 	}
-
-	t.Cleanup(func() { os.Unsetenv("K3S_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
 }
 
 // TestHostDeduplication verifies that adding an existing host doesn't duplicate it.
@@ -120,3 +161,267 @@ func TestHostDeduplication_NewHost(t *testing.T) {
 		t.Errorf("expected 3 hosts, got %d: %v", len(hosts), hosts)
 	}
 }
+
+// --- bootstrap election tests ---
+
+// fastBootstrapElection shortens the election timing for the duration of a test.
+func fastBootstrapElection(t *testing.T) {
+	t.Helper()
+	origWait, origPoll := bootstrapWaitTimeout, bootstrapPollInterval
+	bootstrapWaitTimeout, bootstrapPollInterval = time.Second, time.Millisecond
+	t.Cleanup(func() { bootstrapWaitTimeout, bootstrapPollInterval = origWait, origPoll })
+}
+
+func TestClaimBootstrap_ExistingClusterJoins(t *testing.T) {
+	mock := &vault.MockStore{
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+			return "10.0.0.1", nil
+		},
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return &vault.JoinToken{Token: "existing-token"}, nil
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease != nil {
+		t.Errorf("expected to join the existing cluster, got lease %v", lease)
+	}
+}
+
+func TestClaimBootstrap_WinsElection(t *testing.T) {
+	mock := &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return nil, fmt.Errorf("%w at path: token", vault.ErrNotFound)
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			if distro != "k3s" || name != bootstrapLock {
+				t.Errorf("unexpected lock %s/%s", distro, name)
+			}
+			return &vault.Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder}, nil
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease == nil || lease.Holder != "node-a" {
+		t.Errorf("expected node-a to win the election, got %v", lease)
+	}
+}
+
+func TestClaimBootstrap_LosesElectionAndWaitsForToken(t *testing.T) {
+	fastBootstrapElection(t)
+
+	checks := 0
+	mock := &vault.MockStore{
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+			return "10.0.0.1", nil
+		},
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			checks++
+			// The winner stores the token while we are waiting
+			if checks < 3 {
+				return nil, fmt.Errorf("%w at path: token", vault.ErrNotFound)
+			}
+			return &vault.JoinToken{Token: "winner-token"}, nil
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return nil, &vault.LockHeldError{Name: name, Holder: "node-b", ExpiresAt: time.Now().Add(time.Minute)}
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease != nil {
+		t.Errorf("expected to join after the winner bootstrapped, got lease %v", lease)
+	}
+}
+
+func TestClaimBootstrap_TokenAppearedBeforeLock(t *testing.T) {
+	checks := 0
+	released := false
+	mock := &vault.MockStore{
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+			return "10.0.0.1", nil
+		},
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			checks++
+			if checks == 1 {
+				return nil, fmt.Errorf("%w at path: token", vault.ErrNotFound)
+			}
+			return &vault.JoinToken{Token: "late-token"}, nil
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return &vault.Lease{Name: name, Holder: holder}, nil
+		},
+		ReleaseLockFunc: func(ctx context.Context, lease *vault.Lease) error {
+			released = true
+			return nil
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease != nil || !released {
+		t.Errorf("expected lock to be released and cluster joined, got lease=%v released=%v", lease, released)
+	}
+}
+
+func TestClaimBootstrap_TimesOut(t *testing.T) {
+	fastBootstrapElection(t)
+	bootstrapWaitTimeout = 0
+
+	mock := &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return nil, fmt.Errorf("%w at path: token", vault.ErrNotFound)
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return nil, &vault.LockHeldError{Name: name, Holder: "node-b"}
+		},
+	}
+
+	if _, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a"); !errors.Is(err, vault.ErrLockHeld) {
+		t.Fatalf("expected timeout wrapping ErrLockHeld, got %v", err)
+	}
+}
+
+func TestClaimBootstrap_StoreError(t *testing.T) {
+	mock := &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+
+	if _, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a"); err == nil {
+		t.Fatal("expected error when the secret store is unreachable")
+	}
+}
+
+// A join token without a registered master is a bootstrap that never finished: it isn't joined
+func TestClaimBootstrap_TokenWithoutMasterIsNotReady(t *testing.T) {
+	mock := &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return &vault.JoinToken{Token: "orphaned-token"}, nil
+		},
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+			return "", fmt.Errorf("failed to retrieve master info: %w", vault.ErrNotFound)
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return &vault.Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder}, nil
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease == nil {
+		t.Error("expected node-a to bootstrap the cluster instead of joining it")
+	}
+}
+
+func TestRollbackPublish(t *testing.T) {
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	steps := []error{
+		store.StoreAgentToken(t.Context(), "k3s", testClusterID, "K10abc::node:agent"),
+		store.StoreMasterInfo(t.Context(), "k3s", testClusterID, "node-a", []string{"node-a"}, ""),
+		store.StoreJoinToken(t.Context(), "k3s", testClusterID, "K10abc::server:secret"),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rollbackPublish(t.Context(), store, testClusterID)
+
+	if ready, err := clusterReady(t.Context(), store, testClusterID); err != nil || ready {
+		t.Errorf("expected the cluster not to look ready after the rollback, got %v (%v)", ready, err)
+	}
+	if _, err := store.RetrieveMasterInfo(t.Context(), "k3s", testClusterID); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected the master registration to be removed, got %v", err)
+	}
+}
+
+func TestClaimBootstrap_WaitsWhileLeaseIsRenewed(t *testing.T) {
+	fastBootstrapElection(t)
+	bootstrapWaitTimeout = 20 * time.Millisecond
+
+	// The holder renews its lease on every check and finishes well after the wait timeout
+	start := time.Now()
+	mock := &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			if time.Since(start) < 100*time.Millisecond {
+				return nil, fmt.Errorf("%w at path: token", vault.ErrNotFound)
+			}
+			return &vault.JoinToken{Token: "winner-token"}, nil
+		},
+		RetrieveFirstMasterIPFunc: func(ctx context.Context, distro, clusterID string) (string, error) {
+			return "10.0.0.1", nil
+		},
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return nil, &vault.LockHeldError{Name: name, Holder: "node-b", ExpiresAt: time.Now().Add(time.Minute)}
+		},
+	}
+
+	lease, err := claimBootstrap(t.Context(), mock, testClusterID, "node-a")
+	if err != nil {
+		t.Fatalf("expected to keep waiting while the lease is renewed, got %v", err)
+	}
+	if lease != nil {
+		t.Errorf("expected to join after the winner bootstrapped, got lease %v", lease)
+	}
+}
+
+func TestRenewBootstrap(t *testing.T) {
+	origInterval := bootstrapRenewInterval
+	bootstrapRenewInterval = time.Millisecond
+	t.Cleanup(func() { bootstrapRenewInterval = origInterval })
+
+	var mu sync.Mutex
+	renewals := 0
+	mock := &vault.MockStore{
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if holder != "node-a" || name != bootstrapLock || ttl != bootstrapLockTTL {
+				t.Errorf("unexpected renewal of %s by %s for %s", name, holder, ttl)
+			}
+			renewals++
+			return &vault.Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder, ExpiresAt: time.Now().Add(ttl)}, nil
+		},
+	}
+
+	stop := renewBootstrap(t.Context(), mock, &vault.Lease{Distro: "k3s", ClusterID: testClusterID, Name: bootstrapLock, Holder: "node-a"})
+	time.Sleep(20 * time.Millisecond)
+	stop()
+
+	mu.Lock()
+	got := renewals
+	mu.Unlock()
+	if got == 0 {
+		t.Fatal("expected the lease to be renewed")
+	}
+	time.Sleep(5 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if renewals != got {
+		t.Errorf("expected no renewals after stop, got %d more", renewals-got)
+	}
+}
+
+func TestInstall_VIPWithPort(t *testing.T) {
+	// The check runs before anything else, so the unset mock functions are never reached
+	err := Install(t.Context(), &vault.MockStore{}, "", false, "10.0.0.100:8443", 0)
+	if err == nil || !strings.Contains(err.Error(), "includes a port") {
+		t.Errorf("expected a VIP with a port to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package kubeconfig edits kubeconfig files as YAML documents.
+
+This file implements kubeconfigs for individual users instead of the shared admin kubeconfig:
+- NewRequest: Generates a private key and a certificate request for a Kubernetes user and groups
+- SignRequest: Signs a certificate request with the cluster's client CA as a client certificate
+- NewCredentials: Pairs a signed certificate with its key, reading its serial number and expiry
+- ForUser: Builds a kubeconfig for the cluster of an admin kubeconfig that authenticates as a user
+
+The API server maps the certificate's common name to the user and its organizations to the
+groups, so RBAC bindings and audit logs refer to the person instead of the cluster admin, and
+access ends when the certificate expires.
+*/
+package kubeconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// clockSkew backdates certificates so they are valid on API servers whose clock runs slightly behind.
+const clockSkew = 5 * time.Minute
+
+// Identity is the Kubernetes user a client certificate authenticates as.
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+// Credentials is a signed client certificate with its private key, both PEM encoded.
+type Credentials struct {
+	Certificate  []byte
+	Key          []byte
+	SerialNumber string
+	NotAfter     time.Time
+}
+
+// UserOptions controls ForUser.
+type UserOptions struct {
+	// Name names the cluster entry; usually the cluster ID
+	Name string
+	// User is the Kubernetes user the credentials authenticate as; the user and context entries
+	// are named "<User>@<Name>"
+	User        string
+	Credentials *Credentials
+}
+
+// NewRequest generates an ECDSA P-256 key and a PEM certificate request for id.
+// It returns the request and the PEM private key.
+func NewRequest(id Identity) ([]byte, []byte, error) {
+	if strings.TrimSpace(id.User) == "" {
+		return nil, nil, fmt.Errorf("a user name is required")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: id.User, Organization: id.Groups},
+	}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// SignRequest signs a PEM certificate request with a CA as a client certificate valid for ttl,
+// keeping the request's subject. The certificate never outlives the CA.
+func SignRequest(caCertPEM, caKeyPEM, csrPEM []byte, ttl time.Duration) ([]byte, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("the certificate lifetime must be positive, got %s", ttl)
+	}
+	caCert, err := parseCertificate(caCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %w", err)
+	}
+	caKey, err := parsePrivateKey(caKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key: %w", err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("invalid certificate request: no PEM CERTIFICATE REQUEST block")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request: %w", err)
+	}
+
+	now := time.Now()
+	if !now.Before(caCert.NotAfter) {
+		return nil, fmt.Errorf("the CA expired on %s", caCert.NotAfter.Format(time.DateTime))
+	}
+	notAfter := now.Add(ttl)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// NewCredentials pairs a PEM client certificate with its PEM key.
+func NewCredentials(certPEM, keyPEM []byte) (*Credentials, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return &Credentials{
+		Certificate:  certPEM,
+		Key:          keyPEM,
+		SerialNumber: formatSerial(cert.SerialNumber),
+		NotAfter:     cert.NotAfter,
+	}, nil
+}
+
+// ForUser builds a kubeconfig for the cluster the admin kubeconfig's current context points at,
+// authenticating with opts.Credentials. The admin user isn't copied. It returns the kubeconfig
+// and the name of its context.
+func ForUser(admin []byte, opts UserOptions) ([]byte, string, error) {
+	if opts.User == "" || opts.Credentials == nil {
+		return nil, "", fmt.Errorf("a user and credentials are required")
+	}
+	named, err := Rewrite(admin, Options{Name: opts.Name})
+	if err != nil {
+		return nil, "", err
+	}
+	_, source, err := parse(named)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clusterName := ""
+	current := scalar(source, "current-context")
+	for _, entry := range entries(source, "contexts") {
+		if scalar(entry, "name") == current {
+			clusterName = scalar(mappingValue(entry, "context"), "cluster")
+		}
+	}
+	var cluster *yaml.Node
+	for _, entry := range entries(source, "clusters") {
+		if cluster == nil || scalar(entry, "name") == clusterName {
+			cluster = entry
+		}
+	}
+	if cluster == nil {
+		return nil, "", fmt.Errorf("the kubeconfig has no cluster entry")
+	}
+	clusterName = scalar(cluster, "name")
+
+	name := opts.User + "@" + clusterName
+	user := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(user, "client-certificate-data", base64.StdEncoding.EncodeToString(opts.Credentials.Certificate))
+	setScalar(user, "client-key-data", base64.StdEncoding.EncodeToString(opts.Credentials.Key))
+	userEntry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(userEntry, "name", name)
+	setValue(userEntry, "user", user)
+
+	context := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(context, "cluster", clusterName)
+	setScalar(context, "user", name)
+	contextEntry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(contextEntry, "name", name)
+	setValue(contextEntry, "context", context)
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setScalar(root, "apiVersion", "v1")
+	setScalar(root, "kind", "Config")
+	sequence(root, "clusters").Content = []*yaml.Node{cluster}
+	sequence(root, "users").Content = []*yaml.Node{userEntry}
+	sequence(root, "contexts").Content = []*yaml.Node{contextEntry}
+	setScalar(root, "current-context", name)
+
+	data, err := encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+	return data, name, err
+}
+
+// parseCertificate decodes the first PEM certificate in data.
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM CERTIFICATE block")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parsePrivateKey decodes a PEM private key in PKCS#8, SEC 1 (EC) or PKCS#1 (RSA) form.
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported %s block", block.Type)
+}
+
+// formatSerial renders a serial number the way OpenBao does: colon-separated hex bytes.
+func formatSerial(serial *big.Int) string {
+	b := serial.Bytes()
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,166 @@
+package kubeconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newClientCA returns a PEM CA certificate and SEC 1 key like the client CA of an RKE2 server.
+func newClientCA(t *testing.T, validFor time.Duration) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rke2-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "rke2-client-ca"}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestSignRequest(t *testing.T) {
+	caCert, caKey := newClientCA(t, 365*24*time.Hour)
+	csr, _, err := NewRequest(Identity{User: "alice", Groups: []string{"ops", "dev"}})
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	certPEM, err := SignRequest(caCert, caKey, csr, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The groups end up in one DER set, which sorts them
+	groups := append([]string(nil), cert.Subject.Organization...)
+	sort.Strings(groups)
+	if cert.Subject.CommonName != "alice" || !equal(groups, []string{"dev", "ops"}) {
+		t.Errorf("expected the user and groups in the subject, got %v", cert.Subject)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth || cert.IsCA {
+		t.Errorf("expected a client certificate, got usages %v (CA %v)", cert.ExtKeyUsage, cert.IsCA)
+	}
+	if until := time.Until(cert.NotAfter); until < 23*time.Hour || until > 24*time.Hour {
+		t.Errorf("expected the certificate to expire in 24h, got %s", until)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected the certificate to chain to the client CA: %v", err)
+	}
+}
+
+func TestSignRequest_CappedByCA(t *testing.T) {
+	caCert, caKey := newClientCA(t, time.Hour)
+	csr, _, _ := NewRequest(Identity{User: "alice"})
+	certPEM, err := SignRequest(caCert, caKey, csr, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+	cert, _ := parseCertificate(certPEM)
+	ca, _ := parseCertificate(caCert)
+	if cert.NotAfter.After(ca.NotAfter) {
+		t.Errorf("expected the certificate not to outlive the CA, got %s after %s", cert.NotAfter, ca.NotAfter)
+	}
+}
+
+func TestSignRequest_Errors(t *testing.T) {
+	caCert, caKey := newClientCA(t, time.Hour)
+	_, otherKey := newClientCA(t, time.Hour)
+	expiredCert, expiredKey := newClientCA(t, -time.Minute)
+	csr, _, _ := NewRequest(Identity{User: "alice"})
+
+	tests := []struct {
+		name          string
+		cert, key     []byte
+		csr           []byte
+		ttl           time.Duration
+		wantSubstring string
+	}{
+		{name: "zero TTL", cert: caCert, key: caKey, csr: csr, ttl: 0, wantSubstring: "must be positive"},
+		{name: "expired CA", cert: expiredCert, key: expiredKey, csr: csr, ttl: time.Hour, wantSubstring: "expired"},
+		{name: "key of another CA", cert: caCert, key: otherKey, csr: csr, ttl: time.Hour, wantSubstring: "failed to sign"},
+		{name: "not a CSR", cert: caCert, key: caKey, csr: caCert, ttl: time.Hour, wantSubstring: "invalid certificate request"},
+		{name: "not a key", cert: caCert, key: []byte("key"), csr: csr, ttl: time.Hour, wantSubstring: "invalid CA key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SignRequest(tt.cert, tt.key, tt.csr, tt.ttl)
+			if err == nil || !strings.Contains(err.Error(), tt.wantSubstring) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantSubstring, err)
+			}
+		})
+	}
+
+	if _, _, err := NewRequest(Identity{User: " "}); err == nil {
+		t.Error("expected a request without a user to fail")
+	}
+}
+
+func TestForUser(t *testing.T) {
+	caCert, caKey := newClientCA(t, time.Hour)
+	csr, key, _ := NewRequest(Identity{User: "alice"})
+	cert, err := SignRequest(caCert, caKey, csr, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := NewCredentials(cert, key)
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	if creds.SerialNumber == "" || creds.NotAfter.IsZero() {
+		t.Errorf("expected the serial number and expiry to be read, got %+v", creds)
+	}
+
+	admin := strings.Replace(rke2Kubeconfig, "127.0.0.1", "10.0.0.100", 1)
+	data, context, err := ForUser([]byte(admin), UserOptions{Name: "rke2-abc", User: "alice", Credentials: creds})
+	if err != nil {
+		t.Fatalf("ForUser: %v", err)
+	}
+	kc := decode(t, data)
+
+	if context != "alice@rke2-abc" || kc.CurrentContext != context {
+		t.Errorf("expected context alice@rke2-abc, got %q (current %q)", context, kc.CurrentContext)
+	}
+	clusters, users, contexts := names(kc)
+	if !equal(clusters, []string{"rke2-abc"}) || !equal(users, []string{"alice@rke2-abc"}) || !equal(contexts, []string{"alice@rke2-abc"}) {
+		t.Errorf("expected only the user's entries, got %v %v %v", clusters, users, contexts)
+	}
+	if c := kc.Clusters[0].Cluster; c.Server != "https://10.0.0.100:6443" || c.CAData == "" {
+		t.Errorf("expected the cluster entry of the admin kubeconfig, got %+v", c)
+	}
+	if kc.Users[0].User.KeyData != base64.StdEncoding.EncodeToString(key) {
+		t.Errorf("expected the user's key instead of the admin's, got %q", kc.Users[0].User.KeyData)
+	}
+	// Only the CA data of the cluster entry is left of the admin kubeconfig
+	if strings.Count(string(data), "LS0tLS1CRUdJTi...") != 1 {
+		t.Errorf("expected the admin credentials to be left out:\n%s", data)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package kubeconfig edits kubeconfig files as YAML documents.
+
+This file implements the rewrite applied before a kubeconfig is shared through the secret store:
+- Rewrite: Points every cluster's server at the VIP or load balancer and names the entries after the cluster
+- ParseEndpoint: Splits a VIP given as a host, host:port or IPv6 address
+
+The document is edited as a YAML node tree rather than decoded into structs, so fields edgectl
+doesn't know about (certificate data, exec plugins, extensions) are kept as they are.
+*/
+package kubeconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ErrNoServer is returned by Rewrite when a server endpoint is given but no cluster entry has
+// a server to point at it.
+var ErrNoServer = errors.New("the kubeconfig has no cluster server entry to rewrite")
+
+// Options controls Rewrite.
+type Options struct {
+	// Server is the API endpoint every cluster is pointed at: a host name or IP address with an
+	// optional port (see ParseEndpoint). Without a port the port of each server URL is kept.
+	// Empty leaves the servers unchanged.
+	Server string
+	// Port replaces the port of every server URL; it needs Server and can't be combined with a port
+	// in it. 0 keeps the port.
+	Port int
+	// Name renames the cluster, user and context entries and the current context; a kubeconfig
+	// holding several entries of a kind gets them named "<Name>-<old name>". Empty keeps the names.
+	Name string
+}
+
+// ParseEndpoint splits an endpoint into host and port: "10.0.0.100", "lb.example.com:8443",
+// "fd00::100" and "[fd00::100]:6443" are all accepted. The port is empty when none is given.
+func ParseEndpoint(endpoint string) (string, string, error) {
+	if endpoint == "" {
+		return "", "", fmt.Errorf("the endpoint is empty")
+	}
+	if host, port, err := net.SplitHostPort(endpoint); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port %q in endpoint %q", port, endpoint)
+		}
+		if host == "" {
+			return "", "", fmt.Errorf("endpoint %q has no host", endpoint)
+		}
+		return host, port, nil
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(endpoint, "["), "]")
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", "", fmt.Errorf("invalid endpoint %q (expected a host, host:port or an IPv6 address)", endpoint)
+	}
+	if strings.ContainsAny(host, "/[] ") {
+		return "", "", fmt.Errorf("invalid endpoint %q (expected a host, host:port or an IPv6 address)", endpoint)
+	}
+	return host, "", nil
+}
+
+// Rewrite returns the kubeconfig in data with its cluster servers and entry names changed as
+// opts asks. A server endpoint that matches no cluster entry is an ErrNoServer error, so a
+// kubeconfig that would keep pointing at 127.0.0.1 isn't shared by accident.
+func Rewrite(data []byte, opts Options) ([]byte, error) {
+	doc, root, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Port != 0 && opts.Server == "" {
+		return nil, fmt.Errorf("port %d needs a server endpoint", opts.Port)
+	}
+	if opts.Server != "" {
+		host, port, err := ParseEndpoint(opts.Server)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Port != 0 {
+			if port != "" {
+				return nil, fmt.Errorf("endpoint %q already has a port, so port %d can't be applied", opts.Server, opts.Port)
+			}
+			if opts.Port < 1 || opts.Port > 65535 {
+				return nil, fmt.Errorf("invalid port %d", opts.Port)
+			}
+			port = strconv.Itoa(opts.Port)
+		}
+		rewritten := 0
+		for _, entry := range entries(root, "clusters") {
+			server := mappingValue(mappingValue(entry, "cluster"), "server")
+			if server == nil || server.Value == "" {
+				continue
+			}
+			if server.Value, err = rewriteServer(server.Value, host, port); err != nil {
+				return nil, fmt.Errorf("cluster %q: %w", scalar(entry, "name"), err)
+			}
+			rewritten++
+		}
+		if rewritten == 0 {
+			return nil, ErrNoServer
+		}
+	}
+
+	if opts.Name != "" {
+		clusters := rename(entries(root, "clusters"), opts.Name)
+		users := rename(entries(root, "users"), opts.Name)
+		contexts := rename(entries(root, "contexts"), opts.Name)
+		for _, entry := range entries(root, "contexts") {
+			context := mappingValue(entry, "context")
+			renameReference(mappingValue(context, "cluster"), clusters)
+			renameReference(mappingValue(context, "user"), users)
+		}
+		renameReference(mappingValue(root, "current-context"), contexts)
+	}
+
+	return encode(doc)
+}
+
+// rewriteServer replaces the host (and, when given, the port) of a server URL.
+func rewriteServer(server, host, port string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q", server)
+	}
+	if port == "" {
+		port = u.Port()
+	}
+	if port == "" {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	return u.String(), nil
+}
+
+// rename names the entries after name and returns the new names by old name.
+func rename(list []*yaml.Node, name string) map[string]string {
+	renamed := map[string]string{}
+	for _, entry := range list {
+		node := mappingValue(entry, "name")
+		if node == nil {
+			continue
+		}
+		newName := name
+		if len(list) > 1 && node.Value != name {
+			newName = name + "-" + node.Value
+		}
+		renamed[node.Value] = newName
+		node.Value = newName
+	}
+	return renamed
+}
+
+// renameReference updates a scalar that refers to an entry renamed by rename.
+func renameReference(node *yaml.Node, renamed map[string]string) {
+	if node == nil {
+		return
+	}
+	if newName, ok := renamed[node.Value]; ok {
+		node.Value = newName
+	}
+}
+
+// parse decodes a kubeconfig, returning the document node and its top-level mapping.
+func parse(data []byte) (*yaml.Node, *yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("failed to parse kubeconfig: expected a YAML mapping")
+	}
+	return &doc, doc.Content[0], nil
+}
+
+// encode renders a document with the two-space indentation kubectl uses.
+func encode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// entries returns the mappings in the top-level list key (clusters, users or contexts).
+func entries(root *yaml.Node, key string) []*yaml.Node {
+	list := mappingValue(root, key)
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var result []*yaml.Node
+	for _, entry := range list.Content {
+		if entry.Kind == yaml.MappingNode {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalar returns the string value of key in a mapping node, or "".
+func scalar(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
@@ -0,0 +1,245 @@
+package kubeconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// rke2Kubeconfig is the kubeconfig an RKE2 server writes to /etc/rancher/rke2/rke2.yaml.
+const rke2Kubeconfig = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: LS0tLS1CRUdJTi...
+    server: https://127.0.0.1:6443
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+kind: Config
+preferences: {}
+users:
+- name: default
+  user:
+    client-certificate-data: LS0tLS1CRUdJTi...
+    client-key-data: LS0tLS1CRUdJTi...
+`
+
+// decoded is the subset of a kubeconfig the tests check.
+type decoded struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server string `yaml:"server"`
+			CAData string `yaml:"certificate-authority-data"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			KeyData string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func rewrite(t *testing.T, input string, opts Options) decoded {
+	t.Helper()
+	out, err := Rewrite([]byte(input), opts)
+	if err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	var kc decoded
+	if err := yaml.Unmarshal(out, &kc); err != nil {
+		t.Fatalf("the rewritten kubeconfig doesn't parse: %v\n%s", err, out)
+	}
+	return kc
+}
+
+func TestRewrite_Server(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		server string
+		port   int
+		want   string
+	}{
+		{name: "VIP", input: rke2Kubeconfig, server: "10.0.0.100", want: "https://10.0.0.100:6443"},
+		{name: "VIP with port option", input: rke2Kubeconfig, server: "10.0.0.100", port: 8443, want: "https://10.0.0.100:8443"},
+		{name: "IPv6 VIP with port option", input: rke2Kubeconfig, server: "fd00::100", port: 8443, want: "https://[fd00::100]:8443"},
+		{name: "host name with port", input: rke2Kubeconfig, server: "lb.example.com:8443", want: "https://lb.example.com:8443"},
+		{name: "IPv6 VIP", input: rke2Kubeconfig, server: "fd00::100", want: "https://[fd00::100]:6443"},
+		{name: "IPv6 VIP with port", input: rke2Kubeconfig, server: "[fd00::100]:7443", want: "https://[fd00::100]:7443"},
+		{
+			name:   "localhost on another port",
+			input:  strings.Replace(rke2Kubeconfig, "127.0.0.1:6443", "localhost:16443", 1),
+			server: "10.0.0.100",
+			want:   "https://10.0.0.100:16443",
+		},
+		{
+			name:   "IPv6 loopback",
+			input:  strings.Replace(rke2Kubeconfig, "127.0.0.1:6443", "[::1]:6443", 1),
+			server: "10.0.0.100",
+			want:   "https://10.0.0.100:6443",
+		},
+		{
+			name:   "no port",
+			input:  strings.Replace(rke2Kubeconfig, "127.0.0.1:6443", "api.internal", 1),
+			server: "fd00::100",
+			want:   "https://[fd00::100]",
+		},
+		{
+			name: "other indentation and quoting",
+			input: `apiVersion: v1
+clusters:
+    -   name: "default"
+        cluster:
+            server: "https://127.0.0.1:6443"
+`,
+			server: "10.0.0.100",
+			want:   "https://10.0.0.100:6443",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := rewrite(t, tt.input, Options{Server: tt.server, Port: tt.port})
+			if len(kc.Clusters) != 1 || kc.Clusters[0].Cluster.Server != tt.want {
+				t.Errorf("expected server %s, got %+v", tt.want, kc.Clusters)
+			}
+		})
+	}
+}
+
+func TestRewrite_EveryCluster(t *testing.T) {
+	input := `clusters:
+- name: a
+  cluster:
+    server: https://127.0.0.1:6443
+- name: b
+  cluster:
+    server: https://10.0.0.1:9345
+- name: c
+  cluster: {}
+`
+	kc := rewrite(t, input, Options{Server: "10.0.0.100"})
+	got := []string{kc.Clusters[0].Cluster.Server, kc.Clusters[1].Cluster.Server, kc.Clusters[2].Cluster.Server}
+	want := []string{"https://10.0.0.100:6443", "https://10.0.0.100:9345", ""}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cluster %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestRewrite_Name(t *testing.T) {
+	kc := rewrite(t, rke2Kubeconfig, Options{Server: "10.0.0.100", Name: "rke2-abc123"})
+
+	if kc.Clusters[0].Name != "rke2-abc123" || kc.Users[0].Name != "rke2-abc123" || kc.Contexts[0].Name != "rke2-abc123" {
+		t.Errorf("expected the entries to be named after the cluster, got %+v", kc)
+	}
+	if ctx := kc.Contexts[0].Context; ctx.Cluster != "rke2-abc123" || ctx.User != "rke2-abc123" {
+		t.Errorf("expected the context to refer to the renamed entries, got %+v", ctx)
+	}
+	if kc.CurrentContext != "rke2-abc123" {
+		t.Errorf("expected the current context to be renamed, got %q", kc.CurrentContext)
+	}
+	// Everything else is kept
+	if kc.Clusters[0].Cluster.CAData == "" || kc.Users[0].User.KeyData == "" {
+		t.Errorf("expected the certificate data to be kept, got %+v", kc)
+	}
+}
+
+func TestRewrite_NameSeveralEntries(t *testing.T) {
+	input := `clusters:
+- name: one
+  cluster: {server: "https://127.0.0.1:6443"}
+- name: two
+  cluster: {server: "https://127.0.0.1:6443"}
+contexts:
+- name: one
+  context: {cluster: two, user: admin}
+current-context: one
+users:
+- name: admin
+  user: {}
+`
+	kc := rewrite(t, input, Options{Name: "c1"})
+	if kc.Clusters[0].Name != "c1-one" || kc.Clusters[1].Name != "c1-two" {
+		t.Errorf("expected the clusters to keep distinct names, got %+v", kc.Clusters)
+	}
+	if ctx := kc.Contexts[0]; ctx.Name != "c1" || ctx.Context.Cluster != "c1-two" || ctx.Context.User != "c1" {
+		t.Errorf("expected the context references to follow the renames, got %+v", ctx)
+	}
+	if kc.CurrentContext != "c1" {
+		t.Errorf("expected the current context to be renamed, got %q", kc.CurrentContext)
+	}
+}
+
+func TestRewrite_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		server string
+		port   int
+		check  func(error) bool
+	}{
+		{name: "no clusters", input: "apiVersion: v1\nclusters: []\n", server: "10.0.0.100", check: func(err error) bool { return errors.Is(err, ErrNoServer) }},
+		{name: "no server field", input: "clusters:\n- name: a\n  cluster: {}\n", server: "10.0.0.100", check: func(err error) bool { return errors.Is(err, ErrNoServer) }},
+		{name: "not YAML", input: "clusters: [", server: "10.0.0.100", check: func(err error) bool { return strings.Contains(err.Error(), "failed to parse") }},
+		{name: "not a mapping", input: "- a\n- b\n", check: func(err error) bool { return strings.Contains(err.Error(), "expected a YAML mapping") }},
+		{name: "invalid endpoint", input: rke2Kubeconfig, server: "https://10.0.0.100", check: func(err error) bool { return strings.Contains(err.Error(), "invalid") }},
+		{name: "invalid port", input: rke2Kubeconfig, server: "10.0.0.100:99999", check: func(err error) bool { return strings.Contains(err.Error(), "invalid port") }},
+		{name: "invalid port option", input: rke2Kubeconfig, server: "10.0.0.100", port: 70000, check: func(err error) bool { return strings.Contains(err.Error(), "invalid port") }},
+		{name: "port option and port in server", input: rke2Kubeconfig, server: "10.0.0.100:8443", port: 9443, check: func(err error) bool { return strings.Contains(err.Error(), "already has a port") }},
+		{name: "port option without server", input: rke2Kubeconfig, port: 8443, check: func(err error) bool { return strings.Contains(err.Error(), "needs a server") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Rewrite([]byte(tt.input), Options{Server: tt.server, Port: tt.port, Name: "c1"})
+			if err == nil || !tt.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	// Without a server endpoint there is nothing to validate
+	if _, err := Rewrite([]byte("apiVersion: v1\nclusters: []\n"), Options{Name: "c1"}); err != nil {
+		t.Errorf("expected renaming an empty kubeconfig to work, got %v", err)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint, host, port string
+	}{
+		{"10.0.0.100", "10.0.0.100", ""},
+		{"10.0.0.100:6443", "10.0.0.100", "6443"},
+		{"lb.example.com", "lb.example.com", ""},
+		{"fd00::100", "fd00::100", ""},
+		{"[fd00::100]", "fd00::100", ""},
+		{"[fd00::100]:6443", "fd00::100", "6443"},
+	}
+	for _, tt := range tests {
+		host, port, err := ParseEndpoint(tt.endpoint)
+		if err != nil || host != tt.host || port != tt.port {
+			t.Errorf("%q: expected %q %q, got %q %q (%v)", tt.endpoint, tt.host, tt.port, host, port, err)
+		}
+	}
+	for _, endpoint := range []string{"", ":6443", "fd00::100::1", "10.0.0.100:http", "lb example"} {
+		if _, _, err := ParseEndpoint(endpoint); err == nil {
+			t.Errorf("%q: expected an error", endpoint)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package kubeconfig edits kubeconfig files as YAML documents.
+
+This file implements saving a fetched kubeconfig next to the ones an operator already has:
+- Merge: Inserts or updates the cluster, user and context of a kubeconfig in another one
+- Save: Merges into (or replaces) a kubeconfig file, keeping a backup of the previous file
+
+Entries are matched by name, so fetching the kubeconfig of a cluster again updates its entries
+instead of adding duplicates, and the entries of every other cluster are left alone.
+*/
+package kubeconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// BackupSuffix is appended to the path of a kubeconfig to name the copy Save keeps.
+const BackupSuffix = ".bak"
+
+// MergeOptions controls how a kubeconfig is merged into another.
+type MergeOptions struct {
+	// Name names the cluster, user and context entries (see Options.Name); usually the cluster ID
+	Name string
+	// ContextName overrides the name of the context; empty uses Name
+	ContextName string
+	// SwitchContext makes the merged context the current context. A kubeconfig without a
+	// current context always gets one.
+	SwitchContext bool
+}
+
+// SaveOptions controls Save.
+type SaveOptions struct {
+	MergeOptions
+	// Replace overwrites an existing file instead of merging into it
+	Replace bool
+}
+
+// SaveResult describes what Save did.
+type SaveResult struct {
+	// Context is the name of the saved context
+	Context string
+	// Merged is set when the kubeconfig was merged into an existing file
+	Merged bool
+	// Backup is the path of the copy of the previous file, if there was one
+	Backup string
+}
+
+// Merge returns existing with the clusters, users and contexts of incoming added, after naming
+// them as opts asks. Entries with the same name are replaced in place.
+func Merge(existing, incoming []byte, opts MergeOptions) ([]byte, error) {
+	merged, _, err := merge(existing, incoming, opts)
+	return merged, err
+}
+
+// Save writes the kubeconfig incoming to path, named as opts asks. An existing file is merged
+// into unless opts.Replace is set; either way it is first copied to path+BackupSuffix.
+// The file is replaced atomically and only readable by its owner.
+func Save(path string, incoming []byte, opts SaveOptions) (*SaveResult, error) {
+	existing, err := os.ReadFile(path) //nolint:gosec // path comes from trusted CLI input
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read kubeconfig '%s': %w", path, err)
+	}
+	exists := err == nil
+
+	result := &SaveResult{Merged: exists && !opts.Replace}
+	var data []byte
+	if result.Merged {
+		data, result.Context, err = merge(existing, incoming, opts.MergeOptions)
+	} else {
+		data, result.Context, err = merge(nil, incoming, opts.MergeOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create directory '%s': %w", dir, err)
+	}
+	if exists {
+		result.Backup = path + BackupSuffix
+		if err := writeAtomic(result.Backup, existing); err != nil {
+			return nil, fmt.Errorf("failed to back up kubeconfig to '%s': %w", result.Backup, err)
+		}
+	}
+	if err := writeAtomic(path, data); err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig to path '%s': %w", path, err)
+	}
+	return result, nil
+}
+
+// merge implements Merge and also returns the name of the merged context.
+func merge(existing, incoming []byte, opts MergeOptions) ([]byte, string, error) {
+	named, err := Rewrite(incoming, Options{Name: opts.Name})
+	if err != nil {
+		return nil, "", err
+	}
+	_, source, err := parse(named)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.ContextName != "" {
+		contexts := rename(entries(source, "contexts"), opts.ContextName)
+		renameReference(mappingValue(source, "current-context"), contexts)
+	}
+	context := scalar(source, "current-context")
+	if context == "" {
+		if list := entries(source, "contexts"); len(list) > 0 {
+			context = scalar(list[0], "name")
+		}
+	}
+
+	if len(bytes.TrimSpace(existing)) == 0 {
+		existing = []byte("apiVersion: v1\nkind: Config\n")
+	}
+	doc, target, err := parse(existing)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, key := range []string{"clusters", "users", "contexts"} {
+		list := sequence(target, key)
+		for _, entry := range entries(source, key) {
+			upsert(list, entry)
+		}
+	}
+	if current := scalar(target, "current-context"); context != "" && (opts.SwitchContext || current == "") {
+		setScalar(target, "current-context", context)
+	}
+
+	data, err := encode(doc)
+	return data, context, err
+}
+
+// upsert replaces the entry of list with the same name as entry, or appends entry.
+func upsert(list, entry *yaml.Node) {
+	name := scalar(entry, "name")
+	for i, existing := range list.Content {
+		if existing.Kind == yaml.MappingNode && scalar(existing, "name") == name {
+			list.Content[i] = entry
+			return
+		}
+	}
+	list.Content = append(list.Content, entry)
+}
+
+// sequence returns the list under key in a mapping node, adding an empty one if there is none.
+func sequence(node *yaml.Node, key string) *yaml.Node {
+	list := mappingValue(node, key)
+	if list == nil || list.Kind != yaml.SequenceNode {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setValue(node, key, list)
+	}
+	// An empty list may be written as [], which would keep the entries added to it on one line
+	list.Style = 0
+	return list
+}
+
+// setScalar sets key in a mapping node to a string.
+func setScalar(node *yaml.Node, key, value string) {
+	setValue(node, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// setValue sets key in a mapping node, replacing its value or adding the key.
+func setValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it into place, so a
+// failed write never leaves a truncated kubeconfig behind.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
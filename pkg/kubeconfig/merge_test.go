@@ -0,0 +1,208 @@
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// operatorKubeconfig is a kubeconfig an operator already has, for another cluster.
+const operatorKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+users:
+- name: prod-admin
+  user:
+    token: prod-token
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod-admin
+current-context: prod
+`
+
+func decode(t *testing.T, data []byte) decoded {
+	t.Helper()
+	var kc decoded
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		t.Fatalf("the kubeconfig doesn't parse: %v\n%s", err, data)
+	}
+	return kc
+}
+
+func names(kc decoded) (clusters, users, contexts []string) {
+	for _, c := range kc.Clusters {
+		clusters = append(clusters, c.Name)
+	}
+	for _, u := range kc.Users {
+		users = append(users, u.Name)
+	}
+	for _, c := range kc.Contexts {
+		contexts = append(contexts, c.Name)
+	}
+	return clusters, users, contexts
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMerge_KeepsOtherClusters(t *testing.T) {
+	merged, err := Merge([]byte(operatorKubeconfig), []byte(rke2Kubeconfig), MergeOptions{Name: "rke2-abc"})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	kc := decode(t, merged)
+
+	clusters, users, contexts := names(kc)
+	if !equal(clusters, []string{"prod", "rke2-abc"}) || !equal(users, []string{"prod-admin", "rke2-abc"}) || !equal(contexts, []string{"prod", "rke2-abc"}) {
+		t.Errorf("expected the prod entries and the new cluster's, got %v %v %v", clusters, users, contexts)
+	}
+	if kc.CurrentContext != "prod" {
+		t.Errorf("expected the current context to be kept, got %q", kc.CurrentContext)
+	}
+	if ctx := kc.Contexts[1].Context; ctx.Cluster != "rke2-abc" || ctx.User != "rke2-abc" {
+		t.Errorf("expected the new context to refer to the new entries, got %+v", ctx)
+	}
+}
+
+func TestMerge_UpdatesExistingEntries(t *testing.T) {
+	first, err := Merge([]byte(operatorKubeconfig), []byte(rke2Kubeconfig), MergeOptions{Name: "rke2-abc"})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	rotated := []byte(`clusters:
+- name: default
+  cluster:
+    server: https://10.0.0.100:6443
+users:
+- name: default
+  user:
+    client-key-data: rotated
+contexts:
+- name: default
+  context: {cluster: default, user: default}
+current-context: default
+`)
+	second, err := Merge(first, rotated, MergeOptions{Name: "rke2-abc"})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	kc := decode(t, second)
+
+	clusters, users, contexts := names(kc)
+	if !equal(clusters, []string{"prod", "rke2-abc"}) || !equal(users, []string{"prod-admin", "rke2-abc"}) || !equal(contexts, []string{"prod", "rke2-abc"}) {
+		t.Errorf("expected fetching again not to add entries, got %v %v %v", clusters, users, contexts)
+	}
+	if kc.Clusters[1].Cluster.Server != "https://10.0.0.100:6443" || kc.Users[1].User.KeyData != "rotated" {
+		t.Errorf("expected the entries to be updated, got %+v", kc)
+	}
+}
+
+func TestMerge_ContextOptions(t *testing.T) {
+	merged, err := Merge([]byte(operatorKubeconfig), []byte(rke2Kubeconfig), MergeOptions{Name: "rke2-abc", ContextName: "edge-site-1", SwitchContext: true})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	kc := decode(t, merged)
+
+	if kc.CurrentContext != "edge-site-1" {
+		t.Errorf("expected the current context to switch, got %q", kc.CurrentContext)
+	}
+	_, _, contexts := names(kc)
+	if !equal(contexts, []string{"prod", "edge-site-1"}) {
+		t.Errorf("expected the context to be named edge-site-1, got %v", contexts)
+	}
+	if ctx := kc.Contexts[1].Context; ctx.Cluster != "rke2-abc" || ctx.User != "rke2-abc" {
+		t.Errorf("expected the cluster and user to keep the cluster ID, got %+v", ctx)
+	}
+}
+
+func TestMerge_EmptyDestination(t *testing.T) {
+	for _, existing := range []string{"", "\n", "apiVersion: v1\nclusters: []\n"} {
+		merged, err := Merge([]byte(existing), []byte(rke2Kubeconfig), MergeOptions{Name: "c1"})
+		if err != nil {
+			t.Fatalf("Merge into %q: %v", existing, err)
+		}
+		kc := decode(t, merged)
+		if len(kc.Clusters) != 1 || len(kc.Users) != 1 || len(kc.Contexts) != 1 || kc.CurrentContext != "c1" {
+			t.Errorf("expected one cluster as the current context when merging into %q, got %+v", existing, kc)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".kube", "config")
+
+	// A new file is created without a backup
+	result, err := Save(path, []byte(rke2Kubeconfig), SaveOptions{MergeOptions: MergeOptions{Name: "c1"}})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if result.Merged || result.Backup != "" || result.Context != "c1" {
+		t.Errorf("unexpected result for a new file: %+v", result)
+	}
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o600) {
+		t.Errorf("expected a file only readable by its owner, got %v (%v)", info, err)
+	}
+
+	// An existing file is merged into and backed up
+	if err := os.WriteFile(path, []byte(operatorKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	result, err = Save(path, []byte(rke2Kubeconfig), SaveOptions{MergeOptions: MergeOptions{Name: "c1"}})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !result.Merged || result.Backup != path+BackupSuffix {
+		t.Errorf("unexpected result for a merge: %+v", result)
+	}
+	if backup, _ := os.ReadFile(path + BackupSuffix); string(backup) != operatorKubeconfig {
+		t.Errorf("expected the previous file to be backed up, got:\n%s", backup)
+	}
+	saved, _ := os.ReadFile(path)
+	if clusters, _, _ := names(decode(t, saved)); !equal(clusters, []string{"prod", "c1"}) {
+		t.Errorf("expected both clusters after merging, got %v", clusters)
+	}
+
+	// Replace drops the other clusters, but still keeps a backup
+	result, err = Save(path, []byte(rke2Kubeconfig), SaveOptions{MergeOptions: MergeOptions{Name: "c1"}, Replace: true})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved, _ = os.ReadFile(path)
+	if clusters, _, _ := names(decode(t, saved)); result.Merged || !equal(clusters, []string{"c1"}) {
+		t.Errorf("expected only the fetched cluster after replacing, got %v (%+v)", clusters, result)
+	}
+	if backup, _ := os.ReadFile(path + BackupSuffix); len(decode(t, backup).Clusters) != 2 {
+		t.Errorf("expected the merged file to be backed up before replacing it")
+	}
+}
+
+func TestSave_InvalidDestination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("clusters: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Save(path, []byte(rke2Kubeconfig), SaveOptions{MergeOptions: MergeOptions{Name: "c1"}}); err == nil {
+		t.Fatal("expected merging into an invalid kubeconfig to fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "clusters: [" {
+		t.Errorf("expected the destination to be left alone, got %q", data)
+	}
+}
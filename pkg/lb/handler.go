@@ -4,12 +4,16 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package lb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/michielvha/edgectl/pkg/backup"
 	"github.com/michielvha/edgectl/pkg/logger"
 	vault "github.com/michielvha/edgectl/pkg/vault"
 )
@@ -17,6 +21,35 @@ import (
 // lookupIP is a package-level variable wrapping net.LookupIP so tests can inject a stub.
 var lookupIP = net.LookupIP
 
+// getHostname and detectInterface are package-level variables so tests can act as any node.
+var (
+	getHostname     = os.Hostname
+	detectInterface = detectInterfaceForVIP
+)
+
+// Configuration files written by BootstrapLB.
+const (
+	haproxyConfigPath    = "/etc/haproxy/haproxy.cfg"
+	keepalivedConfigPath = "/etc/keepalived/keepalived.conf"
+)
+
+// electionLock is the name of the lock load balancers take while deciding MASTER vs BACKUP.
+const electionLock = "lb-election"
+
+// LB election timing. Tests can override these.
+var (
+	electionLockTTL      = 2 * time.Minute
+	electionWaitTimeout  = 5 * time.Minute
+	electionPollInterval = 2 * time.Second
+)
+
+// Options controls how a load balancer is created or cleaned up.
+type Options struct {
+	// DryRun prints the packages, configuration files and services that would be changed instead
+	// of changing them. The secret store is still updated: pass one from DryRunStore.
+	DryRun bool
+}
+
 // LBNode represents a load balancer node with its role
 type LBNode struct {
 	Hostname string
@@ -24,18 +57,16 @@ type LBNode struct {
 }
 
 // GetStatus retrieves the load balancer status for a cluster from the secret store
-func GetStatus(store vault.SecretStore, distro, clusterID string) (string, []LBNode, error) {
+func GetStatus(ctx context.Context, store vault.SecretStore, distro, clusterID string) (string, []LBNode, error) {
 	logger.Debug("executing RetrieveLBInfo function")
-	rawNodes, vip, err := store.RetrieveLBInfo(distro, clusterID)
+	records, vip, err := store.RetrieveLBInfo(ctx, distro, clusterID)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to retrieve load balancer info: %w", err)
 	}
 
-	nodes := make([]LBNode, 0, len(rawNodes))
-	for _, node := range rawNodes {
-		hostname, _ := node["hostname"].(string)
-		isMain, _ := node["is_main"].(bool)
-		nodes = append(nodes, LBNode{Hostname: hostname, IsMain: isMain})
+	nodes := make([]LBNode, 0, len(records))
+	for _, record := range records {
+		nodes = append(nodes, LBNode{Hostname: record.Hostname, IsMain: record.IsMain})
 	}
 
 	return vip, nodes, nil
@@ -50,36 +81,74 @@ type LoadBalancerConfig struct {
 	Hostnames []string
 	HostIPs   map[string]string
 	Distro    string // "rke2" or "k3s" — controls HAProxy config (e.g. supervisor port)
+	DryRun    bool   // print the configuration instead of installing it
+}
+
+// DryRunStore returns an in-memory copy of a cluster's records in store (without its locks),
+// so a dry run can go through the real flow without changing the secret store.
+// A cluster that isn't in the store yet gives an empty copy.
+func DryRunStore(ctx context.Context, store vault.SecretStore, distro, clusterID string) (*vault.Client, error) {
+	preview := vault.NewMemoryStore(store.Paths())
+	archive, err := backup.Create(ctx, store, backup.Selection{Distros: []string{distro}, ClusterID: clusterID}, "dry-run")
+	if errors.Is(err, vault.ErrNotFound) {
+		return preview, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster %s for the dry run: %w", clusterID, err)
+	}
+	if _, err := backup.Restore(ctx, preview, archive, backup.RestoreOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to copy cluster %s for the dry run: %w", clusterID, err)
+	}
+	return preview, nil
 }
 
 // CreateLoadBalancer creates a new load balancer for a Kubernetes cluster.
 // It determines if this node should be the primary or backup LB node
 // and configures HAProxy and Keepalived accordingly.
 // The distro parameter ("rke2" or "k3s") controls the HAProxy config.
-func CreateLoadBalancer(store vault.SecretStore, clusterID, vip, distro string) error {
+// With opts.DryRun the election runs against store, but nothing is installed on this node.
+func CreateLoadBalancer(ctx context.Context, store vault.SecretStore, clusterID, vip, distro string, opts Options) error {
 	logger.Debug("Creating load balancer for %s cluster", distro)
+	if err := vault.CheckVIP(vip); err != nil {
+		return err
+	}
 	fmt.Printf("Creating load balancer for %s cluster %s\n", distro, clusterID)
 
 	// Get the current hostname
-	hostname, err := os.Hostname()
+	hostname, err := getHostname()
 	if err != nil {
 		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 
+	// Serialize the MASTER/BACKUP election with other load balancers being created in parallel
+	lease, err := acquireElectionLock(ctx, store, distro, clusterID, hostname)
+	if err != nil {
+		return err
+	}
+	defer func() { releaseElectionLock(ctx, store, lease) }()
+
 	// First check if there are any existing load balancers
-	existingLBs, existingVIP, err := store.RetrieveLBInfo(distro, clusterID)
+	// (no load balancers yet is an empty list, so any error means the election can't be decided)
+	existingLBs, existingVIP, err := store.RetrieveLBInfo(ctx, distro, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to read existing load balancers: %w", err)
+	}
 
-	// isFirst is true if there are no existing load balancers
-	isFirst := err != nil || len(existingLBs) == 0
+	// This node becomes main unless another node already holds that role
+	isMain := !otherMainExists(existingLBs, hostname)
 
-	logger.Debug("Load balancer first node check: isFirst=%v, error=%v, existingLBCount=%d",
-		isFirst, err, len(existingLBs))
+	logger.Debug("Load balancer main election: isMain=%v, existingLBCount=%d", isMain, len(existingLBs))
 
 	// Retrieve server nodes from the secret store for HAProxy configuration
-	hosts, masterVIP, hostIPs, err := store.RetrieveMasterInfo(distro, clusterID)
+	masters, err := store.RetrieveMasterInfo(ctx, distro, clusterID)
+	if errors.Is(err, vault.ErrInvalidRecord) {
+		return fmt.Errorf("failed to read master nodes: %w", err)
+	}
 	if err != nil {
 		logger.Debug("No master nodes found, this might be a new cluster: %v", err)
+		masters = &vault.MasterSet{}
 	}
+	masterVIP := masters.VIP
 
 	// Determine which VIP to use (priority: provided VIP > existing LB VIP > master VIP)
 	effectiveVIP := vip
@@ -95,50 +164,98 @@ func CreateLoadBalancer(store vault.SecretStore, clusterID, vip, distro string)
 	}
 
 	// Determine network interface for VIP
-	iface, err := detectInterfaceForVIP(effectiveVIP)
+	iface, err := detectInterface(effectiveVIP)
 	if err != nil {
 		return fmt.Errorf("could not detect network interface for VIP %s: %w", effectiveVIP, err)
 	}
 
-	// Configure this node as the main LB if it's the first one
-	isMain := isFirst
-
 	// Store the current LB info in the secret store
-	err = store.StoreLBInfo(distro, clusterID, hostname, effectiveVIP, isMain)
+	err = store.StoreLBInfo(ctx, distro, clusterID, hostname, effectiveVIP, isMain)
 	if err != nil {
 		return fmt.Errorf("failed to store load balancer info in secret store: %w", err)
 	}
 
+	// Our role is recorded; let the next node run its election while we install packages
+	releaseElectionLock(ctx, store, lease)
+	lease = nil
+
 	// Bootstrap the load balancer
 	return BootstrapLB(&LoadBalancerConfig{
 		ClusterID: clusterID,
 		IsMain:    isMain,
 		Interface: iface,
 		VIP:       effectiveVIP,
-		Hostnames: hosts,
-		HostIPs:   hostIPs,
+		Hostnames: masters.Hosts,
+		HostIPs:   masters.HostIPs,
 		Distro:    distro,
+		DryRun:    opts.DryRun,
 	})
 }
 
-func BootstrapLBFromSecretStore(store vault.SecretStore, clusterID string, isMain bool, distro string) error {
-	hosts, vip, hostIPs, err := store.RetrieveMasterInfo(distro, clusterID)
+// otherMainExists reports whether a node other than hostname is registered as main.
+// A node re-running create keeps its own role instead of demoting itself to BACKUP.
+func otherMainExists(nodes []vault.LBNodeRecord, hostname string) bool {
+	for _, node := range nodes {
+		if node.IsMain && node.Hostname != hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireElectionLock takes the cluster's LB election lock, waiting up to electionWaitTimeout
+// while another load balancer is running its election.
+func acquireElectionLock(ctx context.Context, store vault.SecretStore, distro, clusterID, hostname string) (*vault.Lease, error) {
+	deadline := time.Now().Add(electionWaitTimeout)
+	for {
+		lease, err := store.AcquireLock(ctx, distro, clusterID, electionLock, hostname, electionLockTTL)
+		if err == nil {
+			return lease, nil
+		}
+		if !errors.Is(err, vault.ErrLockHeld) {
+			return nil, fmt.Errorf("failed to acquire load balancer election lock: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for load balancer election: %w", err)
+		}
+		logger.Debug("Waiting for load balancer election: %v", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(electionPollInterval):
+		}
+	}
+}
+
+// releaseElectionLock gives up the election lock if still held; failures only delay
+// other nodes until the lease expires. The lock is released even when ctx was cancelled.
+func releaseElectionLock(ctx context.Context, store vault.SecretStore, lease *vault.Lease) {
+	if lease == nil {
+		return
+	}
+	if err := store.ReleaseLock(context.WithoutCancel(ctx), lease); err != nil {
+		logger.Warn("Failed to release load balancer election lock: %v", err)
+	}
+}
+
+func BootstrapLBFromSecretStore(ctx context.Context, store vault.SecretStore, clusterID string, isMain bool, distro string) error {
+	masters, err := store.RetrieveMasterInfo(ctx, distro, clusterID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch master info from secret store: %w", err)
 	}
 
-	iface, err := detectInterfaceForVIP(vip)
+	iface, err := detectInterface(masters.VIP)
 	if err != nil {
-		return fmt.Errorf("could not detect network interface for VIP %s: %w", vip, err)
+		return fmt.Errorf("could not detect network interface for VIP %s: %w", masters.VIP, err)
 	}
 
 	return BootstrapLB(&LoadBalancerConfig{
 		ClusterID: clusterID,
 		IsMain:    isMain,
 		Interface: iface,
-		VIP:       vip,
-		Hostnames: hosts,
-		HostIPs:   hostIPs,
+		VIP:       masters.VIP,
+		Hostnames: masters.Hosts,
+		HostIPs:   masters.HostIPs,
 		Distro:    distro,
 	})
 }
@@ -151,23 +268,31 @@ func BootstrapLB(cfg *LoadBalancerConfig) error {
 		state = "MASTER"
 	}
 
+	haproxyConfig, err := generateHAProxyConfig(cfg.Hostnames, cfg.HostIPs, cfg.Distro)
+	if err != nil {
+		return err
+	}
+	keepalivedConfig := generateKeepalivedConfig(cfg.Interface, cfg.VIP, state, priority)
+
+	if cfg.DryRun {
+		fmt.Printf("🔍 Would install HAProxy and KeepAlived and restart them as %s with VIP %s\n", state, cfg.VIP)
+		fmt.Printf("📄 %s (not written):\n\n%s\n", haproxyConfigPath, haproxyConfig)
+		fmt.Printf("📄 %s (not written):\n\n%s\n", keepalivedConfigPath, keepalivedConfig)
+		return nil
+	}
+
 	fmt.Print("🔧 Installing HAProxy and KeepAlived... \n")
 	if err := installPackages(); err != nil {
 		return fmt.Errorf("failed to install dependencies: %w", err)
 	}
 
 	fmt.Print("📄 Generating HAProxy config... \n")
-	haproxyConfig, err := generateHAProxyConfig(cfg.Hostnames, cfg.HostIPs, cfg.Distro)
-	if err != nil {
-		return err
-	}
-	if err := os.WriteFile("/etc/haproxy/haproxy.cfg", []byte(haproxyConfig), 0o644); err != nil { //nolint:gosec // config must be readable by the haproxy service user
+	if err := os.WriteFile(haproxyConfigPath, []byte(haproxyConfig), 0o644); err != nil { //nolint:gosec // config must be readable by the haproxy service user
 		return fmt.Errorf("failed to write haproxy config: %w", err)
 	}
 
 	fmt.Print("📄 Generating Keepalived config... \n")
-	keepalivedConfig := generateKeepalivedConfig(cfg.Interface, cfg.VIP, state, priority)
-	if err := os.WriteFile("/etc/keepalived/keepalived.conf", []byte(keepalivedConfig), 0o644); err != nil { //nolint:gosec // config must be readable by the keepalived service user
+	if err := os.WriteFile(keepalivedConfigPath, []byte(keepalivedConfig), 0o644); err != nil { //nolint:gosec // config must be readable by the keepalived service user
 		return fmt.Errorf("failed to write keepalived config: %w", err)
 	}
 
@@ -332,16 +457,36 @@ func detectInterfaceForVIP(vip string) (string, error) {
 
 // CleanupLoadBalancer removes the load balancer configuration for a cluster.
 // It disables the services, removes configuration files, and cleans up the secret store entry.
-func CleanupLoadBalancer(store vault.SecretStore, distro, clusterID string) error {
+// With opts.DryRun only the secret store entry is removed; pass a store from DryRunStore.
+func CleanupLoadBalancer(ctx context.Context, store vault.SecretStore, distro, clusterID string, opts Options) error {
 	logger.Debug("Cleaning up load balancer for cluster %s", clusterID)
 	fmt.Printf("Cleaning up load balancer for cluster %s\n", clusterID)
 
 	// Get the current hostname
-	hostname, err := os.Hostname()
+	hostname, err := getHostname()
 	if err != nil {
 		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 
+	if opts.DryRun {
+		fmt.Printf("🔍 Would disable HAProxy and Keepalived and remove %s and %s\n", haproxyConfigPath, keepalivedConfigPath)
+	} else {
+		disableLB()
+	}
+
+	// Remove this node from the LB list in the secret store
+	fmt.Print("🔄 Removing load balancer entry from secret store... \n")
+	if err := store.RemoveLBNode(ctx, distro, clusterID, hostname); err != nil {
+		return fmt.Errorf("failed to remove load balancer info from secret store: %w", err)
+	}
+
+	fmt.Printf("✅ Load balancer for cluster %s has been cleaned up successfully\n", clusterID)
+	return nil
+}
+
+// disableLB disables the HAProxy and Keepalived services and removes their configuration files.
+// Failures are only logged, so the node is still removed from the secret store.
+func disableLB() {
 	// Disable the services (this will also stop them)
 	fmt.Print("🛑 Disabling HAProxy and Keepalived services... \n")
 	if err := disableService("haproxy"); err != nil {
@@ -355,23 +500,14 @@ func CleanupLoadBalancer(store vault.SecretStore, distro, clusterID string) erro
 
 	// Remove configuration files
 	fmt.Print("🗑️ Removing configuration files... \n")
-	if err := os.Remove("/etc/haproxy/haproxy.cfg"); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(haproxyConfigPath); err != nil && !os.IsNotExist(err) {
 		logger.Warn("Failed to remove HAProxy config: %v", err)
 		// Continue execution even if file removal fails
 	}
-	if err := os.Remove("/etc/keepalived/keepalived.conf"); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(keepalivedConfigPath); err != nil && !os.IsNotExist(err) {
 		logger.Warn("Failed to remove Keepalived config: %v", err)
 		// Continue execution even if file removal fails
 	}
-
-	// Remove this node from the LB list in the secret store
-	fmt.Print("🔄 Removing load balancer entry from secret store... \n")
-	if err := store.RemoveLBNode(distro, clusterID, hostname); err != nil {
-		return fmt.Errorf("failed to remove load balancer info from secret store: %w", err)
-	}
-
-	fmt.Printf("✅ Load balancer for cluster %s has been cleaned up successfully\n", clusterID)
-	return nil
 }
 
 // disableService disables a systemd service with --now flag to also stop it
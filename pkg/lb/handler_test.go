@@ -4,10 +4,13 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 package lb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/michielvha/edgectl/pkg/vault"
 )
@@ -279,15 +282,15 @@ func TestGenerateKeepalivedConfig_ContainsHealthCheck(t *testing.T) {
 
 func TestGetStatus_ReturnsNodesAndVIP(t *testing.T) {
 	mock := &vault.MockStore{
-		RetrieveLBInfoFunc: func(distro, clusterID string) ([]map[string]interface{}, string, error) {
-			return []map[string]interface{}{
-				{"hostname": "lb1", "is_main": true},
-				{"hostname": "lb2", "is_main": false},
+		RetrieveLBInfoFunc: func(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+			return []vault.LBNodeRecord{
+				{Hostname: "lb1", IsMain: true},
+				{Hostname: "lb2", IsMain: false},
 			}, "10.0.0.100", nil
 		},
 	}
 
-	vip, nodes, err := GetStatus(mock, "rke2", "test-cluster")
+	vip, nodes, err := GetStatus(t.Context(), mock, "rke2", "test-cluster")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -307,12 +310,12 @@ func TestGetStatus_ReturnsNodesAndVIP(t *testing.T) {
 
 func TestGetStatus_EmptyNodes(t *testing.T) {
 	mock := &vault.MockStore{
-		RetrieveLBInfoFunc: func(distro, clusterID string) ([]map[string]interface{}, string, error) {
-			return []map[string]interface{}{}, "", nil
+		RetrieveLBInfoFunc: func(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+			return []vault.LBNodeRecord{}, "", nil
 		},
 	}
 
-	vip, nodes, err := GetStatus(mock, "rke2", "empty-cluster")
+	vip, nodes, err := GetStatus(t.Context(), mock, "rke2", "empty-cluster")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -323,3 +326,218 @@ func TestGetStatus_EmptyNodes(t *testing.T) {
 		t.Errorf("expected 0 nodes, got %d", len(nodes))
 	}
 }
+
+func TestGetStatus_InvalidRecord(t *testing.T) {
+	mock := &vault.MockStore{
+		RetrieveLBInfoFunc: func(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+			return nil, "", &vault.ValidationError{Path: "kv/data/rke2/c1/lb/lb1", Record: "lb", Reason: "hostname is empty"}
+		},
+	}
+
+	_, _, err := GetStatus(t.Context(), mock, "rke2", "c1")
+	if !errors.Is(err, vault.ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord, got %v", err)
+	}
+}
+
+// --- main election tests ---
+
+func TestOtherMainExists_NoNodes(t *testing.T) {
+	if otherMainExists(nil, "lb1") {
+		t.Error("expected no main when there are no nodes")
+	}
+}
+
+func TestOtherMainExists_OtherNodeIsMain(t *testing.T) {
+	nodes := []vault.LBNodeRecord{
+		{Hostname: "lb1", IsMain: true},
+	}
+	if !otherMainExists(nodes, "lb2") {
+		t.Error("expected lb1 to be detected as main")
+	}
+}
+
+func TestOtherMainExists_SelfIsMain(t *testing.T) {
+	// Re-running create on the main node must not demote it to BACKUP
+	nodes := []vault.LBNodeRecord{
+		{Hostname: "lb1", IsMain: true},
+		{Hostname: "lb2", IsMain: false},
+	}
+	if otherMainExists(nodes, "lb1") {
+		t.Error("expected lb1 to keep its main role")
+	}
+}
+
+func TestAcquireElectionLock_WaitsForHolder(t *testing.T) {
+	origWait, origPoll := electionWaitTimeout, electionPollInterval
+	electionWaitTimeout, electionPollInterval = time.Second, time.Millisecond
+	t.Cleanup(func() { electionWaitTimeout, electionPollInterval = origWait, origPoll })
+
+	attempts := 0
+	mock := &vault.MockStore{
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, &vault.LockHeldError{Name: name, Holder: "lb-other"}
+			}
+			return &vault.Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder}, nil
+		},
+	}
+
+	lease, err := acquireElectionLock(t.Context(), mock, "rke2", "test-cluster", "lb1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease.Name != electionLock || attempts != 3 {
+		t.Errorf("expected lock after 3 attempts, got lease %v after %d", lease, attempts)
+	}
+}
+
+func TestAcquireElectionLock_StoreError(t *testing.T) {
+	mock := &vault.MockStore{
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return nil, fmt.Errorf("permission denied")
+		},
+	}
+
+	if _, err := acquireElectionLock(t.Context(), mock, "rke2", "test-cluster", "lb1"); err == nil {
+		t.Fatal("expected error to be returned without waiting")
+	}
+}
+
+// --- create/cleanup flow tests (in-memory store, dry run) ---
+
+// actAs makes the flow run as the load balancer node hostname, with eth0 as its interface.
+func actAs(t *testing.T, hostname string) {
+	t.Helper()
+	origHostname, origDetect := getHostname, detectInterface
+	getHostname = func() (string, error) { return hostname, nil }
+	detectInterface = func(vip string) (string, error) { return "eth0", nil }
+	t.Cleanup(func() { getHostname, detectInterface = origHostname, origDetect })
+}
+
+func TestCreateLoadBalancer_ElectsMainThenBackup(t *testing.T) {
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	if err := store.StoreMasterInfo(t.Context(), "rke2", "test-cluster", "10.0.0.1", []string{"10.0.0.1"}, "10.0.0.100"); err != nil {
+		t.Fatalf("StoreMasterInfo: %v", err)
+	}
+
+	actAs(t, "lb1")
+	if err := CreateLoadBalancer(t.Context(), store, "test-cluster", "", "rke2", Options{DryRun: true}); err != nil {
+		t.Fatalf("creating lb1: %v", err)
+	}
+	actAs(t, "lb2")
+	if err := CreateLoadBalancer(t.Context(), store, "test-cluster", "", "rke2", Options{DryRun: true}); err != nil {
+		t.Fatalf("creating lb2: %v", err)
+	}
+	// Re-running create keeps the node's role
+	actAs(t, "lb1")
+	if err := CreateLoadBalancer(t.Context(), store, "test-cluster", "", "rke2", Options{DryRun: true}); err != nil {
+		t.Fatalf("re-creating lb1: %v", err)
+	}
+
+	vip, nodes, err := GetStatus(t.Context(), store, "rke2", "test-cluster")
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if vip != "10.0.0.100" {
+		t.Errorf("expected the masters' VIP, got %q", vip)
+	}
+	want := []LBNode{{Hostname: "lb1", IsMain: true}, {Hostname: "lb2", IsMain: false}}
+	if fmt.Sprint(nodes) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, nodes)
+	}
+
+	// The election lock is released once the role is recorded
+	if _, err := store.AcquireLock(t.Context(), "rke2", "test-cluster", electionLock, "lb3", time.Minute); err != nil {
+		t.Errorf("expected the election lock to be free, got %v", err)
+	}
+}
+
+func TestCreateLoadBalancer_NoVIP(t *testing.T) {
+	actAs(t, "lb1")
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+
+	if err := CreateLoadBalancer(t.Context(), store, "test-cluster", "", "k3s", Options{DryRun: true}); err == nil {
+		t.Fatal("expected an error without any VIP")
+	}
+	if _, nodes, _ := GetStatus(t.Context(), store, "k3s", "test-cluster"); len(nodes) != 0 {
+		t.Errorf("expected nothing to be stored, got %v", nodes)
+	}
+}
+
+// A failure to read the other load balancers must not make this node a second MASTER
+func TestCreateLoadBalancer_LBReadError(t *testing.T) {
+	actAs(t, "lb2")
+	mock := &vault.MockStore{
+		AcquireLockFunc: func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*vault.Lease, error) {
+			return &vault.Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder}, nil
+		},
+		ReleaseLockFunc: func(ctx context.Context, lease *vault.Lease) error { return nil },
+		RetrieveLBInfoFunc: func(ctx context.Context, distro, clusterID string) ([]vault.LBNodeRecord, string, error) {
+			return nil, "", fmt.Errorf("permission denied")
+		},
+		StoreLBInfoFunc: func(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error {
+			t.Errorf("expected nothing to be stored, got %s with isMain=%v", hostname, isMain)
+			return nil
+		},
+	}
+
+	err := CreateLoadBalancer(t.Context(), mock, "test-cluster", "10.0.0.100", "rke2", Options{})
+	if err == nil || !strings.Contains(err.Error(), "failed to read existing load balancers") {
+		t.Errorf("expected the read error to be returned, got %v", err)
+	}
+}
+
+func TestCleanupLoadBalancer_RemovesNode(t *testing.T) {
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	for _, host := range []string{"lb1", "lb2"} {
+		actAs(t, host)
+		if err := CreateLoadBalancer(t.Context(), store, "test-cluster", "10.0.0.100", "k3s", Options{DryRun: true}); err != nil {
+			t.Fatalf("creating %s: %v", host, err)
+		}
+	}
+
+	if err := CleanupLoadBalancer(t.Context(), store, "k3s", "test-cluster", Options{DryRun: true}); err != nil {
+		t.Fatalf("CleanupLoadBalancer: %v", err)
+	}
+	_, nodes, err := GetStatus(t.Context(), store, "k3s", "test-cluster")
+	if err != nil || len(nodes) != 1 || nodes[0].Hostname != "lb1" {
+		t.Errorf("expected only lb1 to remain, got %v (%v)", nodes, err)
+	}
+}
+
+func TestDryRunStore_CopiesClusterWithoutChangingStore(t *testing.T) {
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	if err := store.StoreLBInfo(t.Context(), "rke2", "test-cluster", "lb1", "10.0.0.100", true); err != nil {
+		t.Fatalf("StoreLBInfo: %v", err)
+	}
+	if _, err := store.AcquireLock(t.Context(), "rke2", "test-cluster", electionLock, "lb1", time.Minute); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+
+	preview, err := DryRunStore(t.Context(), store, "rke2", "test-cluster")
+	if err != nil {
+		t.Fatalf("DryRunStore: %v", err)
+	}
+	actAs(t, "lb2")
+	if err := CreateLoadBalancer(t.Context(), preview, "test-cluster", "", "rke2", Options{DryRun: true}); err != nil {
+		t.Fatalf("CreateLoadBalancer: %v", err)
+	}
+
+	_, nodes, _ := GetStatus(t.Context(), preview, "rke2", "test-cluster")
+	if len(nodes) != 2 || nodes[1].Hostname != "lb2" || nodes[1].IsMain {
+		t.Errorf("expected lb2 to join the copy as BACKUP, got %v", nodes)
+	}
+	if _, nodes, _ := GetStatus(t.Context(), store, "rke2", "test-cluster"); len(nodes) != 1 {
+		t.Errorf("expected the store to be unchanged, got %v", nodes)
+	}
+
+	empty, err := DryRunStore(t.Context(), store, "rke2", "new-cluster")
+	if err != nil {
+		t.Fatalf("DryRunStore (new cluster): %v", err)
+	}
+	if keys, err := empty.ListKeys(t.Context(), empty.Paths().Metadata("rke2")); err != nil || len(keys) != 0 {
+		t.Errorf("expected an empty copy for a new cluster, got %v (%v)", keys, err)
+	}
+}
@@ -1,8 +1,11 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/michielvha/edgectl/pkg/vault"
@@ -17,15 +20,15 @@ func TestFetchToken_SetsEnvVars(t *testing.T) {
 	clusterIDDir = t.TempDir()
 
 	mock := &vault.MockStore{
-		RetrieveJoinTokenFunc: func(distro, clusterID string) (string, error) {
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
 			if clusterID != "agent-cluster" {
 				t.Errorf("unexpected clusterID: %s", clusterID)
 			}
-			return testAgentToken, nil
+			return &vault.AgentToken{Token: testAgentToken}, nil
 		},
 	}
 
-	token, err := FetchToken(mock, "agent-cluster")
+	token, err := FetchToken(t.Context(), mock, "agent-cluster")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -39,6 +42,43 @@ func TestFetchToken_SetsEnvVars(t *testing.T) {
 	t.Cleanup(func() { os.Unsetenv("RKE2_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
 }
 
+// TestFetchToken_NoAgentToken verifies agents never fall back to the server token
+// (RetrieveJoinToken is left unset, so calling it would panic).
+func TestFetchToken_NoAgentToken(t *testing.T) {
+	clusterIDDir = t.TempDir()
+
+	mock := &vault.MockStore{
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+			return nil, vault.ErrNotFound
+		},
+	}
+
+	if _, err := FetchToken(t.Context(), mock, "agent-cluster"); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestInstall_MastersUnreadable verifies an agent doesn't go on without the masters when the
+// store refuses them, for example because the token's policy doesn't cover them.
+func TestInstall_MastersUnreadable(t *testing.T) {
+	clusterIDDir = t.TempDir()
+	t.Cleanup(func() { os.Unsetenv("RKE2_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
+
+	mock := &vault.MockStore{
+		RetrieveAgentTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.AgentToken, error) {
+			return &vault.AgentToken{Token: testAgentToken}, nil
+		},
+		RetrieveMasterInfoFunc: func(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+			return nil, fmt.Errorf("permission denied")
+		},
+	}
+
+	err := Install(t.Context(), mock, "agent-cluster", "", "")
+	if err == nil || !strings.Contains(err.Error(), "failed to retrieve the masters of cluster agent-cluster") {
+		t.Errorf("expected the masters error to be fatal, got %v", err)
+	}
+}
+
 func TestVIPResolutionPriority_StoreWins(t *testing.T) {
 	vip := testFlagVIP
 
@@ -95,7 +135,7 @@ func TestLBHostnameDNS_Resolves(t *testing.T) {
 	}
 	t.Cleanup(func() { lookupHost = original })
 
-	// Simulate the VIP resolution logic from Install()
+	// Simulate the VIP resolution logic from Install(t.Context(), )
 	vip := ""
 	lbHostname := "lb.example.com"
 	if vip == "" && lbHostname != "" {
@@ -125,10 +165,35 @@ func TestLBHostnameDNS_Error(t *testing.T) {
 		if err == nil && len(addrs) > 0 {
 			t.Fatal("expected DNS failure, but got result")
 		}
-		// In Install(), this returns an error — here we just verify the lookup fails
+		// In Install(t.Context(), ), this returns an error — here we just verify the lookup fails
 	}
 
 	if vip != "" {
 		t.Errorf("expected empty VIP after DNS failure, got %q", vip)
 	}
 }
+
+func TestApplyCredentials(t *testing.T) {
+	clusterIDDir = t.TempDir()
+	t.Cleanup(func() { os.Unsetenv("RKE2_TOKEN") }) //nolint:errcheck // error irrelevant in test cleanup
+
+	creds := &vault.JoinCredentials{Distro: "rke2", ClusterID: "ticket-cluster", Role: vault.PolicyRoleAgent, Token: testAgentToken, ServerAddress: "10.0.0.100"}
+	vip, err := applyCredentials(creds, testFlagVIP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vip != "10.0.0.100" {
+		t.Errorf("expected the ticket's server address to win over the flag, got %q", vip)
+	}
+	if got := os.Getenv("RKE2_TOKEN"); got != testAgentToken {
+		t.Errorf("expected RKE2_TOKEN=%q, got %q", testAgentToken, got)
+	}
+	if id, _ := os.ReadFile(clusterIDDir + "/cluster-id"); string(id) != "ticket-cluster" {
+		t.Errorf("expected the cluster-id file to be written, got %q", id)
+	}
+
+	creds.Role = vault.PolicyRoleServer
+	if _, err := applyCredentials(creds, ""); err == nil {
+		t.Error("expected a server ticket to be rejected")
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/logger"
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+// Token rotation seams. Tests can override these.
+var (
+	// nodeTokenPath is the token file RKE2 writes on every server
+	nodeTokenPath = "/var/lib/rancher/rke2/server/node-token"
+	// tokenConfigFiles are the local files that may hold the join token (written by rke2.sh)
+	tokenConfigFiles = []string{"/etc/rancher/rke2/config.yaml"}
+	// runTokenRotate runs the RKE2 token rotation against the local server
+	runTokenRotate = func(ctx context.Context, oldToken, newToken string) error {
+		cmd := exec.CommandContext(ctx, "rke2", "token", "rotate", "--token", oldToken, "--new-token", newToken)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+	// storeRetryDelays are the waits between attempts to store the rotated token
+	storeRetryDelays = []time.Duration{2 * time.Second, 5 * time.Second, 15 * time.Second}
+)
+
+// RotationReport describes the outcome of a token rotation.
+type RotationReport struct {
+	// Token is the new full join token
+	Token string
+	// TokenFile is the root-only file the new token was saved to when it couldn't be stored
+	TokenFile string
+	// UpdatedFiles are the local config files that were switched to the new token
+	UpdatedFiles []string
+	// OtherServers are the other servers registered for the cluster. Their config files aren't
+	// checked, so they may still reference the old token. Agents aren't registered and can't be listed.
+	OtherServers []string
+}
+
+// RotateToken rotates the join token of a cluster. It must run on an RKE2 server of that cluster:
+// the RKE2 token rotation is run locally, the secret store record is replaced (recording when and
+// where it was rotated), and the local config files are switched to the new token.
+// If newToken is empty, a random one is generated. The other servers of the cluster keep the old
+// token in their config files until they are updated; the registered ones are listed in the report.
+func RotateToken(ctx context.Context, store vault.SecretStore, clusterID, newToken string) (*RotationReport, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	tokenBytes, err := os.ReadFile(nodeTokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node token (is this an RKE2 server?): %w", err)
+	}
+	localToken := strings.TrimSpace(string(tokenBytes))
+
+	stored, err := store.RetrieveJoinToken(ctx, "rke2", clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve join token: %w", err)
+	}
+	oldToken := stored.Token
+	if oldToken != localToken {
+		logger.Warn("The join token in the secret store differs from %s; rotating the stored token", nodeTokenPath)
+	}
+
+	if newToken == "" {
+		if newToken, err = generateTokenSecret(); err != nil {
+			return nil, err
+		}
+	}
+	fullToken := withTokenPrefix(oldToken, newToken)
+	if fullToken == oldToken {
+		return nil, errors.New("the new token must differ from the current one")
+	}
+
+	fmt.Printf("🔄 Rotating the RKE2 join token for cluster %s\n", clusterID)
+	if err := runTokenRotate(ctx, oldToken, newToken); err != nil {
+		return nil, fmt.Errorf("rke2 token rotation failed: %w", err)
+	}
+
+	// RKE2 already accepts only the new token from here on, so losing it would lock new nodes out
+	if err := storeRotatedToken(ctx, store, clusterID, oldToken, fullToken, hostname); err != nil {
+		err = fmt.Errorf("token rotated on this server, but updating the secret store failed: %w", err)
+		tokenFile, saveErr := saveRotatedToken(fullToken)
+		if saveErr != nil {
+			return &RotationReport{Token: fullToken}, errors.Join(err, saveErr)
+		}
+		return &RotationReport{Token: fullToken, TokenFile: tokenFile}, err
+	}
+	fmt.Printf("🔐 New join token stored in secret store for cluster %s\n", clusterID)
+
+	report := &RotationReport{Token: fullToken}
+	for _, file := range tokenConfigFiles {
+		updated, err := replaceToken(file, oldToken, fullToken)
+		if err != nil {
+			return report, err
+		}
+		if updated {
+			report.UpdatedFiles = append(report.UpdatedFiles, file)
+		}
+	}
+
+	masters, err := store.RetrieveMasterInfo(ctx, "rke2", clusterID)
+	if err != nil && !errors.Is(err, vault.ErrNotFound) {
+		return report, fmt.Errorf("failed to read master node info from secret store: %w", err)
+	}
+	if masters != nil {
+		for _, host := range masters.Hosts {
+			if host != hostname {
+				report.OtherServers = append(report.OtherServers, host)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// storeRotatedToken replaces the join token in the secret store, retrying after storeRetryDelays
+// when the store fails. A conflict is only retried to find out whether an earlier attempt went through.
+func storeRotatedToken(ctx context.Context, store vault.SecretStore, clusterID, oldToken, newToken, hostname string) error {
+	for attempt := 0; ; attempt++ {
+		err := store.RotateJoinToken(ctx, "rke2", clusterID, oldToken, newToken, hostname)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, vault.ErrConflict) {
+			if stored, getErr := store.RetrieveJoinToken(ctx, "rke2", clusterID); getErr == nil && stored.Token == newToken {
+				return nil
+			}
+			return err
+		}
+		if errors.Is(err, vault.ErrNotFound) || attempt == len(storeRetryDelays) {
+			return err
+		}
+
+		logger.Warn("Failed to store the new join token, retrying in %s: %v", storeRetryDelays[attempt], err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(storeRetryDelays[attempt]):
+		}
+	}
+}
+
+// saveRotatedToken writes a token that couldn't be stored to a file only root can read, so it
+// isn't lost and doesn't end up on the terminal. It returns the path of the file.
+func saveRotatedToken(token string) (string, error) {
+	if err := os.MkdirAll(clusterIDDir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", clusterIDDir, err)
+	}
+	path := filepath.Join(clusterIDDir, "rotated-token")
+	// Remove an earlier file first, WriteFile keeps the permissions of an existing file
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to save the new token to %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// generateTokenSecret returns a random token secret.
+func generateTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withTokenPrefix turns a token secret into a full token by reusing the "K10<ca-hash>::server:"
+// prefix of the old token, so joining nodes keep validating the cluster CA.
+// A new token that is already a full token, or an old token without prefix, is returned as-is.
+func withTokenPrefix(oldToken, newToken string) string {
+	if strings.HasPrefix(newToken, "K10") {
+		return newToken
+	}
+	idx := strings.Index(oldToken, "::server:")
+	if !strings.HasPrefix(oldToken, "K10") || idx < 0 {
+		return newToken
+	}
+	return oldToken[:idx+len("::server:")] + newToken
+}
+
+// tokenSecret returns the secret part of a full "K10<ca-hash>::<user>:<secret>" token.
+func tokenSecret(token string) string {
+	if _, rest, ok := strings.Cut(token, "::"); ok {
+		if _, secret, ok := strings.Cut(rest, ":"); ok {
+			return secret
+		}
+	}
+	return token
+}
+
+// agentToken builds the full agent token "K10<ca-hash>::node:<secret>" from the server token,
+// so agents validate the cluster CA. A server token without CA hash gives the bare secret.
+func agentToken(serverToken, secret string) string {
+	prefix, _, ok := strings.Cut(serverToken, "::")
+	if !ok || !strings.HasPrefix(prefix, "K10") {
+		return secret
+	}
+	return prefix + "::node:" + secret
+}
+
+// replaceToken swaps the old token, or its bare secret, for the new one in a config file.
+// It reports whether the file was changed; a missing file is not an error.
+func replaceToken(path, oldToken, newToken string) (bool, error) {
+	content, err := os.ReadFile(path) //nolint:gosec // path is one of the fixed distro config files
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	updated := strings.ReplaceAll(string(content), oldToken, newToken)
+	if oldSecret := tokenSecret(oldToken); oldSecret != "" && oldSecret != oldToken {
+		updated = strings.ReplaceAll(updated, oldSecret, tokenSecret(newToken))
+	}
+	if updated == string(content) {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	return true, nil
+}
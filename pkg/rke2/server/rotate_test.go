@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/vault"
+)
+
+const testFullToken = "K10abc123::server:oldsecret"
+
+// setupRotation points the rotation seams at temporary files and records the rotate invocation.
+func setupRotation(t *testing.T, configContent string) (configPath string, rotated *[2]string) {
+	t.Helper()
+	dir := t.TempDir()
+	origTokenPath, origFiles, origRun := nodeTokenPath, tokenConfigFiles, runTokenRotate
+	origDir, origDelays := clusterIDDir, storeRetryDelays
+	t.Cleanup(func() {
+		nodeTokenPath, tokenConfigFiles, runTokenRotate = origTokenPath, origFiles, origRun
+		clusterIDDir, storeRetryDelays = origDir, origDelays
+	})
+	clusterIDDir = filepath.Join(dir, "edgectl")
+	storeRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+
+	nodeTokenPath = filepath.Join(dir, "node-token")
+	configPath = filepath.Join(dir, "config.yaml")
+	tokenConfigFiles = []string{configPath, filepath.Join(dir, "missing.yaml")}
+	_ = os.WriteFile(nodeTokenPath, []byte(testFullToken+"\n"), 0o600)
+	_ = os.WriteFile(configPath, []byte(configContent), 0o600)
+
+	rotated = &[2]string{}
+	runTokenRotate = func(ctx context.Context, oldToken, newToken string) error {
+		rotated[0], rotated[1] = oldToken, newToken
+		return nil
+	}
+	return configPath, rotated
+}
+
+func rotationStore(t *testing.T, stored *string) *vault.MockStore {
+	hostname, _ := os.Hostname()
+	return &vault.MockStore{
+		RetrieveJoinTokenFunc: func(ctx context.Context, distro, clusterID string) (*vault.JoinToken, error) {
+			return &vault.JoinToken{Token: *stored, ClusterID: clusterID}, nil
+		},
+		RotateJoinTokenFunc: func(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+			if oldToken != *stored {
+				t.Errorf("expected old token %q, got %q", *stored, oldToken)
+			}
+			if rotatedBy != hostname {
+				t.Errorf("expected rotatedBy %q, got %q", hostname, rotatedBy)
+			}
+			*stored = newToken
+			return nil
+		},
+		RetrieveMasterInfoFunc: func(ctx context.Context, distro, clusterID string) (*vault.MasterSet, error) {
+			return &vault.MasterSet{Hosts: []string{hostname, "master-2", "master-3"}}, nil
+		},
+	}
+}
+
+func TestRotateToken_UpdatesStoreAndConfig(t *testing.T) {
+	configPath, rotated := setupRotation(t, "token: \""+testFullToken+"\"\nserver: https://10.0.0.1:9345\n")
+	stored := testFullToken
+
+	report, err := RotateToken(t.Context(), rotationStore(t, &stored), testClusterID, "newsecret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rotated[0] != testFullToken || rotated[1] != "newsecret" {
+		t.Errorf("unexpected rotate invocation: %v", rotated)
+	}
+	if report.Token != "K10abc123::server:newsecret" || stored != report.Token {
+		t.Errorf("expected the prefixed token to be stored, got report %q, store %q", report.Token, stored)
+	}
+	if len(report.UpdatedFiles) != 1 || report.UpdatedFiles[0] != configPath {
+		t.Errorf("expected only the config file to be updated, got %v", report.UpdatedFiles)
+	}
+	content, _ := os.ReadFile(configPath)
+	if string(content) != "token: \"K10abc123::server:newsecret\"\nserver: https://10.0.0.1:9345\n" {
+		t.Errorf("unexpected config content: %q", content)
+	}
+	if len(report.OtherServers) != 2 || report.OtherServers[0] != "master-2" {
+		t.Errorf("expected the other masters to be reported, got %v", report.OtherServers)
+	}
+}
+
+func TestRotateToken_GeneratesTokenAndReplacesBareSecret(t *testing.T) {
+	configPath, rotated := setupRotation(t, "token: oldsecret\n")
+	stored := testFullToken
+
+	report, err := RotateToken(t.Context(), rotationStore(t, &stored), testClusterID, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret := tokenSecret(report.Token)
+	if len(secret) != 64 || rotated[1] != secret {
+		t.Errorf("expected a generated 64 character secret, got %q (rotated with %q)", secret, rotated[1])
+	}
+	content, _ := os.ReadFile(configPath)
+	if string(content) != "token: "+secret+"\n" {
+		t.Errorf("expected the bare secret to be replaced, got %q", content)
+	}
+}
+
+func TestRotateToken_RotationFailureLeavesStore(t *testing.T) {
+	setupRotation(t, "")
+	runTokenRotate = func(ctx context.Context, oldToken, newToken string) error {
+		return errors.New("exit status 1")
+	}
+	stored := testFullToken
+
+	if _, err := RotateToken(t.Context(), rotationStore(t, &stored), testClusterID, "newsecret"); err == nil {
+		t.Fatal("expected an error when the rotation fails")
+	}
+	if stored != testFullToken {
+		t.Errorf("expected the stored token to be unchanged, got %q", stored)
+	}
+}
+
+func TestRotateToken_StoreFailureReturnsNewToken(t *testing.T) {
+	setupRotation(t, "")
+	stored := testFullToken
+	store := rotationStore(t, &stored)
+	store.RotateJoinTokenFunc = func(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+		return &vault.ConflictError{Path: "kv/data/rke2/test-cluster/token"}
+	}
+
+	report, err := RotateToken(t.Context(), store, testClusterID, "newsecret")
+	if !errors.Is(err, vault.ErrConflict) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if report == nil || report.Token != "K10abc123::server:newsecret" {
+		t.Fatalf("expected the new token in the report, got %+v", report)
+	}
+
+	content, err := os.ReadFile(report.TokenFile)
+	if err != nil || string(content) != report.Token+"\n" {
+		t.Errorf("expected the new token to be saved to %q, got %q (%v)", report.TokenFile, content, err)
+	}
+	if info, err := os.Stat(report.TokenFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the token file to be readable by its owner only, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestRotateToken_RetriesStore(t *testing.T) {
+	setupRotation(t, "")
+	stored := testFullToken
+	store := rotationStore(t, &stored)
+	rotate := store.RotateJoinTokenFunc
+	attempts := 0
+	store.RotateJoinTokenFunc = func(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+		if attempts++; attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return rotate(ctx, distro, clusterID, oldToken, newToken, rotatedBy)
+	}
+
+	report, err := RotateToken(t.Context(), store, testClusterID, "newsecret")
+	if err != nil {
+		t.Fatalf("expected the store to succeed on the third attempt, got %v", err)
+	}
+	if stored != report.Token || report.TokenFile != "" {
+		t.Errorf("expected the token to be stored and not saved to a file, got %+v", report)
+	}
+}
+
+func TestRotateToken_ConflictAfterLostResponse(t *testing.T) {
+	setupRotation(t, "")
+	stored := testFullToken
+	store := rotationStore(t, &stored)
+	rotate := store.RotateJoinTokenFunc
+	store.RotateJoinTokenFunc = func(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+		if stored != testFullToken {
+			return &vault.ConflictError{Path: "token"}
+		}
+		// The write goes through, but the response is lost
+		_ = rotate(ctx, distro, clusterID, oldToken, newToken, rotatedBy)
+		return errors.New("connection reset by peer")
+	}
+
+	if _, err := RotateToken(t.Context(), store, testClusterID, "newsecret"); err != nil {
+		t.Errorf("expected the earlier write to be recognized, got %v", err)
+	}
+}
+
+func TestRotateToken_SameToken(t *testing.T) {
+	setupRotation(t, "")
+	stored := testFullToken
+	if _, err := RotateToken(t.Context(), rotationStore(t, &stored), testClusterID, "oldsecret"); err == nil {
+		t.Error("expected an error rotating to the current token")
+	}
+}
+
+func TestRotateToken_RecordsRotationInStore(t *testing.T) {
+	setupRotation(t, "")
+	hostname, _ := os.Hostname()
+	store := vault.NewMemoryStore(vault.DefaultKVPaths())
+	if err := store.StoreJoinToken(t.Context(), "rke2", testClusterID, testFullToken); err != nil {
+		t.Fatalf("StoreJoinToken: %v", err)
+	}
+	if err := store.StoreMasterInfo(t.Context(), "rke2", testClusterID, "10.0.0.2", []string{hostname, "10.0.0.2"}, ""); err != nil {
+		t.Fatalf("StoreMasterInfo: %v", err)
+	}
+
+	report, err := RotateToken(t.Context(), store, testClusterID, "newsecret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.OtherServers) != 1 || report.OtherServers[0] != "10.0.0.2" {
+		t.Errorf("expected the other master to be reported, got %v", report.OtherServers)
+	}
+
+	token, err := store.RetrieveJoinToken(t.Context(), "rke2", testClusterID)
+	if err != nil || token.Token != "K10abc123::server:newsecret" || token.RotatedBy != hostname {
+		t.Errorf("expected the rotated token by %q, got %+v (%v)", hostname, token, err)
+	}
+	previous, err := store.RetrieveJoinTokenVersion(t.Context(), "rke2", testClusterID, 1)
+	if err != nil || previous.Token != testFullToken {
+		t.Errorf("expected the old token as version 1, got %+v (%v)", previous, err)
+	}
+}
+
+func TestWithTokenPrefix(t *testing.T) {
+	tests := []struct {
+		old, new, want string
+	}{
+		{testFullToken, "fresh", "K10abc123::server:fresh"},
+		{testFullToken, "K10abc123::server:given", "K10abc123::server:given"},
+		{"plainsecret", "fresh", "fresh"},
+	}
+	for _, tt := range tests {
+		if got := withTokenPrefix(tt.old, tt.new); got != tt.want {
+			t.Errorf("withTokenPrefix(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestAgentToken(t *testing.T) {
+	if got := agentToken(testFullToken, "agentsecret"); got != "K10abc123::node:agentsecret" {
+		t.Errorf("unexpected agent token %q", got)
+	}
+	if got := agentToken("plainsecret", "agentsecret"); got != "agentsecret" {
+		t.Errorf("expected the bare secret without CA hash, got %q", got)
+	}
+	if got := tokenSecret("K10abc123::node:agentsecret"); got != "agentsecret" {
+		t.Errorf("unexpected secret %q", got)
+	}
+}
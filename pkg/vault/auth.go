@@ -0,0 +1,221 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the authentication methods supported by NewClient:
+- token: a static token from BAO_TOKEN (default, backwards compatible)
+- token_file: a token read from a file (e.g. written by an OpenBao agent)
+- approle: AppRole login with role_id/secret_id from a file or the environment
+- kubernetes: Kubernetes service-account login using the projected token
+
+Tokens obtained through a login (approle, kubernetes) are kept alive by a lifetime
+watcher, which renews the token and logs in again once it can no longer be renewed.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	vault "github.com/openbao/openbao/api/v2"
+
+	"github.com/michielvha/edgectl/pkg/logger"
+)
+
+// Supported authentication methods.
+const (
+	AuthMethodToken      = "token"
+	AuthMethodTokenFile  = "token_file"
+	AuthMethodAppRole    = "approle"
+	AuthMethodKubernetes = "kubernetes"
+)
+
+const (
+	defaultAppRoleMount        = "approle"
+	defaultKubernetesMount     = "kubernetes"
+	defaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec // path, not a credential
+)
+
+// AuthConfig selects and configures the authentication method used by the client.
+// Credentials can be given inline or as a path to a file containing them; files win.
+type AuthConfig struct {
+	Method string
+
+	// token / token_file
+	Token     string
+	TokenFile string
+
+	// approle
+	RoleID       string
+	RoleIDFile   string
+	SecretID     string
+	SecretIDFile string
+	AppRoleMount string
+
+	// kubernetes
+	KubernetesRole      string
+	KubernetesTokenPath string
+	KubernetesMount     string
+}
+
+// login authenticates the client according to the configured method and sets its token.
+// For login-based methods the auth secret is returned so it can be handed to a lifetime watcher;
+// static token methods return a nil secret.
+func login(ctx context.Context, client *vault.Client, auth AuthConfig) (*vault.Secret, error) {
+	switch auth.Method {
+	case "", AuthMethodToken:
+		if auth.Token == "" {
+			return nil, fmt.Errorf("BAO_TOKEN not set")
+		}
+		client.SetToken(auth.Token)
+		return nil, nil
+
+	case AuthMethodTokenFile:
+		token, err := readCredential("token", "", auth.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		client.SetToken(token)
+		return nil, nil
+
+	case AuthMethodAppRole:
+		roleID, err := readCredential("role_id", auth.RoleID, auth.RoleIDFile)
+		if err != nil {
+			return nil, err
+		}
+		secretID, err := readCredential("secret_id", auth.SecretID, auth.SecretIDFile)
+		if err != nil {
+			return nil, err
+		}
+		mount := valueOrDefault(auth.AppRoleMount, defaultAppRoleMount)
+		return loginWith(ctx, client, fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		})
+
+	case AuthMethodKubernetes:
+		if auth.KubernetesRole == "" {
+			return nil, fmt.Errorf("kubernetes auth requires a role (BAO_K8S_ROLE)")
+		}
+		jwt, err := readCredential("service account token", "", valueOrDefault(auth.KubernetesTokenPath, defaultKubernetesTokenPath))
+		if err != nil {
+			return nil, err
+		}
+		mount := valueOrDefault(auth.KubernetesMount, defaultKubernetesMount)
+		return loginWith(ctx, client, fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+			"role": auth.KubernetesRole,
+			"jwt":  jwt,
+		})
+
+	default:
+		return nil, fmt.Errorf("unsupported auth method %q (expected %s, %s, %s or %s)",
+			auth.Method, AuthMethodToken, AuthMethodTokenFile, AuthMethodAppRole, AuthMethodKubernetes)
+	}
+}
+
+// loginWith performs a login request against an auth mount and sets the resulting client token.
+func loginWith(ctx context.Context, client *vault.Client, path string, data map[string]interface{}) (*vault.Secret, error) {
+	// Login endpoints must not be called with a (possibly stale) token attached. The login runs on
+	// a clone, so requests in flight on the shared client keep their token until the new one is set.
+	loginClient, err := client.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare the login client: %w", err)
+	}
+	loginClient.ClearToken()
+	secret, err := loginClient.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("login via '%s' failed: %w", path, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("login via '%s' returned no token", path)
+	}
+	client.SetToken(secret.Auth.ClientToken)
+	logger.Debug("authenticated via %s (ttl %ds, renewable %v)", path, secret.Auth.LeaseDuration, secret.Auth.Renewable)
+	return secret, nil
+}
+
+// readCredential returns the credential from file when a path is given, otherwise the inline value.
+func readCredential(name, value, file string) (string, error) {
+	if file != "" {
+		raw, err := os.ReadFile(file) //nolint:gosec // path comes from trusted config
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s from '%s': %w", name, file, err)
+		}
+		value = string(raw)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s not set", name)
+	}
+	return value, nil
+}
+
+// valueOrDefault returns value, or def when value is empty.
+func valueOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// startRenewal keeps a login token alive for the lifetime of the client.
+// The watcher renews the token while it can; once renewal is no longer possible
+// (max TTL reached or renewal failed) it logs in again and starts watching the new token.
+// The returned function stops the renewal loop.
+func startRenewal(client *vault.Client, auth AuthConfig, secret *vault.Secret) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		for {
+			watcher, err := client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+			if err != nil {
+				logger.Warn("Token renewal disabled: %v", err)
+				return
+			}
+			go watcher.Start()
+
+			renewed := watchToken(watcher, stop)
+			watcher.Stop()
+			if !renewed {
+				return
+			}
+
+			logger.Debug("token can no longer be renewed, logging in again")
+			secret, err = relogin(client, auth)
+			if err != nil {
+				logger.Warn("Re-authentication failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+// relogin logs in again from the renewal loop, bounded by the default request timeout.
+func relogin(client *vault.Client, auth AuthConfig) (*vault.Secret, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	defer cancel()
+	return login(ctx, client, auth)
+}
+
+// watchToken drains the watcher until it is done or stop is closed.
+// It returns true when the watcher finished on its own and a new login is needed.
+func watchToken(watcher *vault.LifetimeWatcher, stop <-chan struct{}) bool {
+	for {
+		select {
+		case <-stop:
+			return false
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				logger.Debug("token renewal stopped: %v", err)
+			}
+			return true
+		case renewal := <-watcher.RenewCh():
+			logger.Debug("token renewed at %s", renewal.RenewedAt)
+		}
+	}
+}
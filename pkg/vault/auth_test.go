@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// newLoginTestClient starts a stub OpenBao server that answers login requests on loginPath
+// and returns a raw SDK client pointed at it, plus a pointer to the last received login body.
+func newLoginTestClient(t *testing.T, loginPath string) (*vault.Client, *map[string]interface{}) {
+	t.Helper()
+
+	var received map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/"+loginPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "" {
+			t.Errorf("login request must not carry a token, got %q", r.Header.Get("X-Vault-Token"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.login-token","lease_duration":3600,"renewable":true}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := vault.NewClient(&vault.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client, &received
+}
+
+func TestLogin_StaticToken(t *testing.T) {
+	client, _ := newLoginTestClient(t, "unused")
+
+	secret, err := login(t.Context(), client, AuthConfig{Token: "s.static"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret != nil {
+		t.Error("expected no auth secret for static token")
+	}
+	if client.Token() != "s.static" {
+		t.Errorf("expected token 's.static', got %q", client.Token())
+	}
+}
+
+func TestLogin_StaticTokenMissing(t *testing.T) {
+	client, _ := newLoginTestClient(t, "unused")
+
+	if _, err := login(t.Context(), client, AuthConfig{Method: AuthMethodToken}); err == nil {
+		t.Fatal("expected error when no token is configured")
+	}
+}
+
+func TestLogin_TokenFile(t *testing.T) {
+	client, _ := newLoginTestClient(t, "unused")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s.from-file\n"), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	if _, err := login(t.Context(), client, AuthConfig{Method: AuthMethodTokenFile, TokenFile: path}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "s.from-file" {
+		t.Errorf("expected trimmed token 's.from-file', got %q", client.Token())
+	}
+}
+
+func TestLogin_AppRole(t *testing.T) {
+	client, received := newLoginTestClient(t, "auth/approle/login")
+	secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+	if err := os.WriteFile(secretIDFile, []byte("secret-456"), 0o600); err != nil {
+		t.Fatalf("failed to write secret-id file: %v", err)
+	}
+
+	secret, err := login(t.Context(), client, AuthConfig{
+		Method:       AuthMethodAppRole,
+		RoleID:       "role-123",
+		SecretIDFile: secretIDFile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret == nil || !secret.Auth.Renewable {
+		t.Fatal("expected a renewable auth secret")
+	}
+	if client.Token() != "s.login-token" {
+		t.Errorf("expected login token to be set, got %q", client.Token())
+	}
+	if (*received)["role_id"] != "role-123" || (*received)["secret_id"] != "secret-456" {
+		t.Errorf("unexpected login body: %v", *received)
+	}
+}
+
+// A re-login must not strip the token from requests running concurrently on the shared client
+func TestLogin_KeepsTokenDuringRelogin(t *testing.T) {
+	var client *vault.Client
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "" {
+			t.Errorf("login request must not carry a token, got %q", r.Header.Get("X-Vault-Token"))
+		}
+		if client.Token() != "s.old-token" {
+			t.Errorf("expected the shared client to keep its token during the login, got %q", client.Token())
+		}
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.login-token","lease_duration":3600,"renewable":true}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := vault.NewClient(&vault.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetToken("s.old-token")
+
+	if _, err := login(t.Context(), client, AuthConfig{Method: AuthMethodAppRole, RoleID: "r", SecretID: "s"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "s.login-token" {
+		t.Errorf("expected the new token to be set, got %q", client.Token())
+	}
+}
+
+func TestLogin_Kubernetes(t *testing.T) {
+	client, received := newLoginTestClient(t, "auth/k8s-edge/login")
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtPath, []byte("eyJhbGciOi.jwt"), 0o600); err != nil {
+		t.Fatalf("failed to write jwt file: %v", err)
+	}
+
+	_, err := login(t.Context(), client, AuthConfig{
+		Method:              AuthMethodKubernetes,
+		KubernetesRole:      "edgectl",
+		KubernetesTokenPath: jwtPath,
+		KubernetesMount:     "k8s-edge",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if (*received)["role"] != "edgectl" || (*received)["jwt"] != "eyJhbGciOi.jwt" {
+		t.Errorf("unexpected login body: %v", *received)
+	}
+}
+
+func TestLogin_UnknownMethod(t *testing.T) {
+	client, _ := newLoginTestClient(t, "unused")
+
+	if _, err := login(t.Context(), client, AuthConfig{Method: "ldap"}); err == nil {
+		t.Fatal("expected error for unsupported auth method")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file defines the storage behind a Client. Every backend offers the same KV v2 semantics,
+so the records, locks and history built on top of it (everything in this package except the
+OpenBao-only policies and join tickets) work unchanged on each of them:
+- openbao: OpenBao's KV v2 secrets engine (see openbao.go), the default
+- file: a directory of encrypted documents on the local (or a shared) file system (see filestore.go)
+- kubernetes: Secrets in a namespace of a (management) Kubernetes cluster (see kubestore.go)
+- memory: a map in the process, for tests and dry runs (see memstore.go); it can't be configured
+
+The backend is selected with `store.backend` in the edgectl config file (EDGECTL_STORE_BACKEND).
+*/
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// Storage backends a Client can keep its data in.
+const (
+	BackendOpenBao    = "openbao"
+	BackendFile       = "file"
+	BackendKubernetes = "kubernetes"
+)
+
+// kvBackend is the storage behind a Client. Paths are KV v2 paths: secrets are read and
+// written at <mount>/data/<key>, listed and deleted with all their versions at <mount>/metadata/<key>.
+type kvBackend interface {
+	// read returns version of the secret at a data path (0 reads the current version) and that
+	// version's number. Missing, deleted and destroyed versions return nil data without error;
+	// the number is then 0 for a secret that was never written, else the number of the deleted version.
+	read(ctx context.Context, dataPath string, version int) (map[string]interface{}, int, error)
+
+	// write stores data as a new version of the secret at a data path. With cas >= 0 the write
+	// only succeeds while the current version equals cas (0: the secret must not exist yet);
+	// otherwise it fails with *ConflictError.
+	write(ctx context.Context, dataPath string, data map[string]interface{}, cas int) error
+
+	// list returns the keys directly under a metadata path, sub-directories with a trailing "/".
+	// A path without keys returns an empty list.
+	list(ctx context.Context, metadataPath string) ([]string, error)
+
+	// delete soft-deletes the current version of the secret at a data path, or removes the
+	// secret with all its versions at a metadata path. Deleting a missing secret is not an error.
+	delete(ctx context.Context, path string) error
+
+	// history returns the versions of the secret at a data path in any order, and the number of
+	// the current version. A secret that was never written (or was removed) returns no versions.
+	history(ctx context.Context, dataPath string) ([]SecretVersion, int, error)
+}
+
+// parseKVPath splits a KV v2 path into its kind ("data" or "metadata"), the mount and the key
+// below it. The key is empty for the root of a mount, which can only be listed.
+func parseKVPath(path string) (string, string, string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, s := range segments {
+		if s == "" {
+			return "", "", "", fmt.Errorf("invalid secret store path: %s", path)
+		}
+	}
+	for i := 1; i < len(segments); i++ {
+		if kind := segments[i]; kind == "data" || kind == "metadata" {
+			return kind, strings.Join(segments[:i], "/"), strings.Join(segments[i+1:], "/"), nil
+		}
+	}
+	return "", "", "", fmt.Errorf("'%s' is not a KV v2 path (expected <mount>/data/<key> or <mount>/metadata/<key>)", path)
+}
+
+// openbao returns the OpenBao API client for operations that only exist in OpenBao
+// (policies, tokens, response wrapping).
+func (c *Client) openbao() (*vault.Client, error) {
+	if c.VaultClient == nil {
+		return nil, errors.New("this operation needs the openbao secret store backend")
+	}
+	return c.VaultClient, nil
+}
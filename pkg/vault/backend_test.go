@@ -0,0 +1,241 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// backendConformance runs the KV v2 behaviour every storage backend must share against clients
+// returned by open, so the records, history and locks work the same on each backend.
+func backendConformance(t *testing.T, open func(t *testing.T) *Client) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, client *Client)
+	}{
+		{"GenericCRUD", conformanceGenericCRUD},
+		{"CASConflict", conformanceCASConflict},
+		{"TokenHistoryRollback", conformanceTokenHistoryRollback},
+		{"PrunesOldVersions", conformancePrunesOldVersions},
+		{"LocksAndMasters", conformanceLocksAndMasters},
+		{"DeleteClusterData", conformanceDeleteClusterData},
+		{"LoadBalancers", conformanceLoadBalancers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+func conformanceGenericCRUD(t *testing.T, client *Client) {
+	path := client.paths.Data("rke2", "c1", "custom")
+
+	if _, err := client.RetrieveSecret(t.Context(), path); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before the first write, got %v", err)
+	}
+	if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"key": "value", "count": 3}); err != nil {
+		t.Fatalf("StoreSecret: %v", err)
+	}
+
+	data, err := client.RetrieveSecret(t.Context(), path)
+	if err != nil {
+		t.Fatalf("RetrieveSecret: %v", err)
+	}
+	if data["key"] != "value" || toInt(data["count"]) != 3 {
+		t.Errorf("unexpected data: %v", data)
+	}
+
+	keys, err := client.ListKeys(t.Context(), client.paths.Metadata("rke2"))
+	if err != nil || !reflect.DeepEqual(keys, []string{"c1/"}) {
+		t.Errorf("expected [c1/], got %v (%v)", keys, err)
+	}
+	keys, err = client.ListKeys(t.Context(), client.paths.Metadata("rke2", "c1"))
+	if err != nil || !reflect.DeepEqual(keys, []string{"custom"}) {
+		t.Errorf("expected [custom], got %v (%v)", keys, err)
+	}
+
+	// A plain delete removes the current version only; the key is still listed
+	if err := client.DeleteSecret(t.Context(), path); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, err := client.RetrieveSecret(t.Context(), path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	history, err := client.SecretHistory(t.Context(), path)
+	if err != nil || len(history) != 1 || !history[0].Deleted() {
+		t.Errorf("expected one deleted version, got %+v (%v)", history, err)
+	}
+
+	// Deleting the metadata removes the key and the directories it leaves empty
+	if err := client.DeleteSecret(t.Context(), client.paths.Metadata("rke2", "c1", "custom")); err != nil {
+		t.Fatalf("DeleteSecret (metadata): %v", err)
+	}
+	keys, err = client.ListKeys(t.Context(), client.paths.Metadata("rke2"))
+	if err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys after removal, got %v (%v)", keys, err)
+	}
+	if _, err := client.SecretHistory(t.Context(), path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the history of a removed key, got %v", err)
+	}
+}
+
+func conformanceCASConflict(t *testing.T, client *Client) {
+	path := client.paths.Data("rke2", "c1", "masters")
+
+	if err := client.storeSecretCAS(t.Context(), path, map[string]interface{}{"n": 1}, 0); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	err := client.storeSecretCAS(t.Context(), path, map[string]interface{}{"n": 2}, 0)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Version != 0 {
+		t.Fatalf("expected a ConflictError for version 0, got %v", err)
+	}
+	if err := client.storeSecretCAS(t.Context(), path, map[string]interface{}{"n": 2}, 1); err != nil {
+		t.Errorf("write at the current version: %v", err)
+	}
+}
+
+func conformanceTokenHistoryRollback(t *testing.T, client *Client) {
+	for _, token := range []string{"K10aaa::server:one", "K10aaa::server:two"} {
+		if err := client.StoreJoinToken(t.Context(), "rke2", "c1", token); err != nil {
+			t.Fatalf("StoreJoinToken: %v", err)
+		}
+	}
+	first, err := client.RetrieveJoinTokenVersion(t.Context(), "rke2", "c1", 1)
+	if err != nil || first.Token != "K10aaa::server:one" {
+		t.Fatalf("expected version 1 to hold the first token, got %+v (%v)", first, err)
+	}
+
+	version, err := client.RollbackSecret(t.Context(), client.paths.Data("rke2", "c1", "token"), 1)
+	if err != nil || version != 3 {
+		t.Fatalf("expected rollback to write version 3, got %d (%v)", version, err)
+	}
+	current, err := client.RetrieveJoinToken(t.Context(), "rke2", "c1")
+	if err != nil || current.Token != "K10aaa::server:one" {
+		t.Errorf("expected the rolled back token, got %+v (%v)", current, err)
+	}
+
+	history, err := client.SecretHistory(t.Context(), client.paths.Data("rke2", "c1", "token"))
+	if err != nil || len(history) != 3 || !history[2].Current {
+		t.Errorf("expected 3 versions with the last one current, got %+v (%v)", history, err)
+	}
+}
+
+func conformancePrunesOldVersions(t *testing.T, client *Client) {
+	path := client.paths.Data("rke2", "c1", "custom")
+
+	for i := 1; i <= kvMaxVersions+2; i++ {
+		if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"n": i}); err != nil {
+			t.Fatalf("StoreSecret: %v", err)
+		}
+	}
+	history, err := client.SecretHistory(t.Context(), path)
+	if err != nil {
+		t.Fatalf("SecretHistory: %v", err)
+	}
+	if len(history) != kvMaxVersions || history[0].Version != 3 {
+		t.Errorf("expected versions 3-%d, got %+v", kvMaxVersions+2, history)
+	}
+	if _, err := client.RetrieveSecretVersion(t.Context(), path, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a pruned version, got %v", err)
+	}
+}
+
+func conformanceLocksAndMasters(t *testing.T, client *Client) {
+	fixedNow(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-b", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected ErrLockHeld, got %v", err)
+	}
+
+	if err := client.StoreMasterInfo(t.Context(), "rke2", "c1", "10.0.0.1", []string{"10.0.0.1"}, "10.0.0.100"); err != nil {
+		t.Fatalf("StoreMasterInfo: %v", err)
+	}
+	if err := client.StoreMasterInfo(t.Context(), "rke2", "c1", "10.0.0.2", []string{"10.0.0.2"}, ""); err != nil {
+		t.Fatalf("StoreMasterInfo: %v", err)
+	}
+	masters, err := client.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if err != nil {
+		t.Fatalf("RetrieveMasterInfo: %v", err)
+	}
+	if len(masters.Hosts) != 2 || masters.VIP != "10.0.0.100" {
+		t.Errorf("expected both masters and the VIP, got %+v", masters)
+	}
+}
+
+func conformanceDeleteClusterData(t *testing.T, client *Client) {
+	fixedNow(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	dir := t.TempDir()
+	kubeconfig, caCert, caKey := filepath.Join(dir, "kubeconfig.yaml"), filepath.Join(dir, "client-ca.crt"), filepath.Join(dir, "client-ca.key")
+	for path, content := range map[string]string{kubeconfig: "apiVersion: v1\nclusters: []\n", caCert: "cert", caKey: "key"} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	steps := []error{
+		client.StoreJoinToken(t.Context(), "rke2", "c1", "K10aaa::server:one"),
+		client.StoreAgentToken(t.Context(), "rke2", "c1", "K10aaa::node:two"),
+		client.StoreMasterInfo(t.Context(), "rke2", "c1", "10.0.0.1", []string{"10.0.0.1"}, "10.0.0.100"),
+		client.StoreLBInfo(t.Context(), "rke2", "c1", "lb1", "10.0.0.100", true),
+		client.StoreKubeConfig(t.Context(), "rke2", "c1", kubeconfig, "", 0),
+		client.StoreClientCA(t.Context(), "rke2", "c1", caCert, caKey),
+		client.StoreJoinToken(t.Context(), "rke2", "other", "K10bbb::server:three"),
+	}
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute); err != nil {
+		steps = append(steps, err)
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("storing cluster data: %v", err)
+		}
+	}
+
+	if err := client.DeleteClusterData(t.Context(), "rke2", "c1"); err != nil {
+		t.Fatalf("DeleteClusterData: %v", err)
+	}
+	if _, err := client.RetrieveCluster(t.Context(), "rke2", "c1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the deleted cluster, got %v", err)
+	}
+	// The client CA key can sign credentials for the cluster, so it must not outlive it
+	if _, err := client.RetrieveClientCA(t.Context(), "rke2", "c1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the client CA to be deleted, got %v", err)
+	}
+	if history, err := client.SecretHistory(t.Context(), client.paths.Data("rke2", "c1", "client-ca")); err == nil && len(history) > 0 {
+		t.Errorf("expected no versions of the client CA to be kept, got %d", len(history))
+	}
+	keys, err := client.ListKeys(t.Context(), client.paths.Metadata("rke2"))
+	if err != nil || !reflect.DeepEqual(keys, []string{"other/"}) {
+		t.Errorf("expected only the other cluster to remain, got %v (%v)", keys, err)
+	}
+}
+
+func conformanceLoadBalancers(t *testing.T, client *Client) {
+	nodes, vip, err := client.RetrieveLBInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(nodes) != 0 || vip != "" {
+		t.Fatalf("expected no load balancers yet, got %v %q (%v)", nodes, vip, err)
+	}
+
+	for _, err := range []error{
+		client.StoreLBInfo(t.Context(), "rke2", "c1", "lb1", "10.0.0.100", true),
+		client.StoreLBInfo(t.Context(), "rke2", "c1", "lb2", "10.0.0.100", false),
+		client.RemoveLBNode(t.Context(), "rke2", "c1", "lb2"),
+		client.RemoveLBNode(t.Context(), "rke2", "c1", "missing"),
+	} {
+		if err != nil {
+			t.Fatalf("managing load balancers: %v", err)
+		}
+	}
+
+	nodes, vip, err = client.RetrieveLBInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(nodes) != 1 || nodes[0].Hostname != "lb1" || vip != "10.0.0.100" {
+		t.Errorf("expected only lb1 to remain, got %v %q (%v)", nodes, vip, err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file handles what is needed to issue kubeconfigs to users:
+  - StoreClientCA: Uploads the client CA of the API server (certificate and key) from a server
+  - RetrieveClientCA: Fetches the client CA of a cluster to sign user certificates with
+  - SignWithPKI: Has an OpenBao PKI engine sign a certificate request instead, so the CA key never
+    leaves OpenBao
+
+The client CA is written by the first server and can only be read with the server policy or an
+operator token; agents and load balancers have no access to it.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// StoreClientCA reads the client CA certificate and key from the host and uploads them to the secret store.
+func (c *Client) StoreClientCA(ctx context.Context, distro, clusterID, certPath, keyPath string) error {
+	cert, err := os.ReadFile(certPath) //nolint:gosec // path comes from the distribution's fixed layout
+	if err != nil {
+		return fmt.Errorf("failed to read client CA certificate from path '%s': %w", certPath, err)
+	}
+	key, err := os.ReadFile(keyPath) //nolint:gosec // path comes from the distribution's fixed layout
+	if err != nil {
+		return fmt.Errorf("failed to read client CA key from path '%s': %w", keyPath, err)
+	}
+
+	data, err := encodeRecord(&ClientCARecord{SchemaVersion: CurrentSchemaVersion, Certificate: string(cert), Key: string(key)})
+	if err != nil {
+		return err
+	}
+	return c.StoreSecret(ctx, c.paths.Data(distro, clusterID, "client-ca"), data)
+}
+
+// RetrieveClientCA fetches the client CA of a cluster from the secret store.
+func (c *Client) RetrieveClientCA(ctx context.Context, distro, clusterID string) (*ClientCARecord, error) {
+	path := c.paths.Data(distro, clusterID, "client-ca")
+	data, err := c.RetrieveSecret(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	record := &ClientCARecord{}
+	if err := decodeRecord(path, data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// PKICertificate is a certificate signed by an OpenBao PKI engine.
+type PKICertificate struct {
+	Certificate  string
+	IssuingCA    string
+	SerialNumber string
+}
+
+// SignWithPKI has the PKI engine at mount sign a PEM certificate request with role, valid for ttl.
+// The sign-verbatim endpoint is used so the request's subject, which carries the Kubernetes user
+// and groups, is kept as is.
+func (c *Client) SignWithPKI(ctx context.Context, mount, role, csr string, ttl time.Duration) (*PKICertificate, error) {
+	api, err := c.openbao()
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s/sign-verbatim/%s", strings.Trim(mount, "/"), role)
+
+	var secret *vault.Secret
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		secret, err = api.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+			"csr":           csr,
+			"ttl":           ttl.String(),
+			"ext_key_usage": []string{"ClientAuth"},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate via '%s': %w", path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("failed to sign certificate via '%s': empty response", path)
+	}
+
+	cert := &PKICertificate{}
+	cert.Certificate, _ = secret.Data["certificate"].(string)
+	cert.IssuingCA, _ = secret.Data["issuing_ca"].(string)
+	cert.SerialNumber, _ = secret.Data["serial_number"].(string)
+	if cert.Certificate == "" {
+		return nil, fmt.Errorf("failed to sign certificate via '%s': the response holds no certificate", path)
+	}
+	return cert, nil
+}
@@ -4,27 +4,78 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 Package vault provides specialized handlers for cluster secrets management.
 
 This file handles cluster-level operations:
-- DeleteClusterData: Removes all secret store data for a given cluster (token, kubeconfig, masters, LB entries)
+- RetrieveCluster: Assembles every record stored for a cluster into a ClusterRecord
+- DeleteClusterData: Removes all secret store data for a given cluster (tokens, kubeconfig, masters, LB entries, locks)
 */
 package vault
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/michielvha/edgectl/pkg/logger"
 )
 
+// RetrieveCluster reads the server and agent tokens, master set, kubeconfig and load balancer records of a cluster.
+// Items that don't exist are left nil; ErrNotFound is returned only when none of them exist.
+// Records that don't match the schema are returned as a *ValidationError.
+func (c *Client) RetrieveCluster(ctx context.Context, distro, clusterID string) (*ClusterRecord, error) {
+	cluster := &ClusterRecord{SchemaVersion: CurrentSchemaVersion, Distro: distro, ClusterID: clusterID}
+
+	token, err := c.RetrieveJoinToken(ctx, distro, clusterID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	cluster.Token = token
+
+	agentToken, err := c.RetrieveAgentToken(ctx, distro, clusterID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	cluster.AgentToken = agentToken
+
+	masters, err := c.RetrieveMasterInfo(ctx, distro, clusterID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	cluster.Masters = masters
+
+	kubeconfig, err := c.RetrieveKubeconfigRecord(ctx, distro, clusterID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	cluster.Kubeconfig = kubeconfig
+
+	lbNodes, lbVIP, err := c.RetrieveLBInfo(ctx, distro, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	cluster.LBNodes = lbNodes
+
+	// The load balancer VIP is authoritative; fall back to the one recorded with the masters
+	cluster.VIP = lbVIP
+	if cluster.VIP == "" && masters != nil {
+		cluster.VIP = masters.VIP
+	}
+
+	if token == nil && agentToken == nil && masters == nil && kubeconfig == nil && len(lbNodes) == 0 {
+		return nil, fmt.Errorf("%w for %s cluster %s", ErrNotFound, distro, clusterID)
+	}
+	return cluster, nil
+}
+
 // DeleteClusterData permanently removes all secret store data for a cluster.
-// Uses kv/metadata/ prefix for permanent deletion of all KV v2 versions.
+// Uses the metadata path for permanent deletion of all KV v2 versions.
 // Errors are logged as warnings and do not stop the cleanup — best-effort deletion.
-func (c *Client) DeleteClusterData(distro, clusterID string) error {
-	basePath := fmt.Sprintf("kv/metadata/%s/%s", distro, clusterID)
+func (c *Client) DeleteClusterData(ctx context.Context, distro, clusterID string) error {
+	basePath := c.paths.Metadata(distro, clusterID)
 	var lastErr error
 
 	// Delete known fixed paths
-	for _, subpath := range []string{"token", "kubeconfig", "masters"} {
+	for _, subpath := range []string{"token", "agent-token", "kubeconfig", "client-ca", "masters"} {
 		path := fmt.Sprintf("%s/%s", basePath, subpath)
-		if err := c.DeleteSecret(path); err != nil {
+		if err := c.DeleteSecret(ctx, path); err != nil {
 			logger.Warn("Failed to delete %s: %v", path, err)
 			lastErr = err
 		} else {
@@ -32,27 +83,30 @@ func (c *Client) DeleteClusterData(distro, clusterID string) error {
 		}
 	}
 
-	// Delete all LB entries (list then delete each)
-	lbPath := fmt.Sprintf("%s/lb", basePath)
-	keys, err := c.ListKeys(lbPath)
-	if err == nil {
+	// Delete all LB entries and locks (list then delete each)
+	for _, dir := range []string{"lb", "locks"} {
+		dirPath := fmt.Sprintf("%s/%s", basePath, dir)
+		keys, err := c.ListKeys(ctx, dirPath)
+		if err != nil {
+			continue
+		}
 		for _, key := range keys {
-			path := fmt.Sprintf("%s/%s", lbPath, key)
-			if err := c.DeleteSecret(path); err != nil {
-				logger.Warn("Failed to delete LB entry %s: %v", path, err)
+			path := fmt.Sprintf("%s/%s", dirPath, key)
+			if err := c.DeleteSecret(ctx, path); err != nil {
+				logger.Warn("Failed to delete %s entry %s: %v", dir, path, err)
 				lastErr = err
 			} else {
-				logger.Debug("Deleted LB entry %s", path)
+				logger.Debug("Deleted %s entry %s", dir, path)
 			}
 		}
-		// Delete the LB directory itself
-		if err := c.DeleteSecret(lbPath); err != nil {
-			logger.Warn("Failed to delete LB path %s: %v", lbPath, err)
+		// Delete the directory itself
+		if err := c.DeleteSecret(ctx, dirPath); err != nil {
+			logger.Warn("Failed to delete %s path %s: %v", dir, dirPath, err)
 		}
 	}
 
 	// Delete the cluster root
-	if err := c.DeleteSecret(basePath); err != nil {
+	if err := c.DeleteSecret(ctx, basePath); err != nil {
 		logger.Warn("Failed to delete cluster root %s: %v", basePath, err)
 	}
 
@@ -0,0 +1,125 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file resolves the secret store connection settings. Every setting can be provided
+in the edgectl config file (under the `secretstore` key) or through an environment
+variable, with the config file taking precedence:
+
+	secretstore:
+	  address: https://bao:8200    # BAO_ADDR or VAULT_ADDR
+	  tls:
+	    ca_cert: /etc/edgectl/bao-ca.pem        # BAO_CACERT, --tls-ca-cert
+	    client_cert: /etc/edgectl/bao-client.pem # BAO_CLIENT_CERT, --tls-client-cert (mutual TLS)
+	    client_key: /etc/edgectl/bao-client.key  # BAO_CLIENT_KEY, --tls-client-key
+	    server_name: bao.internal  # BAO_TLS_SERVER_NAME, --tls-server-name
+	    skip_verify: false         # BAO_SKIP_VERIFY, --tls-skip-verify (testing only)
+	  auth:
+	    method: approle            # BAO_AUTH_METHOD: token | token_file | approle | kubernetes
+	    role_id_file: /etc/edgectl/role-id
+	    secret_id_file: /etc/edgectl/secret-id
+	  kv:
+	    mount: edge                # BAO_KV_MOUNT (default: kv)
+	    prefix: teams/platform     # BAO_KV_PREFIX (default: none)
+	  request_timeout: 30s         # BAO_REQUEST_TIMEOUT, per request attempt
+	  max_retries: 3               # BAO_MAX_RETRIES, for 5xx and connection errors
+	  retry_wait_min: 500ms        # BAO_RETRY_WAIT_MIN
+	  retry_wait_max: 10s          # BAO_RETRY_WAIT_MAX
+
+The storage backend is selected under the `store` key (see backend.go). The file and
+kubernetes backends use the kv mount and prefix above; the OpenBao connection and auth settings are ignored:
+
+	store:
+	  backend: file                # EDGECTL_STORE_BACKEND: openbao (default) | file | kubernetes
+	  file:
+	    path: /var/lib/edgectl/store    # EDGECTL_STORE_PATH
+	    key_file: /etc/edgectl/store.key # EDGECTL_STORE_KEY_FILE, created on first use
+	  kubernetes:
+	    namespace: edgectl         # EDGECTL_STORE_NAMESPACE (default: edgectl)
+	    kubeconfig: ~/.kube/mgmt   # EDGECTL_STORE_KUBECONFIG (default: in-cluster, $KUBECONFIG, ~/.kube/config)
+	    context: management        # EDGECTL_STORE_CONTEXT (default: the current context)
+*/
+package vault
+
+import (
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// Config holds the settings used by NewClientWithConfig to connect and authenticate.
+type Config struct {
+	// Backend is the storage backend: BackendOpenBao (also when empty), BackendFile or BackendKubernetes
+	Backend    string
+	File       FileConfig
+	Kubernetes KubernetesConfig
+	// Address is the OpenBao URL; empty keeps the SDK default (BAO_ADDR, VAULT_ADDR)
+	Address string
+	TLS     TLSConfig
+	Auth    AuthConfig
+	KV      KVPaths
+	Retry   RetryConfig
+}
+
+// FileConfig configures the file backend (see filestore.go).
+type FileConfig struct {
+	// Path is the directory holding the encrypted documents
+	Path string
+	// KeyFile holds the age identity the documents are encrypted with
+	KeyFile string
+}
+
+// KubernetesConfig configures the kubernetes backend (see kubestore.go).
+type KubernetesConfig struct {
+	// Namespace holds the Secrets (default DefaultKubernetesNamespace)
+	Namespace string
+	// Kubeconfig and Context select the cluster; without a kubeconfig the in-cluster
+	// service account is used when running in a pod, else $KUBECONFIG or ~/.kube/config
+	Kubeconfig string
+	Context    string
+}
+
+// LoadConfig resolves the secret store configuration from viper (config file) and the environment.
+func LoadConfig() Config {
+	return Config{
+		Backend: setting("store.backend", "EDGECTL_STORE_BACKEND"),
+		File: FileConfig{
+			Path:    valueOrDefault(setting("store.file.path", "EDGECTL_STORE_PATH"), DefaultFileStorePath),
+			KeyFile: valueOrDefault(setting("store.file.key_file", "EDGECTL_STORE_KEY_FILE"), DefaultFileStoreKeyFile),
+		},
+		Kubernetes: KubernetesConfig{
+			Namespace:  setting("store.kubernetes.namespace", "EDGECTL_STORE_NAMESPACE"),
+			Kubeconfig: setting("store.kubernetes.kubeconfig", "EDGECTL_STORE_KUBECONFIG"),
+			Context:    setting("store.kubernetes.context", "EDGECTL_STORE_CONTEXT"),
+		},
+		Address: setting("secretstore.address", "BAO_ADDR"),
+		TLS:     loadTLSConfig(),
+		Auth: AuthConfig{
+			Method:              setting("secretstore.auth.method", "BAO_AUTH_METHOD"),
+			Token:               setting("secretstore.auth.token", "BAO_TOKEN"),
+			TokenFile:           setting("secretstore.auth.token_file", "BAO_TOKEN_FILE"),
+			RoleID:              setting("secretstore.auth.role_id", "BAO_ROLE_ID"),
+			RoleIDFile:          setting("secretstore.auth.role_id_file", "BAO_ROLE_ID_FILE"),
+			SecretID:            setting("secretstore.auth.secret_id", "BAO_SECRET_ID"),
+			SecretIDFile:        setting("secretstore.auth.secret_id_file", "BAO_SECRET_ID_FILE"),
+			AppRoleMount:        setting("secretstore.auth.approle_mount", "BAO_APPROLE_MOUNT"),
+			KubernetesRole:      setting("secretstore.auth.kubernetes_role", "BAO_K8S_ROLE"),
+			KubernetesTokenPath: setting("secretstore.auth.kubernetes_token_path", "BAO_K8S_TOKEN_PATH"),
+			KubernetesMount:     setting("secretstore.auth.kubernetes_mount", "BAO_K8S_MOUNT"),
+		},
+		KV: KVPaths{
+			Mount:  valueOrDefault(setting("secretstore.kv.mount", "BAO_KV_MOUNT"), DefaultKVMount),
+			Prefix: setting("secretstore.kv.prefix", "BAO_KV_PREFIX"),
+		},
+		Retry: loadRetryConfig(),
+	}
+}
+
+// setting returns the config file value for key, falling back to the given environment variable.
+func setting(key, env string) string {
+	if v := viper.GetString(key); v != "" {
+		return v
+	}
+	return os.Getenv(env)
+}
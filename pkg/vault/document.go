@@ -0,0 +1,131 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the KV v2 versioning of the backends that store one document per secret
+(file and kubernetes): a kvDocument holds every version of a secret and applies check-and-set,
+soft deletes and version pruning the way OpenBao does. The backends only load and save it.
+*/
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// kvMaxVersions is how many versions of a secret a document keeps, like OpenBao's KV v2 default.
+const kvMaxVersions = 10
+
+// kvDocument holds all versions of a secret.
+type kvDocument struct {
+	CurrentVersion int                `json:"current_version"`
+	Versions       map[int]*kvVersion `json:"versions"`
+}
+
+// kvVersion is one version of a secret; Data is dropped when the version is destroyed.
+type kvVersion struct {
+	Data         map[string]interface{} `json:"data,omitempty"`
+	CreatedTime  time.Time              `json:"created_time"`
+	DeletionTime time.Time              `json:"deletion_time,omitzero"`
+	Destroyed    bool                   `json:"destroyed,omitempty"`
+}
+
+// deleted reports whether the version's data can't be read.
+func (v *kvVersion) deleted() bool {
+	return v.Destroyed || !v.DeletionTime.IsZero()
+}
+
+// newDocument returns the document of a secret that was never written.
+func newDocument() *kvDocument {
+	return &kvDocument{Versions: map[int]*kvVersion{}}
+}
+
+// decodeDocument parses a stored document. Numbers are decoded as json.Number, as the OpenBao client does.
+func decodeDocument(raw []byte) (*kvDocument, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	doc := newDocument()
+	if err := dec.Decode(doc); err != nil {
+		return nil, fmt.Errorf("invalid secret document: %w", err)
+	}
+	if doc.Versions == nil {
+		doc.Versions = map[int]*kvVersion{}
+	}
+	return doc, nil
+}
+
+// encode serializes the document for storage.
+func (d *kvDocument) encode() ([]byte, error) {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode secret document: %w", err)
+	}
+	return raw, nil
+}
+
+// get returns the data and number of version (0: the current one), following kvBackend.read.
+func (d *kvDocument) get(version int) (map[string]interface{}, int) {
+	if version == 0 {
+		version = d.CurrentVersion
+	}
+	v, ok := d.Versions[version]
+	if !ok {
+		return nil, 0
+	}
+	if v.deleted() {
+		return nil, version
+	}
+	return v.Data, version
+}
+
+// put adds data as a new version, following kvBackend.write: with cas >= 0 the current version
+// must equal cas, else *ConflictError is returned. The oldest versions beyond kvMaxVersions are pruned.
+func (d *kvDocument) put(path string, data map[string]interface{}, cas int) error {
+	if cas >= 0 && cas != d.CurrentVersion {
+		return &ConflictError{Path: path, Version: cas}
+	}
+
+	// Keep the data as it will be read back, so the caller's map isn't shared
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+	var stored map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&stored); err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+
+	d.CurrentVersion++
+	d.Versions[d.CurrentVersion] = &kvVersion{Data: stored, CreatedTime: now().UTC()}
+	delete(d.Versions, d.CurrentVersion-kvMaxVersions)
+	return nil
+}
+
+// softDelete marks the current version deleted. It reports false if there was nothing to delete.
+func (d *kvDocument) softDelete() bool {
+	v, ok := d.Versions[d.CurrentVersion]
+	if !ok || v.deleted() {
+		return false
+	}
+	v.DeletionTime = now().UTC()
+	return true
+}
+
+// history lists the versions in any order and the current version number, following kvBackend.history.
+func (d *kvDocument) history() ([]SecretVersion, int) {
+	versions := make([]SecretVersion, 0, len(d.Versions))
+	for number, v := range d.Versions {
+		versions = append(versions, SecretVersion{
+			Version:      number,
+			CreatedTime:  v.CreatedTime,
+			DeletionTime: v.DeletionTime,
+			Destroyed:    v.Destroyed,
+		})
+	}
+	return versions, d.CurrentVersion
+}
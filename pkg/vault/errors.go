@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file defines the errors returned by SecretStore implementations so callers can react
+to specific conditions with errors.Is / errors.As instead of matching on message text:
+- ErrNotFound: nothing is stored at the requested path
+- ConflictError (matches ErrConflict): a check-and-set write lost against a concurrent writer
+- LockHeldError (matches ErrLockHeld): a lock is held by someone else
+- ValidationError (matches ErrInvalidRecord): stored data doesn't match the record schema
+*/
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned (wrapped) when no data exists at a path.
+var ErrNotFound = errors.New("no data found")
+
+// ErrConflict is matched by every ConflictError via errors.Is.
+var ErrConflict = errors.New("check-and-set conflict")
+
+// ConflictError reports that a check-and-set write was rejected because the secret
+// was modified after it was read. Callers may re-read and retry.
+type ConflictError struct {
+	Path    string
+	Version int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("check-and-set conflict at path '%s': secret changed since version %d", e.Path, e.Version)
+}
+
+// Is makes errors.Is(err, ErrConflict) true for any ConflictError.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ErrLockHeld is matched by every LockHeldError via errors.Is.
+var ErrLockHeld = errors.New("lock is held")
+
+// LockHeldError reports that a lock is currently held by another holder.
+type LockHeldError struct {
+	Name      string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("lock '%s' is held by %s until %s", e.Name, e.Holder, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrLockHeld) true for any LockHeldError.
+func (e *LockHeldError) Is(target error) bool {
+	return target == ErrLockHeld
+}
+
+// ErrInvalidRecord is matched by every ValidationError via errors.Is.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// ValidationError reports that data stored at a path doesn't decode into the expected record.
+type ValidationError struct {
+	Path   string
+	Record string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Record == "" {
+		return fmt.Sprintf("invalid record at path '%s': %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s record at path '%s': %s", e.Record, e.Path, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrInvalidRecord) true for any ValidationError.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidRecord
+}
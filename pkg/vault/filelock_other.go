@@ -0,0 +1,21 @@
+//go:build !unix && !windows
+
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+*/
+package vault
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile fails: this platform has no file locking, so the file backend can't be shared safely.
+func tryLockFile(f *os.File, exclusive bool) (bool, error) {
+	return false, errors.New("the file secret store backend is not supported on this platform")
+}
+
+// unlockFile releases the lock taken by tryLockFile.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,396 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the file storage backend, for lab setups and single-node edge boxes
+where running OpenBao is too heavy:
+- NewFileStore: Opens (and creates) a store directory, returning a Client that keeps its data there
+
+Every secret is one document at <path>/<mount>/<key>.age holding all its versions (see
+document.go), so the records, history and rollback work as they do on OpenBao. Documents are JSON encrypted with an
+age X25519 key, which is read from the key file (and generated there on first use).
+
+Each operation holds an advisory lock on <path>/.lock (exclusive for writes, shared for reads)
+and documents are replaced atomically, so several edgectl processes — also on different hosts
+sharing the directory over NFS, given a lock-capable mount and the same key file — can use one
+store. Check-and-set writes, and with them the cluster locks, behave as on OpenBao.
+*/
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/michielvha/edgectl/pkg/crypt"
+)
+
+// Defaults for the file backend settings.
+const (
+	DefaultFileStorePath    = "/var/lib/edgectl/store"
+	DefaultFileStoreKeyFile = "/etc/edgectl/store.key"
+)
+
+const (
+	// fileStoreExt is the extension of secret documents
+	fileStoreExt = ".age"
+	// fileStoreLock is the lock file in the store directory
+	fileStoreLock = ".lock"
+)
+
+// fileKV stores secrets as encrypted documents in a directory.
+type fileKV struct {
+	root      string
+	identity  *age.X25519Identity
+	recipient age.Recipient
+}
+
+// Compile-time check: fileKV must satisfy kvBackend.
+var _ kvBackend = (*fileKV)(nil)
+
+// NewFileStore opens the file store directory of cfg, creating it and the key file if they don't
+// exist yet, and returns a client that stores cluster data there under the kv path layout.
+func NewFileStore(cfg FileConfig, kv KVPaths) (*Client, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("the file secret store needs a path (store.file.path)")
+	}
+	if cfg.KeyFile == "" {
+		return nil, fmt.Errorf("the file secret store needs a key file (store.file.key_file)")
+	}
+	if err := os.MkdirAll(cfg.Path, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create secret store directory: %w", err)
+	}
+	identity, err := loadOrCreateKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		paths: kv,
+		kv:    &fileKV{root: cfg.Path, identity: identity, recipient: identity.Recipient()},
+	}, nil
+}
+
+// loadOrCreateKey reads the age identity in path, generating it first if the file doesn't exist.
+func loadOrCreateKey(path string) (*age.X25519Identity, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // path comes from trusted config
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := createKey(path); err != nil && !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		// Read back what was written, also when another process created the key first
+		raw, err = os.ReadFile(path) //nolint:gosec // path comes from trusted config
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store key: %w", err)
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret store key %s: %w", path, err)
+	}
+	identity, ok := identities[0].(*age.X25519Identity)
+	if !ok || len(identities) != 1 {
+		return nil, fmt.Errorf("invalid secret store key %s: expected a single age X25519 identity", path)
+	}
+	return identity, nil
+}
+
+// createKey writes a new age identity to path, readable by the owner only. It fails with
+// fs.ErrExist if the file was created in the meantime.
+func createKey(path string) error {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return fmt.Errorf("failed to generate secret store key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create secret store key: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec // path comes from trusted config
+	if err != nil {
+		return fmt.Errorf("failed to create secret store key: %w", err)
+	}
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", now().UTC().Format(time.RFC3339), identity.Recipient(), identity)
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write secret store key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write secret store key: %w", err)
+	}
+	return nil
+}
+
+// splitKVPath splits a KV v2 path into its kind ("data" or "metadata"), the file system path
+// of the key relative to the store root (<mount>/<key>) and whether the key is empty.
+// Segments that could escape the store or name its lock and temporary files are rejected.
+func splitKVPath(path string) (string, string, bool, error) {
+	kind, mount, key, err := parseKVPath(path)
+	if err != nil {
+		return "", "", false, err
+	}
+	rel := mount
+	if key != "" {
+		rel += "/" + key
+	}
+	for _, s := range strings.Split(rel, "/") {
+		if strings.HasPrefix(s, ".") || strings.ContainsAny(s, `\:`) {
+			return "", "", false, fmt.Errorf("invalid secret store path: %s", path)
+		}
+	}
+	return kind, filepath.FromSlash(rel), key == "", nil
+}
+
+// document returns the file of the secret at a data or metadata path, and the path's kind.
+func (f *fileKV) document(path string) (string, string, error) {
+	kind, rel, empty, err := splitKVPath(path)
+	if err != nil {
+		return "", "", err
+	}
+	if empty {
+		return "", "", fmt.Errorf("'%s' has no key", path)
+	}
+	return filepath.Join(f.root, rel+fileStoreExt), kind, nil
+}
+
+// fileLockPoll is the backoff between attempts to take a store lock held by another process.
+var fileLockPoll = RetryConfig{WaitMin: 10 * time.Millisecond, WaitMax: 500 * time.Millisecond}
+
+// locked runs fn while holding the store lock. Waiting for the lock stops when ctx is done, so a
+// process stuck while holding it can't hang the caller; once taken, fn runs to completion since
+// operations are short and leave no partial state behind.
+func (f *fileKV) locked(ctx context.Context, exclusive bool, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(filepath.Join(f.root, fileStoreLock), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open secret store lock: %w", err)
+	}
+	defer func() { _ = lock.Close() }()
+
+	for attempt := 1; ; attempt++ {
+		acquired, err := tryLockFile(lock, exclusive)
+		if err != nil {
+			return fmt.Errorf("failed to lock secret store: %w", err)
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the secret store lock %s: %w", lock.Name(), ctx.Err())
+		case <-time.After(fileLockPoll.backoff(attempt)):
+		}
+	}
+	defer func() { _ = unlockFile(lock) }()
+	return fn()
+}
+
+// load reads and decrypts a document; a missing file returns nil without error.
+func (f *fileKV) load(file string) (*kvDocument, error) {
+	sealed, err := os.ReadFile(file) //nolint:gosec // file is built from a validated path below the store root
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := crypt.Open(sealed, []age.Identity{f.identity})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return doc, nil
+}
+
+// save encrypts a document and atomically replaces file with it.
+func (f *fileKV) save(file string, doc *kvDocument) error {
+	raw, err := doc.encode()
+	if err != nil {
+		return err
+	}
+	sealed, err := crypt.Seal(raw, []age.Recipient{f.recipient})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // no-op once renamed
+
+	if _, err := tmp.Write(sealed); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// remove deletes file and the directories it leaves empty, up to the store root.
+func (f *fileKV) remove(file string) error {
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for dir := filepath.Dir(file); dir != f.root && strings.HasPrefix(dir, f.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil { // fails when the directory isn't empty
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fileKV) read(ctx context.Context, dataPath string, version int) (map[string]interface{}, int, error) {
+	file, kind, err := f.document(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	var data map[string]interface{}
+	number := 0
+	err = f.locked(ctx, false, func() error {
+		doc, err := f.load(file)
+		if err != nil || doc == nil {
+			return err
+		}
+		data, number = doc.get(version)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, number, nil
+}
+
+func (f *fileKV) write(ctx context.Context, dataPath string, data map[string]interface{}, cas int) error {
+	file, kind, err := f.document(dataPath)
+	if err != nil {
+		return err
+	}
+	if kind != "data" {
+		return fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	return f.locked(ctx, true, func() error {
+		doc, err := f.load(file)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			doc = newDocument()
+		}
+		if err := doc.put(dataPath, data, cas); err != nil {
+			return err
+		}
+		return f.save(file, doc)
+	})
+}
+
+func (f *fileKV) list(ctx context.Context, metadataPath string) ([]string, error) {
+	kind, rel, _, err := splitKVPath(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "metadata" {
+		return nil, fmt.Errorf("'%s' is not a KV v2 metadata path", metadataPath)
+	}
+
+	keys := []string{}
+	err = f.locked(ctx, false, func() error {
+		entries, err := os.ReadDir(filepath.Join(f.root, rel))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			switch {
+			case strings.HasPrefix(name, "."):
+				// lock and temporary files
+			case entry.IsDir():
+				keys = append(keys, name+"/")
+			case strings.HasSuffix(name, fileStoreExt):
+				keys = append(keys, strings.TrimSuffix(name, fileStoreExt))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (f *fileKV) delete(ctx context.Context, path string) error {
+	file, kind, err := f.document(path)
+	if err != nil {
+		return err
+	}
+
+	return f.locked(ctx, true, func() error {
+		if kind == "metadata" {
+			return f.remove(file)
+		}
+
+		doc, err := f.load(file)
+		if err != nil || doc == nil || !doc.softDelete() {
+			return err
+		}
+		return f.save(file, doc)
+	})
+}
+
+func (f *fileKV) history(ctx context.Context, dataPath string) ([]SecretVersion, int, error) {
+	file, kind, err := f.document(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	var versions []SecretVersion
+	current := 0
+	err = f.locked(ctx, false, func() error {
+		doc, err := f.load(file)
+		if err != nil || doc == nil {
+			return err
+		}
+		versions, current = doc.history()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return versions, current, nil
+}
@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFileStoreClient opens a file store in a temporary directory.
+func newFileStoreClient(t *testing.T) (*Client, FileConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := FileConfig{Path: filepath.Join(dir, "store"), KeyFile: filepath.Join(dir, "store.key")}
+	client, err := NewFileStore(cfg, DefaultKVPaths())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return client, cfg
+}
+
+func TestFileStore_Conformance(t *testing.T) {
+	backendConformance(t, func(t *testing.T) *Client {
+		client, _ := newFileStoreClient(t)
+		return client
+	})
+}
+
+func TestFileStore_RemovesEmptyDirectories(t *testing.T) {
+	client, cfg := newFileStoreClient(t)
+	if err := client.StoreLBInfo(t.Context(), "rke2", "c1", "lb1", "10.0.0.100", true); err != nil {
+		t.Fatalf("StoreLBInfo: %v", err)
+	}
+	if err := client.DeleteSecret(t.Context(), client.paths.Metadata("rke2", "c1", "lb", "lb1")); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Path, DefaultKVMount, "rke2")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty directories to be removed, got %v", err)
+	}
+	if _, err := os.Stat(cfg.Path); err != nil {
+		t.Errorf("expected the store directory to remain, got %v", err)
+	}
+}
+
+func TestFileStore_ConcurrentWritersShareTheStore(t *testing.T) {
+	_, cfg := newFileStoreClient(t)
+
+	// Every joining server opens the store on its own, as separate edgectl processes would
+	const servers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, servers)
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := NewFileStore(cfg, DefaultKVPaths())
+			if err != nil {
+				errs <- err
+				return
+			}
+			ip := fmt.Sprintf("10.0.0.%d", i+1)
+			errs <- client.StoreMasterInfo(t.Context(), "rke2", "c1", ip, []string{ip}, "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("StoreMasterInfo: %v", err)
+		}
+	}
+
+	client, err := NewFileStore(cfg, DefaultKVPaths())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	masters, err := client.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(masters.Hosts) != servers {
+		t.Errorf("expected %d masters, got %+v (%v)", servers, masters, err)
+	}
+}
+
+// A process stuck while holding the store lock must not hang callers past their context
+func TestFileStore_LockWaitStopsWithContext(t *testing.T) {
+	client, cfg := newFileStoreClient(t)
+	holder, err := os.OpenFile(filepath.Join(cfg.Path, fileStoreLock), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if acquired, err := tryLockFile(holder, true); err != nil || !acquired {
+		t.Fatalf("expected to take the lock, got %v (%v)", acquired, err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.RetrieveJoinToken(ctx, "rke2", "c1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to stop at the deadline, got %v", err)
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("expected to give up shortly after the deadline, waited %s", waited)
+	}
+
+	// Once the holder lets go, the store works again
+	if err := unlockFile(holder); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.StoreJoinToken(t.Context(), "rke2", "c1", "K10aaa::server:one"); err != nil {
+		t.Errorf("expected the store to work after the lock was released, got %v", err)
+	}
+}
+
+func TestFileStore_EncryptsWithKeyFile(t *testing.T) {
+	client, cfg := newFileStoreClient(t)
+	if err := client.StoreJoinToken(t.Context(), "rke2", "c1", "K10aaa::server:plaintext-secret"); err != nil {
+		t.Fatalf("StoreJoinToken: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(cfg.Path, DefaultKVMount, "rke2", "c1", "token"+fileStoreExt))
+	if err != nil {
+		t.Fatalf("reading the document: %v", err)
+	}
+	if strings.Contains(string(raw), "plaintext-secret") {
+		t.Error("expected the document to be encrypted")
+	}
+	info, err := os.Stat(cfg.KeyFile)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a key file with mode 0600, got %v (%v)", info, err)
+	}
+
+	// Reopening with the same key reads the data; another key can't
+	reopened, err := NewFileStore(cfg, DefaultKVPaths())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if token, err := reopened.RetrieveJoinToken(t.Context(), "rke2", "c1"); err != nil || token.Token != "K10aaa::server:plaintext-secret" {
+		t.Errorf("expected the token with the same key, got %+v (%v)", token, err)
+	}
+	other, err := NewFileStore(FileConfig{Path: cfg.Path, KeyFile: filepath.Join(t.TempDir(), "other.key")}, DefaultKVPaths())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := other.RetrieveJoinToken(t.Context(), "rke2", "c1"); err == nil {
+		t.Error("expected reading with another key to fail")
+	}
+}
+
+func TestFileStore_Errors(t *testing.T) {
+	client, _ := newFileStoreClient(t)
+
+	for _, path := range []string{"kv/data/../../etc/passwd", "kv/data/.lock", "kv/nothing/key", "kv/data"} {
+		if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"k": "v"}); err == nil {
+			t.Errorf("expected an error for path %q", path)
+		}
+	}
+	if _, err := client.CreateScopedToken(t.Context(), "policy", time.Minute); err == nil {
+		t.Error("expected OpenBao-only operations to fail on the file backend")
+	}
+	if _, err := NewFileStore(FileConfig{KeyFile: "store.key"}, DefaultKVPaths()); err == nil {
+		t.Error("expected an error without a path")
+	}
+}
+
+func TestNewClient_SelectsBackend(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("EDGECTL_STORE_BACKEND", BackendFile)
+	t.Setenv("EDGECTL_STORE_PATH", filepath.Join(dir, "store"))
+	t.Setenv("EDGECTL_STORE_KEY_FILE", filepath.Join(dir, "store.key"))
+
+	client, err := NewClient(t.Context())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if client.VaultClient != nil {
+		t.Error("expected a file store client without an OpenBao client")
+	}
+	if _, ok := client.kv.(*fileKV); !ok {
+		t.Errorf("expected the file backend, got %T", client.kv)
+	}
+
+	t.Setenv("EDGECTL_STORE_BACKEND", "etcd")
+	if _, err := NewClient(t.Context()); err == nil || !strings.Contains(err.Error(), "unsupported secret store backend") {
+		t.Errorf("expected an unsupported backend error, got %v", err)
+	}
+}
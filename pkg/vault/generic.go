@@ -6,10 +6,12 @@ Package vault provides a client for interacting with OpenBao (Vault-compatible s
 This file implements the generic secret store client that provides basic CRUD operations
 for secrets management. It offers a clean abstraction over the OpenBao API for:
 - Creating and initializing a secret store client
+- Bounding every request with a timeout and retrying transient failures (see retry.go)
 - Storing secrets at specific paths
 - Retrieving secrets from paths
 - Listing keys under a path
 - Deleting a secret under a given path
+- Check-and-set read-modify-write for records updated by several nodes concurrently
 
 This generic implementation serves as the foundation for more specialized
 secret store interactions defined elsewhere in the package.
@@ -17,39 +19,120 @@ secret store interactions defined elsewhere in the package.
 package vault
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"math/rand/v2"
+	"time"
 
 	vault "github.com/openbao/openbao/api/v2"
 
 	"github.com/michielvha/edgectl/pkg/logger"
 )
 
+// Client is a secret store client. Its data lives in OpenBao (VaultClient) or, for the
+// alternative backends, wherever kv keeps it; VaultClient is then nil.
 type Client struct {
 	VaultClient *vault.Client
+
+	// kv stores the secrets (see backend.go)
+	kv kvBackend
+
+	// paths builds the KV v2 paths for cluster data
+	paths KVPaths
+
+	// retry sets the per-request timeout and the retries for transient errors
+	retry RetryConfig
+
+	// stopRenewal stops the token lifetime watcher, if one was started
+	stopRenewal func()
+}
+
+// NewClient creates a secret store client using the configuration from the edgectl config file and environment:
+// an authenticated OpenBao client, or a client for the configured store backend (see backend.go).
+func NewClient(ctx context.Context) (*Client, error) {
+	cfg := LoadConfig()
+	switch cfg.Backend {
+	case "", BackendOpenBao:
+		return NewClientWithConfig(ctx, cfg)
+	case BackendFile:
+		return NewFileStore(cfg.File, cfg.KV)
+	case BackendKubernetes:
+		return NewKubernetesStore(cfg.Kubernetes, cfg.KV, cfg.Retry)
+	default:
+		return nil, fmt.Errorf("unsupported secret store backend %q (expected %s, %s or %s)", cfg.Backend, BackendOpenBao, BackendFile, BackendKubernetes)
+	}
+}
+
+// NewClientWithConfig creates a secret store client and authenticates it with the configured auth method.
+// Tokens obtained through a login are renewed in the background until Close is called.
+// ctx bounds the login; requests made later use the context passed to each method.
+func NewClientWithConfig(ctx context.Context, cfg Config) (*Client, error) {
+	c, err := newUnauthenticatedClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkTLS(ctx, cfg.TLS); err != nil {
+		return nil, err
+	}
+	client := c.VaultClient
+
+	var secret *vault.Secret
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		secret, err = login(ctx, client, cfg.Auth)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if secret != nil && secret.Auth != nil && secret.Auth.Renewable {
+		c.stopRenewal = startRenewal(client, cfg.Auth, secret)
+	}
+	return c, nil
 }
 
-func NewClient() (*Client, error) {
-	// The OpenBao SDK reads VAULT_ADDR from the environment automatically.
+// newUnauthenticatedClient creates a secret store client without logging in.
+func newUnauthenticatedClient(cfg Config) (*Client, error) {
+	// The OpenBao SDK reads VAULT_ADDR and the TLS variables from the environment automatically.
 	config := vault.DefaultConfig()
+	if cfg.Address != "" {
+		config.Address = cfg.Address
+	}
+	if err := configureTLS(config, cfg.TLS); err != nil {
+		return nil, err
+	}
+	// Retries are done by withRetry so they respect the caller's context and request timeout
+	config.MaxRetries = 0
 	client, err := vault.NewClient(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create secret store client: %w", err)
 	}
-	token := os.Getenv("BAO_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("BAO_TOKEN not set")
+	c := &Client{VaultClient: client, paths: cfg.KV, retry: cfg.Retry}
+	c.kv = &openbaoKV{c: c}
+	return c, nil
+}
+
+// Paths returns the KV v2 path layout (mount and prefix) this client stores cluster data under.
+func (c *Client) Paths() KVPaths {
+	return c.paths
+}
+
+// Close stops background token renewal. The client must not be used afterwards.
+func (c *Client) Close() {
+	if c.stopRenewal != nil {
+		c.stopRenewal()
+		c.stopRenewal = nil
 	}
-	client.SetToken(token)
-	return &Client{VaultClient: client}, nil
 }
 
 // InitVaultClient centralizes secret store client creation and error handling.
 // Returns nil if the client initialization failed.
 // Use this in cmd/ handlers; use NewClient() in pkg/ code that propagates errors.
-func InitVaultClient() *Client {
+func InitVaultClient(ctx context.Context) *Client {
 	logger.Debug("initializing secret store client")
-	vaultClient, err := NewClient()
+	vaultClient, err := NewClient(ctx)
 	if err != nil {
 		fmt.Printf("❌ failed to initialize secret store client: %v\n", err)
 		return nil
@@ -58,66 +141,109 @@ func InitVaultClient() *Client {
 }
 
 // StoreSecret stores any secret (key-value map) under a given path
-func (c *Client) StoreSecret(fullVaultPath string, data map[string]interface{}) error {
-	_, err := c.VaultClient.Logical().Write(fullVaultPath, map[string]interface{}{
-		"data": data,
-	})
-	if err != nil {
+func (c *Client) StoreSecret(ctx context.Context, fullVaultPath string, data map[string]interface{}) error {
+	if err := c.kv.write(ctx, fullVaultPath, data, -1); err != nil {
 		return fmt.Errorf("failed to store secret at path '%s': %w", fullVaultPath, err)
 	}
 	return nil
 }
 
 // RetrieveSecret retrieves a key-value map from a given path
-func (c *Client) RetrieveSecret(fullVaultPath string) (map[string]interface{}, error) {
-	secret, err := c.VaultClient.Logical().Read(fullVaultPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read secret at path '%s': %w", fullVaultPath, err)
-	}
-	if secret == nil || secret.Data == nil {
-		return nil, fmt.Errorf("no data found at path: %s", fullVaultPath)
-	}
-	data, ok := secret.Data["data"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid data format at path: %s", fullVaultPath)
-	}
-	return data, nil
+func (c *Client) RetrieveSecret(ctx context.Context, fullVaultPath string) (map[string]interface{}, error) {
+	return c.RetrieveSecretVersion(ctx, fullVaultPath, 0)
 }
 
-// ListKeys lists all keys at a given path
-func (c *Client) ListKeys(fullVaultPath string) ([]string, error) {
-	secret, err := c.VaultClient.Logical().List(fullVaultPath)
+// readSecretVersion reads a secret together with its current KV v2 version.
+// A missing or deleted secret returns nil data without error; the version is then
+// 0 for a path that was never written, or the version of the deleted entry.
+func (c *Client) readSecretVersion(ctx context.Context, fullVaultPath string) (map[string]interface{}, int, error) {
+	data, version, err := c.kv.read(ctx, fullVaultPath, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list keys at path '%s': %w", fullVaultPath, err)
+		return nil, 0, fmt.Errorf("failed to read secret at path '%s': %w", fullVaultPath, err)
 	}
-	if secret == nil || secret.Data == nil {
-		return []string{}, nil // Return empty slice for non-existent paths
+	return data, version, nil
+}
+
+// storeSecretCAS writes a secret only if its current version still equals version
+// (0 means the secret must not exist yet). A lost race is reported as *ConflictError.
+func (c *Client) storeSecretCAS(ctx context.Context, fullVaultPath string, data map[string]interface{}, version int) error {
+	err := c.kv.write(ctx, fullVaultPath, data, version)
+	if err != nil && !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("failed to store secret at path '%s': %w", fullVaultPath, err)
 	}
+	return err
+}
+
+// maxCASAttempts bounds how often updateSecretCAS re-reads and retries after a conflict.
+const maxCASAttempts = 5
+
+// casRetryDelay is the base delay between check-and-set attempts. Tests can lower it.
+var casRetryDelay = 200 * time.Millisecond
+
+// updateSecretCAS performs a read-modify-write of the secret at fullVaultPath using check-and-set.
+// mutate receives the current data (nil if the secret does not exist) and returns the data to store.
+// On a conflict the secret is re-read and mutate is applied again, up to maxCASAttempts times;
+// after that the last *ConflictError is returned.
+func (c *Client) updateSecretCAS(ctx context.Context, fullVaultPath string, mutate func(current map[string]interface{}) (map[string]interface{}, error)) error {
+	var err error
+	for attempt := 1; attempt <= maxCASAttempts; attempt++ {
+		current, version, readErr := c.readSecretVersion(ctx, fullVaultPath)
+		if readErr != nil {
+			return readErr
+		}
+
+		updated, mutateErr := mutate(current)
+		if mutateErr != nil {
+			return mutateErr
+		}
+
+		err = c.storeSecretCAS(ctx, fullVaultPath, updated, version)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
 
-	keysRaw, ok := secret.Data["keys"]
-	if !ok {
-		return []string{}, nil
+		logger.Debug("check-and-set conflict on %s (attempt %d/%d), retrying", fullVaultPath, attempt, maxCASAttempts)
+		if sleepErr := sleep(ctx, casBackoff(attempt)); sleepErr != nil {
+			return sleepErr
+		}
 	}
+	return err
+}
 
-	keysInterface, ok := keysRaw.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid keys format at path: %s", fullVaultPath)
+// casBackoff returns a linearly growing delay with jitter so concurrent writers don't retry in lockstep.
+func casBackoff(attempt int) time.Duration {
+	if casRetryDelay <= 0 {
+		return 0
 	}
+	return time.Duration(attempt)*casRetryDelay + rand.N(casRetryDelay) //nolint:gosec // jitter does not need a secure source
+}
 
-	keys := make([]string, 0, len(keysInterface))
-	for _, k := range keysInterface {
-		if strKey, ok := k.(string); ok {
-			keys = append(keys, strKey)
-		}
+// toInt converts a numeric value decoded from an API response (json.Number or float64) to an int.
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	case float64:
+		return int(n)
+	case int:
+		return n
 	}
+	return 0
+}
 
+// ListKeys lists all keys at a given path
+func (c *Client) ListKeys(ctx context.Context, fullVaultPath string) ([]string, error) {
+	keys, err := c.kv.list(ctx, fullVaultPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys at path '%s': %w", fullVaultPath, err)
+	}
 	return keys, nil
 }
 
 // DeleteSecret deletes a secret at a specific path
-func (c *Client) DeleteSecret(fullVaultPath string) error {
-	_, err := c.VaultClient.Logical().Delete(fullVaultPath)
-	if err != nil {
+func (c *Client) DeleteSecret(ctx context.Context, fullVaultPath string) error {
+	if err := c.kv.delete(ctx, fullVaultPath); err != nil {
 		return fmt.Errorf("failed to delete secret at path '%s': %w", fullVaultPath, err)
 	}
 	return nil
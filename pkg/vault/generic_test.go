@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// casStubServer is a minimal KV v2 endpoint for a single secret that honours options.cas.
+// conflicts makes the next N writes fail with a check-and-set mismatch, simulating a concurrent writer.
+type casStubServer struct {
+	mu        sync.Mutex
+	data      map[string]interface{}
+	version   int
+	conflicts int
+	writes    int
+}
+
+func (s *casStubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.version == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     s.data,
+				"metadata": map[string]interface{}{"version": s.version},
+			},
+		})
+	case http.MethodPut, http.MethodPost:
+		s.writes++
+		var body struct {
+			Options map[string]interface{} `json:"options"`
+			Data    map[string]interface{} `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		cas, hasCAS := body.Options["cas"].(float64)
+		if s.conflicts > 0 || (hasCAS && int(cas) != s.version) {
+			if s.conflicts > 0 {
+				s.conflicts--
+				// Someone else wrote in between
+				s.version++
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		s.data = body.Data
+		s.version++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": s.version}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newStubClient returns a Client talking to the given handler.
+func newStubClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	api, err := vault.NewClient(&vault.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	api.SetToken("test-token")
+	c := &Client{VaultClient: api, paths: DefaultKVPaths()}
+	c.kv = &openbaoKV{c: c}
+	return c
+}
+
+// noCASDelay disables the check-and-set retry delay for the duration of a test.
+func noCASDelay(t *testing.T) {
+	t.Helper()
+	original := casRetryDelay
+	casRetryDelay = 0
+	t.Cleanup(func() { casRetryDelay = original })
+}
+
+func TestUpdateSecretCAS_RetriesOnConflict(t *testing.T) {
+	noCASDelay(t)
+	stub := &casStubServer{conflicts: 2}
+	client := newStubClient(t, stub)
+
+	calls := 0
+	err := client.updateSecretCAS(t.Context(), "kv/data/test", func(current map[string]interface{}) (map[string]interface{}, error) {
+		calls++
+		return map[string]interface{}{"value": "ok"}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected mutate to run 3 times (2 conflicts + success), got %d", calls)
+	}
+	if stub.data["value"] != "ok" {
+		t.Errorf("expected value to be stored, got %v", stub.data)
+	}
+}
+
+func TestUpdateSecretCAS_ReturnsConflictErrorWhenExhausted(t *testing.T) {
+	noCASDelay(t)
+	stub := &casStubServer{conflicts: maxCASAttempts}
+	client := newStubClient(t, stub)
+
+	err := client.updateSecretCAS(t.Context(), "kv/data/test", func(current map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"value": "never"}, nil
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Path != "kv/data/test" {
+		t.Errorf("expected *ConflictError for kv/data/test, got %#v", err)
+	}
+	if stub.writes != maxCASAttempts {
+		t.Errorf("expected %d write attempts, got %d", maxCASAttempts, stub.writes)
+	}
+}
+
+func TestUpdateSecretCAS_MutateError(t *testing.T) {
+	stub := &casStubServer{}
+	client := newStubClient(t, stub)
+
+	wantErr := errors.New("boom")
+	err := client.updateSecretCAS(t.Context(), "kv/data/test", func(current map[string]interface{}) (map[string]interface{}, error) {
+		return nil, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected mutate error, got %v", err)
+	}
+	if stub.writes != 0 {
+		t.Errorf("expected no writes, got %d", stub.writes)
+	}
+}
+
+func TestStoreMasterInfo_MergesWithStoredHosts(t *testing.T) {
+	original := lookupHost
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"10.0.0.2"}, nil
+	}
+	t.Cleanup(func() { lookupHost = original })
+
+	stub := &casStubServer{
+		version: 1,
+		data: map[string]interface{}{
+			"hosts":    []interface{}{"master1"},
+			"host_ips": map[string]interface{}{"master1": "10.0.0.1"},
+			"vip":      "10.0.0.100",
+			"first_ip": "10.0.0.1",
+		},
+	}
+	client := newStubClient(t, stub)
+
+	// The caller only knows about itself; the stored master must not be dropped
+	if err := client.StoreMasterInfo(t.Context(), "rke2", "c1", "master2", []string{"master2"}, "10.0.0.200"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hosts := stub.data["hosts"].([]interface{})
+	if len(hosts) != 2 || hosts[0] != "master1" || hosts[1] != "master2" {
+		t.Errorf("expected [master1 master2], got %v", hosts)
+	}
+	if stub.data["vip"] != "10.0.0.100" {
+		t.Errorf("expected stored VIP to win, got %v", stub.data["vip"])
+	}
+	if stub.data["first_ip"] != "10.0.0.1" {
+		t.Errorf("expected first_ip of master1, got %v", stub.data["first_ip"])
+	}
+}
+
+func TestRetrieveSecret_NotFoundIsTyped(t *testing.T) {
+	client := newStubClient(t, &casStubServer{})
+
+	_, err := client.RetrieveSecret(t.Context(), "kv/data/missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
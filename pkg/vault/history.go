@@ -0,0 +1,129 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements access to the KV v2 version history of a secret:
+- SecretHistory: Lists the versions of a secret with their creation and deletion times
+- RetrieveSecretVersion: Reads a specific version of a secret
+- RollbackSecret: Restores an earlier version by writing it as the new current version
+
+KV v2 keeps every write as a new version (up to the mount's max_versions), so an overwritten
+join token or kubeconfig can be inspected and restored. A rollback never rewrites history:
+the chosen version is copied into a new version with check-and-set, like `bao kv rollback`.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecretVersion describes one KV v2 version of a secret.
+type SecretVersion struct {
+	Version     int
+	CreatedTime time.Time
+	// DeletionTime is set when the version was soft-deleted; it can still be undeleted
+	DeletionTime time.Time
+	// Destroyed versions have had their data permanently removed
+	Destroyed bool
+	// Current marks the latest version, which plain reads return
+	Current bool
+}
+
+// Deleted reports whether the version's data can't be read (soft-deleted or destroyed).
+func (v SecretVersion) Deleted() bool {
+	return v.Destroyed || !v.DeletionTime.IsZero()
+}
+
+// SecretHistory lists the versions of the secret at a KV v2 data path, oldest first.
+// Versions beyond the mount's max_versions have been pruned by the store and are not listed.
+func (c *Client) SecretHistory(ctx context.Context, fullVaultPath string) ([]SecretVersion, error) {
+	if _, err := MetadataPath(fullVaultPath); err != nil {
+		return nil, err
+	}
+
+	versions, current, err := c.kv.history(ctx, fullVaultPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w at path: %s", ErrNotFound, fullVaultPath)
+	}
+
+	for i := range versions {
+		versions[i].Current = versions[i].Version == current
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// RetrieveSecretVersion reads a specific version of the secret at a KV v2 data path.
+// Version 0 reads the current version. A deleted or destroyed version returns ErrNotFound.
+func (c *Client) RetrieveSecretVersion(ctx context.Context, fullVaultPath string, version int) (map[string]interface{}, error) {
+	data, _, err := c.kv.read(ctx, fullVaultPath, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret at path '%s': %w", fullVaultPath, err)
+	}
+	if data == nil {
+		if version > 0 {
+			return nil, fmt.Errorf("%w at path: %s (version %d)", ErrNotFound, fullVaultPath, version)
+		}
+		return nil, fmt.Errorf("%w at path: %s", ErrNotFound, fullVaultPath)
+	}
+	return data, nil
+}
+
+// RollbackSecret restores version of the secret at a KV v2 data path by writing its data as a
+// new version, and returns the number of that new version. The write uses check-and-set against
+// the current version, so a concurrent update is reported as *ConflictError instead of being lost.
+func (c *Client) RollbackSecret(ctx context.Context, fullVaultPath string, version int) (int, error) {
+	if version <= 0 {
+		return 0, fmt.Errorf("invalid version %d: versions start at 1", version)
+	}
+
+	history, err := c.SecretHistory(ctx, fullVaultPath)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for _, v := range history {
+		if v.Current {
+			current = v.Version
+		}
+	}
+	if version == current {
+		return 0, fmt.Errorf("version %d is already the current version of %s", version, fullVaultPath)
+	}
+
+	data, err := c.RetrieveSecretVersion(ctx, fullVaultPath, version)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.storeSecretCAS(ctx, fullVaultPath, data, current); err != nil {
+		return 0, err
+	}
+	return current + 1, nil
+}
+
+// MetadataPath converts a KV v2 data path (<mount>/data/<key>) into its metadata path.
+func MetadataPath(fullVaultPath string) (string, error) {
+	mount, key, ok := strings.Cut(fullVaultPath, "/data/")
+	if !ok || mount == "" || key == "" {
+		return "", fmt.Errorf("'%s' is not a KV v2 data path (expected <mount>/data/<key>)", fullVaultPath)
+	}
+	return mount + "/metadata/" + key, nil
+}
+
+// parseTime parses an RFC 3339 timestamp from a metadata response; empty or invalid values give the zero time.
+func parseTime(v interface{}) time.Time {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// historyStubServer is a minimal KV v2 endpoint for a single secret that keeps every version,
+// serves the metadata endpoint and honours ?version= reads and options.cas writes.
+type historyStubServer struct {
+	mu       sync.Mutex
+	versions []map[string]interface{}
+	deleted  map[int]bool
+}
+
+func (s *historyStubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/metadata/"):
+		versions := map[string]interface{}{}
+		for i := range s.versions {
+			deletion := ""
+			if s.deleted[i+1] {
+				deletion = "2025-06-02T08:00:00Z"
+			}
+			versions[strconv.Itoa(i+1)] = map[string]interface{}{
+				"created_time":  "2025-06-01T1" + strconv.Itoa(i) + ":00:00.123456Z",
+				"deletion_time": deletion,
+				"destroyed":     false,
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"current_version": len(s.versions), "versions": versions},
+		})
+	case r.Method == http.MethodGet:
+		version := len(s.versions)
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, _ = strconv.Atoi(v)
+		}
+		if version < 1 || version > len(s.versions) || s.deleted[version] {
+			// KV v2 answers deleted versions with a 404 carrying only metadata
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": nil, "metadata": map[string]interface{}{"version": version}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     s.versions[version-1],
+				"metadata": map[string]interface{}{"version": version},
+			},
+		})
+	default:
+		var body struct {
+			Options map[string]interface{} `json:"options"`
+			Data    map[string]interface{} `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if cas, ok := body.Options["cas"].(float64); ok && int(cas) != len(s.versions) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		s.versions = append(s.versions, body.Data)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": len(s.versions)}})
+	}
+}
+
+func newHistoryStub() *historyStubServer {
+	return &historyStubServer{
+		versions: []map[string]interface{}{
+			{"schema_version": 1, "join_token": "K10first", "cluster": "c1"},
+			{"schema_version": 1, "join_token": "K10second", "cluster": "c1"},
+			{"schema_version": 1, "join_token": "K10third", "cluster": "c1"},
+		},
+		deleted: map[int]bool{2: true},
+	}
+}
+
+func TestSecretHistory_ListsVersionsOldestFirst(t *testing.T) {
+	client := newStubClient(t, newHistoryStub())
+
+	versions, err := client.SecretHistory(t.Context(), "kv/data/rke2/c1/token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("expected 3 versions, got %+v", versions)
+	}
+	for i, v := range versions {
+		if v.Version != i+1 {
+			t.Errorf("expected version %d at index %d, got %d", i+1, i, v.Version)
+		}
+		if v.CreatedTime.IsZero() {
+			t.Errorf("expected created time for version %d", v.Version)
+		}
+	}
+	if !versions[1].Deleted() || versions[0].Deleted() {
+		t.Errorf("expected only version 2 to be deleted, got %+v", versions)
+	}
+	if !versions[2].Current || versions[0].Current {
+		t.Errorf("expected version 3 to be current, got %+v", versions)
+	}
+}
+
+func TestRetrieveJoinTokenVersion(t *testing.T) {
+	client := newStubClient(t, newHistoryStub())
+
+	token, err := client.RetrieveJoinTokenVersion(t.Context(), "rke2", "c1", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.Token != "K10first" {
+		t.Errorf("expected version 1 token, got %s", token.Token)
+	}
+
+	current, err := client.RetrieveJoinToken(t.Context(), "rke2", "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if current.Token != "K10third" {
+		t.Errorf("expected current token, got %s", current.Token)
+	}
+
+	if _, err := client.RetrieveJoinTokenVersion(t.Context(), "rke2", "c1", 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted version, got %v", err)
+	}
+}
+
+func TestRollbackSecret_WritesOldDataAsNewVersion(t *testing.T) {
+	stub := newHistoryStub()
+	client := newStubClient(t, stub)
+
+	newVersion, err := client.RollbackSecret(t.Context(), "kv/data/rke2/c1/token", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if newVersion != 4 || len(stub.versions) != 4 {
+		t.Fatalf("expected rollback to create version 4, got %d (%d stored)", newVersion, len(stub.versions))
+	}
+	if stub.versions[3]["join_token"] != "K10first" {
+		t.Errorf("expected version 1 data as the new version, got %v", stub.versions[3])
+	}
+}
+
+func TestRollbackSecret_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+	}{
+		{"deleted version", 2},
+		{"current version", 3},
+		{"unknown version", 9},
+		{"invalid version", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newHistoryStub()
+			client := newStubClient(t, stub)
+			if _, err := client.RollbackSecret(t.Context(), "kv/data/rke2/c1/token", tt.version); err == nil {
+				t.Error("expected an error")
+			}
+			if len(stub.versions) != 3 {
+				t.Errorf("expected nothing to be written, got %d versions", len(stub.versions))
+			}
+		})
+	}
+}
+
+func TestMetadataPath(t *testing.T) {
+	got, err := MetadataPath("edge/data/teams/platform/rke2/c1/token")
+	if err != nil || got != "edge/metadata/teams/platform/rke2/c1/token" {
+		t.Errorf("unexpected metadata path %q, %v", got, err)
+	}
+	if _, err := MetadataPath("secret/rke2/c1/token"); err == nil {
+		t.Error("expected an error for a path without a data segment")
+	}
+}
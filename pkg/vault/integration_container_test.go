@@ -0,0 +1,69 @@
+//go:build integration
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const openbaoImage = "openbao/openbao:2.3.1"
+
+// TestMain starts a single OpenBao container for all integration tests,
+// runs the tests, then cleans up.
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        openbaoImage,
+		ExposedPorts: []string{"8200/tcp"},
+		Cmd:          []string{"server", "-dev", "-dev-root-token-id=" + openbaoDevToken, "-dev-listen-address=0.0.0.0:8200"},
+		Env: map[string]string{
+			"BAO_ADDR":              "http://0.0.0.0:8200",
+			"SKIP_SETCAP":           "true",
+			"BAO_DEV_ROOT_TOKEN_ID": openbaoDevToken,
+		},
+		WaitingFor: wait.ForHTTP("/v1/sys/seal-status").
+			WithPort("8200/tcp").
+			WithStartupTimeout(60 * time.Second),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start OpenBao container: %v\n", err)
+		os.Exit(1)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get container host: %v\n", err)
+		os.Exit(1)
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "8200")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get mapped port: %v\n", err)
+		os.Exit(1)
+	}
+
+	integrationAddr = fmt.Sprintf("http://%s:%s", host, mappedPort.Port())
+
+	// Run all tests
+	code := m.Run()
+
+	// Cleanup
+	if err := container.Terminate(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to terminate container: %v\n", err)
+	}
+
+	os.Exit(code)
+}
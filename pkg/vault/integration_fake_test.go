@@ -0,0 +1,23 @@
+//go:build !integration
+
+package vault
+
+import (
+	"os"
+	"testing"
+
+	"github.com/michielvha/edgectl/pkg/vault/vaulttest"
+)
+
+// TestMain starts a fake OpenBao (see pkg/vault/vaulttest) for the integration tests, so they
+// run in a plain `go test` without Docker. Build with -tags integration to run them against a
+// real OpenBao container instead.
+func TestMain(m *testing.M) {
+	server := vaulttest.NewServer()
+	integrationAddr = server.URL
+
+	code := m.Run()
+
+	server.Close()
+	os.Exit(code)
+}
@@ -1,80 +1,25 @@
-//go:build integration
-
 package vault
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
 )
 
-const (
-	openbaoImage    = "openbao/openbao:2.3.1"
-	openbaoDevToken = "root"
-)
+// openbaoDevToken is the root token of the OpenBao the integration tests run against.
+const openbaoDevToken = "root"
 
-// Shared container address for all integration tests.
+// integrationAddr is the address of that OpenBao, set by TestMain: a container with the
+// integration build tag (integration_container_test.go), else a fake (integration_fake_test.go).
 var integrationAddr string
 
-// TestMain starts a single OpenBao container for all integration tests,
-// runs the tests, then cleans up.
-func TestMain(m *testing.M) {
-	ctx := context.Background()
-
-	req := testcontainers.ContainerRequest{
-		Image:        openbaoImage,
-		ExposedPorts: []string{"8200/tcp"},
-		Cmd:          []string{"server", "-dev", "-dev-root-token-id=" + openbaoDevToken, "-dev-listen-address=0.0.0.0:8200"},
-		Env: map[string]string{
-			"BAO_ADDR":              "http://0.0.0.0:8200",
-			"SKIP_SETCAP":           "true",
-			"BAO_DEV_ROOT_TOKEN_ID": openbaoDevToken,
-		},
-		WaitingFor: wait.ForHTTP("/v1/sys/seal-status").
-			WithPort("8200/tcp").
-			WithStartupTimeout(60 * time.Second),
-	}
-
-	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: req,
-		Started:          true,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to start OpenBao container: %v\n", err)
-		os.Exit(1)
-	}
-
-	host, err := container.Host(ctx)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get container host: %v\n", err)
-		os.Exit(1)
-	}
-
-	mappedPort, err := container.MappedPort(ctx, "8200")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get mapped port: %v\n", err)
-		os.Exit(1)
-	}
-
-	integrationAddr = fmt.Sprintf("http://%s:%s", host, mappedPort.Port())
-
-	// Run all tests
-	code := m.Run()
-
-	// Cleanup
-	if err := container.Terminate(ctx); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: failed to terminate container: %v\n", err)
-	}
-
-	os.Exit(code)
-}
-
 // newTestClient creates a vault Client connected to the shared dev OpenBao instance.
 // Each test gets its own KV mount via a unique prefix to avoid cross-test contamination.
 func newTestClient(t *testing.T) *Client {
@@ -84,7 +29,7 @@ func newTestClient(t *testing.T) *Client {
 	t.Setenv("VAULT_ADDR", integrationAddr)
 	t.Setenv("BAO_TOKEN", openbaoDevToken)
 
-	client, err := NewClient()
+	client, err := NewClient(t.Context())
 	if err != nil {
 		t.Fatalf("failed to create vault client: %v", err)
 	}
@@ -112,7 +57,7 @@ func TestIntegration_GenericCRUD(t *testing.T) {
 	path := "kv/data/test/crud"
 
 	// Store
-	err := client.StoreSecret(path, map[string]interface{}{
+	err := client.StoreSecret(t.Context(), path, map[string]interface{}{
 		"username": "admin",
 		"password": "s3cret",
 	})
@@ -121,7 +66,7 @@ func TestIntegration_GenericCRUD(t *testing.T) {
 	}
 
 	// Retrieve
-	data, err := client.RetrieveSecret(path)
+	data, err := client.RetrieveSecret(t.Context(), path)
 	if err != nil {
 		t.Fatalf("RetrieveSecret failed: %v", err)
 	}
@@ -133,7 +78,7 @@ func TestIntegration_GenericCRUD(t *testing.T) {
 	}
 
 	// List keys
-	keys, err := client.ListKeys("kv/metadata/test")
+	keys, err := client.ListKeys(t.Context(), "kv/metadata/test")
 	if err != nil {
 		t.Fatalf("ListKeys failed: %v", err)
 	}
@@ -142,13 +87,13 @@ func TestIntegration_GenericCRUD(t *testing.T) {
 	}
 
 	// Delete
-	err = client.DeleteSecret("kv/metadata/test/crud")
+	err = client.DeleteSecret(t.Context(), "kv/metadata/test/crud")
 	if err != nil {
 		t.Fatalf("DeleteSecret failed: %v", err)
 	}
 
 	// Verify deleted
-	_, err = client.RetrieveSecret(path)
+	_, err = client.RetrieveSecret(t.Context(), path)
 	if err == nil {
 		t.Error("expected error after deletion, got nil")
 	}
@@ -162,17 +107,63 @@ func TestIntegration_TokenStoreRetrieve(t *testing.T) {
 	clusterID := "integration-test-cluster"
 	token := "K10abc123def456::server:xyz789"
 
-	err := client.StoreJoinToken("rke2", clusterID, token)
+	err := client.StoreJoinToken(t.Context(), "rke2", clusterID, token)
 	if err != nil {
 		t.Fatalf("StoreJoinToken failed: %v", err)
 	}
 
-	got, err := client.RetrieveJoinToken("rke2", clusterID)
+	got, err := client.RetrieveJoinToken(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveJoinToken failed: %v", err)
 	}
-	if got != token {
-		t.Errorf("expected token %q, got %q", token, got)
+	if got.Token != token {
+		t.Errorf("expected token %q, got %q", token, got.Token)
+	}
+	if got.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", CurrentSchemaVersion, got.SchemaVersion)
+	}
+}
+
+// --- Version history and rollback ---
+
+func TestIntegration_TokenHistoryRollback(t *testing.T) {
+	client := newTestClient(t)
+
+	clusterID := "integration-history-cluster"
+	path := client.Paths().Data("rke2", clusterID, "token")
+	t.Cleanup(func() {
+		_ = client.DeleteSecret(context.WithoutCancel(t.Context()), client.Paths().Metadata("rke2", clusterID, "token"))
+	})
+
+	for _, token := range []string{"K10first", "K10second"} {
+		if err := client.StoreJoinToken(t.Context(), "rke2", clusterID, token); err != nil {
+			t.Fatalf("StoreJoinToken failed: %v", err)
+		}
+	}
+
+	versions, err := client.SecretHistory(t.Context(), path)
+	if err != nil {
+		t.Fatalf("SecretHistory failed: %v", err)
+	}
+	if len(versions) != 2 || !versions[1].Current {
+		t.Fatalf("expected 2 versions with the second current, got %+v", versions)
+	}
+
+	old, err := client.RetrieveJoinTokenVersion(t.Context(), "rke2", clusterID, 1)
+	if err != nil || old.Token != "K10first" {
+		t.Fatalf("expected version 1 token, got %v, %v", old, err)
+	}
+
+	newVersion, err := client.RollbackSecret(t.Context(), path, 1)
+	if err != nil {
+		t.Fatalf("RollbackSecret failed: %v", err)
+	}
+	if newVersion != 3 {
+		t.Errorf("expected rollback to create version 3, got %d", newVersion)
+	}
+	current, err := client.RetrieveJoinToken(t.Context(), "rke2", clusterID)
+	if err != nil || current.Token != "K10first" {
+		t.Errorf("expected restored token, got %v, %v", current, err)
 	}
 }
 
@@ -184,42 +175,42 @@ func TestIntegration_MasterInfoAccumulation(t *testing.T) {
 	clusterID := "master-test-cluster"
 
 	// First master
-	err := client.StoreMasterInfo("rke2", clusterID, "master1", []string{"master1"}, "10.0.0.100")
+	err := client.StoreMasterInfo(t.Context(), "rke2", clusterID, "master1", []string{"master1"}, "10.0.0.100")
 	if err != nil {
 		t.Fatalf("StoreMasterInfo (1st) failed: %v", err)
 	}
 
-	hosts, vip, hostIPs, err := client.RetrieveMasterInfo("rke2", clusterID)
+	masters, err := client.RetrieveMasterInfo(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveMasterInfo (1st) failed: %v", err)
 	}
-	if len(hosts) != 1 || hosts[0] != "master1" {
-		t.Errorf("expected [master1], got %v", hosts)
+	if len(masters.Hosts) != 1 || masters.Hosts[0] != "master1" {
+		t.Errorf("expected [master1], got %v", masters.Hosts)
 	}
-	if vip != "10.0.0.100" {
-		t.Errorf("expected VIP 10.0.0.100, got %q", vip)
+	if masters.VIP != "10.0.0.100" {
+		t.Errorf("expected VIP 10.0.0.100, got %q", masters.VIP)
 	}
 
 	// Second master
-	err = client.StoreMasterInfo("rke2", clusterID, "master2", []string{"master1", "master2"}, "10.0.0.100")
+	err = client.StoreMasterInfo(t.Context(), "rke2", clusterID, "master2", []string{"master1", "master2"}, "10.0.0.100")
 	if err != nil {
 		t.Fatalf("StoreMasterInfo (2nd) failed: %v", err)
 	}
 
-	hosts, _, hostIPs, err = client.RetrieveMasterInfo("rke2", clusterID)
+	masters, err = client.RetrieveMasterInfo(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveMasterInfo (2nd) failed: %v", err)
 	}
-	if len(hosts) != 2 {
-		t.Errorf("expected 2 hosts, got %d: %v", len(hosts), hosts)
+	if len(masters.Hosts) != 2 {
+		t.Errorf("expected 2 hosts, got %d: %v", len(masters.Hosts), masters.Hosts)
 	}
 	// Both masters should have IPs in the map
-	if len(hostIPs) < 1 {
-		t.Errorf("expected at least 1 entry in hostIPs, got %d", len(hostIPs))
+	if len(masters.HostIPs) < 1 {
+		t.Errorf("expected at least 1 entry in hostIPs, got %d", len(masters.HostIPs))
 	}
 
 	// First master IP should be retrievable
-	firstIP, err := client.RetrieveFirstMasterIP("rke2", clusterID)
+	firstIP, err := client.RetrieveFirstMasterIP(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveFirstMasterIP failed: %v", err)
 	}
@@ -228,6 +219,42 @@ func TestIntegration_MasterInfoAccumulation(t *testing.T) {
 	}
 }
 
+// --- Concurrent master joins (check-and-set) ---
+
+func TestIntegration_MasterInfoConcurrentJoins(t *testing.T) {
+	client := newTestClient(t)
+
+	clusterID := "concurrent-join-cluster"
+	masters := []string{"master1", "master2", "master3"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(masters))
+	for _, host := range masters {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			// Each joining server only knows about itself, like server.Install does
+			errs <- client.StoreMasterInfo(t.Context(), "rke2", clusterID, host, []string{host}, "10.0.0.100")
+		}(host)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("StoreMasterInfo failed: %v", err)
+		}
+	}
+
+	stored, err := client.RetrieveMasterInfo(t.Context(), "rke2", clusterID)
+	if err != nil {
+		t.Fatalf("RetrieveMasterInfo failed: %v", err)
+	}
+	if len(stored.Hosts) != len(masters) {
+		t.Errorf("expected %d hosts after concurrent joins, got %d: %v", len(masters), len(stored.Hosts), stored.Hosts)
+	}
+}
+
 // --- Kubeconfig VIP replacement ---
 
 func TestIntegration_KubeconfigVIPReplacement(t *testing.T) {
@@ -252,14 +279,14 @@ clusters:
 	tmpFile.Close()
 
 	// Store with VIP replacement
-	err = client.StoreKubeConfig("rke2", clusterID, tmpFile.Name(), "10.0.0.100")
+	err = client.StoreKubeConfig(t.Context(), "rke2", clusterID, tmpFile.Name(), "10.0.0.100", 0)
 	if err != nil {
 		t.Fatalf("StoreKubeConfig failed: %v", err)
 	}
 
 	// Retrieve to a new file
 	outPath := fmt.Sprintf("%s/kubeconfig-out.yaml", t.TempDir())
-	err = client.RetrieveKubeConfig("rke2", clusterID, outPath)
+	err = client.RetrieveKubeConfig(t.Context(), "rke2", clusterID, outPath)
 	if err != nil {
 		t.Fatalf("RetrieveKubeConfig failed: %v", err)
 	}
@@ -281,6 +308,28 @@ clusters:
 	if strings.Contains(contentStr, "127.0.0.1") {
 		t.Error("expected kubeconfig NOT to contain 127.0.0.1 after VIP replacement")
 	}
+	if !strings.Contains(contentStr, "name: "+clusterID) {
+		t.Error("expected the kubeconfig cluster to be named after the cluster ID")
+	}
+
+	// The API port is given separately; a VIP carrying its own port is refused
+	if err := client.StoreKubeConfig(t.Context(), "rke2", clusterID, tmpFile.Name(), "10.0.0.100", 8443); err != nil {
+		t.Fatalf("StoreKubeConfig with API port failed: %v", err)
+	}
+	if record, err := client.RetrieveKubeconfigRecord(t.Context(), "rke2", clusterID); err != nil || !strings.Contains(record.Kubeconfig, "https://10.0.0.100:8443") {
+		t.Errorf("expected the kubeconfig to use port 8443 on the VIP, got %v (%v)", record, err)
+	}
+	if err := client.StoreKubeConfig(t.Context(), "rke2", clusterID, tmpFile.Name(), "10.0.0.100:8443", 0); err == nil || !strings.Contains(err.Error(), "includes a port") {
+		t.Errorf("expected a VIP with a port to be refused, got %v", err)
+	}
+
+	// A VIP with no server entry to rewrite is refused rather than stored unchanged
+	if err := os.WriteFile(tmpFile.Name(), []byte("apiVersion: v1\nclusters: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.StoreKubeConfig(t.Context(), "rke2", clusterID, tmpFile.Name(), "10.0.0.100", 0); !errors.Is(err, kubeconfig.ErrNoServer) {
+		t.Errorf("expected ErrNoServer, got %v", err)
+	}
 }
 
 // --- LB info with main/backup ---
@@ -291,18 +340,18 @@ func TestIntegration_LBInfoMainBackup(t *testing.T) {
 	clusterID := "lb-test-cluster"
 
 	// Store main LB
-	err := client.StoreLBInfo("rke2", clusterID, "lb-main", "10.0.0.200", true)
+	err := client.StoreLBInfo(t.Context(), "rke2", clusterID, "lb-main", "10.0.0.200", true)
 	if err != nil {
 		t.Fatalf("StoreLBInfo (main) failed: %v", err)
 	}
 
 	// Store backup LB
-	err = client.StoreLBInfo("rke2", clusterID, "lb-backup", "10.0.0.200", false)
+	err = client.StoreLBInfo(t.Context(), "rke2", clusterID, "lb-backup", "10.0.0.200", false)
 	if err != nil {
 		t.Fatalf("StoreLBInfo (backup) failed: %v", err)
 	}
 
-	nodes, vip, err := client.RetrieveLBInfo("rke2", clusterID)
+	nodes, vip, err := client.RetrieveLBInfo(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveLBInfo failed: %v", err)
 	}
@@ -317,7 +366,7 @@ func TestIntegration_LBInfoMainBackup(t *testing.T) {
 	// Verify main/backup roles
 	var hasMain, hasBackup bool
 	for _, node := range nodes {
-		if isMain, ok := node["is_main"].(bool); ok && isMain {
+		if node.IsMain {
 			hasMain = true
 		} else {
 			hasBackup = true
@@ -331,12 +380,12 @@ func TestIntegration_LBInfoMainBackup(t *testing.T) {
 	}
 
 	// Remove a node
-	err = client.RemoveLBNode("rke2", clusterID, "lb-backup")
+	err = client.RemoveLBNode(t.Context(), "rke2", clusterID, "lb-backup")
 	if err != nil {
 		t.Fatalf("RemoveLBNode failed: %v", err)
 	}
 
-	nodes, _, err = client.RetrieveLBInfo("rke2", clusterID)
+	nodes, _, err = client.RetrieveLBInfo(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("RetrieveLBInfo after removal failed: %v", err)
 	}
@@ -353,9 +402,9 @@ func TestIntegration_DeleteClusterData(t *testing.T) {
 	clusterID := "cleanup-test-cluster"
 
 	// Store all types of data
-	_ = client.StoreJoinToken("rke2", clusterID, "test-token")
-	_ = client.StoreMasterInfo("rke2", clusterID, "master1", []string{"master1"}, "10.0.0.1")
-	_ = client.StoreLBInfo("rke2", clusterID, "lb1", "10.0.0.1", true)
+	_ = client.StoreJoinToken(t.Context(), "rke2", clusterID, "test-token")
+	_ = client.StoreMasterInfo(t.Context(), "rke2", clusterID, "master1", []string{"master1"}, "10.0.0.1")
+	_ = client.StoreLBInfo(t.Context(), "rke2", clusterID, "lb1", "10.0.0.1", true)
 
 	// Create temp kubeconfig
 	tmpFile, err := os.CreateTemp(t.TempDir(), "kubeconfig-*.yaml")
@@ -364,28 +413,92 @@ func TestIntegration_DeleteClusterData(t *testing.T) {
 	}
 	tmpFile.WriteString("apiVersion: v1\nclusters: []\n")
 	tmpFile.Close()
-	_ = client.StoreKubeConfig("rke2", clusterID, tmpFile.Name(), "")
+	_ = client.StoreKubeConfig(t.Context(), "rke2", clusterID, tmpFile.Name(), "", 0)
 
 	// Verify data exists
-	_, err = client.RetrieveJoinToken("rke2", clusterID)
+	_, err = client.RetrieveJoinToken(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("expected token to exist before cleanup: %v", err)
 	}
 
 	// Delete all
-	err = client.DeleteClusterData("rke2", clusterID)
+	err = client.DeleteClusterData(t.Context(), "rke2", clusterID)
 	if err != nil {
 		t.Fatalf("DeleteClusterData failed: %v", err)
 	}
 
 	// Verify everything is gone
-	_, err = client.RetrieveJoinToken("rke2", clusterID)
+	_, err = client.RetrieveJoinToken(t.Context(), "rke2", clusterID)
 	if err == nil {
 		t.Error("expected token retrieval to fail after cleanup")
 	}
 
-	_, _, _, err = client.RetrieveMasterInfo("rke2", clusterID)
+	_, err = client.RetrieveMasterInfo(t.Context(), "rke2", clusterID)
 	if err == nil {
 		t.Error("expected master info retrieval to fail after cleanup")
 	}
 }
+
+// --- Backend conformance ---
+
+func TestIntegration_Conformance(t *testing.T) {
+	mounts := 0
+	backendConformance(t, func(t *testing.T) *Client {
+		client := newTestClient(t)
+
+		// Every case starts from an empty store: give it a KV mount of its own
+		mounts++
+		mount := fmt.Sprintf("conformance-%d", mounts)
+		_, err := client.VaultClient.Logical().WriteWithContext(t.Context(), "sys/mounts/"+mount, map[string]interface{}{
+			"type":    "kv",
+			"options": map[string]interface{}{"version": "2"},
+		})
+		if err != nil {
+			t.Fatalf("failed to enable the %s mount: %v", mount, err)
+		}
+		client.paths.Mount = mount
+		return client
+	})
+}
+
+// --- Scoped policies ---
+
+func TestIntegration_AgentPolicyIsScoped(t *testing.T) {
+	client := newTestClient(t)
+
+	if err := client.StoreJoinToken(t.Context(), "rke2", "policy-c1", "K10server"); err != nil {
+		t.Fatalf("StoreJoinToken: %v", err)
+	}
+	if err := client.StoreAgentToken(t.Context(), "rke2", "policy-c1", "K10agent"); err != nil {
+		t.Fatalf("StoreAgentToken: %v", err)
+	}
+
+	policy, err := NewClusterPolicy(client.Paths(), "rke2", "policy-c1", PolicyRoleAgent, "")
+	if err != nil {
+		t.Fatalf("NewClusterPolicy: %v", err)
+	}
+	if err := client.WritePolicy(t.Context(), policy); err != nil {
+		t.Fatalf("WritePolicy: %v", err)
+	}
+	creds, err := client.CreateScopedToken(t.Context(), policy.Name, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("CreateScopedToken: %v", err)
+	}
+
+	t.Setenv("BAO_TOKEN", creds.Token)
+	agent, err := NewClient(t.Context())
+	if err != nil {
+		t.Fatalf("failed to create scoped client: %v", err)
+	}
+
+	token, err := agent.RetrieveAgentToken(t.Context(), "rke2", "policy-c1")
+	if err != nil || token.Token != "K10agent" {
+		t.Fatalf("expected the agent token to be readable, got %v, %v", token, err)
+	}
+	if _, err := agent.RetrieveJoinToken(t.Context(), "rke2", "policy-c1"); err == nil {
+		t.Error("expected the server token to be denied")
+	}
+	if err := agent.StoreAgentToken(t.Context(), "rke2", "policy-c1", "K10forged"); err == nil {
+		t.Error("expected writes to be denied")
+	}
+}
@@ -3,36 +3,63 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 */
 package vault
 
+import (
+	"context"
+	"time"
+)
+
 // SecretStore defines the interface for all secret store operations.
+// Every operation that talks to the store takes a context; cancelling it aborts in-flight requests.
 // The existing *Client struct satisfies this interface implicitly.
 // Consumers accept SecretStore to allow dependency injection and testing.
 type SecretStore interface {
+	// Paths returns the KV v2 path layout cluster data is stored under
+	Paths() KVPaths
+
 	// Generic CRUD
-	StoreSecret(fullVaultPath string, data map[string]interface{}) error
-	RetrieveSecret(fullVaultPath string) (map[string]interface{}, error)
-	ListKeys(fullVaultPath string) ([]string, error)
-	DeleteSecret(fullVaultPath string) error
+	StoreSecret(ctx context.Context, fullVaultPath string, data map[string]interface{}) error
+	RetrieveSecret(ctx context.Context, fullVaultPath string) (map[string]interface{}, error)
+	ListKeys(ctx context.Context, fullVaultPath string) ([]string, error)
+	DeleteSecret(ctx context.Context, fullVaultPath string) error
+
+	// KV v2 version history
+	SecretHistory(ctx context.Context, fullVaultPath string) ([]SecretVersion, error)
+	RetrieveSecretVersion(ctx context.Context, fullVaultPath string, version int) (map[string]interface{}, error)
+	RollbackSecret(ctx context.Context, fullVaultPath string, version int) (int, error)
 
 	// Cluster token management
-	StoreJoinToken(distro, clusterID, token string) error
-	RetrieveJoinToken(distro, clusterID string) (string, error)
+	StoreJoinToken(ctx context.Context, distro, clusterID, token string) error
+	RetrieveJoinToken(ctx context.Context, distro, clusterID string) (*JoinToken, error)
+	RetrieveJoinTokenVersion(ctx context.Context, distro, clusterID string, version int) (*JoinToken, error)
+	RotateJoinToken(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error
+	StoreAgentToken(ctx context.Context, distro, clusterID, token string) error
+	RetrieveAgentToken(ctx context.Context, distro, clusterID string) (*AgentToken, error)
 
 	// Cluster master/server management
-	StoreMasterInfo(distro, clusterID, hostname string, hosts []string, vip string) error
-	RetrieveMasterInfo(distro, clusterID string) (hosts []string, vip string, hostIPs map[string]string, err error)
-	RetrieveFirstMasterIP(distro, clusterID string) (string, error)
+	StoreMasterInfo(ctx context.Context, distro, clusterID, hostname string, hosts []string, vip string) error
+	RetrieveMasterInfo(ctx context.Context, distro, clusterID string) (*MasterSet, error)
+	RetrieveFirstMasterIP(ctx context.Context, distro, clusterID string) (string, error)
 
 	// Cluster kubeconfig management
-	StoreKubeConfig(distro, clusterID, kubeconfigPath, vip string) error
-	RetrieveKubeConfig(distro, clusterID, destinationPath string) error
+	StoreKubeConfig(ctx context.Context, distro, clusterID, kubeconfigPath, vip string, apiPort int) error
+	RetrieveKubeConfig(ctx context.Context, distro, clusterID, destinationPath string) error
+	RetrieveKubeConfigVersion(ctx context.Context, distro, clusterID, destinationPath string, version int) error
+	RetrieveKubeconfigRecord(ctx context.Context, distro, clusterID string) (*KubeconfigRecord, error)
+	StoreClientCA(ctx context.Context, distro, clusterID, certPath, keyPath string) error
+	RetrieveClientCA(ctx context.Context, distro, clusterID string) (*ClientCARecord, error)
 
 	// Cluster load balancer management
-	StoreLBInfo(distro, clusterID, hostname, vip string, isMain bool) error
-	RetrieveLBInfo(distro, clusterID string) (nodes []map[string]interface{}, vip string, err error)
-	RemoveLBNode(distro, clusterID, hostname string) error
+	StoreLBInfo(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error
+	RetrieveLBInfo(ctx context.Context, distro, clusterID string) (nodes []LBNodeRecord, vip string, err error)
+	RemoveLBNode(ctx context.Context, distro, clusterID, hostname string) error
+
+	// Cluster-scoped locks (bootstrap and load balancer elections)
+	AcquireLock(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*Lease, error)
+	ReleaseLock(ctx context.Context, lease *Lease) error
 
 	// Cluster management
-	DeleteClusterData(distro, clusterID string) error
+	RetrieveCluster(ctx context.Context, distro, clusterID string) (*ClusterRecord, error)
+	DeleteClusterData(ctx context.Context, distro, clusterID string) error
 }
 
 // Compile-time check: *Client must satisfy SecretStore.
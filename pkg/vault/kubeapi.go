@@ -0,0 +1,412 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the small part of the Kubernetes API the kubernetes backend needs: the
+core/v1 Secrets of one namespace, reached with the credentials of a kubeconfig file or, when
+edgectl runs in a pod, of its service account:
+- newKubeAPI: Connects to the API server of a kubeconfig context or the in-cluster API server
+- get / create / update / remove / list: Secret requests; errors are returned as *kubeAPIError
+
+Kubeconfig users authenticate with a token, a token file or a client certificate; exec and
+auth-provider plugins are not supported.
+*/
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultKubernetesNamespace is the namespace the kubernetes backend keeps its Secrets in when none is configured.
+const DefaultKubernetesNamespace = "edgectl"
+
+// Service account credentials mounted into every pod.
+const (
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// kubeAPIError is an error response of the Kubernetes API (a metav1.Status).
+type kubeAPIError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+}
+
+func (e *kubeAPIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("kubernetes API returned %d %s", e.StatusCode, e.Reason)
+	}
+	return fmt.Sprintf("kubernetes API returned %d %s: %s", e.StatusCode, e.Reason, e.Message)
+}
+
+// isKubeStatus reports whether err is an API error with the given HTTP status code.
+func isKubeStatus(err error, code int) bool {
+	var apiErr *kubeAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// kubeSecret is a core/v1 Secret, with only the fields edgectl uses.
+type kubeSecret struct {
+	APIVersion string         `json:"apiVersion,omitempty"`
+	Kind       string         `json:"kind,omitempty"`
+	Metadata   kubeObjectMeta `json:"metadata"`
+	Type       string         `json:"type,omitempty"`
+	// Data values are base64 in JSON, which encoding/json does for []byte
+	Data map[string][]byte `json:"data,omitempty"`
+}
+
+// kubeObjectMeta is the metadata of a Kubernetes object.
+type kubeObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// kubeSecretList is a page of a Secret list.
+type kubeSecretList struct {
+	Metadata struct {
+		Continue string `json:"continue,omitempty"`
+	} `json:"metadata"`
+	Items []kubeSecret `json:"items"`
+}
+
+// kubeAPI calls the Secrets API of one namespace.
+type kubeAPI struct {
+	server    string
+	namespace string
+	token     string
+	// tokenFile is read for every request, as projected service account tokens are rotated
+	tokenFile string
+	http      *http.Client
+}
+
+// newKubeAPI connects to the API server of cfg: the kubeconfig file and context when given,
+// the in-cluster API server when running in a pod, else the current context of $KUBECONFIG
+// or ~/.kube/config.
+func newKubeAPI(cfg KubernetesConfig) (*kubeAPI, error) {
+	namespace := valueOrDefault(cfg.Namespace, DefaultKubernetesNamespace)
+
+	path := cfg.Kubeconfig
+	if path == "" {
+		if host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"); host != "" && port != "" {
+			return inClusterAPI(net.JoinHostPort(host, port), namespace)
+		}
+		if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+			path = paths[0]
+		} else if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".kube", "config")
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no kubeconfig found: set store.kubernetes.kubeconfig (EDGECTL_STORE_KUBECONFIG)")
+	}
+	return kubeconfigAPI(path, cfg.Context, namespace)
+}
+
+// inClusterAPI connects to the API server of the cluster edgectl runs in, as its service account.
+func inClusterAPI(hostPort, namespace string) (*kubeAPI, error) {
+	ca, err := os.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account CA: %w", err)
+	}
+	tlsConfig, err := kubeTLSConfig(ca, false, "")
+	if err != nil {
+		return nil, err
+	}
+	return &kubeAPI{
+		server:    "https://" + hostPort,
+		namespace: namespace,
+		tokenFile: inClusterTokenFile,
+		http:      &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}},
+	}, nil
+}
+
+// kubeconfigFile holds the parts of a kubeconfig file edgectl reads.
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeconfigAPI connects with the cluster and user of a kubeconfig context (empty: the current context).
+func kubeconfigAPI(path, contextName, namespace string) (*kubeAPI, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // path comes from trusted config
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var kc kubeconfigFile
+	if err := yaml.Unmarshal(raw, &kc); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+	}
+
+	contextName = valueOrDefault(contextName, kc.CurrentContext)
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in kubeconfig %s", contextName, path)
+	}
+
+	// Relative file references are relative to the kubeconfig file
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	api := &kubeAPI{namespace: namespace}
+	var tlsConfig *tls.Config
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		api.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		ca, err := fileOrData(resolve(c.Cluster.CertificateAuthority), c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA of cluster %q: %w", clusterName, err)
+		}
+		if tlsConfig, err = kubeTLSConfig(ca, c.Cluster.InsecureSkipTLSVerify, c.Cluster.TLSServerName); err != nil {
+			return nil, err
+		}
+	}
+	if api.server == "" {
+		return nil, fmt.Errorf("cluster %q of context %q has no server in kubeconfig %s", clusterName, contextName, path)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("user %q of context %q uses an exec or auth-provider plugin, which edgectl doesn't support: use a token or client certificate", userName, contextName)
+		}
+		api.token = u.User.Token
+		api.tokenFile = resolve(u.User.TokenFile)
+		cert, err := fileOrData(resolve(u.User.ClientCertificate), u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate of user %q: %w", userName, err)
+		}
+		key, err := fileOrData(resolve(u.User.ClientKey), u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client key of user %q: %w", userName, err)
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate of user %q: %w", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	api.http = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}}
+	return api, nil
+}
+
+// fileOrData returns the content of file, or else the base64-decoded data; nil when both are empty.
+func fileOrData(file, data string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file) //nolint:gosec // path comes from the trusted kubeconfig
+	}
+	if data == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// kubeTLSConfig trusts ca (or the system roots when nil) for API server connections.
+func kubeTLSConfig(ca []byte, insecure bool, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure, //nolint:gosec // explicitly requested in the kubeconfig
+		ServerName:         serverName,
+	}
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in the API server CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// secretsPath returns the API path of the namespace's Secrets, or of one Secret.
+func (k *kubeAPI) secretsPath(name string) string {
+	p := "/api/v1/namespaces/" + url.PathEscape(k.namespace) + "/secrets"
+	if name != "" {
+		p += "/" + url.PathEscape(name)
+	}
+	return p
+}
+
+// do sends a request and decodes a successful JSON response into out (when not nil).
+func (k *kubeAPI) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	target := k.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token := k.token
+	if k.tokenFile != "" {
+		raw, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the API token: %w", err)
+		}
+		token = strings.TrimSpace(string(raw))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &kubeAPIError{StatusCode: resp.StatusCode}
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &status) == nil {
+			apiErr.Reason, apiErr.Message = status.Reason, status.Message
+		}
+		if apiErr.Reason == "" {
+			apiErr.Reason = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("invalid response from the kubernetes API: %w", err)
+	}
+	return nil
+}
+
+// get reads a Secret; a missing Secret returns nil without error.
+func (k *kubeAPI) get(ctx context.Context, name string) (*kubeSecret, error) {
+	secret := &kubeSecret{}
+	err := k.do(ctx, http.MethodGet, k.secretsPath(name), nil, nil, secret)
+	if isKubeStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// create creates a Secret; it fails with a 409 if the Secret exists.
+func (k *kubeAPI) create(ctx context.Context, secret *kubeSecret) error {
+	return k.do(ctx, http.MethodPost, k.secretsPath(""), nil, secret, nil)
+}
+
+// update replaces a Secret; it fails with a 409 if the Secret changed since its resourceVersion was read.
+func (k *kubeAPI) update(ctx context.Context, secret *kubeSecret) error {
+	return k.do(ctx, http.MethodPut, k.secretsPath(secret.Metadata.Name), nil, secret, nil)
+}
+
+// remove deletes a Secret; deleting a missing Secret is not an error.
+func (k *kubeAPI) remove(ctx context.Context, name string) error {
+	err := k.do(ctx, http.MethodDelete, k.secretsPath(name), nil, nil, nil)
+	if isKubeStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// list returns all Secrets matching a label selector, following continue tokens.
+func (k *kubeAPI) list(ctx context.Context, selector string) ([]kubeSecret, error) {
+	var secrets []kubeSecret
+	query := url.Values{"labelSelector": {selector}, "limit": {"500"}}
+	for {
+		page := &kubeSecretList{}
+		if err := k.do(ctx, http.MethodGet, k.secretsPath(""), query, nil, page); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, page.Items...)
+		if page.Metadata.Continue == "" {
+			return secrets, nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
@@ -4,9 +4,11 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 Package vault provides specialized handlers for cluster secrets management.
 
 This file handles the kubeconfig management for Kubernetes clusters:
-  - StoreKubeConfig: Reads the kubeconfig from a server, updates the API endpoint with VIP if provided,
-    and stores it in the secret store
+  - StoreKubeConfig: Reads the kubeconfig from a server, updates the API endpoint with VIP if provided
+    and names its entries after the cluster (see pkg/kubeconfig), and stores it in the secret store
+  - RetrieveKubeconfigRecord: Fetches the kubeconfig record of a cluster (RetrieveKubeconfigRecordVersion for an earlier version)
   - RetrieveKubeConfig: Fetches a kubeconfig from the secret store and writes it to a specified path on the host
+  - RetrieveKubeConfigVersion: Same as RetrieveKubeConfig for an earlier version of the kubeconfig
 
 These functions enable secure kubeconfig sharing between cluster members and administrators
 without requiring direct SSH access to the control plane nodes.
@@ -14,45 +16,93 @@ without requiring direct SSH access to the control plane nodes.
 package vault
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+
+	"github.com/michielvha/edgectl/pkg/kubeconfig"
 )
 
-// StoreKubeConfig reads the kubeconfig from the host, modifies it to use VIP if provided, and uploads it to the secret store
-func (c *Client) StoreKubeConfig(distro, clusterID, kubeconfigPath, vip string) error {
-	kubeconfig, err := os.ReadFile(kubeconfigPath) //nolint:gosec // path comes from trusted CLI input
+// StoreKubeConfig reads the kubeconfig from the host, points it at the VIP if provided, renames its
+// cluster, user and context to the cluster ID, and uploads it to the secret store.
+// vip is a host name or IP address; apiPort is the port the VIP serves the API on (0 keeps the
+// API server port).
+func (c *Client) StoreKubeConfig(ctx context.Context, distro, clusterID, kubeconfigPath, vip string, apiPort int) error {
+	if err := CheckVIP(vip); err != nil {
+		return err
+	}
+
+	raw, err := os.ReadFile(kubeconfigPath) //nolint:gosec // path comes from trusted CLI input
 	if err != nil {
 		return fmt.Errorf("failed to read kubeconfig from path '%s': %w", kubeconfigPath, err)
 	}
 
-	// Replace the localhost URL with the VIP in the kubeconfig if VIP is provided
-	kubeconfigStr := string(kubeconfig)
-	if vip != "" {
-		kubeconfigStr = strings.ReplaceAll(
-			kubeconfigStr,
-			"server: https://127.0.0.1:6443",
-			fmt.Sprintf("server: https://%s:6443", vip),
-		)
+	// Point the clusters at the VIP when one is provided and name the entries after the cluster,
+	// so the kubeconfig can sit next to those of other clusters
+	rewritten, err := kubeconfig.Rewrite(raw, kubeconfig.Options{Server: vip, Port: apiPort, Name: clusterID})
+	if err != nil {
+		return fmt.Errorf("failed to rewrite kubeconfig from path '%s': %w", kubeconfigPath, err)
+	}
+	if vip != "" && apiPort != 0 {
+		fmt.Printf("🔄 Updated kubeconfig to use VIP: %s, port %d\n", vip, apiPort)
+	} else if vip != "" {
 		fmt.Printf("🔄 Updated kubeconfig to use VIP: %s\n", vip)
 	}
 
-	return c.StoreSecret(fmt.Sprintf("kv/data/%s/%s/kubeconfig", distro, clusterID), map[string]interface{}{
-		"kubeconfig": kubeconfigStr,
-	})
+	data, err := encodeRecord(&KubeconfigRecord{SchemaVersion: CurrentSchemaVersion, Kubeconfig: string(rewritten)})
+	if err != nil {
+		return err
+	}
+	return c.StoreSecret(ctx, c.paths.Data(distro, clusterID, "kubeconfig"), data)
 }
 
-// RetrieveKubeConfig fetches the kubeconfig from the secret store and saves it to the host
-func (c *Client) RetrieveKubeConfig(distro, clusterID, destinationPath string) error {
-	data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/kubeconfig", distro, clusterID))
+// CheckVIP returns an error unless vip is empty or a host name or IP address without a port.
+// The VIP also ends up in TLS SANs and in the agents' server URL, so a port is set separately.
+func CheckVIP(vip string) error {
+	if vip == "" {
+		return nil
+	}
+	_, port, err := kubeconfig.ParseEndpoint(vip)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve kubeconfig for cluster %s: %w", clusterID, err)
+		return fmt.Errorf("invalid VIP: %w", err)
 	}
+	if port != "" {
+		return fmt.Errorf("the VIP %q includes a port; give the host only and set the API port separately", vip)
+	}
+	return nil
+}
 
-	kubeconfig, ok := data["kubeconfig"].(string)
-	if !ok {
-		return fmt.Errorf("kubeconfig not found or invalid type for cluster %s", clusterID)
+// RetrieveKubeconfigRecord fetches the kubeconfig record of a cluster from the secret store
+func (c *Client) RetrieveKubeconfigRecord(ctx context.Context, distro, clusterID string) (*KubeconfigRecord, error) {
+	return c.RetrieveKubeconfigRecordVersion(ctx, distro, clusterID, 0)
+}
+
+// RetrieveKubeconfigRecordVersion fetches a specific version of the kubeconfig record; version 0 is the current one
+func (c *Client) RetrieveKubeconfigRecordVersion(ctx context.Context, distro, clusterID string, version int) (*KubeconfigRecord, error) {
+	path := c.paths.Data(distro, clusterID, "kubeconfig")
+	data, err := c.RetrieveSecretVersion(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	record := &KubeconfigRecord{}
+	if err := decodeRecord(path, data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// RetrieveKubeConfig fetches the kubeconfig from the secret store and saves it to the host
+func (c *Client) RetrieveKubeConfig(ctx context.Context, distro, clusterID, destinationPath string) error {
+	return c.RetrieveKubeConfigVersion(ctx, distro, clusterID, destinationPath, 0)
+}
+
+// RetrieveKubeConfigVersion fetches a specific version of the kubeconfig and saves it to the host;
+// version 0 is the current one
+func (c *Client) RetrieveKubeConfigVersion(ctx context.Context, distro, clusterID, destinationPath string, version int) error {
+	record, err := c.RetrieveKubeconfigRecordVersion(ctx, distro, clusterID, version)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve kubeconfig for cluster %s: %w", clusterID, err)
 	}
 
 	// Create directory structure if it doesn't exist
@@ -61,7 +111,7 @@ func (c *Client) RetrieveKubeConfig(distro, clusterID, destinationPath string) e
 		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
 	}
 
-	err = os.WriteFile(destinationPath, []byte(kubeconfig), 0o600)
+	err = os.WriteFile(destinationPath, []byte(record.Kubeconfig), 0o600)
 	if err != nil {
 		return fmt.Errorf("failed to write kubeconfig to path '%s': %w", destinationPath, err)
 	}
@@ -0,0 +1,324 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the kubernetes storage backend, which keeps the records of edge clusters
+as Secrets in a namespace of a management cluster instead of in a separate OpenBao:
+- NewKubernetesStore: Connects to the API server (see kubeapi.go), returning a Client that keeps its data there
+
+Every secret is one Secret holding all its versions (see document.go), so the records, history
+and rollback work as they do on OpenBao. A <distro>/<cluster-id>/<item> path is kept in a
+Secret named edgectl-<distro>-<cluster-id>-<item>-<hash>, labelled with
+app.kubernetes.io/managed-by=edgectl and edgectl.io/{distro,cluster,item} so it can be found
+with kubectl, and annotated with its full path. Writes use the Secret's resourceVersion for
+optimistic concurrency: a write based on a stale read is rejected by the API server and redone,
+so check-and-set writes, and with them the cluster locks, behave as on OpenBao.
+
+The Secrets are only as protected as the namespace: restrict access to it with RBAC and enable
+encryption at rest on the management cluster.
+*/
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// kubeSecretType is the type of the Secrets edgectl manages
+	kubeSecretType = "edgectl.io/kv"
+	// kubeDocumentKey is the Secret data key holding the document
+	kubeDocumentKey = "document"
+	// kubeMaxWriteAttempts bounds how often a write is redone after losing a race for a Secret
+	kubeMaxWriteAttempts = 5
+)
+
+// Labels and annotations of the Secrets edgectl manages.
+const (
+	kubeLabelManagedBy = "app.kubernetes.io/managed-by"
+	kubeLabelMount     = "edgectl.io/mount"
+	kubeLabelDistro    = "edgectl.io/distro"
+	kubeLabelCluster   = "edgectl.io/cluster"
+	kubeLabelItem      = "edgectl.io/item"
+	kubeAnnotationPath = "edgectl.io/path"
+	kubeManagedBy      = "edgectl"
+)
+
+var (
+	// kubeLabelValue matches valid label values (at most 63 characters, checked separately)
+	kubeLabelValue = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	// kubeNameInvalid matches runs of characters that can't appear in a Secret name
+	kubeNameInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// kubeKV stores secrets as Secrets through the Kubernetes API.
+type kubeKV struct {
+	c   *Client
+	api *kubeAPI
+}
+
+// Compile-time check: kubeKV must satisfy kvBackend.
+var _ kvBackend = (*kubeKV)(nil)
+
+// NewKubernetesStore connects to the Kubernetes API server of cfg and returns a client that stores
+// cluster data as Secrets under the kv path layout. Requests are retried as configured in retry.
+func NewKubernetesStore(cfg KubernetesConfig, kv KVPaths, retry RetryConfig) (*Client, error) {
+	api, err := newKubeAPI(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the kubernetes secret store: %w", err)
+	}
+	c := &Client{paths: kv, retry: retry}
+	c.kv = &kubeKV{c: c, api: api}
+	return c, nil
+}
+
+// kubeSecretName returns the name of the Secret keeping key (<mount>/<key>). The readable part is
+// shortened and made DNS-safe; the hash keeps names of different keys apart.
+func kubeSecretName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	_, rest, _ := strings.Cut(key, "/") // the mount is part of the hash only
+	readable := strings.Trim(kubeNameInvalid.ReplaceAllString(strings.ToLower(rest), "-"), "-")
+	if len(readable) > 200 {
+		readable = strings.TrimRight(readable[:200], "-")
+	}
+	return "edgectl-" + readable + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// ref returns the kind of a KV path, the key it addresses (<mount>/<key>) and the name of its Secret.
+func (k *kubeKV) ref(path string) (string, string, string, error) {
+	kind, mount, key, err := parseKVPath(path)
+	if err != nil {
+		return "", "", "", err
+	}
+	if key == "" {
+		return "", "", "", fmt.Errorf("'%s' has no key", path)
+	}
+	full := mount + "/" + key
+	return kind, full, kubeSecretName(full), nil
+}
+
+// labels returns the labels of the Secret keeping key: the mount, and the distro, cluster and item
+// for keys laid out as [<prefix>/]<distro>/<cluster-id>/<item>. Values that aren't valid label values are left out.
+func (k *kubeKV) labels(key string) map[string]string {
+	labels := map[string]string{kubeLabelManagedBy: kubeManagedBy}
+	set := func(name, value string) {
+		if len(value) <= 63 && kubeLabelValue.MatchString(value) {
+			labels[name] = value
+		}
+	}
+
+	mount, rest, _ := strings.Cut(key, "/")
+	set(kubeLabelMount, mount)
+	if prefix := strings.Trim(k.c.paths.Prefix, "/"); prefix != "" {
+		var ok bool
+		if rest, ok = strings.CutPrefix(rest, prefix+"/"); !ok {
+			return labels
+		}
+	}
+	if parts := strings.SplitN(rest, "/", 3); len(parts) == 3 {
+		set(kubeLabelDistro, parts[0])
+		set(kubeLabelCluster, parts[1])
+		set(kubeLabelItem, strings.ReplaceAll(parts[2], "/", "."))
+	}
+	return labels
+}
+
+// load reads the Secret of key and its document; a missing Secret returns nil for both.
+func (k *kubeKV) load(ctx context.Context, name, key string) (*kubeSecret, *kvDocument, error) {
+	var secret *kubeSecret
+	err := k.c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = k.api.get(ctx, name)
+		return err
+	})
+	if err != nil || secret == nil {
+		return nil, nil, err
+	}
+	if path := secret.Metadata.Annotations[kubeAnnotationPath]; path != key {
+		return nil, nil, fmt.Errorf("secret %s/%s holds %q, not %q", k.api.namespace, name, path, key)
+	}
+	doc, err := decodeDocument(secret.Data[kubeDocumentKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("secret %s/%s: %w", k.api.namespace, name, err)
+	}
+	return secret, doc, nil
+}
+
+// save creates the Secret of key, or updates secret (read at its resourceVersion) with doc.
+// It reports false when the Secret was created or changed by someone else in the meantime.
+func (k *kubeKV) save(ctx context.Context, secret *kubeSecret, name, key string, doc *kvDocument) (bool, error) {
+	raw, err := doc.encode()
+	if err != nil {
+		return false, err
+	}
+
+	if secret == nil {
+		secret = &kubeSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: kubeObjectMeta{
+				Name:        name,
+				Namespace:   k.api.namespace,
+				Labels:      k.labels(key),
+				Annotations: map[string]string{kubeAnnotationPath: key},
+			},
+			Type: kubeSecretType,
+		}
+	}
+	secret.Data = map[string][]byte{kubeDocumentKey: raw}
+
+	err = k.c.withRetry(ctx, func(ctx context.Context) error {
+		if secret.Metadata.ResourceVersion == "" {
+			return k.api.create(ctx, secret)
+		}
+		return k.api.update(ctx, secret)
+	})
+	if isKubeStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (k *kubeKV) read(ctx context.Context, dataPath string, version int) (map[string]interface{}, int, error) {
+	kind, key, name, err := k.ref(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	_, doc, err := k.load(ctx, name, key)
+	if err != nil || doc == nil {
+		return nil, 0, err
+	}
+	data, number := doc.get(version)
+	return data, number, nil
+}
+
+func (k *kubeKV) write(ctx context.Context, dataPath string, data map[string]interface{}, cas int) error {
+	kind, key, name, err := k.ref(dataPath)
+	if err != nil {
+		return err
+	}
+	if kind != "data" {
+		return fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	// A lost race means the Secret changed since it was read: read it again, so the
+	// check-and-set is decided on the current version
+	for range kubeMaxWriteAttempts {
+		secret, doc, err := k.load(ctx, name, key)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			doc = newDocument()
+		}
+		if err := doc.put(dataPath, data, cas); err != nil {
+			return err
+		}
+		if saved, err := k.save(ctx, secret, name, key, doc); saved || err != nil {
+			return err
+		}
+	}
+	if cas >= 0 {
+		return &ConflictError{Path: dataPath, Version: cas}
+	}
+	return fmt.Errorf("%w: secret %s/%s kept changing during the write", ErrConflict, k.api.namespace, name)
+}
+
+func (k *kubeKV) list(ctx context.Context, metadataPath string) ([]string, error) {
+	kind, mount, key, err := parseKVPath(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "metadata" {
+		return nil, fmt.Errorf("'%s' is not a KV v2 metadata path", metadataPath)
+	}
+	prefix := mount + "/"
+	if key != "" {
+		prefix += key + "/"
+	}
+
+	selector := kubeLabelManagedBy + "=" + kubeManagedBy
+	if mountLabel, ok := k.labels(mount)[kubeLabelMount]; ok {
+		selector += "," + kubeLabelMount + "=" + mountLabel
+	}
+	var secrets []kubeSecret
+	err = k.c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secrets, err = k.api.list(ctx, selector)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, secret := range secrets {
+		rest, ok := strings.CutPrefix(secret.Metadata.Annotations[kubeAnnotationPath], prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		child := rest
+		if first, _, nested := strings.Cut(rest, "/"); nested {
+			child = first + "/"
+		}
+		if !seen[child] {
+			seen[child] = true
+			keys = append(keys, child)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (k *kubeKV) delete(ctx context.Context, path string) error {
+	kind, key, name, err := k.ref(path)
+	if err != nil {
+		return err
+	}
+
+	if kind == "metadata" {
+		return k.c.withRetry(ctx, func(ctx context.Context) error {
+			return k.api.remove(ctx, name)
+		})
+	}
+
+	for range kubeMaxWriteAttempts {
+		secret, doc, err := k.load(ctx, name, key)
+		if err != nil || doc == nil || !doc.softDelete() {
+			return err
+		}
+		if saved, err := k.save(ctx, secret, name, key, doc); saved || err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: secret %s/%s kept changing during the delete", ErrConflict, k.api.namespace, name)
+}
+
+func (k *kubeKV) history(ctx context.Context, dataPath string) ([]SecretVersion, int, error) {
+	kind, key, name, err := k.ref(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	_, doc, err := k.load(ctx, name, key)
+	if err != nil || doc == nil {
+		return nil, 0, err
+	}
+	versions, current := doc.history()
+	return versions, current, nil
+}
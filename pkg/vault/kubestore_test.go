@@ -0,0 +1,365 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeKubeAPI serves the core/v1 Secrets API from memory, with resourceVersion checks on
+// update, label selectors and paginated lists, for requests carrying token.
+type fakeKubeAPI struct {
+	mu       sync.Mutex
+	token    string
+	secrets  map[string]*kubeSecret // by namespace/name
+	revision int
+	// pageSize limits list pages, to exercise continue tokens
+	pageSize int
+	// beforeUpdate, when set, runs before an update is applied (to simulate a concurrent writer)
+	beforeUpdate func(stored *kubeSecret)
+}
+
+func newFakeKubeAPI() *fakeKubeAPI {
+	return &fakeKubeAPI{token: "test-token", secrets: map[string]*kubeSecret{}, pageSize: 2}
+}
+
+func (f *fakeKubeAPI) status(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind": "Status", "status": "Failure", "code": code, "reason": reason, "message": message,
+	})
+}
+
+func (f *fakeKubeAPI) reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// store saves a copy of secret under a new resourceVersion.
+func (f *fakeKubeAPI) store(key string, secret *kubeSecret) *kubeSecret {
+	f.revision++
+	stored := *secret
+	stored.Metadata.ResourceVersion = strconv.Itoa(f.revision)
+	f.secrets[key] = &stored
+	return &stored
+}
+
+// matches reports whether labels satisfy an equality-based selector ("a=b,c=d").
+func matches(labels map[string]string, selector string) bool {
+	for _, term := range strings.Split(selector, ",") {
+		if name, value, ok := strings.Cut(term, "="); ok && labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		f.status(w, http.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/namespaces/")
+	namespace, rest, _ := strings.Cut(rest, "/")
+	resource, name, _ := strings.Cut(rest, "/")
+	if !ok || resource != "secrets" {
+		f.status(w, http.StatusNotFound, "NotFound", "unknown path "+r.URL.Path)
+		return
+	}
+	key := namespace + "/" + name
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		var names []string
+		for k, s := range f.secrets {
+			if strings.HasPrefix(k, namespace+"/") && matches(s.Metadata.Labels, r.URL.Query().Get("labelSelector")) {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		start, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+		list := &kubeSecretList{Items: []kubeSecret{}}
+		for i := start; i < len(names) && i < start+f.pageSize; i++ {
+			list.Items = append(list.Items, *f.secrets[names[i]])
+		}
+		if start+f.pageSize < len(names) {
+			list.Metadata.Continue = strconv.Itoa(start + f.pageSize)
+		}
+		f.reply(w, http.StatusOK, list)
+
+	case r.Method == http.MethodGet:
+		secret, ok := f.secrets[key]
+		if !ok {
+			f.status(w, http.StatusNotFound, "NotFound", fmt.Sprintf("secrets %q not found", name))
+			return
+		}
+		f.reply(w, http.StatusOK, secret)
+
+	case r.Method == http.MethodPost:
+		secret := &kubeSecret{}
+		if err := json.NewDecoder(r.Body).Decode(secret); err != nil {
+			f.status(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		key = namespace + "/" + secret.Metadata.Name
+		if _, exists := f.secrets[key]; exists {
+			f.status(w, http.StatusConflict, "AlreadyExists", fmt.Sprintf("secrets %q already exists", secret.Metadata.Name))
+			return
+		}
+		f.reply(w, http.StatusCreated, f.store(key, secret))
+
+	case r.Method == http.MethodPut:
+		secret := &kubeSecret{}
+		if err := json.NewDecoder(r.Body).Decode(secret); err != nil {
+			f.status(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		stored, ok := f.secrets[key]
+		if !ok {
+			f.status(w, http.StatusNotFound, "NotFound", fmt.Sprintf("secrets %q not found", name))
+			return
+		}
+		if f.beforeUpdate != nil {
+			f.beforeUpdate(stored)
+			f.beforeUpdate = nil
+			stored = f.store(key, stored)
+		}
+		if secret.Metadata.ResourceVersion != stored.Metadata.ResourceVersion {
+			f.status(w, http.StatusConflict, "Conflict", "the object has been modified; please apply your changes to the latest version and try again")
+			return
+		}
+		f.reply(w, http.StatusOK, f.store(key, secret))
+
+	case r.Method == http.MethodDelete:
+		if _, ok := f.secrets[key]; !ok {
+			f.status(w, http.StatusNotFound, "NotFound", fmt.Sprintf("secrets %q not found", name))
+			return
+		}
+		delete(f.secrets, key)
+		f.reply(w, http.StatusOK, map[string]string{"kind": "Status", "status": "Success"})
+
+	default:
+		f.status(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// writeKubeconfig writes a kubeconfig for server to a temporary file, with contexts "test"
+// (the current one, authenticating with token) and "plugin" (an exec plugin user).
+func writeKubeconfig(t *testing.T, server *httptest.Server, token string) string {
+	t.Helper()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	content := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: test
+  user:
+    token: %s
+- name: plugin
+  user:
+    exec:
+      command: kubelogin
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+- name: plugin
+  context:
+    cluster: test
+    user: plugin
+`, server.URL, base64.StdEncoding.EncodeToString(ca), token)
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newKubeStoreClient connects a kubernetes store to a fake API server over TLS.
+func newKubeStoreClient(t *testing.T, kv KVPaths) (*Client, *fakeKubeAPI) {
+	t.Helper()
+	fake := newFakeKubeAPI()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := KubernetesConfig{Kubeconfig: writeKubeconfig(t, server, fake.token), Namespace: "edge"}
+	client, err := NewKubernetesStore(cfg, kv, RetryConfig{})
+	if err != nil {
+		t.Fatalf("NewKubernetesStore: %v", err)
+	}
+	return client, fake
+}
+
+func TestKubeStore_Conformance(t *testing.T) {
+	backendConformance(t, func(t *testing.T) *Client {
+		client, _ := newKubeStoreClient(t, DefaultKVPaths())
+		return client
+	})
+}
+
+func TestKubeStore_SecretsAreLabelled(t *testing.T) {
+	client, fake := newKubeStoreClient(t, KVPaths{Mount: "edge", Prefix: "teams/platform"})
+	if err := client.StoreLBInfo(t.Context(), "rke2", "c1", "lb1", "10.0.0.100", true); err != nil {
+		t.Fatalf("StoreLBInfo: %v", err)
+	}
+
+	if len(fake.secrets) != 1 {
+		t.Fatalf("expected one Secret, got %d", len(fake.secrets))
+	}
+	for key, secret := range fake.secrets {
+		if !strings.HasPrefix(key, "edge/edgectl-teams-platform-rke2-c1-lb-lb1-") {
+			t.Errorf("unexpected Secret %s", key)
+		}
+		want := map[string]string{
+			kubeLabelManagedBy: kubeManagedBy,
+			kubeLabelMount:     "edge",
+			kubeLabelDistro:    "rke2",
+			kubeLabelCluster:   "c1",
+			kubeLabelItem:      "lb.lb1",
+		}
+		for name, value := range want {
+			if secret.Metadata.Labels[name] != value {
+				t.Errorf("expected label %s=%s, got %v", name, value, secret.Metadata.Labels)
+			}
+		}
+		if secret.Metadata.Annotations[kubeAnnotationPath] != "edge/teams/platform/rke2/c1/lb/lb1" {
+			t.Errorf("unexpected path annotation: %v", secret.Metadata.Annotations)
+		}
+		if secret.Type != kubeSecretType {
+			t.Errorf("expected type %s, got %s", kubeSecretType, secret.Type)
+		}
+	}
+
+	nodes, _, err := client.RetrieveLBInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(nodes) != 1 || nodes[0].Hostname != "lb1" {
+		t.Errorf("expected lb1 to be read back, got %+v (%v)", nodes, err)
+	}
+}
+
+func TestKubeStore_RedoesWriteAfterResourceVersionConflict(t *testing.T) {
+	client, fake := newKubeStoreClient(t, DefaultKVPaths())
+	path := client.paths.Data("rke2", "c1", "custom")
+	if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"n": 1}); err != nil {
+		t.Fatalf("StoreSecret: %v", err)
+	}
+
+	// Another writer adds version 2 between our read and our update
+	concurrentWrite := func(stored *kubeSecret) {
+		doc, err := decodeDocument(stored.Data[kubeDocumentKey])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = doc.put(path, map[string]interface{}{"n": "other"}, -1)
+		raw, _ := doc.encode()
+		stored.Data = map[string][]byte{kubeDocumentKey: raw}
+	}
+
+	// A check-and-set write based on version 1 must now lose
+	fake.beforeUpdate = concurrentWrite
+	err := client.storeSecretCAS(t.Context(), path, map[string]interface{}{"n": 2}, 1)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a ConflictError, got %v", err)
+	}
+
+	// An unconditional write is redone on top of the other writer's version
+	fake.beforeUpdate = concurrentWrite
+	if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"n": 3}); err != nil {
+		t.Fatalf("StoreSecret: %v", err)
+	}
+	history, err := client.SecretHistory(t.Context(), path)
+	if err != nil || len(history) != 4 {
+		t.Fatalf("expected 4 versions, got %+v (%v)", history, err)
+	}
+	data, err := client.RetrieveSecret(t.Context(), path)
+	if err != nil || toInt(data["n"]) != 3 {
+		t.Errorf("expected the redone write to be current, got %v (%v)", data, err)
+	}
+}
+
+func TestKubeStore_ConcurrentWriters(t *testing.T) {
+	client, _ := newKubeStoreClient(t, DefaultKVPaths())
+
+	const servers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, servers)
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip := fmt.Sprintf("10.0.0.%d", i+1)
+			errs <- client.StoreMasterInfo(t.Context(), "rke2", "c1", ip, []string{ip}, "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("StoreMasterInfo: %v", err)
+		}
+	}
+
+	masters, err := client.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(masters.Hosts) != servers {
+		t.Errorf("expected %d masters, got %+v (%v)", servers, masters, err)
+	}
+}
+
+func TestKubeStore_Kubeconfig(t *testing.T) {
+	fake := newFakeKubeAPI()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	if _, err := NewKubernetesStore(KubernetesConfig{Kubeconfig: writeKubeconfig(t, server, fake.token), Context: "plugin"}, DefaultKVPaths(), RetryConfig{}); err == nil || !strings.Contains(err.Error(), "plugin") {
+		t.Errorf("expected exec plugins to be rejected, got %v", err)
+	}
+	if _, err := NewKubernetesStore(KubernetesConfig{Kubeconfig: writeKubeconfig(t, server, fake.token), Context: "missing"}, DefaultKVPaths(), RetryConfig{}); err == nil {
+		t.Error("expected an error for a missing context")
+	}
+
+	// A wrong token is rejected by the API server, and not retried
+	client, err := NewKubernetesStore(KubernetesConfig{Kubeconfig: writeKubeconfig(t, server, "wrong")}, DefaultKVPaths(), DefaultRetryConfig())
+	if err != nil {
+		t.Fatalf("NewKubernetesStore: %v", err)
+	}
+	_, err = client.RetrieveSecret(t.Context(), client.paths.Data("rke2", "c1", "token"))
+	var apiErr *kubeAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 from the API server, got %v", err)
+	}
+}
+
+func TestKubeSecretName(t *testing.T) {
+	name := kubeSecretName("kv/rke2/My_Cluster/lb/node-1.example.com")
+	if !strings.HasPrefix(name, "edgectl-rke2-my-cluster-lb-node-1-example-com-") || len(name) != len("edgectl-rke2-my-cluster-lb-node-1-example-com-")+10 {
+		t.Errorf("unexpected name %s", name)
+	}
+	if kubeSecretName("kv/rke2/c1/token") == kubeSecretName("edge/rke2/c1/token") {
+		t.Error("expected keys of different mounts to get different names")
+	}
+	if long := kubeSecretName("kv/" + strings.Repeat("a", 300)); len(long) > 253 {
+		t.Errorf("expected a valid name length, got %d", len(long))
+	}
+}
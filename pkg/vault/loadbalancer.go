@@ -14,76 +14,71 @@ relationships between nodes, tracking of virtual IPs (VIPs), and automatic failo
 package vault
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 )
 
 // StoreLBInfo stores information about a load balancer node
-func (c *Client) StoreLBInfo(distro, clusterID, hostname, vip string, isMain bool) error {
-	path := fmt.Sprintf("kv/data/%s/%s/lb/%s", distro, clusterID, hostname)
-	return c.StoreSecret(path, map[string]interface{}{
-		"hostname": hostname,
-		"vip":      vip,
-		"is_main":  isMain,
-	})
+func (c *Client) StoreLBInfo(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error {
+	data, err := encodeRecord(&LBNodeRecord{SchemaVersion: CurrentSchemaVersion, Hostname: hostname, VIP: vip, IsMain: isMain})
+	if err != nil {
+		return err
+	}
+	return c.StoreSecret(ctx, c.paths.Data(distro, clusterID, "lb", hostname), data)
 }
 
-// RetrieveLBInfo retrieves information about load balancer nodes
-func (c *Client) RetrieveLBInfo(distro, clusterID string) (nodes []map[string]interface{}, vip string, err error) {
+// RetrieveLBInfo retrieves information about load balancer nodes.
+// A node record that doesn't match the schema is returned as a *ValidationError rather than skipped.
+func (c *Client) RetrieveLBInfo(ctx context.Context, distro, clusterID string) (nodes []LBNodeRecord, vip string, err error) {
 	// List all LB entries for this cluster
-	path := fmt.Sprintf("kv/metadata/%s/%s/lb", distro, clusterID)
-	keys, err := c.ListKeys(path)
+	path := c.paths.Metadata(distro, clusterID, "lb")
+	keys, err := c.ListKeys(ctx, path)
 	if err != nil {
 		// Return an empty list instead of an error when no LBs exist yet
-		if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "not found") {
-			return []map[string]interface{}{}, "", nil
+		if errors.Is(err, ErrNotFound) {
+			return []LBNodeRecord{}, "", nil
 		}
 		return nil, "", fmt.Errorf("failed to list load balancers for cluster %s: %w", clusterID, err)
 	}
 
-	// If keys list is empty, we have no load balancers yet
-	if len(keys) == 0 {
-		return []map[string]interface{}{}, "", nil
-	}
-
-	lbNodes := []map[string]interface{}{}
+	lbNodes := []LBNodeRecord{}
 
 	// Retrieve details for each LB
 	for _, key := range keys {
-		data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/lb/%s", distro, clusterID, key))
+		nodePath := c.paths.Data(distro, clusterID, "lb", key)
+		data, err := c.RetrieveSecret(ctx, nodePath)
 		if err != nil {
-			continue
+			// The node may have been removed between listing and reading
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, "", fmt.Errorf("failed to retrieve load balancer %s for cluster %s: %w", key, clusterID, err)
 		}
 
-		lbNodes = append(lbNodes, data)
-
-		// Get VIP from any LB (they should all have the same VIP)
-		if vip == "" {
-			vip, _ = data["vip"].(string)
+		node := LBNodeRecord{}
+		if err := decodeRecord(nodePath, data, &node); err != nil {
+			return nil, "", err
 		}
+		lbNodes = append(lbNodes, node)
 
-		// If this is the main LB, use its VIP as the definitive one
-		isMain, ok := data["is_main"].(bool)
-		if ok && isMain && data["vip"] != nil {
-			vip = data["vip"].(string)
+		// Get VIP from any LB (they should all have the same VIP);
+		// the main LB's VIP is the definitive one
+		if vip == "" || (node.IsMain && node.VIP != "") {
+			vip = node.VIP
 		}
 	}
 
-	// Return empty list instead of error when no load balancer nodes are found
-	if len(lbNodes) == 0 {
-		return []map[string]interface{}{}, "", nil
-	}
-
 	return lbNodes, vip, nil
 }
 
 // RemoveLBNode removes a load balancer node from the secret store
-func (c *Client) RemoveLBNode(distro, clusterID, hostname string) error {
+func (c *Client) RemoveLBNode(ctx context.Context, distro, clusterID, hostname string) error {
 	// Delete the LB node entry
-	path := fmt.Sprintf("kv/metadata/%s/%s/lb/%s", distro, clusterID, hostname)
-	if err := c.DeleteSecret(path); err != nil {
+	path := c.paths.Metadata(distro, clusterID, "lb", hostname)
+	if err := c.DeleteSecret(ctx, path); err != nil {
 		// If the entry doesn't exist, don't return an error
-		if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, ErrNotFound) {
 			return nil
 		}
 		return fmt.Errorf("failed to delete load balancer node %s for cluster %s: %w", hostname, clusterID, err)
@@ -0,0 +1,99 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file implements a lease-based lock on top of KV v2 check-and-set:
+- AcquireLock: Takes (or renews) a named, cluster-scoped lock for a holder with a TTL
+- ReleaseLock: Gives up a lock previously acquired by the same holder
+
+Locks are stored at <distro>/<cluster-id>/locks/<name>. A lock whose TTL has passed is
+considered free, so a node that crashes while holding one only blocks others until the
+lease expires. Because every write uses check-and-set, two nodes racing for the same
+lock can never both win. This is used to elect the bootstrap server of a new cluster
+and the main load balancer node when nodes are provisioned in parallel.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Lease represents a held lock. It is returned by AcquireLock and passed back to ReleaseLock.
+type Lease struct {
+	Distro    string
+	ClusterID string
+	Name      string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+// now is a package-level variable wrapping time.Now so tests can control lease expiry.
+var now = time.Now
+
+// AcquireLock takes the named lock for holder, valid for ttl. If holder already owns the lock
+// its lease is extended. If another holder owns an unexpired lease, a *LockHeldError is returned.
+func (c *Client) AcquireLock(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*Lease, error) {
+	lease := &Lease{Distro: distro, ClusterID: clusterID, Name: name, Holder: holder}
+
+	path := c.paths.Data(distro, clusterID, "locks", name)
+	err := c.updateSecretCAS(ctx, path, func(current map[string]interface{}) (map[string]interface{}, error) {
+		if held := heldBy(name, current); held != nil && held.Holder != holder {
+			return nil, held
+		}
+
+		acquiredAt := now().UTC()
+		lease.ExpiresAt = acquiredAt.Add(ttl)
+		return map[string]interface{}{
+			"holder":      holder,
+			"acquired_at": acquiredAt.Format(time.RFC3339),
+			"expires_at":  lease.ExpiresAt.Format(time.RFC3339),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// ReleaseLock frees a lock held by lease.Holder. Releasing a lock that has meanwhile
+// expired and been taken over by another holder returns a *LockHeldError and leaves it untouched.
+func (c *Client) ReleaseLock(ctx context.Context, lease *Lease) error {
+	path := c.paths.Data(lease.Distro, lease.ClusterID, "locks", lease.Name)
+	return c.updateSecretCAS(ctx, path, func(current map[string]interface{}) (map[string]interface{}, error) {
+		if held := heldBy(lease.Name, current); held != nil && held.Holder != lease.Holder {
+			return nil, held
+		}
+		return map[string]interface{}{
+			"holder":      "",
+			"released_by": lease.Holder,
+			"released_at": now().UTC().Format(time.RFC3339),
+		}, nil
+	})
+}
+
+// heldBy returns the current lease on a lock as a *LockHeldError, or nil if the lock is free or expired.
+func heldBy(name string, current map[string]interface{}) *LockHeldError {
+	holder, _ := current["holder"].(string)
+	if holder == "" {
+		return nil
+	}
+
+	expiresRaw, _ := current["expires_at"].(string)
+	expiresAt, err := time.Parse(time.RFC3339, expiresRaw)
+	if err != nil {
+		// An unreadable expiry would otherwise block the lock forever; treat it as expired
+		return nil
+	}
+	if !now().Before(expiresAt) {
+		return nil
+	}
+	return &LockHeldError{Name: name, Holder: holder, ExpiresAt: expiresAt}
+}
+
+// String describes the lease for log output.
+func (l *Lease) String() string {
+	return fmt.Sprintf("%s/%s lock '%s' held by %s until %s", l.Distro, l.ClusterID, l.Name, l.Holder, l.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fixedNow pins the package clock for the duration of a test and returns a setter to move it.
+func fixedNow(t *testing.T, start time.Time) func(time.Time) {
+	t.Helper()
+	original := now
+	current := start
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = original })
+	return func(next time.Time) { current = next }
+}
+
+func TestAcquireLock_FreeLock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	fixedNow(t, start)
+	stub := &casStubServer{}
+	client := newStubClient(t, stub)
+
+	lease, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease.Holder != "node-a" || !lease.ExpiresAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected lease: %+v", lease)
+	}
+	if stub.data["holder"] != "node-a" {
+		t.Errorf("expected holder to be stored, got %v", stub.data)
+	}
+}
+
+func TestAcquireLock_HeldByOther(t *testing.T) {
+	fixedNow(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := newStubClient(t, &casStubServer{})
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-b", time.Minute)
+	if !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+	var held *LockHeldError
+	if !errors.As(err, &held) || held.Holder != "node-a" {
+		t.Errorf("expected lock held by node-a, got %v", err)
+	}
+}
+
+func TestAcquireLock_SameHolderRenews(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	setNow := fixedNow(t, start)
+	client := newStubClient(t, &casStubServer{})
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setNow(start.Add(30 * time.Second))
+
+	lease, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("expected holder to renew its own lock, got %v", err)
+	}
+	if !lease.ExpiresAt.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("expected extended expiry, got %s", lease.ExpiresAt)
+	}
+}
+
+func TestAcquireLock_ExpiredLockCanBeTaken(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	setNow := fixedNow(t, start)
+	client := newStubClient(t, &casStubServer{})
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setNow(start.Add(2 * time.Minute))
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-b", time.Minute); err != nil {
+		t.Fatalf("expected expired lock to be taken over, got %v", err)
+	}
+}
+
+func TestReleaseLock_FreesLock(t *testing.T) {
+	fixedNow(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := newStubClient(t, &casStubServer{})
+
+	lease, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.ReleaseLock(t.Context(), lease); err != nil {
+		t.Fatalf("unexpected release error: %v", err)
+	}
+
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-b", time.Minute); err != nil {
+		t.Fatalf("expected released lock to be free, got %v", err)
+	}
+}
+
+func TestReleaseLock_TakenOverByOther(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	setNow := fixedNow(t, start)
+	client := newStubClient(t, &casStubServer{})
+
+	stale, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setNow(start.Add(2 * time.Minute))
+	if _, err := client.AcquireLock(t.Context(), "rke2", "c1", "bootstrap", "node-b", time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := client.ReleaseLock(t.Context(), stale); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld when releasing a taken-over lock, got %v", err)
+	}
+}
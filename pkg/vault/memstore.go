@@ -0,0 +1,186 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the memory storage backend, which keeps secrets in the process only:
+- NewMemoryStore: Returns a Client whose data lives in memory and is lost when it is dropped
+
+It behaves like OpenBao's KV v2 engine (versions, check-and-set, soft and full deletes, lists,
+missing secrets), so unlike MockStore it can stand in for a real store in tests that run a whole
+flow, and in dry runs that must not change the real store. Documents are kept encoded, so data
+read back never shares maps with what was written.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryKV keeps documents (see document.go) in a map keyed by <mount>/<key>.
+type memoryKV struct {
+	mu   sync.Mutex
+	docs map[string][]byte
+}
+
+// Compile-time check: memoryKV must satisfy kvBackend.
+var _ kvBackend = (*memoryKV)(nil)
+
+// NewMemoryStore returns an empty in-memory store using the kv path layout.
+// It is safe for concurrent use.
+func NewMemoryStore(kv KVPaths) *Client {
+	c := &Client{paths: kv}
+	c.kv = &memoryKV{docs: map[string][]byte{}}
+	return c
+}
+
+// ref returns the kind of a KV path and the key it addresses (<mount>/<key>).
+func (m *memoryKV) ref(path string) (string, string, error) {
+	kind, mount, key, err := parseKVPath(path)
+	if err != nil {
+		return "", "", err
+	}
+	if key == "" {
+		return "", "", fmt.Errorf("'%s' has no key", path)
+	}
+	return kind, mount + "/" + key, nil
+}
+
+// load returns the document of key, or nil if it doesn't exist. The caller holds m.mu.
+func (m *memoryKV) load(key string) (*kvDocument, error) {
+	raw, ok := m.docs[key]
+	if !ok {
+		return nil, nil
+	}
+	return decodeDocument(raw)
+}
+
+// save stores doc under key. The caller holds m.mu.
+func (m *memoryKV) save(key string, doc *kvDocument) error {
+	raw, err := doc.encode()
+	if err != nil {
+		return err
+	}
+	m.docs[key] = raw
+	return nil
+}
+
+func (m *memoryKV) read(ctx context.Context, dataPath string, version int) (map[string]interface{}, int, error) {
+	kind, key, err := m.ref(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, err := m.load(key)
+	if err != nil || doc == nil {
+		return nil, 0, err
+	}
+	data, number := doc.get(version)
+	return data, number, nil
+}
+
+func (m *memoryKV) write(ctx context.Context, dataPath string, data map[string]interface{}, cas int) error {
+	kind, key, err := m.ref(dataPath)
+	if err != nil {
+		return err
+	}
+	if kind != "data" {
+		return fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, err := m.load(key)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		doc = newDocument()
+	}
+	if err := doc.put(dataPath, data, cas); err != nil {
+		return err
+	}
+	return m.save(key, doc)
+}
+
+func (m *memoryKV) list(ctx context.Context, metadataPath string) ([]string, error) {
+	kind, mount, key, err := parseKVPath(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "metadata" {
+		return nil, fmt.Errorf("'%s' is not a KV v2 metadata path", metadataPath)
+	}
+	prefix := mount + "/"
+	if key != "" {
+		prefix += key + "/"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := map[string]bool{}
+	keys := []string{}
+	for stored := range m.docs {
+		rest, ok := strings.CutPrefix(stored, prefix)
+		if !ok {
+			continue
+		}
+		child := rest
+		if first, _, nested := strings.Cut(rest, "/"); nested {
+			child = first + "/"
+		}
+		if !seen[child] {
+			seen[child] = true
+			keys = append(keys, child)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memoryKV) delete(ctx context.Context, path string) error {
+	kind, key, err := m.ref(path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kind == "metadata" {
+		delete(m.docs, key)
+		return nil
+	}
+	doc, err := m.load(key)
+	if err != nil || doc == nil || !doc.softDelete() {
+		return err
+	}
+	return m.save(key, doc)
+}
+
+func (m *memoryKV) history(ctx context.Context, dataPath string) ([]SecretVersion, int, error) {
+	kind, key, err := m.ref(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind != "data" {
+		return nil, 0, fmt.Errorf("'%s' is not a KV v2 data path", dataPath)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, err := m.load(key)
+	if err != nil || doc == nil {
+		return nil, 0, err
+	}
+	versions, current := doc.history()
+	return versions, current, nil
+}
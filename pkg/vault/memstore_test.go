@@ -0,0 +1,77 @@
+package vault
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	backendConformance(t, func(t *testing.T) *Client {
+		return NewMemoryStore(DefaultKVPaths())
+	})
+}
+
+func TestMemoryStore_DataIsNotShared(t *testing.T) {
+	client := NewMemoryStore(DefaultKVPaths())
+	path := client.paths.Data("rke2", "c1", "custom")
+
+	data := map[string]interface{}{"key": "value"}
+	if err := client.StoreSecret(t.Context(), path, data); err != nil {
+		t.Fatalf("StoreSecret: %v", err)
+	}
+	data["key"] = "changed by the caller"
+
+	read, err := client.RetrieveSecret(t.Context(), path)
+	if err != nil || read["key"] != "value" {
+		t.Fatalf("expected the stored value, got %v (%v)", read, err)
+	}
+	read["key"] = "changed by a reader"
+	if again, _ := client.RetrieveSecret(t.Context(), path); again["key"] != "value" {
+		t.Errorf("expected reads to return copies, got %v", again)
+	}
+}
+
+func TestMemoryStore_ConcurrentWriters(t *testing.T) {
+	client := NewMemoryStore(DefaultKVPaths())
+
+	const servers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, servers)
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip := fmt.Sprintf("10.0.0.%d", i+1)
+			errs <- client.StoreMasterInfo(t.Context(), "rke2", "c1", ip, []string{ip}, "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("StoreMasterInfo: %v", err)
+		}
+	}
+
+	masters, err := client.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if err != nil || len(masters.Hosts) != servers {
+		t.Errorf("expected %d masters, got %+v (%v)", servers, masters, err)
+	}
+}
+
+func TestMemoryStore_Errors(t *testing.T) {
+	client := NewMemoryStore(DefaultKVPaths())
+
+	for _, path := range []string{"kv/nothing/key", "kv/data", "kv/metadata/rke2/c1", "kv//data/key"} {
+		if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"k": "v"}); err == nil {
+			t.Errorf("expected an error for path %q", path)
+		}
+	}
+	if _, err := client.ListKeys(t.Context(), "kv/data/rke2"); err == nil {
+		t.Error("expected listing a data path to fail")
+	}
+	if err := client.WritePolicy(t.Context(), &ClusterPolicy{Name: "policy"}); err == nil {
+		t.Error("expected OpenBao-only operations to fail on the memory backend")
+	}
+}
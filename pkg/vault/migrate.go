@@ -0,0 +1,337 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file implements the migration of stored cluster data to the current layout and schema:
+- PlanMigration: Walks all clusters and lists the changes needed, without writing anything
+- ApplyMigration: Writes the planned changes and leaves a migration marker
+- ReadMigrationMarker: Reads the marker left by the last migration
+
+Two kinds of outdated data are detected:
+  - Legacy layout: K3s clusters created before the distro path segment was introduced were
+    stored under rke2/ (e.g. rke2/k3s-abc12345/token); they are moved to k3s/<cluster-id>/
+  - Old schema: records without (or with an older) schema_version are rewritten with the
+    current schema version
+
+Migration only uses the generic ListKeys/RetrieveSecret/StoreSecret/DeleteSecret operations,
+so it works against any SecretStore implementation. Locks are transient and never migrated.
+*/
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration actions.
+const (
+	// MigrationMove moves a record from the legacy layout to the current one
+	MigrationMove = "move"
+	// MigrationUpgrade rewrites a record in place with the current schema version
+	MigrationUpgrade = "upgrade"
+)
+
+// MigrationChange is a single record rewrite planned by PlanMigration.
+type MigrationChange struct {
+	Action    string
+	Distro    string // distro the cluster is stored under after migration
+	ClusterID string
+	Item      string // e.g. token, masters, lb/<hostname>
+	From      string // data path the record is read from
+	To        string // data path the record is written to (equal to From for upgrades)
+	Before    map[string]interface{}
+	After     map[string]interface{}
+
+	// fromMetadata is the metadata path deleted after a move
+	fromMetadata string
+}
+
+// MigrationPlan lists every change needed to bring the store to CurrentSchemaVersion.
+type MigrationPlan struct {
+	Changes []MigrationChange
+}
+
+// MigrationMarker records the last migration applied to a store.
+type MigrationMarker struct {
+	SchemaVersion int    `json:"schema_version"`
+	MigratedAt    string `json:"migrated_at"`
+	MigratedBy    string `json:"migrated_by"`
+	Changes       int    `json:"changes"`
+}
+
+// Validate checks that the marker names a schema version.
+func (m *MigrationMarker) Validate() error {
+	if m.SchemaVersion <= 0 {
+		return &ValidationError{Record: "migration marker", Reason: "schema_version is not set"}
+	}
+	return nil
+}
+
+// migrationMarkerPath returns the data path of the migration marker. It lives outside the
+// distro directories so it never shows up as a cluster.
+func migrationMarkerPath(paths KVPaths) string {
+	return paths.Data("edgectl", "migration")
+}
+
+// PlanMigration inspects every cluster of every distro and returns the changes needed to
+// reach the current layout and schema. Nothing is written. Records that can't be decoded,
+// records written by a newer edgectl, and clusters present under both the legacy and the
+// current path are reported as errors so they can be fixed by hand first.
+func PlanMigration(ctx context.Context, store SecretStore) (*MigrationPlan, error) {
+	paths := store.Paths()
+	plan := &MigrationPlan{}
+
+	for _, distro := range Distros {
+		clusters, err := store.ListKeys(ctx, paths.Metadata(distro))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s clusters: %w", distro, err)
+		}
+
+		for _, key := range clusters {
+			clusterID := strings.TrimSuffix(key, "/")
+			if clusterID == key {
+				// Not a cluster directory
+				continue
+			}
+
+			target := distro
+			if legacy := legacyDistro(distro, clusterID); legacy != "" {
+				target = legacy
+				if exists, err := clusterExists(ctx, store, target, clusterID); err != nil {
+					return nil, err
+				} else if exists {
+					return nil, fmt.Errorf("cluster %s is stored both under %s/ and %s/; remove one copy before migrating", clusterID, distro, target)
+				}
+			}
+
+			changes, err := planCluster(ctx, store, distro, target, clusterID)
+			if err != nil {
+				return nil, err
+			}
+			plan.Changes = append(plan.Changes, changes...)
+		}
+	}
+	return plan, nil
+}
+
+// legacyDistro returns the distro a cluster stored under distro actually belongs to,
+// or "" when it is already in the right place. Cluster IDs are prefixed with their distro.
+func legacyDistro(distro, clusterID string) string {
+	if distro == "rke2" && strings.HasPrefix(clusterID, "k3s-") {
+		return "k3s"
+	}
+	return ""
+}
+
+// clusterExists reports whether anything is stored for the cluster.
+func clusterExists(ctx context.Context, store SecretStore, distro, clusterID string) (bool, error) {
+	keys, err := store.ListKeys(ctx, store.Paths().Metadata(distro, clusterID))
+	if err != nil {
+		return false, fmt.Errorf("failed to list %s cluster %s: %w", distro, clusterID, err)
+	}
+	return len(keys) > 0, nil
+}
+
+// clusterItems lists the record items stored for a cluster (token, agent-token, kubeconfig, client-ca, masters, lb/<hostname>).
+func clusterItems(ctx context.Context, store SecretStore, distro, clusterID string) ([]string, error) {
+	paths := store.Paths()
+	keys, err := store.ListKeys(ctx, paths.Metadata(distro, clusterID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s cluster %s: %w", distro, clusterID, err)
+	}
+
+	items := []string{}
+	for _, key := range keys {
+		switch key {
+		case "token", "agent-token", "kubeconfig", "client-ca", "masters":
+			items = append(items, key)
+		case "lb/":
+			nodes, err := store.ListKeys(ctx, paths.Metadata(distro, clusterID, "lb"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to list load balancers of %s cluster %s: %w", distro, clusterID, err)
+			}
+			for _, node := range nodes {
+				items = append(items, "lb/"+node)
+			}
+		}
+	}
+	sort.Strings(items)
+	return items, nil
+}
+
+// newItemRecord returns an empty typed record for a cluster item.
+func newItemRecord(item string) record {
+	switch {
+	case item == "token":
+		return &JoinToken{}
+	case item == "agent-token":
+		return &AgentToken{}
+	case item == "kubeconfig":
+		return &KubeconfigRecord{}
+	case item == "client-ca":
+		return &ClientCARecord{}
+	case item == "masters":
+		return &MasterSet{}
+	case strings.HasPrefix(item, "lb/"):
+		return &LBNodeRecord{}
+	}
+	return nil
+}
+
+// planCluster returns the changes for one cluster stored under distro that belongs under target.
+func planCluster(ctx context.Context, store SecretStore, distro, target, clusterID string) ([]MigrationChange, error) {
+	paths := store.Paths()
+	items, err := clusterItems(ctx, store, distro, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []MigrationChange{}
+	for _, item := range items {
+		from := paths.Data(distro, clusterID, item)
+		data, err := store.RetrieveSecret(ctx, from)
+		if err != nil {
+			// Only the latest version was deleted; nothing to migrate
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		rec := newItemRecord(item)
+		if err := decodeRecord(from, data, rec); err != nil {
+			return nil, err
+		}
+		version := toInt(data["schema_version"])
+		if version > CurrentSchemaVersion {
+			return nil, fmt.Errorf("record at '%s' has schema version %d, newer than the supported %d; upgrade edgectl", from, version, CurrentSchemaVersion)
+		}
+
+		change := MigrationChange{
+			Action:    MigrationUpgrade,
+			Distro:    target,
+			ClusterID: clusterID,
+			Item:      item,
+			From:      from,
+			To:        from,
+			Before:    data,
+		}
+		if target != distro {
+			change.Action = MigrationMove
+			change.To = paths.Data(target, clusterID, item)
+			change.fromMetadata = paths.Metadata(distro, clusterID, item)
+		} else if version == CurrentSchemaVersion {
+			continue
+		}
+
+		if change.After, err = encodeRecord(rec); err != nil {
+			return nil, err
+		}
+		change.After["schema_version"] = CurrentSchemaVersion
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// ApplyMigration writes every planned change and then stores a migration marker naming migratedBy.
+// Moved records are written to their new path before the legacy path is deleted, so an interrupted
+// migration never loses data and can simply be planned and applied again.
+func ApplyMigration(ctx context.Context, store SecretStore, plan *MigrationPlan, migratedBy string) (*MigrationMarker, error) {
+	for _, change := range plan.Changes {
+		if err := store.StoreSecret(ctx, change.To, change.After); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s: %w", change.From, err)
+		}
+		if change.Action == MigrationMove {
+			if err := store.DeleteSecret(ctx, change.fromMetadata); err != nil {
+				return nil, fmt.Errorf("migrated %s to %s but failed to delete the legacy copy: %w", change.From, change.To, err)
+			}
+		}
+	}
+
+	marker := &MigrationMarker{
+		SchemaVersion: CurrentSchemaVersion,
+		MigratedAt:    now().UTC().Format(time.RFC3339),
+		MigratedBy:    migratedBy,
+		Changes:       len(plan.Changes),
+	}
+	data, err := encodeRecord(marker)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.StoreSecret(ctx, migrationMarkerPath(store.Paths()), data); err != nil {
+		return nil, fmt.Errorf("failed to store migration marker: %w", err)
+	}
+	return marker, nil
+}
+
+// ReadMigrationMarker returns the marker left by the last migration, or nil if the store was never migrated.
+func ReadMigrationMarker(ctx context.Context, store SecretStore) (*MigrationMarker, error) {
+	path := migrationMarkerPath(store.Paths())
+	data, err := store.RetrieveSecret(ctx, path)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	marker := &MigrationMarker{}
+	if err := decodeRecord(path, data, marker); err != nil {
+		return nil, err
+	}
+	return marker, nil
+}
+
+// Diff lists the fields a change adds, removes or modifies as "+ key: value", "- key: value"
+// and "~ key: old -> new" lines, sorted by key. Fields whose value is unchanged are omitted.
+func (c MigrationChange) Diff() []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, m := range []map[string]interface{}{c.Before, c.After} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, k := range keys {
+		before, inBefore := c.Before[k]
+		after, inAfter := c.After[k]
+		switch {
+		case !inBefore:
+			lines = append(lines, fmt.Sprintf("+ %s: %v", k, after))
+		case !inAfter:
+			lines = append(lines, fmt.Sprintf("- %s: %v", k, before))
+		case !sameValue(before, after):
+			lines = append(lines, fmt.Sprintf("~ %s: %v -> %v", k, before, after))
+		}
+	}
+	return lines
+}
+
+// sameValue compares two decoded JSON values, treating all numeric types as equal by value.
+func sameValue(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		return toInt(a) == toInt(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// isNumber reports whether v is one of the numeric types toInt understands.
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case json.Number, float64, int:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMapStore returns a MockStore whose generic CRUD operations are backed by a map of
+// data paths, with ListKeys and DeleteSecret accepting the matching metadata paths.
+func newMapStore(secrets map[string]map[string]interface{}) *MockStore {
+	toData := func(path string) string {
+		return strings.Replace(path, "/metadata/", "/data/", 1)
+	}
+	return &MockStore{
+		StoreSecretFunc: func(ctx context.Context, path string, data map[string]interface{}) error {
+			secrets[path] = data
+			return nil
+		},
+		RetrieveSecretFunc: func(ctx context.Context, path string) (map[string]interface{}, error) {
+			data, ok := secrets[path]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return data, nil
+		},
+		ListKeysFunc: func(ctx context.Context, path string) ([]string, error) {
+			prefix := toData(path) + "/"
+			seen := map[string]bool{}
+			keys := []string{}
+			for p := range secrets {
+				rest, ok := strings.CutPrefix(p, prefix)
+				if !ok {
+					continue
+				}
+				key, _, isDir := strings.Cut(rest, "/")
+				if isDir {
+					key += "/"
+				}
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			return keys, nil
+		},
+		DeleteSecretFunc: func(ctx context.Context, path string) error {
+			delete(secrets, toData(path))
+			return nil
+		},
+	}
+}
+
+func TestPlanMigration_MovesLegacyK3sCluster(t *testing.T) {
+	secrets := map[string]map[string]interface{}{
+		"kv/data/rke2/k3s-abc/token":     {"join_token": "K10abc", "cluster": "k3s-abc"},
+		"kv/data/rke2/k3s-abc/lb/lb1":    {"hostname": "lb1", "vip": "10.0.0.100", "is_main": true},
+		"kv/data/rke2/k3s-abc/client-ca": {"schema_version": 1, "certificate": "cert", "key": "key"},
+		"kv/data/rke2/rke2-def/token":    {"schema_version": 1, "join_token": "K10def", "cluster": "rke2-def"},
+		"kv/data/rke2/rke2-def/locks/":   {"holder": ""},
+	}
+	store := newMapStore(secrets)
+
+	plan, err := PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d: %+v", len(plan.Changes), plan.Changes)
+	}
+	for _, change := range plan.Changes {
+		if change.Action != MigrationMove || change.Distro != "k3s" || change.ClusterID != "k3s-abc" {
+			t.Errorf("unexpected change: %+v", change)
+		}
+		if !strings.HasPrefix(change.To, "kv/data/k3s/k3s-abc/") {
+			t.Errorf("expected target under k3s/, got %s", change.To)
+		}
+	}
+
+	// A plan never writes
+	if _, ok := secrets["kv/data/k3s/k3s-abc/token"]; ok {
+		t.Error("expected dry run to leave the store untouched")
+	}
+}
+
+func TestPlanMigration_UpgradesRecordsWithoutSchemaVersion(t *testing.T) {
+	store := newMapStore(map[string]map[string]interface{}{
+		"kv/data/rke2/c1/masters": {"hosts": []interface{}{"m1"}, "vip": "10.0.0.100"},
+	})
+
+	plan, err := PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != MigrationUpgrade {
+		t.Fatalf("expected a single upgrade, got %+v", plan.Changes)
+	}
+
+	diff := strings.Join(plan.Changes[0].Diff(), "\n")
+	if !strings.Contains(diff, "+ schema_version: 1") {
+		t.Errorf("expected diff to add schema_version, got:\n%s", diff)
+	}
+	if strings.Contains(diff, "hosts") || strings.Contains(diff, "vip") {
+		t.Errorf("expected unchanged fields to be omitted, got:\n%s", diff)
+	}
+}
+
+func TestPlanMigration_CurrentStoreHasNoChanges(t *testing.T) {
+	store := newMapStore(map[string]map[string]interface{}{
+		"kv/data/k3s/k3s-abc/token": {"schema_version": 1, "join_token": "K10abc", "cluster": "k3s-abc"},
+	})
+
+	plan, err := PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes, got %+v", plan.Changes)
+	}
+}
+
+func TestPlanMigration_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]map[string]interface{}
+	}{
+		{"invalid record", map[string]map[string]interface{}{
+			"kv/data/rke2/c1/token": {"cluster": "c1"},
+		}},
+		{"newer schema", map[string]map[string]interface{}{
+			"kv/data/rke2/c1/token": {"schema_version": CurrentSchemaVersion + 1, "join_token": "K10"},
+		}},
+		{"both layouts", map[string]map[string]interface{}{
+			"kv/data/rke2/k3s-abc/token": {"join_token": "old"},
+			"kv/data/k3s/k3s-abc/token":  {"join_token": "new"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PlanMigration(t.Context(), newMapStore(tt.secrets)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestApplyMigration_WritesChangesAndMarker(t *testing.T) {
+	original := now
+	now = func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = original })
+
+	secrets := map[string]map[string]interface{}{
+		"kv/data/rke2/k3s-abc/token":    {"join_token": "K10abc", "cluster": "k3s-abc"},
+		"kv/data/rke2/rke2-def/masters": {"hosts": []interface{}{"m1"}},
+	}
+	store := newMapStore(secrets)
+
+	if marker, err := ReadMigrationMarker(t.Context(), store); err != nil || marker != nil {
+		t.Fatalf("expected no marker before migrating, got %v, %v", marker, err)
+	}
+
+	plan, err := PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ApplyMigration(t.Context(), store, plan, "admin-host"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := secrets["kv/data/rke2/k3s-abc/token"]; ok {
+		t.Error("expected legacy token to be removed")
+	}
+	token, ok := secrets["kv/data/k3s/k3s-abc/token"]
+	if !ok || token["join_token"] != "K10abc" || token["schema_version"] != CurrentSchemaVersion {
+		t.Errorf("expected migrated token under k3s/, got %v", token)
+	}
+	if secrets["kv/data/rke2/rke2-def/masters"]["schema_version"] != CurrentSchemaVersion {
+		t.Errorf("expected masters to be upgraded, got %v", secrets["kv/data/rke2/rke2-def/masters"])
+	}
+
+	marker, err := ReadMigrationMarker(t.Context(), store)
+	if err != nil || marker == nil {
+		t.Fatalf("expected marker, got %v, %v", marker, err)
+	}
+	if marker.SchemaVersion != CurrentSchemaVersion || marker.MigratedBy != "admin-host" || marker.Changes != 2 || marker.MigratedAt != "2025-06-01T12:00:00Z" {
+		t.Errorf("unexpected marker: %+v", marker)
+	}
+
+	// Running again finds nothing left to do
+	plan, err = PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes after migrating, got %+v", plan.Changes)
+	}
+}
+
+func TestApplyMigration_StoreErrorKeepsLegacyCopy(t *testing.T) {
+	secrets := map[string]map[string]interface{}{
+		"kv/data/rke2/k3s-abc/token": {"join_token": "K10abc"},
+	}
+	store := newMapStore(secrets)
+	plan, err := PlanMigration(t.Context(), store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store.StoreSecretFunc = func(context.Context, string, map[string]interface{}) error { return errors.New("permission denied") }
+	if _, err := ApplyMigration(t.Context(), store, plan, "admin-host"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, ok := secrets["kv/data/rke2/k3s-abc/token"]; !ok {
+		t.Error("expected legacy copy to be kept when the write fails")
+	}
+}
@@ -3,131 +3,258 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 */
 package vault
 
+import (
+	"context"
+	"time"
+)
+
 // MockStore is a hand-written mock implementing SecretStore.
 // Each field is a function that, when set, overrides the default (zero-value) behavior.
 // Tests set only the methods they care about; unset methods panic with a clear message.
 type MockStore struct {
-	StoreSecretFunc           func(fullVaultPath string, data map[string]interface{}) error
-	RetrieveSecretFunc        func(fullVaultPath string) (map[string]interface{}, error)
-	ListKeysFunc              func(fullVaultPath string) ([]string, error)
-	DeleteSecretFunc          func(fullVaultPath string) error
-	StoreJoinTokenFunc        func(distro, clusterID, token string) error
-	RetrieveJoinTokenFunc     func(distro, clusterID string) (string, error)
-	StoreMasterInfoFunc       func(distro, clusterID, hostname string, hosts []string, vip string) error
-	RetrieveMasterInfoFunc    func(distro, clusterID string) ([]string, string, map[string]string, error)
-	RetrieveFirstMasterIPFunc func(distro, clusterID string) (string, error)
-	StoreKubeConfigFunc       func(distro, clusterID, kubeconfigPath, vip string) error
-	RetrieveKubeConfigFunc    func(distro, clusterID, destinationPath string) error
-	StoreLBInfoFunc           func(distro, clusterID, hostname, vip string, isMain bool) error
-	RetrieveLBInfoFunc        func(distro, clusterID string) ([]map[string]interface{}, string, error)
-	RemoveLBNodeFunc          func(distro, clusterID, hostname string) error
-	DeleteClusterDataFunc     func(distro, clusterID string) error
+	PathsFunc                     func() KVPaths
+	StoreSecretFunc               func(ctx context.Context, fullVaultPath string, data map[string]interface{}) error
+	RetrieveSecretFunc            func(ctx context.Context, fullVaultPath string) (map[string]interface{}, error)
+	ListKeysFunc                  func(ctx context.Context, fullVaultPath string) ([]string, error)
+	DeleteSecretFunc              func(ctx context.Context, fullVaultPath string) error
+	SecretHistoryFunc             func(ctx context.Context, fullVaultPath string) ([]SecretVersion, error)
+	RetrieveSecretVersionFunc     func(ctx context.Context, fullVaultPath string, version int) (map[string]interface{}, error)
+	RollbackSecretFunc            func(ctx context.Context, fullVaultPath string, version int) (int, error)
+	StoreJoinTokenFunc            func(ctx context.Context, distro, clusterID, token string) error
+	RetrieveJoinTokenFunc         func(ctx context.Context, distro, clusterID string) (*JoinToken, error)
+	RetrieveJoinTokenVersionFunc  func(ctx context.Context, distro, clusterID string, version int) (*JoinToken, error)
+	StoreAgentTokenFunc           func(ctx context.Context, distro, clusterID, token string) error
+	RetrieveAgentTokenFunc        func(ctx context.Context, distro, clusterID string) (*AgentToken, error)
+	RotateJoinTokenFunc           func(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error
+	StoreMasterInfoFunc           func(ctx context.Context, distro, clusterID, hostname string, hosts []string, vip string) error
+	RetrieveMasterInfoFunc        func(ctx context.Context, distro, clusterID string) (*MasterSet, error)
+	RetrieveFirstMasterIPFunc     func(ctx context.Context, distro, clusterID string) (string, error)
+	StoreKubeConfigFunc           func(ctx context.Context, distro, clusterID, kubeconfigPath, vip string, apiPort int) error
+	RetrieveKubeConfigFunc        func(ctx context.Context, distro, clusterID, destinationPath string) error
+	RetrieveKubeConfigVersionFunc func(ctx context.Context, distro, clusterID, destinationPath string, version int) error
+	RetrieveKubeconfigRecordFunc  func(ctx context.Context, distro, clusterID string) (*KubeconfigRecord, error)
+	StoreClientCAFunc             func(ctx context.Context, distro, clusterID, certPath, keyPath string) error
+	RetrieveClientCAFunc          func(ctx context.Context, distro, clusterID string) (*ClientCARecord, error)
+	StoreLBInfoFunc               func(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error
+	RetrieveLBInfoFunc            func(ctx context.Context, distro, clusterID string) ([]LBNodeRecord, string, error)
+	RemoveLBNodeFunc              func(ctx context.Context, distro, clusterID, hostname string) error
+	AcquireLockFunc               func(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*Lease, error)
+	ReleaseLockFunc               func(ctx context.Context, lease *Lease) error
+	RetrieveClusterFunc           func(ctx context.Context, distro, clusterID string) (*ClusterRecord, error)
+	DeleteClusterDataFunc         func(ctx context.Context, distro, clusterID string) error
 }
 
 // Compile-time check: *MockStore must satisfy SecretStore.
 var _ SecretStore = (*MockStore)(nil)
 
-func (m *MockStore) StoreSecret(fullVaultPath string, data map[string]interface{}) error {
+// Paths returns PathsFunc's result, or the default layout when unset, so tests
+// exercising path construction don't need to configure it.
+func (m *MockStore) Paths() KVPaths {
+	if m.PathsFunc != nil {
+		return m.PathsFunc()
+	}
+	return DefaultKVPaths()
+}
+
+func (m *MockStore) StoreSecret(ctx context.Context, fullVaultPath string, data map[string]interface{}) error {
 	if m.StoreSecretFunc != nil {
-		return m.StoreSecretFunc(fullVaultPath, data)
+		return m.StoreSecretFunc(ctx, fullVaultPath, data)
 	}
 	panic("MockStore.StoreSecret not set")
 }
 
-func (m *MockStore) RetrieveSecret(fullVaultPath string) (map[string]interface{}, error) {
+func (m *MockStore) RetrieveSecret(ctx context.Context, fullVaultPath string) (map[string]interface{}, error) {
 	if m.RetrieveSecretFunc != nil {
-		return m.RetrieveSecretFunc(fullVaultPath)
+		return m.RetrieveSecretFunc(ctx, fullVaultPath)
 	}
 	panic("MockStore.RetrieveSecret not set")
 }
 
-func (m *MockStore) ListKeys(fullVaultPath string) ([]string, error) {
+func (m *MockStore) ListKeys(ctx context.Context, fullVaultPath string) ([]string, error) {
 	if m.ListKeysFunc != nil {
-		return m.ListKeysFunc(fullVaultPath)
+		return m.ListKeysFunc(ctx, fullVaultPath)
 	}
 	panic("MockStore.ListKeys not set")
 }
 
-func (m *MockStore) DeleteSecret(fullVaultPath string) error {
+func (m *MockStore) DeleteSecret(ctx context.Context, fullVaultPath string) error {
 	if m.DeleteSecretFunc != nil {
-		return m.DeleteSecretFunc(fullVaultPath)
+		return m.DeleteSecretFunc(ctx, fullVaultPath)
 	}
 	panic("MockStore.DeleteSecret not set")
 }
 
-func (m *MockStore) StoreJoinToken(distro, clusterID, token string) error {
+func (m *MockStore) SecretHistory(ctx context.Context, fullVaultPath string) ([]SecretVersion, error) {
+	if m.SecretHistoryFunc != nil {
+		return m.SecretHistoryFunc(ctx, fullVaultPath)
+	}
+	panic("MockStore.SecretHistory not set")
+}
+
+func (m *MockStore) RetrieveSecretVersion(ctx context.Context, fullVaultPath string, version int) (map[string]interface{}, error) {
+	if m.RetrieveSecretVersionFunc != nil {
+		return m.RetrieveSecretVersionFunc(ctx, fullVaultPath, version)
+	}
+	panic("MockStore.RetrieveSecretVersion not set")
+}
+
+func (m *MockStore) RollbackSecret(ctx context.Context, fullVaultPath string, version int) (int, error) {
+	if m.RollbackSecretFunc != nil {
+		return m.RollbackSecretFunc(ctx, fullVaultPath, version)
+	}
+	panic("MockStore.RollbackSecret not set")
+}
+
+func (m *MockStore) StoreJoinToken(ctx context.Context, distro, clusterID, token string) error {
 	if m.StoreJoinTokenFunc != nil {
-		return m.StoreJoinTokenFunc(distro, clusterID, token)
+		return m.StoreJoinTokenFunc(ctx, distro, clusterID, token)
 	}
 	panic("MockStore.StoreJoinToken not set")
 }
 
-func (m *MockStore) RetrieveJoinToken(distro, clusterID string) (string, error) {
+func (m *MockStore) RetrieveJoinToken(ctx context.Context, distro, clusterID string) (*JoinToken, error) {
 	if m.RetrieveJoinTokenFunc != nil {
-		return m.RetrieveJoinTokenFunc(distro, clusterID)
+		return m.RetrieveJoinTokenFunc(ctx, distro, clusterID)
 	}
 	panic("MockStore.RetrieveJoinToken not set")
 }
 
-func (m *MockStore) StoreMasterInfo(distro, clusterID, hostname string, hosts []string, vip string) error {
+func (m *MockStore) RetrieveJoinTokenVersion(ctx context.Context, distro, clusterID string, version int) (*JoinToken, error) {
+	if m.RetrieveJoinTokenVersionFunc != nil {
+		return m.RetrieveJoinTokenVersionFunc(ctx, distro, clusterID, version)
+	}
+	panic("MockStore.RetrieveJoinTokenVersion not set")
+}
+
+func (m *MockStore) RotateJoinToken(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+	if m.RotateJoinTokenFunc != nil {
+		return m.RotateJoinTokenFunc(ctx, distro, clusterID, oldToken, newToken, rotatedBy)
+	}
+	panic("MockStore.RotateJoinToken not set")
+}
+
+func (m *MockStore) StoreAgentToken(ctx context.Context, distro, clusterID, token string) error {
+	if m.StoreAgentTokenFunc != nil {
+		return m.StoreAgentTokenFunc(ctx, distro, clusterID, token)
+	}
+	panic("MockStore.StoreAgentToken not set")
+}
+
+func (m *MockStore) RetrieveAgentToken(ctx context.Context, distro, clusterID string) (*AgentToken, error) {
+	if m.RetrieveAgentTokenFunc != nil {
+		return m.RetrieveAgentTokenFunc(ctx, distro, clusterID)
+	}
+	panic("MockStore.RetrieveAgentToken not set")
+}
+
+func (m *MockStore) StoreMasterInfo(ctx context.Context, distro, clusterID, hostname string, hosts []string, vip string) error {
 	if m.StoreMasterInfoFunc != nil {
-		return m.StoreMasterInfoFunc(distro, clusterID, hostname, hosts, vip)
+		return m.StoreMasterInfoFunc(ctx, distro, clusterID, hostname, hosts, vip)
 	}
 	panic("MockStore.StoreMasterInfo not set")
 }
 
-func (m *MockStore) RetrieveMasterInfo(distro, clusterID string) (hosts []string, vip string, hostIPs map[string]string, err error) {
+func (m *MockStore) RetrieveMasterInfo(ctx context.Context, distro, clusterID string) (*MasterSet, error) {
 	if m.RetrieveMasterInfoFunc != nil {
-		return m.RetrieveMasterInfoFunc(distro, clusterID)
+		return m.RetrieveMasterInfoFunc(ctx, distro, clusterID)
 	}
 	panic("MockStore.RetrieveMasterInfo not set")
 }
 
-func (m *MockStore) RetrieveFirstMasterIP(distro, clusterID string) (string, error) {
+func (m *MockStore) RetrieveFirstMasterIP(ctx context.Context, distro, clusterID string) (string, error) {
 	if m.RetrieveFirstMasterIPFunc != nil {
-		return m.RetrieveFirstMasterIPFunc(distro, clusterID)
+		return m.RetrieveFirstMasterIPFunc(ctx, distro, clusterID)
 	}
 	panic("MockStore.RetrieveFirstMasterIP not set")
 }
 
-func (m *MockStore) StoreKubeConfig(distro, clusterID, kubeconfigPath, vip string) error {
+func (m *MockStore) StoreKubeConfig(ctx context.Context, distro, clusterID, kubeconfigPath, vip string, apiPort int) error {
 	if m.StoreKubeConfigFunc != nil {
-		return m.StoreKubeConfigFunc(distro, clusterID, kubeconfigPath, vip)
+		return m.StoreKubeConfigFunc(ctx, distro, clusterID, kubeconfigPath, vip, apiPort)
 	}
 	panic("MockStore.StoreKubeConfig not set")
 }
 
-func (m *MockStore) RetrieveKubeConfig(distro, clusterID, destinationPath string) error {
+func (m *MockStore) RetrieveKubeConfig(ctx context.Context, distro, clusterID, destinationPath string) error {
 	if m.RetrieveKubeConfigFunc != nil {
-		return m.RetrieveKubeConfigFunc(distro, clusterID, destinationPath)
+		return m.RetrieveKubeConfigFunc(ctx, distro, clusterID, destinationPath)
 	}
 	panic("MockStore.RetrieveKubeConfig not set")
 }
 
-func (m *MockStore) StoreLBInfo(distro, clusterID, hostname, vip string, isMain bool) error {
+func (m *MockStore) RetrieveKubeConfigVersion(ctx context.Context, distro, clusterID, destinationPath string, version int) error {
+	if m.RetrieveKubeConfigVersionFunc != nil {
+		return m.RetrieveKubeConfigVersionFunc(ctx, distro, clusterID, destinationPath, version)
+	}
+	panic("MockStore.RetrieveKubeConfigVersion not set")
+}
+
+func (m *MockStore) RetrieveKubeconfigRecord(ctx context.Context, distro, clusterID string) (*KubeconfigRecord, error) {
+	if m.RetrieveKubeconfigRecordFunc != nil {
+		return m.RetrieveKubeconfigRecordFunc(ctx, distro, clusterID)
+	}
+	panic("MockStore.RetrieveKubeconfigRecord not set")
+}
+
+func (m *MockStore) StoreClientCA(ctx context.Context, distro, clusterID, certPath, keyPath string) error {
+	if m.StoreClientCAFunc != nil {
+		return m.StoreClientCAFunc(ctx, distro, clusterID, certPath, keyPath)
+	}
+	panic("MockStore.StoreClientCA not set")
+}
+
+func (m *MockStore) RetrieveClientCA(ctx context.Context, distro, clusterID string) (*ClientCARecord, error) {
+	if m.RetrieveClientCAFunc != nil {
+		return m.RetrieveClientCAFunc(ctx, distro, clusterID)
+	}
+	panic("MockStore.RetrieveClientCA not set")
+}
+
+func (m *MockStore) StoreLBInfo(ctx context.Context, distro, clusterID, hostname, vip string, isMain bool) error {
 	if m.StoreLBInfoFunc != nil {
-		return m.StoreLBInfoFunc(distro, clusterID, hostname, vip, isMain)
+		return m.StoreLBInfoFunc(ctx, distro, clusterID, hostname, vip, isMain)
 	}
 	panic("MockStore.StoreLBInfo not set")
 }
 
-func (m *MockStore) RetrieveLBInfo(distro, clusterID string) (nodes []map[string]interface{}, vip string, err error) {
+func (m *MockStore) RetrieveLBInfo(ctx context.Context, distro, clusterID string) (nodes []LBNodeRecord, vip string, err error) {
 	if m.RetrieveLBInfoFunc != nil {
-		return m.RetrieveLBInfoFunc(distro, clusterID)
+		return m.RetrieveLBInfoFunc(ctx, distro, clusterID)
 	}
 	panic("MockStore.RetrieveLBInfo not set")
 }
 
-func (m *MockStore) RemoveLBNode(distro, clusterID, hostname string) error {
+func (m *MockStore) RemoveLBNode(ctx context.Context, distro, clusterID, hostname string) error {
 	if m.RemoveLBNodeFunc != nil {
-		return m.RemoveLBNodeFunc(distro, clusterID, hostname)
+		return m.RemoveLBNodeFunc(ctx, distro, clusterID, hostname)
 	}
 	panic("MockStore.RemoveLBNode not set")
 }
 
-func (m *MockStore) DeleteClusterData(distro, clusterID string) error {
+func (m *MockStore) AcquireLock(ctx context.Context, distro, clusterID, name, holder string, ttl time.Duration) (*Lease, error) {
+	if m.AcquireLockFunc != nil {
+		return m.AcquireLockFunc(ctx, distro, clusterID, name, holder, ttl)
+	}
+	panic("MockStore.AcquireLock not set")
+}
+
+func (m *MockStore) ReleaseLock(ctx context.Context, lease *Lease) error {
+	if m.ReleaseLockFunc != nil {
+		return m.ReleaseLockFunc(ctx, lease)
+	}
+	panic("MockStore.ReleaseLock not set")
+}
+
+func (m *MockStore) RetrieveCluster(ctx context.Context, distro, clusterID string) (*ClusterRecord, error) {
+	if m.RetrieveClusterFunc != nil {
+		return m.RetrieveClusterFunc(ctx, distro, clusterID)
+	}
+	panic("MockStore.RetrieveCluster not set")
+}
+
+func (m *MockStore) DeleteClusterData(ctx context.Context, distro, clusterID string) error {
 	if m.DeleteClusterDataFunc != nil {
-		return m.DeleteClusterDataFunc(distro, clusterID)
+		return m.DeleteClusterDataFunc(ctx, distro, clusterID)
 	}
 	panic("MockStore.DeleteClusterData not set")
 }
@@ -0,0 +1,168 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the openbao storage backend on OpenBao's KV v2 secrets engine.
+Every request is bounded by the request timeout and retried on transient failures (see retry.go).
+*/
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// openbaoKV stores secrets in the KV v2 engine of the OpenBao server c is connected to.
+type openbaoKV struct {
+	c *Client
+}
+
+// Compile-time check: openbaoKV must satisfy kvBackend.
+var _ kvBackend = (*openbaoKV)(nil)
+
+// logicalRead performs a logical read with retries. params are sent as query parameters (e.g. version).
+func (o *openbaoKV) logicalRead(ctx context.Context, path string, params map[string][]string) (*vault.Secret, error) {
+	var secret *vault.Secret
+	err := o.c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = o.c.VaultClient.Logical().ReadWithDataWithContext(ctx, path, params)
+		return err
+	})
+	return secret, err
+}
+
+func (o *openbaoKV) read(ctx context.Context, dataPath string, version int) (map[string]interface{}, int, error) {
+	var params map[string][]string
+	if version > 0 {
+		params = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+
+	secret, err := o.logicalRead(ctx, dataPath, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+
+	number := 0
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		number = toInt(metadata["version"])
+	}
+	if secret.Data["data"] == nil {
+		return nil, number, nil
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid data format at path: %s", dataPath)
+	}
+	return data, number, nil
+}
+
+func (o *openbaoKV) write(ctx context.Context, dataPath string, data map[string]interface{}, cas int) error {
+	body := map[string]interface{}{"data": data}
+	if cas >= 0 {
+		body["options"] = map[string]interface{}{"cas": cas}
+	}
+	err := o.c.withRetry(ctx, func(ctx context.Context) error {
+		_, err := o.c.VaultClient.Logical().WriteWithContext(ctx, dataPath, body)
+		return err
+	})
+	if cas >= 0 && isCASMismatch(err) {
+		return &ConflictError{Path: dataPath, Version: cas}
+	}
+	return err
+}
+
+func (o *openbaoKV) list(ctx context.Context, metadataPath string) ([]string, error) {
+	var secret *vault.Secret
+	err := o.c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = o.c.VaultClient.Logical().ListWithContext(ctx, metadataPath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return []string{}, nil // Return empty slice for non-existent paths
+	}
+
+	keysRaw, ok := secret.Data["keys"]
+	if !ok {
+		return []string{}, nil
+	}
+
+	keysInterface, ok := keysRaw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid keys format at path: %s", metadataPath)
+	}
+
+	keys := make([]string, 0, len(keysInterface))
+	for _, k := range keysInterface {
+		if strKey, ok := k.(string); ok {
+			keys = append(keys, strKey)
+		}
+	}
+	return keys, nil
+}
+
+func (o *openbaoKV) delete(ctx context.Context, path string) error {
+	return o.c.withRetry(ctx, func(ctx context.Context) error {
+		_, err := o.c.VaultClient.Logical().DeleteWithContext(ctx, path)
+		return err
+	})
+}
+
+func (o *openbaoKV) history(ctx context.Context, dataPath string) ([]SecretVersion, int, error) {
+	metadataPath, err := MetadataPath(dataPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	secret, err := o.logicalRead(ctx, metadataPath, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read metadata at path '%s': %w", metadataPath, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+
+	current := toInt(secret.Data["current_version"])
+	rawVersions, _ := secret.Data["versions"].(map[string]interface{})
+	versions := make([]SecretVersion, 0, len(rawVersions))
+	for key, raw := range rawVersions {
+		number, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid version '%s' in metadata at path: %s", key, metadataPath)
+		}
+		fields, _ := raw.(map[string]interface{})
+		version := SecretVersion{Version: number}
+		version.CreatedTime = parseTime(fields["created_time"])
+		version.DeletionTime = parseTime(fields["deletion_time"])
+		version.Destroyed, _ = fields["destroyed"].(bool)
+		versions = append(versions, version)
+	}
+	return versions, current, nil
+}
+
+// isCASMismatch reports whether err is OpenBao rejecting a write because the cas version didn't match.
+func isCASMismatch(err error) bool {
+	var respErr *vault.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, msg := range respErr.Errors {
+		if strings.Contains(msg, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
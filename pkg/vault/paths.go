@@ -0,0 +1,61 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file implements the KV v2 path builder. All cluster data lives under
+
+	<mount>/data/[<prefix>/]<distro>/<cluster-id>/<item>
+
+with the matching <mount>/metadata/... paths used for listing and permanent deletion.
+The mount (default `kv`) and the optional prefix (e.g. `teams/platform`) are resolved
+once from configuration so every caller builds identical paths.
+*/
+package vault
+
+import (
+	"strings"
+)
+
+// DefaultKVMount is the KV v2 mount used when none is configured.
+const DefaultKVMount = "kv"
+
+// KVPaths builds KV v2 API paths for a mount and an optional path prefix.
+type KVPaths struct {
+	Mount  string
+	Prefix string
+}
+
+// DefaultKVPaths returns the path layout used when nothing is configured: the `kv/` mount without prefix.
+func DefaultKVPaths() KVPaths {
+	return KVPaths{Mount: DefaultKVMount}
+}
+
+// Data returns the KV v2 data path (used to read and write secrets) for the given path segments.
+func (p KVPaths) Data(parts ...string) string {
+	return p.build("data", parts)
+}
+
+// Metadata returns the KV v2 metadata path (used to list keys and delete all versions) for the given path segments.
+func (p KVPaths) Metadata(parts ...string) string {
+	return p.build("metadata", parts)
+}
+
+// build joins mount, API segment, prefix and parts, ignoring empty segments and stray slashes.
+func (p KVPaths) build(kind string, parts []string) string {
+	mount := p.Mount
+	if mount == "" {
+		mount = DefaultKVMount
+	}
+
+	segments := []string{strings.Trim(mount, "/"), kind}
+	for _, part := range append([]string{p.Prefix}, parts...) {
+		if part = strings.Trim(part, "/"); part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Distros lists the distributions cluster data is stored for; each one is a top-level path segment.
+var Distros = []string{"rke2", "k3s"}
@@ -0,0 +1,41 @@
+package vault
+
+import "testing"
+
+func TestKVPaths_Default(t *testing.T) {
+	p := DefaultKVPaths()
+
+	if got := p.Data("rke2", "my-cluster", "token"); got != "kv/data/rke2/my-cluster/token" {
+		t.Errorf("unexpected data path %q", got)
+	}
+	if got := p.Metadata("rke2", "my-cluster", "lb"); got != "kv/metadata/rke2/my-cluster/lb" {
+		t.Errorf("unexpected metadata path %q", got)
+	}
+}
+
+func TestKVPaths_CustomMountAndPrefix(t *testing.T) {
+	p := KVPaths{Mount: "edge", Prefix: "teams/platform"}
+
+	if got := p.Data("k3s", "k3s-abc", "lb", "lb1"); got != "edge/data/teams/platform/k3s/k3s-abc/lb/lb1" {
+		t.Errorf("unexpected data path %q", got)
+	}
+	if got := p.Metadata("k3s", "k3s-abc"); got != "edge/metadata/teams/platform/k3s/k3s-abc" {
+		t.Errorf("unexpected metadata path %q", got)
+	}
+}
+
+func TestKVPaths_TrimsSlashesAndEmptySegments(t *testing.T) {
+	p := KVPaths{Mount: "/edge/", Prefix: "/teams/"}
+
+	if got := p.Metadata("rke2", ""); got != "edge/metadata/teams/rke2" {
+		t.Errorf("unexpected metadata path %q", got)
+	}
+}
+
+func TestKVPaths_EmptyMountFallsBackToDefault(t *testing.T) {
+	p := KVPaths{}
+
+	if got := p.Data("rke2", "c1", "masters"); got != "kv/data/rke2/c1/masters" {
+		t.Errorf("unexpected data path %q", got)
+	}
+}
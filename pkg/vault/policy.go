@@ -0,0 +1,234 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements least-privilege access for the nodes of a cluster:
+- NewClusterPolicy: Builds the ACL policy for a node role, scoped to one cluster's paths
+- WritePolicy: Writes a policy to OpenBao
+- CreateScopedToken: Mints a short-lived token carrying only that policy
+- CreateAppRoleCredentials: Creates an AppRole for the policy and issues a role_id/secret_id pair
+
+The roles match what each node type does during its install:
+- server: reads and writes everything of its cluster (tokens, kubeconfig, masters, locks)
+- agent: reads the agent token and the masters (hostnames, IPs and the VIP it joins through)
+- lb: reads the masters and the other load balancers, writes its own lb entry and the election lock
+
+A compromised node therefore can't read other clusters' data, and a worker can't read the
+server token or the kubeconfig of its own cluster.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// Node roles a cluster policy can be created for.
+const (
+	PolicyRoleServer = "server"
+	PolicyRoleAgent  = "agent"
+	PolicyRoleLB     = "lb"
+)
+
+// PolicyRoles lists the supported node roles.
+var PolicyRoles = []string{PolicyRoleServer, PolicyRoleAgent, PolicyRoleLB}
+
+// policyNameSegment restricts the values that end up in policy names and paths, so they can't
+// contain glob characters or break out of the HCL string.
+var policyNameSegment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ClusterPolicy is an ACL policy scoped to the paths of one cluster.
+type ClusterPolicy struct {
+	Name  string
+	Rules string
+}
+
+// NewClusterPolicy builds the policy for a node role in a cluster. hostname is required for the
+// lb role, whose policy only allows writing that host's lb entry.
+func NewClusterPolicy(paths KVPaths, distro, clusterID, role, hostname string) (*ClusterPolicy, error) {
+	for name, value := range map[string]string{"distro": distro, "cluster ID": clusterID} {
+		if !policyNameSegment.MatchString(value) {
+			return nil, fmt.Errorf("invalid %s %q for a policy", name, value)
+		}
+	}
+
+	data := func(parts ...string) string { return paths.Data(append([]string{distro, clusterID}, parts...)...) }
+	metadata := func(parts ...string) string {
+		return paths.Metadata(append([]string{distro, clusterID}, parts...)...)
+	}
+
+	name := fmt.Sprintf("edgectl-%s-%s-%s", distro, clusterID, role)
+	var rules []policyRule
+	switch role {
+	case PolicyRoleServer:
+		rules = []policyRule{
+			{data("*"), []string{"create", "read", "update", "delete"}},
+			{metadata(), []string{"read", "list", "delete"}},
+			{metadata("*"), []string{"read", "list", "delete"}},
+		}
+	case PolicyRoleAgent:
+		rules = []policyRule{
+			{data("agent-token"), []string{"read"}},
+			// the master set holds only hostnames, IPs and the VIP the agent joins through
+			{data("masters"), []string{"read"}},
+		}
+	case PolicyRoleLB:
+		if !policyNameSegment.MatchString(hostname) {
+			return nil, fmt.Errorf("the lb role needs the hostname of the load balancer, got %q", hostname)
+		}
+		name += "-" + hostname
+		rules = []policyRule{
+			{data("masters"), []string{"read"}},
+			{metadata("lb"), []string{"list"}},
+			{data("lb", "*"), []string{"read"}},
+			{data("lb", hostname), []string{"create", "read", "update"}},
+			{metadata("lb", hostname), []string{"delete"}},
+			{data("locks", "lb-election"), []string{"create", "read", "update"}},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported role %q (expected %s)", role, strings.Join(PolicyRoles, ", "))
+	}
+
+	return &ClusterPolicy{Name: name, Rules: renderRules(fmt.Sprintf("edgectl %s policy for %s cluster %s", role, distro, clusterID), rules)}, nil
+}
+
+// policyRule grants capabilities on one path.
+type policyRule struct {
+	path         string
+	capabilities []string
+}
+
+// renderRules renders rules as HCL with a leading comment.
+func renderRules(comment string, rules []policyRule) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", comment)
+	for _, r := range rules {
+		fmt.Fprintf(&b, "\npath %q {\n  capabilities = [\"%s\"]\n}\n", r.path, strings.Join(r.capabilities, `", "`))
+	}
+	return b.String()
+}
+
+// WritePolicy creates or replaces an ACL policy.
+func (c *Client) WritePolicy(ctx context.Context, policy *ClusterPolicy) error {
+	api, err := c.openbao()
+	if err != nil {
+		return err
+	}
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		return api.Sys().PutPolicyWithContext(ctx, policy.Name, policy.Rules)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write policy '%s': %w", policy.Name, err)
+	}
+	return nil
+}
+
+// ScopedCredentials are the credentials minted for a cluster policy: a token, or an AppRole
+// role_id/secret_id pair to log in with (auth.method approle).
+type ScopedCredentials struct {
+	Policy    string    `json:"policy" yaml:"policy"`
+	Method    string    `json:"method" yaml:"method"`
+	Token     string    `json:"token,omitempty" yaml:"token,omitempty"`
+	Accessor  string    `json:"accessor,omitempty" yaml:"accessor,omitempty"`
+	RoleName  string    `json:"role_name,omitempty" yaml:"role_name,omitempty"`
+	RoleID    string    `json:"role_id,omitempty" yaml:"role_id,omitempty"`
+	SecretID  string    `json:"secret_id,omitempty" yaml:"secret_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// CreateScopedToken mints a token that carries only policy (plus OpenBao's default policy, which
+// lets it look up and renew itself) and can't outlive ttl.
+func (c *Client) CreateScopedToken(ctx context.Context, policy string, ttl time.Duration) (*ScopedCredentials, error) {
+	api, err := c.openbao()
+	if err != nil {
+		return nil, err
+	}
+
+	var secret *vault.Secret
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = api.Auth().Token().CreateWithContext(ctx, &vault.TokenCreateRequest{
+			Policies:       []string{policy},
+			TTL:            ttl.String(),
+			ExplicitMaxTTL: ttl.String(),
+			DisplayName:    policy,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token for policy '%s': %w", policy, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("failed to create token for policy '%s': empty response", policy)
+	}
+
+	return &ScopedCredentials{
+		Policy:    policy,
+		Method:    AuthMethodToken,
+		Token:     secret.Auth.ClientToken,
+		Accessor:  secret.Auth.Accessor,
+		ExpiresAt: now().UTC().Add(time.Duration(secret.Auth.LeaseDuration) * time.Second),
+	}, nil
+}
+
+// CreateAppRoleCredentials creates (or updates) an AppRole named after policy on the AppRole mount
+// and issues a secret_id for it. Tokens logged in with it carry only policy and live at most ttl;
+// the secret_id itself expires after ttl as well.
+func (c *Client) CreateAppRoleCredentials(ctx context.Context, mount, policy string, ttl time.Duration) (*ScopedCredentials, error) {
+	api, err := c.openbao()
+	if err != nil {
+		return nil, err
+	}
+	mount = strings.Trim(valueOrDefault(mount, defaultAppRoleMount), "/")
+	rolePath := fmt.Sprintf("auth/%s/role/%s", mount, policy)
+	seconds := int(ttl.Seconds())
+
+	var roleID, secretID string
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		if _, err := api.Logical().WriteWithContext(ctx, rolePath, map[string]interface{}{
+			"token_policies": []string{policy},
+			"token_ttl":      seconds,
+			"token_max_ttl":  seconds,
+			"secret_id_ttl":  seconds,
+		}); err != nil {
+			return err
+		}
+
+		role, err := api.Logical().ReadWithContext(ctx, rolePath+"/role-id")
+		if err != nil {
+			return err
+		}
+		if role == nil || role.Data["role_id"] == nil {
+			return fmt.Errorf("no role_id returned for %s", rolePath)
+		}
+		roleID = fmt.Sprint(role.Data["role_id"])
+
+		issued, err := api.Logical().WriteWithContext(ctx, rolePath+"/secret-id", nil)
+		if err != nil {
+			return err
+		}
+		if issued == nil || issued.Data["secret_id"] == nil {
+			return fmt.Errorf("no secret_id returned for %s", rolePath)
+		}
+		secretID = fmt.Sprint(issued.Data["secret_id"])
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AppRole credentials for policy '%s': %w", policy, err)
+	}
+
+	return &ScopedCredentials{
+		Policy:    policy,
+		Method:    AuthMethodAppRole,
+		RoleName:  policy,
+		RoleID:    roleID,
+		SecretID:  secretID,
+		ExpiresAt: now().UTC().Add(ttl),
+	}, nil
+}
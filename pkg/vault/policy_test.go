@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewClusterPolicy_Roles(t *testing.T) {
+	paths := KVPaths{Mount: "edge", Prefix: "teams/platform"}
+	tests := []struct {
+		role, hostname string
+		wantName       string
+		want           []string
+		notWant        []string
+	}{
+		{
+			role: PolicyRoleServer, wantName: "edgectl-rke2-c1-server",
+			want: []string{
+				`path "edge/data/teams/platform/rke2/c1/*"`,
+				`path "edge/metadata/teams/platform/rke2/c1"`,
+				`"create", "read", "update", "delete"`,
+			},
+		},
+		{
+			role: PolicyRoleAgent, wantName: "edgectl-rke2-c1-agent",
+			want: []string{
+				`path "edge/data/teams/platform/rke2/c1/agent-token" {` + "\n" + `  capabilities = ["read"]`,
+				`path "edge/data/teams/platform/rke2/c1/masters" {` + "\n" + `  capabilities = ["read"]`,
+			},
+			notWant: []string{"/token\"", "kubeconfig", "/*", "update"},
+		},
+		{
+			role: PolicyRoleLB, hostname: "lb-1", wantName: "edgectl-rke2-c1-lb-lb-1",
+			want: []string{
+				`path "edge/data/teams/platform/rke2/c1/masters"`,
+				`path "edge/data/teams/platform/rke2/c1/lb/lb-1" {` + "\n" + `  capabilities = ["create", "read", "update"]`,
+				`path "edge/metadata/teams/platform/rke2/c1/lb/lb-1" {` + "\n" + `  capabilities = ["delete"]`,
+				`path "edge/data/teams/platform/rke2/c1/locks/lb-election"`,
+			},
+			notWant: []string{"token", "kubeconfig"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			policy, err := NewClusterPolicy(paths, "rke2", "c1", tt.role, tt.hostname)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy.Name != tt.wantName {
+				t.Errorf("expected name %q, got %q", tt.wantName, policy.Name)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(policy.Rules, w) {
+					t.Errorf("expected policy to contain %q, got:\n%s", w, policy.Rules)
+				}
+			}
+			for _, nw := range tt.notWant {
+				if strings.Contains(policy.Rules, nw) {
+					t.Errorf("expected policy not to contain %q, got:\n%s", nw, policy.Rules)
+				}
+			}
+		})
+	}
+}
+
+func TestNewClusterPolicy_Errors(t *testing.T) {
+	tests := []struct {
+		name, clusterID, role, hostname string
+	}{
+		{"unknown role", "c1", "admin", ""},
+		{"lb without hostname", "c1", PolicyRoleLB, ""},
+		{"glob in cluster ID", "c*", PolicyRoleAgent, ""},
+		{"quote in hostname", "c1", PolicyRoleLB, `lb"1`},
+		{"path in cluster ID", "../other", PolicyRoleServer, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClusterPolicy(DefaultKVPaths(), "rke2", tt.clusterID, tt.role, tt.hostname); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// policyStub records the requests made by the policy and credential helpers.
+type policyStub struct {
+	mu       sync.Mutex
+	requests map[string]map[string]interface{}
+}
+
+func (s *policyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body := map[string]interface{}{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	s.requests[r.Method+" "+r.URL.Path] = body
+
+	switch r.URL.Path {
+	case "/v1/auth/token/create":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "s.scoped", "accessor": "acc-1", "lease_duration": 3600},
+		})
+	case "/v1/auth/approle/role/edgectl-rke2-c1-agent/role-id":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"role_id": "role-123"}})
+	case "/v1/auth/approle/role/edgectl-rke2-c1-agent/secret-id":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"secret_id": "secret-456"}})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestWritePolicy(t *testing.T) {
+	stub := &policyStub{requests: map[string]map[string]interface{}{}}
+	client := newStubClient(t, stub)
+	policy, _ := NewClusterPolicy(DefaultKVPaths(), "rke2", "c1", PolicyRoleAgent, "")
+
+	if err := client.WritePolicy(t.Context(), policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := stub.requests["PUT /v1/sys/policies/acl/edgectl-rke2-c1-agent"]
+	if body == nil || body["policy"] != policy.Rules {
+		t.Errorf("expected the policy rules to be written, got %v", stub.requests)
+	}
+}
+
+func TestCreateScopedToken(t *testing.T) {
+	original := now
+	now = func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = original })
+
+	stub := &policyStub{requests: map[string]map[string]interface{}{}}
+	client := newStubClient(t, stub)
+
+	creds, err := client.CreateScopedToken(t.Context(), "edgectl-rke2-c1-agent", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.Token != "s.scoped" || creds.Method != AuthMethodToken || !creds.ExpiresAt.Equal(now().Add(time.Hour)) {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	body := stub.requests["POST /v1/auth/token/create"]
+	policies, _ := body["policies"].([]interface{})
+	if len(policies) != 1 || policies[0] != "edgectl-rke2-c1-agent" || body["ttl"] != "1h0m0s" || body["explicit_max_ttl"] != "1h0m0s" {
+		t.Errorf("unexpected token request: %v", body)
+	}
+}
+
+func TestCreateAppRoleCredentials(t *testing.T) {
+	stub := &policyStub{requests: map[string]map[string]interface{}{}}
+	client := newStubClient(t, stub)
+
+	creds, err := client.CreateAppRoleCredentials(t.Context(), "", "edgectl-rke2-c1-agent", 30*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.RoleID != "role-123" || creds.SecretID != "secret-456" || creds.Method != AuthMethodAppRole {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	role := stub.requests["PUT /v1/auth/approle/role/edgectl-rke2-c1-agent"]
+	policies, _ := role["token_policies"].([]interface{})
+	if len(policies) != 1 || policies[0] != "edgectl-rke2-c1-agent" || role["token_max_ttl"] != float64(1800) || role["secret_id_ttl"] != float64(1800) {
+		t.Errorf("unexpected role definition: %v", role)
+	}
+}
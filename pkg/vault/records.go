@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file defines the typed records stored for every cluster:
+- JoinToken: <distro>/<cluster-id>/token
+- AgentToken: <distro>/<cluster-id>/agent-token
+- MasterSet: <distro>/<cluster-id>/masters
+- LBNodeRecord: <distro>/<cluster-id>/lb/<hostname>
+- KubeconfigRecord: <distro>/<cluster-id>/kubeconfig
+- ClientCARecord: <distro>/<cluster-id>/client-ca
+- ClusterRecord: everything above, assembled for a whole cluster
+
+Records are converted to and from the KV v2 key/value maps through their JSON tags, so the
+stored layout is defined in one place. Each record carries a schema version; records written
+before versioning was introduced decode with SchemaVersion 0. Data that doesn't match the
+schema is reported as a *ValidationError instead of being silently skipped.
+*/
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CurrentSchemaVersion is the schema version written with every record.
+const CurrentSchemaVersion = 1
+
+// record is implemented by every typed record so it can be validated after decoding.
+type record interface {
+	Validate() error
+}
+
+// JoinToken is the token servers and agents use to join a cluster.
+type JoinToken struct {
+	SchemaVersion int    `json:"schema_version"`
+	Token         string `json:"join_token"`
+	ClusterID     string `json:"cluster"`
+	// RotatedAt (RFC 3339) and RotatedBy are set when the token was replaced by a rotation
+	RotatedAt string `json:"rotated_at,omitempty"`
+	RotatedBy string `json:"rotated_by,omitempty"`
+}
+
+// Validate checks that the record holds a token.
+func (t *JoinToken) Validate() error {
+	if t.Token == "" {
+		return &ValidationError{Record: "token", Reason: "join_token is empty"}
+	}
+	return nil
+}
+
+// AgentToken is the agent-only token workers use to join a cluster. Unlike the JoinToken
+// (the server token), it can't be used to join as a control-plane node.
+type AgentToken struct {
+	SchemaVersion int    `json:"schema_version"`
+	Token         string `json:"agent_token"`
+	ClusterID     string `json:"cluster"`
+}
+
+// Validate checks that the record holds a token.
+func (t *AgentToken) Validate() error {
+	if t.Token == "" {
+		return &ValidationError{Record: "agent-token", Reason: "agent_token is empty"}
+	}
+	return nil
+}
+
+// MasterSet lists the control-plane nodes of a cluster and the VIP in front of them.
+type MasterSet struct {
+	SchemaVersion int               `json:"schema_version"`
+	Hosts         []string          `json:"hosts"`
+	VIP           string            `json:"vip"`
+	LastAdded     string            `json:"last_added"`
+	HostIPs       map[string]string `json:"host_ips"`
+	FirstIP       string            `json:"first_ip"`
+}
+
+// Validate checks that the record lists at least one host and no empty hostnames.
+func (m *MasterSet) Validate() error {
+	if len(m.Hosts) == 0 {
+		return &ValidationError{Record: "masters", Reason: "hosts is empty"}
+	}
+	for i, h := range m.Hosts {
+		if h == "" {
+			return &ValidationError{Record: "masters", Reason: fmt.Sprintf("hosts[%d] is empty", i)}
+		}
+	}
+	return nil
+}
+
+// FirstMasterIP returns the address of the first (initial) master: the stored first_ip,
+// else the IP recorded for the first host, else that host's name.
+func (m *MasterSet) FirstMasterIP() string {
+	if m.FirstIP != "" {
+		return m.FirstIP
+	}
+	if len(m.Hosts) == 0 {
+		return ""
+	}
+	if ip, ok := m.HostIPs[m.Hosts[0]]; ok {
+		return ip
+	}
+	return m.Hosts[0]
+}
+
+// LBNodeRecord describes one load balancer node of a cluster.
+type LBNodeRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Hostname      string `json:"hostname"`
+	VIP           string `json:"vip"`
+	IsMain        bool   `json:"is_main"`
+}
+
+// Validate checks that the record names its host.
+func (n *LBNodeRecord) Validate() error {
+	if n.Hostname == "" {
+		return &ValidationError{Record: "lb", Reason: "hostname is empty"}
+	}
+	return nil
+}
+
+// KubeconfigRecord holds the admin kubeconfig uploaded by the first server.
+type KubeconfigRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Kubeconfig    string `json:"kubeconfig"`
+}
+
+// Validate checks that the record holds a kubeconfig.
+func (k *KubeconfigRecord) Validate() error {
+	if k.Kubeconfig == "" {
+		return &ValidationError{Record: "kubeconfig", Reason: "kubeconfig is empty"}
+	}
+	return nil
+}
+
+// ClientCARecord holds the CA the cluster's API server trusts for client certificates, uploaded
+// by the first server so kubeconfigs can be issued to users. The key makes it as sensitive as
+// the admin kubeconfig.
+type ClientCARecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	Certificate   string `json:"certificate"`
+	Key           string `json:"key"`
+}
+
+// Validate checks that the record holds a certificate and its key.
+func (c *ClientCARecord) Validate() error {
+	if c.Certificate == "" || c.Key == "" {
+		return &ValidationError{Record: "client-ca", Reason: "certificate or key is empty"}
+	}
+	return nil
+}
+
+// ClusterRecord is the full set of records stored for one cluster.
+// Items that don't exist (yet) are nil; LBNodes is empty when no load balancer was created.
+type ClusterRecord struct {
+	SchemaVersion int               `json:"schema_version"`
+	Distro        string            `json:"distro"`
+	ClusterID     string            `json:"cluster_id"`
+	Token         *JoinToken        `json:"token,omitempty"`
+	AgentToken    *AgentToken       `json:"agent_token,omitempty"`
+	Masters       *MasterSet        `json:"masters,omitempty"`
+	Kubeconfig    *KubeconfigRecord `json:"kubeconfig,omitempty"`
+	LBNodes       []LBNodeRecord    `json:"lb_nodes"`
+	VIP           string            `json:"vip,omitempty"`
+}
+
+// decodeRecord converts a KV map into a typed record and validates it.
+// path is only used to give the error context.
+func decodeRecord(path string, data map[string]interface{}, v record) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return &ValidationError{Path: path, Reason: err.Error()}
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &ValidationError{Path: path, Reason: err.Error()}
+	}
+	if err := v.Validate(); err != nil {
+		if verr, ok := err.(*ValidationError); ok { //nolint:errorlint // Validate returns *ValidationError unwrapped
+			verr.Path = path
+		}
+		return err
+	}
+	return nil
+}
+
+// encodeRecord converts a typed record into the KV map stored in the secret store.
+func encodeRecord(v record) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeRecord_LegacyRecordWithoutSchemaVersion(t *testing.T) {
+	data := map[string]interface{}{
+		"hosts":    []interface{}{"master1", "master2"},
+		"vip":      "10.0.0.100",
+		"host_ips": map[string]interface{}{"master1": "10.0.0.1"},
+	}
+
+	masters := &MasterSet{}
+	if err := decodeRecord("kv/data/rke2/c1/masters", data, masters); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if masters.SchemaVersion != 0 {
+		t.Errorf("expected schema version 0 for legacy record, got %d", masters.SchemaVersion)
+	}
+	if len(masters.Hosts) != 2 || masters.VIP != "10.0.0.100" || masters.HostIPs["master1"] != "10.0.0.1" {
+		t.Errorf("unexpected record: %+v", masters)
+	}
+}
+
+func TestDecodeRecord_WrongTypeIsValidationError(t *testing.T) {
+	data := map[string]interface{}{"hostname": "lb1", "is_main": "yes"}
+
+	err := decodeRecord("kv/data/rke2/c1/lb/lb1", data, &LBNodeRecord{})
+	if !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord, got %v", err)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Path != "kv/data/rke2/c1/lb/lb1" {
+		t.Errorf("expected ValidationError with path, got %v", err)
+	}
+}
+
+func TestDecodeRecord_MissingRequiredField(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   map[string]interface{}
+		record record
+	}{
+		{"token", map[string]interface{}{"cluster": "c1"}, &JoinToken{}},
+		{"masters", map[string]interface{}{"vip": "10.0.0.100"}, &MasterSet{}},
+		{"masters empty host", map[string]interface{}{"hosts": []interface{}{"master1", ""}}, &MasterSet{}},
+		{"lb", map[string]interface{}{"is_main": true}, &LBNodeRecord{}},
+		{"kubeconfig", map[string]interface{}{}, &KubeconfigRecord{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeRecord("kv/data/some/path", tt.data, tt.record)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			if verr.Path != "kv/data/some/path" {
+				t.Errorf("expected path to be set, got %q", verr.Path)
+			}
+		})
+	}
+}
+
+func TestEncodeRecord_RoundTrip(t *testing.T) {
+	in := &LBNodeRecord{SchemaVersion: CurrentSchemaVersion, Hostname: "lb1", VIP: "10.0.0.100", IsMain: true}
+
+	data, err := encodeRecord(in)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data["hostname"] != "lb1" || data["is_main"] != true {
+		t.Errorf("unexpected encoded data: %v", data)
+	}
+
+	out := &LBNodeRecord{}
+	if err := decodeRecord("path", data, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *out != *in {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestMasterSet_FirstMasterIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		masters MasterSet
+		want    string
+	}{
+		{"stored first_ip", MasterSet{FirstIP: "10.0.0.9", Hosts: []string{"m1"}}, "10.0.0.9"},
+		{"ip of first host", MasterSet{Hosts: []string{"m1", "m2"}, HostIPs: map[string]string{"m1": "10.0.0.1"}}, "10.0.0.1"},
+		{"hostname fallback", MasterSet{Hosts: []string{"m1"}}, "m1"},
+		{"empty", MasterSet{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.masters.FirstMasterIP(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetrieveMasterInfo_InvalidRecord(t *testing.T) {
+	stub := &casStubServer{data: map[string]interface{}{"hosts": "master1"}, version: 1}
+	client := newStubClient(t, stub)
+
+	_, err := client.RetrieveMasterInfo(t.Context(), "rke2", "c1")
+	if !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord, got %v", err)
+	}
+}
+
+func TestStoreMasterInfo_RefusesToOverwriteInvalidRecord(t *testing.T) {
+	original := lookupHost
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"10.0.0.2"}, nil
+	}
+	t.Cleanup(func() { lookupHost = original })
+
+	stub := &casStubServer{data: map[string]interface{}{"hosts": "master1"}, version: 1}
+	client := newStubClient(t, stub)
+
+	err := client.StoreMasterInfo(t.Context(), "rke2", "c1", "master2", []string{"master2"}, "")
+	if !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected ErrInvalidRecord, got %v", err)
+	}
+	if stub.writes != 0 {
+		t.Errorf("expected no writes, got %d", stub.writes)
+	}
+}
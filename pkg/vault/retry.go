@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements request timeouts and retries for the Client:
+- RetryConfig: Per-request timeout and exponential backoff settings
+- withRetry: Runs a request with a timeout, retrying transient failures
+- isTransient: Classifies errors worth retrying (5xx, 429, connection errors, request timeouts)
+
+Edge nodes often reach the secret store over flaky uplinks, so a single dropped connection
+or a 503 from a standby node should not fail a whole install. Every attempt gets its own
+timeout so a hung endpoint can't block forever, and cancelling the caller's context (e.g.
+Ctrl-C) stops both the in-flight request and any pending retry immediately.
+*/
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+
+	"github.com/michielvha/edgectl/pkg/logger"
+)
+
+// Retry defaults, used when nothing is configured.
+const (
+	DefaultRequestTimeout = 30 * time.Second
+	DefaultMaxRetries     = 3
+	DefaultRetryWaitMin   = 500 * time.Millisecond
+	DefaultRetryWaitMax   = 10 * time.Second
+)
+
+// RetryConfig controls how long a single request may take and how transient failures are retried.
+type RetryConfig struct {
+	// Timeout bounds every individual request attempt; 0 disables it
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt; 0 disables retrying
+	MaxRetries int
+	// WaitMin and WaitMax bound the exponential backoff between attempts
+	WaitMin time.Duration
+	WaitMax time.Duration
+}
+
+// DefaultRetryConfig returns the retry settings used when nothing is configured.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Timeout:    DefaultRequestTimeout,
+		MaxRetries: DefaultMaxRetries,
+		WaitMin:    DefaultRetryWaitMin,
+		WaitMax:    DefaultRetryWaitMax,
+	}
+}
+
+// backoff returns the delay before retry number attempt (starting at 1): WaitMin doubled per
+// attempt and capped at WaitMax, with jitter so several nodes don't retry in lockstep.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	if r.WaitMin <= 0 {
+		return 0
+	}
+	wait := r.WaitMin
+	for i := 1; i < attempt && (r.WaitMax <= 0 || wait < r.WaitMax); i++ {
+		wait *= 2
+	}
+	if r.WaitMax > 0 && wait > r.WaitMax {
+		wait = r.WaitMax
+	}
+	// Equal jitter: half fixed, half random
+	half := wait / 2
+	return half + rand.N(half+1) //nolint:gosec // jitter does not need a secure source
+}
+
+// withRetry runs request with a per-attempt timeout and retries it with exponential backoff
+// while it fails with a transient error. The last error is returned once the retries are used up
+// or ctx is done.
+func (c *Client) withRetry(ctx context.Context, request func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, request)
+		if err == nil || attempt >= c.retry.MaxRetries || !isTransient(ctx, err) {
+			return err
+		}
+
+		wait := c.retry.backoff(attempt + 1)
+		logger.Debug("transient secret store error (attempt %d/%d), retrying in %s: %v", attempt+1, c.retry.MaxRetries+1, wait, err)
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return fmt.Errorf("%w (giving up: %w)", err, sleepErr)
+		}
+	}
+}
+
+// attempt runs request once, bounded by the configured request timeout.
+func (c *Client) attempt(ctx context.Context, request func(ctx context.Context) error) error {
+	if c.retry.Timeout <= 0 {
+		return request(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.retry.Timeout)
+	defer cancel()
+	return request(attemptCtx)
+}
+
+// isTransient reports whether err is worth retrying. Nothing is retried once ctx itself is done.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// The per-attempt timeout expired while the caller is still waiting
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError || respErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var kubeErr *kubeAPIError
+	if errors.As(err, &kubeErr) {
+		return kubeErr.StatusCode >= http.StatusInternalServerError || kubeErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	// Certificate problems won't fix themselves
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// loadRetryConfig resolves the retry settings from the config file and environment,
+// falling back to the defaults for unset or unparsable values.
+func loadRetryConfig() RetryConfig {
+	retry := DefaultRetryConfig()
+	retry.Timeout = durationSetting("secretstore.request_timeout", "BAO_REQUEST_TIMEOUT", retry.Timeout)
+	retry.MaxRetries = intSetting("secretstore.max_retries", "BAO_MAX_RETRIES", retry.MaxRetries)
+	retry.WaitMin = durationSetting("secretstore.retry_wait_min", "BAO_RETRY_WAIT_MIN", retry.WaitMin)
+	retry.WaitMax = durationSetting("secretstore.retry_wait_max", "BAO_RETRY_WAIT_MAX", retry.WaitMax)
+	return retry
+}
+
+// durationSetting parses a duration setting (e.g. "30s"), returning def when unset or invalid.
+func durationSetting(key, env string, def time.Duration) time.Duration {
+	raw := setting(key, env)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		logger.Warn("Ignoring invalid %s value %q, using %s", key, raw, def)
+		return def
+	}
+	return d
+}
+
+// intSetting parses a non-negative integer setting, returning def when unset or invalid.
+func intSetting(key, env string, def int) int {
+	raw := setting(key, env)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		logger.Warn("Ignoring invalid %s value %q, using %d", key, raw, def)
+		return def
+	}
+	return n
+}
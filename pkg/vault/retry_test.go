@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// flakyHandler fails the first `failures` requests with status, then serves a KV v2 secret.
+type flakyHandler struct {
+	failures int32
+	status   int
+	hits     atomic.Int32
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.hits.Add(1) <= h.failures {
+		w.WriteHeader(h.status)
+		_, _ = w.Write([]byte(`{"errors":["unavailable"]}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"data":{"data":{"key":"value"},"metadata":{"version":1}}}`))
+}
+
+// fastRetries configures the client to retry quickly in tests.
+func fastRetries(c *Client, maxRetries int) {
+	c.retry = RetryConfig{Timeout: time.Second, MaxRetries: maxRetries, WaitMin: time.Millisecond, WaitMax: 5 * time.Millisecond}
+}
+
+func TestWithRetry_RetriesServerErrors(t *testing.T) {
+	handler := &flakyHandler{failures: 2, status: http.StatusServiceUnavailable}
+	client := newStubClient(t, handler)
+	fastRetries(client, 3)
+
+	data, err := client.RetrieveSecret(t.Context(), "kv/data/flaky")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data["key"] != "value" {
+		t.Errorf("unexpected data: %v", data)
+	}
+	if got := handler.hits.Load(); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestWithRetry_GivesUpAfterMaxRetries(t *testing.T) {
+	handler := &flakyHandler{failures: 10, status: http.StatusBadGateway}
+	client := newStubClient(t, handler)
+	fastRetries(client, 2)
+
+	_, err := client.RetrieveSecret(t.Context(), "kv/data/flaky")
+	var respErr *vault.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 response error, got %v", err)
+	}
+	if got := handler.hits.Load(); got != 3 {
+		t.Errorf("expected 1 attempt + 2 retries, got %d requests", got)
+	}
+}
+
+func TestWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	handler := &flakyHandler{failures: 1, status: http.StatusForbidden}
+	client := newStubClient(t, handler)
+	fastRetries(client, 3)
+
+	if _, err := client.RetrieveSecret(t.Context(), "kv/data/flaky"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := handler.hits.Load(); got != 1 {
+		t.Errorf("expected a single request, got %d", got)
+	}
+}
+
+func TestWithRetry_RequestTimeout(t *testing.T) {
+	var hits atomic.Int32
+	client := newStubClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-r.Context().Done()
+	}))
+	client.retry = RetryConfig{Timeout: 20 * time.Millisecond, MaxRetries: 1, WaitMin: time.Millisecond}
+
+	start := time.Now()
+	_, err := client.RetrieveSecret(t.Context(), "kv/data/hung")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("expected the timed out request to be retried once, got %d requests", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the request timeout to bound the call, took %s", elapsed)
+	}
+}
+
+func TestWithRetry_CancelStopsRetrying(t *testing.T) {
+	handler := &flakyHandler{failures: 100, status: http.StatusServiceUnavailable}
+	client := newStubClient(t, handler)
+	client.retry = RetryConfig{Timeout: time.Second, MaxRetries: 100, WaitMin: time.Hour, WaitMax: time.Hour}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.RetrieveSecret(ctx, "kv/data/flaky")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected cancellation to interrupt the backoff, took %s", elapsed)
+	}
+	if got := handler.hits.Load(); got != 1 {
+		t.Errorf("expected a single request, got %d", got)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"503", context.Background(), &vault.ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"429", context.Background(), &vault.ResponseError{StatusCode: http.StatusTooManyRequests}, true},
+		{"404", context.Background(), &vault.ResponseError{StatusCode: http.StatusNotFound}, false},
+		{"connection refused", context.Background(), fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"attempt timeout", context.Background(), fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"caller cancelled", cancelled, &vault.ResponseError{StatusCode: http.StatusServiceUnavailable}, false},
+		{"other", context.Background(), errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	retry := RetryConfig{WaitMin: 100 * time.Millisecond, WaitMax: time.Second}
+
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		got := retry.backoff(attempt)
+		if got < limit/2 || got > limit {
+			t.Errorf("attempt %d: expected backoff in [%s, %s], got %s", attempt, limit/2, limit, got)
+		}
+	}
+
+	if got := (RetryConfig{}).backoff(3); got != 0 {
+		t.Errorf("expected no backoff without WaitMin, got %s", got)
+	}
+}
+
+func TestLoadRetryConfig(t *testing.T) {
+	t.Setenv("BAO_REQUEST_TIMEOUT", "5s")
+	t.Setenv("BAO_MAX_RETRIES", "not-a-number")
+
+	retry := loadRetryConfig()
+	if retry.Timeout != 5*time.Second {
+		t.Errorf("expected 5s timeout, got %s", retry.Timeout)
+	}
+	if retry.MaxRetries != DefaultMaxRetries {
+		t.Errorf("expected invalid value to fall back to %d, got %d", DefaultMaxRetries, retry.MaxRetries)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides specialized handlers for cluster secrets management.
+
+This file implements what the generic secrets commands need beyond plain reads and writes:
+  - ParseSecretData: Decodes a JSON or YAML document into the keys of a secret
+  - ParseLiterals: Builds the keys of a secret from key=value pairs
+  - PatchSecret: Merges keys into an existing secret instead of replacing it
+  - ListingPath: Resolves the metadata path to list for a data or metadata path
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ParseSecretData decodes a JSON or YAML mapping into secret data. Nested values are kept as is.
+func ParseSecretData(data []byte) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	// JSON is valid YAML, so one decoder reads both
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to parse secret data (expected a JSON or YAML mapping): %w", err)
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("the secret data holds no keys")
+	}
+	return decoded, nil
+}
+
+// ParseLiterals builds secret data from key=value pairs. The value is everything after the
+// first '=' and may be empty; a key given twice is an error.
+func ParseLiterals(pairs []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid literal %q (expected key=value)", pair)
+		}
+		if _, exists := data[key]; exists {
+			return nil, fmt.Errorf("key %q is given more than once", key)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+// PatchSecret merges data into the secret at a KV v2 data path and stores the result as a new
+// version: keys in data are added or replaced, keys set to nil are removed and all other keys
+// are kept. The secret must exist. The write uses check-and-set, so concurrent patches aren't lost.
+func (c *Client) PatchSecret(ctx context.Context, fullVaultPath string, data map[string]interface{}) error {
+	return c.updateSecretCAS(ctx, fullVaultPath, func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w at path: %s (use put or set to create it)", ErrNotFound, fullVaultPath)
+		}
+		patched := make(map[string]interface{}, len(current)+len(data))
+		for k, v := range current {
+			patched[k] = v
+		}
+		for k, v := range data {
+			if v == nil {
+				delete(patched, k)
+				continue
+			}
+			patched[k] = v
+		}
+		return patched, nil
+	})
+}
+
+// ListingPath returns the KV v2 metadata path to list for path, which may be a data path
+// (kv/data/rke2), a metadata path (kv/metadata/rke2) or the root of a mount (kv/data).
+func ListingPath(path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if mount, ok := strings.CutSuffix(path, "/data"); ok && mount != "" {
+		return mount + "/metadata", nil
+	}
+	if strings.HasSuffix(path, "/metadata") || strings.Contains(path, "/metadata/") {
+		return path, nil
+	}
+	return MetadataPath(path)
+}
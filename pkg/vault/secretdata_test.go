@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseSecretData(t *testing.T) {
+	for name, input := range map[string]string{
+		"JSON": `{"api_url": "https://example.com", "retries": 3, "tls": {"verify": true}}`,
+		"YAML": "api_url: https://example.com\nretries: 3\ntls:\n  verify: true\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := ParseSecretData([]byte(input))
+			if err != nil {
+				t.Fatalf("ParseSecretData: %v", err)
+			}
+			if data["api_url"] != "https://example.com" || data["retries"] != 3 {
+				t.Errorf("unexpected data: %#v", data)
+			}
+			if tls, ok := data["tls"].(map[string]interface{}); !ok || tls["verify"] != true {
+				t.Errorf("expected nested values to be kept, got %#v", data["tls"])
+			}
+		})
+	}
+
+	for _, input := range []string{"", "# only a comment\n", "- a\n- b\n", "{", "just text"} {
+		if _, err := ParseSecretData([]byte(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestParseLiterals(t *testing.T) {
+	data, err := ParseLiterals([]string{"url=https://example.com/?a=b", "empty=", "list=a,b"})
+	if err != nil {
+		t.Fatalf("ParseLiterals: %v", err)
+	}
+	if data["url"] != "https://example.com/?a=b" || data["empty"] != "" || data["list"] != "a,b" {
+		t.Errorf("unexpected data: %#v", data)
+	}
+
+	for _, pairs := range [][]string{{"novalue"}, {"=value"}, {"a=1", "a=2"}} {
+		if _, err := ParseLiterals(pairs); err == nil {
+			t.Errorf("%q: expected an error", pairs)
+		}
+	}
+}
+
+func TestPatchSecret(t *testing.T) {
+	client := NewMemoryStore(DefaultKVPaths())
+	path := client.paths.Data("myapp", "config")
+
+	if err := client.PatchSecret(t.Context(), path, map[string]interface{}{"a": "1"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected patching a missing secret to fail with ErrNotFound, got %v", err)
+	}
+
+	if err := client.StoreSecret(t.Context(), path, map[string]interface{}{"keep": "k", "change": "old", "drop": "d"}); err != nil {
+		t.Fatalf("StoreSecret: %v", err)
+	}
+	if err := client.PatchSecret(t.Context(), path, map[string]interface{}{"change": "new", "add": "a", "drop": nil}); err != nil {
+		t.Fatalf("PatchSecret: %v", err)
+	}
+
+	data, err := client.RetrieveSecret(t.Context(), path)
+	if err != nil {
+		t.Fatalf("RetrieveSecret: %v", err)
+	}
+	if len(data) != 3 || data["keep"] != "k" || data["change"] != "new" || data["add"] != "a" {
+		t.Errorf("unexpected patched data: %#v", data)
+	}
+	if history, _ := client.SecretHistory(t.Context(), path); len(history) != 2 {
+		t.Errorf("expected the patch to be stored as a new version, got %d versions", len(history))
+	}
+}
+
+func TestListingPath(t *testing.T) {
+	tests := map[string]string{
+		"kv/data":                       "kv/metadata",
+		"kv/data/":                      "kv/metadata",
+		"kv/metadata":                   "kv/metadata",
+		"kv/data/myapp":                 "kv/metadata/myapp",
+		"kv/data/myapp/":                "kv/metadata/myapp",
+		"kv/metadata/rke2/c1":           "kv/metadata/rke2/c1",
+		"teams/kv/data/platform/rke2":   "teams/kv/metadata/platform/rke2",
+		"teams/kv/metadata/platform/k3": "teams/kv/metadata/platform/k3",
+	}
+	for path, want := range tests {
+		if got, err := ListingPath(path); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", path, want, got, err)
+		}
+	}
+	for _, path := range []string{"", "kv", "secret/myapp"} {
+		if _, err := ListingPath(path); err == nil || !strings.Contains(err.Error(), "KV v2") {
+			t.Errorf("%q: expected an error, got %v", path, err)
+		}
+	}
+}
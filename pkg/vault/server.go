@@ -4,10 +4,10 @@ Copyright © 2025 VH & Co - contact@vhco.pro
 Package vault provides specialized handlers for cluster secrets management.
 
 This file handles master node management for Kubernetes clusters:
-- StoreMasterInfo: Records metadata about master nodes, including their hostnames, IPs, and VIPs
+- StoreMasterInfo: Merges a master node into the cluster's master list (hostnames, IPs, VIP) using check-and-set
 - RetrieveMasterInfo: Gets the list of master nodes, their IPs, and associated VIP
 - RetrieveFirstMasterIP: Gets the IP of the first (initial) master node for joining operations
-- Helper functions: getFirstMasterIP, getHostIP
+- Helper functions: getFirstMasterIP, getHostIP, mergeHosts
 
 These functions enable multi-master high availability configurations by tracking
 cluster node membership, determining network endpoints for control plane access,
@@ -16,6 +16,7 @@ and facilitating orderly cluster expansion and maintenance.
 package vault
 
 import (
+	"context"
 	"fmt"
 	"net"
 )
@@ -23,8 +24,12 @@ import (
 // lookupHost is a package-level variable wrapping net.LookupHost so tests can inject a stub.
 var lookupHost = net.LookupHost
 
-// StoreMasterInfo stores information about master nodes and their configuration
-func (c *Client) StoreMasterInfo(distro, clusterID, hostname string, hosts []string, vip string) error {
+// StoreMasterInfo registers a master node and merges it into the cluster's master list.
+// The hosts passed in are merged with the hosts already stored (never replacing them), and
+// the update is done with check-and-set so servers joining in parallel don't lose each other's entries.
+// A VIP that is already stored wins over the provided one.
+// If the record keeps changing underneath us, a *ConflictError is returned.
+func (c *Client) StoreMasterInfo(ctx context.Context, distro, clusterID, hostname string, hosts []string, vip string) error {
 	// Get the IP address of this host
 	ipAddr, err := getHostIP(hostname)
 	if err != nil {
@@ -32,39 +37,56 @@ func (c *Client) StoreMasterInfo(distro, clusterID, hostname string, hosts []str
 		ipAddr = hostname
 	}
 
-	// Check if we already have master IPs stored
-	var hostIPs map[string]string
-	data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/masters", distro, clusterID))
-	if err == nil && data["host_ips"] != nil {
-		// Try to retrieve existing host_ips map
-		if ipsData, ok := data["host_ips"].(map[string]interface{}); ok {
-			hostIPs = make(map[string]string)
-			for k, v := range ipsData {
-				if strVal, ok := v.(string); ok {
-					hostIPs[k] = strVal
-				}
+	path := c.paths.Data(distro, clusterID, "masters")
+	return c.updateSecretCAS(ctx, path, func(current map[string]interface{}) (map[string]interface{}, error) {
+		stored := &MasterSet{}
+		if current != nil {
+			if err := decodeRecord(path, current, stored); err != nil {
+				return nil, err
 			}
 		}
-	}
 
-	// Initialize map if it doesn't exist yet
-	if hostIPs == nil {
-		hostIPs = make(map[string]string)
-	}
+		// Add/update this host's IP
+		hostIPs := stored.HostIPs
+		if hostIPs == nil {
+			hostIPs = make(map[string]string)
+		}
+		hostIPs[hostname] = ipAddr
 
-	// Add/update this host's IP
-	hostIPs[hostname] = ipAddr
+		merged := mergeHosts(stored.Hosts, hosts, []string{hostname})
 
-	path := fmt.Sprintf("kv/data/%s/%s/masters", distro, clusterID)
-	return c.StoreSecret(path, map[string]interface{}{
-		"hosts":      hosts,
-		"vip":        vip,
-		"last_added": hostname,
-		"host_ips":   hostIPs,
-		"first_ip":   getFirstMasterIP(hosts, hostIPs, ipAddr),
+		if stored.VIP != "" {
+			vip = stored.VIP
+		}
+
+		return encodeRecord(&MasterSet{
+			SchemaVersion: CurrentSchemaVersion,
+			Hosts:         merged,
+			VIP:           vip,
+			LastAdded:     hostname,
+			HostIPs:       hostIPs,
+			FirstIP:       getFirstMasterIP(merged, hostIPs, ipAddr),
+		})
 	})
 }
 
+// mergeHosts concatenates the host lists, dropping duplicates and empty entries while
+// preserving order so the first master stays first.
+func mergeHosts(lists ...[]string) []string {
+	merged := []string{}
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, h := range list {
+			if h == "" || seen[h] {
+				continue
+			}
+			seen[h] = true
+			merged = append(merged, h)
+		}
+	}
+	return merged
+}
+
 // Helper function to get the IP of the first master in the list
 func getFirstMasterIP(hosts []string, hostIPs map[string]string, currentIP string) string {
 	// If we have no hosts, return the current IP
@@ -96,72 +118,25 @@ func getHostIP(hostname string) (string, error) {
 	return addrs[0], nil
 }
 
-// RetrieveMasterInfo retrieves master nodes information
-func (c *Client) RetrieveMasterInfo(distro, clusterID string) (hosts []string, vip string, hostIPs map[string]string, err error) {
-	data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/masters", distro, clusterID))
+// RetrieveMasterInfo retrieves the master set of a cluster: its master nodes, their IPs and the VIP
+func (c *Client) RetrieveMasterInfo(ctx context.Context, distro, clusterID string) (*MasterSet, error) {
+	path := c.paths.Data(distro, clusterID, "masters")
+	data, err := c.RetrieveSecret(ctx, path)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	hostsRaw, ok := data["hosts"]
-	if !ok {
-		return nil, "", nil, fmt.Errorf("hosts information not found for cluster %s", clusterID)
+		return nil, err
 	}
-
-	// Convert interface{} to string slice
-	hosts = []string{}
-	if hostsArray, ok := hostsRaw.([]interface{}); ok {
-		for _, h := range hostsArray {
-			if hostStr, ok := h.(string); ok {
-				hosts = append(hosts, hostStr)
-			}
-		}
+	masters := &MasterSet{}
+	if err := decodeRecord(path, data, masters); err != nil {
+		return nil, err
 	}
-
-	vip, _ = data["vip"].(string)
-
-	// Extract host_ips map if available
-	hostIPs = make(map[string]string)
-	if hostIPsRaw, ok := data["host_ips"].(map[string]interface{}); ok {
-		for hostname, ipRaw := range hostIPsRaw {
-			if ip, ok := ipRaw.(string); ok {
-				hostIPs[hostname] = ip
-			}
-		}
-	}
-
-	return hosts, vip, hostIPs, nil
+	return masters, nil
 }
 
 // RetrieveFirstMasterIP retrieves the IP address of the first master node in the cluster
-func (c *Client) RetrieveFirstMasterIP(distro, clusterID string) (string, error) {
-	data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/masters", distro, clusterID))
+func (c *Client) RetrieveFirstMasterIP(ctx context.Context, distro, clusterID string) (string, error) {
+	masters, err := c.RetrieveMasterInfo(ctx, distro, clusterID)
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve master info: %w", err)
 	}
-
-	// Try to get the explicitly stored first_ip
-	if firstIP, ok := data["first_ip"].(string); ok && firstIP != "" {
-		return firstIP, nil
-	}
-
-	// Fallback: Try to get the first host's IP from host_ips map
-	hosts, ok := data["hosts"].([]interface{})
-	if !ok || len(hosts) == 0 {
-		return "", fmt.Errorf("no master IP information found for cluster %s", clusterID)
-	}
-
-	firstHost, ok := hosts[0].(string)
-	if !ok {
-		return "", fmt.Errorf("no master IP information found for cluster %s", clusterID)
-	}
-
-	if hostIPs, ok := data["host_ips"].(map[string]interface{}); ok {
-		if ip, ok := hostIPs[firstHost].(string); ok {
-			return ip, nil
-		}
-	}
-
-	// If we have a hostname but no IP, return the hostname as fallback
-	return firstHost, nil
+	return masters.FirstMasterIP(), nil
 }
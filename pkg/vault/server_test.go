@@ -105,3 +105,20 @@ func TestGetHostIP_MultipleAddrs_ReturnsFirst(t *testing.T) {
 		t.Errorf("expected first addr '10.0.0.1', got %q", ip)
 	}
 }
+
+// --- mergeHosts tests ---
+
+func TestMergeHosts_PreservesOrderAndDeduplicates(t *testing.T) {
+	merged := mergeHosts([]string{"master1", "master2"}, []string{"master2", "master3"}, []string{"master1"})
+	want := []string{"master1", "master2", "master3"}
+	if fmt.Sprint(merged) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, merged)
+	}
+}
+
+func TestMergeHosts_SkipsEmpty(t *testing.T) {
+	merged := mergeHosts(nil, []string{"", "master1"})
+	if len(merged) != 1 || merged[0] != "master1" {
+		t.Errorf("expected [master1], got %v", merged)
+	}
+}
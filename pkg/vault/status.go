@@ -0,0 +1,357 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements the health checks of the secret store:
+  - CheckStatus: Reports on the configured store, even when it is sealed or the login fails
+  - Status: Reports on the store of a connected client: server, token, KV mount and access
+  - Preflight: Runs the same checks before an install, failing if any of them finds a problem
+  - PreflightChecks: The access a node role needs to the paths of its cluster
+  - RunPreflight: Preflight for cmd/ handlers, printing the outcome
+
+Commands used to find out that the store is sealed, or that their token has expired or lacks a
+capability, half-way through an install; the preflight lets them fail before touching the host.
+*/
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+
+	"github.com/michielvha/edgectl/pkg/logger"
+)
+
+// tokenExpiryWarning is how close to its expiry a token that can't be renewed is reported.
+const tokenExpiryWarning = 15 * time.Minute
+
+// Status describes the secret store and the credentials edgectl uses with it.
+type Status struct {
+	Backend     string         `json:"backend" yaml:"backend"`
+	Address     string         `json:"address,omitempty" yaml:"address,omitempty"`
+	Initialized bool           `json:"initialized" yaml:"initialized"`
+	Sealed      bool           `json:"sealed" yaml:"sealed"`
+	Version     string         `json:"version,omitempty" yaml:"version,omitempty"`
+	Token       *TokenStatus   `json:"token,omitempty" yaml:"token,omitempty"`
+	KV          *KVMountStatus `json:"kv,omitempty" yaml:"kv,omitempty"`
+	// Problems make the store unusable for edgectl; Warnings don't (yet)
+	Problems []string `json:"problems,omitempty" yaml:"problems,omitempty"`
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// TokenStatus describes the token a client is logged in with.
+type TokenStatus struct {
+	DisplayName string   `json:"display_name,omitempty" yaml:"display_name,omitempty"`
+	Policies    []string `json:"policies" yaml:"policies"`
+	// ExpiresAt is nil for tokens that never expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Renewable bool       `json:"renewable" yaml:"renewable"`
+}
+
+// KVMountStatus describes the mount cluster data is stored under.
+type KVMountStatus struct {
+	Path    string `json:"path" yaml:"path"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// AccessCheck asks for capabilities (create, read, update, delete, list) on a path.
+type AccessCheck struct {
+	Path         string
+	Capabilities []string
+}
+
+// Err returns an error listing the problems of the status, or nil if there are none.
+func (s *Status) Err() error {
+	if len(s.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the secret store isn't ready: %s", strings.Join(s.Problems, "; "))
+}
+
+// PreflightChecks returns the access a node of role (server, agent or lb) needs to the paths of
+// its cluster during an install. An empty cluster ID stands for a cluster that doesn't exist
+// yet, which only a token that may create any cluster of the distro can install.
+func PreflightChecks(paths KVPaths, distro, clusterID, role, hostname string) []AccessCheck {
+	if clusterID == "" {
+		clusterID = "*"
+	}
+	data := func(parts ...string) string { return paths.Data(append([]string{distro, clusterID}, parts...)...) }
+
+	switch role {
+	case PolicyRoleServer:
+		return []AccessCheck{
+			{Path: data("token"), Capabilities: []string{"create", "read", "update"}},
+			{Path: data("masters"), Capabilities: []string{"create", "read", "update"}},
+		}
+	case PolicyRoleAgent:
+		return []AccessCheck{
+			{Path: data("agent-token"), Capabilities: []string{"read"}},
+			{Path: data("masters"), Capabilities: []string{"read"}},
+		}
+	case PolicyRoleLB:
+		return []AccessCheck{
+			{Path: data("masters"), Capabilities: []string{"read"}},
+			{Path: data("lb", hostname), Capabilities: []string{"create", "read", "update"}},
+		}
+	}
+	return nil
+}
+
+// CheckStatus reports on the secret store configured in the edgectl config file and environment.
+// Unlike NewClient it doesn't stop at the first failure: a sealed or unreachable server and a
+// failed login are reported as problems of the status.
+func CheckStatus(ctx context.Context) *Status {
+	cfg := LoadConfig()
+	if cfg.Backend != "" && cfg.Backend != BackendOpenBao {
+		c, err := NewClient(ctx)
+		if err != nil {
+			return &Status{Backend: cfg.Backend, Problems: []string{err.Error()}}
+		}
+		defer c.Close()
+		return c.Status(ctx)
+	}
+
+	s := &Status{Backend: BackendOpenBao}
+	c, err := newUnauthenticatedClient(cfg)
+	if err != nil {
+		s.Problems = append(s.Problems, err.Error())
+		return s
+	}
+	s.Address = c.VaultClient.Address()
+	if err := c.checkTLS(ctx, cfg.TLS); err != nil {
+		s.Problems = append(s.Problems, err.Error())
+		return s
+	}
+	if !c.serverStatus(ctx, s) {
+		return s
+	}
+
+	client, err := NewClientWithConfig(ctx, cfg)
+	if err != nil {
+		s.Problems = append(s.Problems, fmt.Sprintf("failed to log in with auth method %s: %v", valueOrDefault(cfg.Auth.Method, AuthMethodToken), err))
+		return s
+	}
+	defer client.Close()
+	client.credentialStatus(ctx, s, nil)
+	return s
+}
+
+// Status reports on the secret store of a connected client and checks its token for the
+// capabilities in checks.
+func (c *Client) Status(ctx context.Context, checks ...AccessCheck) *Status {
+	s := &Status{Backend: c.backendName()}
+	if c.VaultClient == nil {
+		// The other backends have no server to ask, so a listing stands in for a health check
+		s.Initialized = true
+		if _, err := c.ListKeys(ctx, c.paths.Metadata()); err != nil {
+			s.Problems = append(s.Problems, err.Error())
+		}
+		return s
+	}
+
+	s.Address = c.VaultClient.Address()
+	if c.serverStatus(ctx, s) {
+		c.credentialStatus(ctx, s, checks)
+	}
+	return s
+}
+
+// Preflight runs Status with checks and returns it, with an error if the store isn't usable.
+// Warnings are logged by the caller; only problems fail the preflight.
+func (c *Client) Preflight(ctx context.Context, checks ...AccessCheck) (*Status, error) {
+	s := c.Status(ctx, checks...)
+	return s, s.Err()
+}
+
+// RunPreflight runs the preflight checks of a node role and prints warnings and problems.
+// Returns false if the install should stop. Use this in cmd/ handlers before touching the host.
+func RunPreflight(ctx context.Context, c *Client, distro, clusterID, role, hostname string) bool {
+	logger.Debug("running secret store preflight for a %s %s node", distro, role)
+	s, err := c.Preflight(ctx, PreflightChecks(c.paths, distro, clusterID, role, hostname)...)
+	for _, w := range s.Warnings {
+		fmt.Printf("⚠️ %s\n", w)
+	}
+	if err != nil {
+		fmt.Printf("❌ Secret store preflight failed (see 'edgectl secrets status'):\n")
+		for _, p := range s.Problems {
+			fmt.Printf("  - %s\n", p)
+		}
+		return false
+	}
+	return true
+}
+
+// serverStatus fills in the seal status and version of an OpenBao server and reports whether
+// it is ready to be logged in to.
+func (c *Client) serverStatus(ctx context.Context, s *Status) bool {
+	var seal *vault.SealStatusResponse
+	err := c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		seal, err = c.VaultClient.Sys().SealStatusWithContext(ctx)
+		return err
+	})
+	if err != nil {
+		s.Problems = append(s.Problems, fmt.Sprintf("can't reach the secret store at %s: %v", s.Address, err))
+		return false
+	}
+
+	s.Initialized, s.Sealed, s.Version = seal.Initialized, seal.Sealed, seal.Version
+	switch {
+	case !seal.Initialized:
+		s.Problems = append(s.Problems, "the secret store isn't initialized (run 'bao operator init')")
+		return false
+	case seal.Sealed:
+		s.Problems = append(s.Problems, fmt.Sprintf("the secret store is sealed (unseal progress %d/%d; run 'bao operator unseal')", seal.Progress, seal.T))
+		return false
+	}
+	return true
+}
+
+// credentialStatus fills in the token and KV mount of a logged in client and checks the token
+// for the capabilities in checks.
+func (c *Client) credentialStatus(ctx context.Context, s *Status, checks []AccessCheck) {
+	api := c.VaultClient
+
+	var self *vault.Secret
+	err := c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		self, err = api.Auth().Token().LookupSelfWithContext(ctx)
+		return err
+	})
+	switch {
+	case isPermissionDenied(err):
+		// OpenBao answers the same for unknown tokens and tokens without the default policy
+		s.Problems = append(s.Problems, "the token is invalid or has expired (or lacks the default policy, which lets it look itself up)")
+		return
+	case err != nil:
+		s.Problems = append(s.Problems, fmt.Sprintf("failed to look up the token: %v", err))
+		return
+	case self != nil:
+		s.Token = tokenStatus(self)
+		if t := s.Token; t.ExpiresAt != nil && !t.Renewable && time.Until(*t.ExpiresAt) < tokenExpiryWarning {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("the token expires in %s and can't be renewed", time.Until(*t.ExpiresAt).Round(time.Second)))
+		}
+	}
+
+	s.KV = c.kvMountStatus(ctx, s)
+
+	for _, check := range checks {
+		var capabilities []string
+		err := c.withRetry(ctx, func(ctx context.Context) error {
+			var err error
+			capabilities, err = api.Sys().CapabilitiesSelfWithContext(ctx, check.Path)
+			return err
+		})
+		if err != nil {
+			s.Problems = append(s.Problems, fmt.Sprintf("failed to check the token's capabilities on %s: %v", check.Path, err))
+			continue
+		}
+		if missing := missingCapabilities(capabilities, check.Capabilities); len(missing) > 0 {
+			s.Problems = append(s.Problems, fmt.Sprintf("the token lacks %s on %s", strings.Join(missing, ", "), check.Path))
+		}
+	}
+}
+
+// kvMountStatus looks up the KV mount of the client's paths, adding a problem if it is missing
+// or isn't a KV v2 engine. It uses the endpoint the bao CLI uses for `bao kv`, which any token
+// with access to the mount may read.
+func (c *Client) kvMountStatus(ctx context.Context, s *Status) *KVMountStatus {
+	mount := strings.Trim(c.paths.Mount, "/")
+	if mount == "" {
+		mount = DefaultKVMount
+	}
+	kv := &KVMountStatus{Path: mount + "/"}
+
+	var secret *vault.Secret
+	err := c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = c.VaultClient.Logical().ReadWithContext(ctx, "sys/internal/ui/mounts/"+mount)
+		return err
+	})
+	if isPermissionDenied(err) || (err == nil && (secret == nil || secret.Data == nil)) {
+		// OpenBao answers the same for a missing mount and one the token can't access
+		s.Problems = append(s.Problems, fmt.Sprintf("the KV mount %s doesn't exist or the token has no access to it (enable it with 'bao secrets enable -path=%s kv-v2')", kv.Path, mount))
+		return kv
+	}
+	if err != nil {
+		s.Problems = append(s.Problems, fmt.Sprintf("failed to look up the KV mount %s: %v", kv.Path, err))
+		return kv
+	}
+
+	kv.Type, _ = secret.Data["type"].(string)
+	if options, ok := secret.Data["options"].(map[string]interface{}); ok {
+		kv.Version, _ = options["version"].(string)
+	}
+	switch {
+	case kv.Type != "kv":
+		s.Problems = append(s.Problems, fmt.Sprintf("the mount %s is a %s engine, not KV v2", kv.Path, kv.Type))
+	case kv.Version != "2":
+		s.Problems = append(s.Problems, fmt.Sprintf("the mount %s is KV version %s; edgectl needs version 2 (bao kv enable-versioning %s)", kv.Path, valueOrDefault(kv.Version, "1"), mount))
+	}
+	return kv
+}
+
+// tokenStatus converts a token lookup response.
+func tokenStatus(self *vault.Secret) *TokenStatus {
+	t := &TokenStatus{}
+	t.DisplayName, _ = self.Data["display_name"].(string)
+	t.Renewable, _ = self.Data["renewable"].(bool)
+	if policies, ok := self.Data["policies"].([]interface{}); ok {
+		for _, p := range policies {
+			if name, ok := p.(string); ok {
+				t.Policies = append(t.Policies, name)
+			}
+		}
+	}
+	if ttl := toInt(self.Data["ttl"]); ttl > 0 {
+		expires := time.Now().Add(time.Duration(ttl) * time.Second)
+		t.ExpiresAt = &expires
+	}
+	return t
+}
+
+// missingCapabilities returns the capabilities of wanted that granted lacks; "root" grants all.
+func missingCapabilities(granted, wanted []string) []string {
+	has := map[string]bool{}
+	for _, c := range granted {
+		has[c] = true
+	}
+	if has["root"] {
+		return nil
+	}
+	var missing []string
+	for _, c := range wanted {
+		if !has[c] || has["deny"] {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// isPermissionDenied reports whether err is a 403 response.
+func isPermissionDenied(err error) bool {
+	var respErr *vault.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// backendName returns the name of the storage backend of the client.
+func (c *Client) backendName() string {
+	switch c.kv.(type) {
+	case *openbaoKV:
+		return BackendOpenBao
+	case *fileKV:
+		return BackendFile
+	case *kubeKV:
+		return BackendKubernetes
+	case *memoryKV:
+		return "memory"
+	}
+	return "unknown"
+}
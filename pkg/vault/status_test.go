@@ -0,0 +1,202 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michielvha/edgectl/pkg/vault/vaulttest"
+)
+
+// newStatusServer starts a fake OpenBao with the default KV mount and points the config at it.
+func newStatusServer(t *testing.T) *vaulttest.Server {
+	t.Helper()
+	server := vaulttest.NewServer()
+	t.Cleanup(server.Close)
+	server.EnableKV(DefaultKVMount + "/")
+	t.Setenv("BAO_ADDR", server.URL)
+	t.Setenv("BAO_TOKEN", vaulttest.RootToken)
+	t.Setenv("BAO_KV_MOUNT", "")
+	return server
+}
+
+// hasProblem reports whether a problem of s contains substring.
+func hasProblem(s *Status, substring string) bool {
+	for _, p := range s.Problems {
+		if strings.Contains(p, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckStatus_Healthy(t *testing.T) {
+	server := newStatusServer(t)
+
+	s := CheckStatus(t.Context())
+	if err := s.Err(); err != nil {
+		t.Fatalf("expected a healthy status, got %v", err)
+	}
+	if s.Backend != BackendOpenBao || s.Address != server.URL || !s.Initialized || s.Sealed || s.Version != vaulttest.Version {
+		t.Errorf("unexpected server status: %+v", s)
+	}
+	if s.Token == nil || len(s.Token.Policies) != 1 || s.Token.Policies[0] != "root" || s.Token.ExpiresAt != nil {
+		t.Errorf("expected a root token that never expires, got %+v", s.Token)
+	}
+	if s.KV == nil || s.KV.Path != DefaultKVMount+"/" || s.KV.Type != "kv" || s.KV.Version != "2" {
+		t.Errorf("expected the KV v2 mount, got %+v", s.KV)
+	}
+}
+
+func TestCheckStatus_Sealed(t *testing.T) {
+	server := newStatusServer(t)
+	server.SetSealed(true)
+
+	s := CheckStatus(t.Context())
+	if !s.Sealed || !hasProblem(s, "sealed") {
+		t.Errorf("expected the seal to be reported, got %+v", s)
+	}
+	if s.Token != nil || s.KV != nil {
+		t.Errorf("expected no login to be attempted while sealed, got %+v", s)
+	}
+}
+
+func TestCheckStatus_MissingMount(t *testing.T) {
+	newStatusServer(t)
+	t.Setenv("BAO_KV_MOUNT", "edge")
+
+	if s := CheckStatus(t.Context()); !hasProblem(s, "KV mount edge/ doesn't exist") {
+		t.Errorf("expected the missing mount to be reported, got %v", s.Problems)
+	}
+}
+
+func TestCheckStatus_UnknownToken(t *testing.T) {
+	newStatusServer(t)
+	t.Setenv("BAO_TOKEN", "s.unknown")
+
+	if s := CheckStatus(t.Context()); !hasProblem(s, "the token is invalid") || s.KV != nil {
+		t.Errorf("expected the unknown token to be reported, got %+v", s)
+	}
+}
+
+func TestPreflight_ScopedToken(t *testing.T) {
+	newStatusServer(t)
+	admin, err := NewClient(t.Context())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	policy, err := NewClusterPolicy(admin.Paths(), "rke2", "c1", PolicyRoleAgent, "")
+	if err != nil {
+		t.Fatalf("NewClusterPolicy: %v", err)
+	}
+	if err := admin.WritePolicy(t.Context(), policy); err != nil {
+		t.Fatalf("WritePolicy: %v", err)
+	}
+	creds, err := admin.CreateScopedToken(t.Context(), policy.Name, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("CreateScopedToken: %v", err)
+	}
+	t.Setenv("BAO_TOKEN", creds.Token)
+	agent, err := NewClient(t.Context())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	s, err := agent.Preflight(t.Context(), PreflightChecks(agent.Paths(), "rke2", "c1", PolicyRoleAgent, "node1")...)
+	if err != nil {
+		t.Fatalf("expected the agent preflight to pass, got %v", err)
+	}
+	if s.Token == nil || s.Token.ExpiresAt == nil || time.Until(*s.Token.ExpiresAt) > 10*time.Minute {
+		t.Errorf("expected the token to expire within its TTL, got %+v", s.Token)
+	}
+
+	_, err = agent.Preflight(t.Context(), PreflightChecks(agent.Paths(), "rke2", "c1", PolicyRoleServer, "node1")...)
+	if err == nil || !strings.Contains(err.Error(), "the token lacks create, read, update on kv/data/rke2/c1/token") {
+		t.Errorf("expected the server preflight to fail on the missing capabilities, got %v", err)
+	}
+	_, err = agent.Preflight(t.Context(), PreflightChecks(agent.Paths(), "rke2", "c2", PolicyRoleAgent, "node1")...)
+	if err == nil || !strings.Contains(err.Error(), "lacks read on kv/data/rke2/c2/agent-token") {
+		t.Errorf("expected the token of c1 not to be enough for c2, got %v", err)
+	}
+}
+
+// The preflight of each role must pass with the policy edgectl creates for that role
+func TestPreflight_RolePolicies(t *testing.T) {
+	newStatusServer(t)
+	admin, err := NewClient(t.Context())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	for _, role := range PolicyRoles {
+		t.Run(role, func(t *testing.T) {
+			policy, err := NewClusterPolicy(admin.Paths(), "k3s", "c1", role, "lb1")
+			if err != nil {
+				t.Fatalf("NewClusterPolicy: %v", err)
+			}
+			if err := admin.WritePolicy(t.Context(), policy); err != nil {
+				t.Fatalf("WritePolicy: %v", err)
+			}
+			creds, err := admin.CreateScopedToken(t.Context(), policy.Name, 10*time.Minute)
+			if err != nil {
+				t.Fatalf("CreateScopedToken: %v", err)
+			}
+			t.Setenv("BAO_TOKEN", creds.Token)
+			client, err := NewClient(t.Context())
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			if _, err := client.Preflight(t.Context(), PreflightChecks(client.Paths(), "k3s", "c1", role, "lb1")...); err != nil {
+				t.Errorf("expected the preflight to pass, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStatus_MemoryStore(t *testing.T) {
+	s := NewMemoryStore(DefaultKVPaths()).Status(t.Context())
+	if err := s.Err(); err != nil || s.Backend != "memory" || !s.Initialized || s.Token != nil {
+		t.Errorf("unexpected status: %+v (%v)", s, err)
+	}
+}
+
+func TestPreflightChecks(t *testing.T) {
+	paths := DefaultKVPaths()
+	tests := []struct {
+		role, clusterID string
+		want            []string
+	}{
+		{role: PolicyRoleServer, clusterID: "", want: []string{"kv/data/rke2/*/token", "kv/data/rke2/*/masters"}},
+		{role: PolicyRoleServer, clusterID: "c1", want: []string{"kv/data/rke2/c1/token", "kv/data/rke2/c1/masters"}},
+		{role: PolicyRoleAgent, clusterID: "c1", want: []string{"kv/data/rke2/c1/agent-token", "kv/data/rke2/c1/masters"}},
+		{role: PolicyRoleLB, clusterID: "c1", want: []string{"kv/data/rke2/c1/masters", "kv/data/rke2/c1/lb/lb1"}},
+		{role: "unknown", clusterID: "c1"},
+	}
+	for _, tt := range tests {
+		checks := PreflightChecks(paths, "rke2", tt.clusterID, tt.role, "lb1")
+		var got []string
+		for _, check := range checks {
+			got = append(got, check.Path)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s %q: expected %v, got %v", tt.role, tt.clusterID, tt.want, got)
+		}
+	}
+}
+
+func TestMissingCapabilities(t *testing.T) {
+	wanted := []string{"create", "read", "update"}
+	tests := []struct {
+		granted []string
+		want    string
+	}{
+		{granted: []string{"root"}, want: ""},
+		{granted: []string{"create", "read", "update", "delete"}, want: ""},
+		{granted: []string{"read", "list"}, want: "create update"},
+		{granted: []string{"deny"}, want: "create read update"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(missingCapabilities(tt.granted, wanted), " "); got != tt.want {
+			t.Errorf("%v: expected %q missing, got %q", tt.granted, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements join tickets: single-use, expiring credentials for joining a cluster.
+- CreateJoinTicket: Response-wraps the join credentials of a cluster for one node role
+- RedeemJoinTicket / UnwrapJoinTicket: Redeem a ticket on the joining node, without any secret store credentials
+- NewClientFromCredentials: Connects a joining server with the store token of its ticket
+
+A ticket is an OpenBao response-wrapping token. OpenBao hands out the wrapped credentials only
+once and discards them when the ticket expires, so a leaked ticket is useless after it was
+redeemed or its TTL passed — and a failed unwrap shows that someone else redeemed it first.
+
+Agent tickets carry the agent token and the server address, nothing else. Server tickets also
+carry a short-lived token with the cluster's server policy (see policy.go), because a joining
+server registers itself in the secret store.
+*/
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// serverTicketInstallWindow is how long the store token in a server ticket outlives the ticket,
+// so a server redeeming it just before it expires can still finish its install.
+const serverTicketInstallWindow = time.Hour
+
+// JoinCredentials are what a node needs to join a cluster; they are the payload of a join ticket.
+type JoinCredentials struct {
+	SchemaVersion int    `json:"schema_version"`
+	Distro        string `json:"distro"`
+	ClusterID     string `json:"cluster"`
+	Role          string `json:"role"`
+	// Token is the agent token for agents and the server token for servers
+	Token string `json:"join_token"`
+	// ServerAddress is the VIP, or the first server's address when the cluster has no VIP
+	ServerAddress string `json:"server_address"`
+	VIP           string `json:"vip,omitempty"`
+	// StoreToken is a short-lived secret store token with the cluster's server policy (servers only)
+	StoreToken string `json:"store_token,omitempty"`
+}
+
+// Validate checks that the credentials are complete for their role.
+func (j *JoinCredentials) Validate() error {
+	switch {
+	case j.ClusterID == "":
+		return &ValidationError{Record: "join ticket", Reason: "cluster is empty"}
+	case j.Token == "":
+		return &ValidationError{Record: "join ticket", Reason: "join_token is empty"}
+	case j.Role != PolicyRoleAgent && j.Role != PolicyRoleServer:
+		return &ValidationError{Record: "join ticket", Reason: fmt.Sprintf("unsupported role %q", j.Role)}
+	case j.Role == PolicyRoleServer && j.StoreToken == "":
+		return &ValidationError{Record: "join ticket", Reason: "store_token is empty"}
+	}
+	return nil
+}
+
+// Check verifies that the credentials were issued for a node of distro with role.
+func (j *JoinCredentials) Check(distro, role string) error {
+	if j.Distro != distro || j.Role != role {
+		return fmt.Errorf("the join ticket was issued for a %s %s of cluster %s, not for a %s %s", j.Distro, j.Role, j.ClusterID, distro, role)
+	}
+	return nil
+}
+
+// JoinTicket is a response-wrapped JoinCredentials.
+type JoinTicket struct {
+	Ticket    string    `json:"ticket" yaml:"ticket"`
+	Accessor  string    `json:"accessor" yaml:"accessor"`
+	Distro    string    `json:"distro" yaml:"distro"`
+	ClusterID string    `json:"cluster_id" yaml:"cluster_id"`
+	Role      string    `json:"role" yaml:"role"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// CreateJoinTicket wraps the join credentials of a cluster for role (agent or server) in a
+// single-use ticket that expires after ttl. For servers, the cluster's server policy is written
+// and a token carrying it is included, valid for ttl plus an install window.
+func (c *Client) CreateJoinTicket(ctx context.Context, distro, clusterID, role string, ttl time.Duration) (*JoinTicket, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("the ticket TTL must be positive, got %s", ttl)
+	}
+
+	creds := &JoinCredentials{SchemaVersion: CurrentSchemaVersion, Distro: distro, ClusterID: clusterID, Role: role}
+	switch role {
+	case PolicyRoleAgent:
+		token, err := c.RetrieveAgentToken(ctx, distro, clusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve agent token: %w", err)
+		}
+		creds.Token = token.Token
+	case PolicyRoleServer:
+		token, err := c.RetrieveJoinToken(ctx, distro, clusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve join token: %w", err)
+		}
+		creds.Token = token.Token
+	default:
+		return nil, fmt.Errorf("unsupported role %q for a join ticket (expected %s or %s)", role, PolicyRoleAgent, PolicyRoleServer)
+	}
+
+	masters, err := c.RetrieveMasterInfo(ctx, distro, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve master node info: %w", err)
+	}
+	creds.VIP = masters.VIP
+	creds.ServerAddress = masters.VIP
+	if creds.ServerAddress == "" {
+		creds.ServerAddress = masters.FirstMasterIP()
+	}
+
+	if role == PolicyRoleServer {
+		policy, err := NewClusterPolicy(c.paths, distro, clusterID, PolicyRoleServer, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := c.WritePolicy(ctx, policy); err != nil {
+			return nil, err
+		}
+		scoped, err := c.CreateScopedToken(ctx, policy.Name, ttl+serverTicketInstallWindow)
+		if err != nil {
+			return nil, err
+		}
+		creds.StoreToken = scoped.Token
+	}
+
+	data, err := encodeRecord(creds)
+	if err != nil {
+		return nil, err
+	}
+	wrapInfo, err := c.wrap(ctx, data, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JoinTicket{
+		Ticket:    wrapInfo.Token,
+		Accessor:  wrapInfo.Accessor,
+		Distro:    distro,
+		ClusterID: clusterID,
+		Role:      role,
+		ExpiresAt: now().UTC().Add(time.Duration(wrapInfo.TTL) * time.Second),
+	}, nil
+}
+
+// wrap stores data in OpenBao's cubbyhole for a new response-wrapping token that expires after ttl.
+func (c *Client) wrap(ctx context.Context, data map[string]interface{}, ttl time.Duration) (*vault.SecretWrapInfo, error) {
+	api, err := c.openbao()
+	if err != nil {
+		return nil, err
+	}
+	wrapping := api.WithRequestCallbacks(func(r *vault.Request) {
+		r.WrapTTL = ttl.String()
+	})
+
+	var secret *vault.Secret
+	err = c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		secret, err = wrapping.Logical().WriteWithContext(ctx, "sys/wrapping/wrap", data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap join credentials: %w", err)
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return nil, fmt.Errorf("failed to wrap join credentials: no wrapping token returned")
+	}
+	return secret.WrapInfo, nil
+}
+
+// RedeemJoinTicket redeems a join ticket using the secret store address from the edgectl config
+// file and environment, and checks that it was issued for a node of distro with role.
+func RedeemJoinTicket(ctx context.Context, ticket, distro, role string) (*JoinCredentials, error) {
+	creds, err := UnwrapJoinTicket(ctx, LoadConfig(), ticket)
+	if err != nil {
+		return nil, err
+	}
+	if err := creds.Check(distro, role); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// UnwrapJoinTicket redeems a join ticket and returns the credentials it holds. It needs only the
+// secret store address and TLS settings from cfg: the ticket itself authenticates the request.
+// The unwrap is not retried, as a ticket can only be redeemed once.
+func UnwrapJoinTicket(ctx context.Context, cfg Config, ticket string) (*JoinCredentials, error) {
+	ticket = strings.TrimSpace(ticket)
+	if ticket == "" {
+		return nil, fmt.Errorf("the join ticket is empty")
+	}
+
+	c, err := newUnauthenticatedClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkTLS(ctx, cfg.TLS); err != nil {
+		return nil, err
+	}
+	// Don't send a token picked up from the environment; the ticket is the token
+	c.VaultClient.ClearToken()
+
+	var secret *vault.Secret
+	err = c.attempt(ctx, func(ctx context.Context) error {
+		secret, err = c.VaultClient.Logical().UnwrapWithContext(ctx, ticket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem join ticket (it may have expired or been used already): %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("failed to redeem join ticket: %w", ErrNotFound)
+	}
+
+	creds := &JoinCredentials{}
+	if err := decodeRecord("sys/wrapping/unwrap", secret.Data, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// NewClientFromCredentials creates a secret store client authenticated with the store token of
+// server credentials. Only the address, TLS settings, KV paths and retry settings of cfg are used.
+func NewClientFromCredentials(ctx context.Context, cfg Config, creds *JoinCredentials) (*Client, error) {
+	if creds.StoreToken == "" {
+		return nil, fmt.Errorf("the join ticket for cluster %s holds no secret store token", creds.ClusterID)
+	}
+	cfg.Auth = AuthConfig{Method: AuthMethodToken, Token: creds.StoreToken}
+	return NewClientWithConfig(ctx, cfg)
+}
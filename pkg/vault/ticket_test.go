@@ -0,0 +1,160 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ticketStub serves the records of cluster c1 and implements single-use response wrapping.
+type ticketStub struct {
+	mu       sync.Mutex
+	records  map[string]map[string]interface{}
+	wrapTTL  string
+	wrapped  map[string]interface{}
+	unwraps  int
+	requests []string
+}
+
+func newTicketStub() *ticketStub {
+	return &ticketStub{records: map[string]map[string]interface{}{
+		"/v1/kv/data/rke2/c1/token":       {"join_token": "K10abc::server:secret", "cluster": "c1"},
+		"/v1/kv/data/rke2/c1/agent-token": {"agent_token": "K10abc::node:agent", "cluster": "c1"},
+		"/v1/kv/data/rke2/c1/masters":     {"hosts": []string{"m1"}, "first_ip": "10.0.0.1"},
+	}}
+}
+
+func (s *ticketStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if data, ok := s.records[r.URL.Path]; ok {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 1}},
+		})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/sys/wrapping/wrap":
+		s.wrapTTL = r.Header.Get("X-Vault-Wrap-TTL")
+		_ = json.NewDecoder(r.Body).Decode(&s.wrapped)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"wrap_info": map[string]interface{}{"token": "s.ticket", "accessor": "acc-ticket", "ttl": 1800},
+		})
+	case "/v1/sys/wrapping/unwrap":
+		s.unwraps++
+		if r.Header.Get("X-Vault-Token") != "s.ticket" || s.wrapped == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["wrapping token is not valid or does not exist"]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": s.wrapped})
+		s.wrapped = nil
+	case "/v1/auth/token/create":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "s.server-scoped", "lease_duration": 5400},
+		})
+	case "/v1/sys/policies/acl/edgectl-rke2-c1-server":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestJoinTicket_AgentRoundTrip(t *testing.T) {
+	stub := newTicketStub()
+	client := newStubClient(t, stub)
+
+	ticket, err := client.CreateJoinTicket(t.Context(), "rke2", "c1", PolicyRoleAgent, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ticket.Ticket != "s.ticket" || ticket.Role != PolicyRoleAgent || stub.wrapTTL != "30m0s" {
+		t.Errorf("unexpected ticket %+v (wrap TTL %q)", ticket, stub.wrapTTL)
+	}
+	if stub.wrapped["join_token"] != "K10abc::node:agent" || stub.wrapped["store_token"] != nil {
+		t.Errorf("expected only the agent token to be wrapped, got %v", stub.wrapped)
+	}
+
+	t.Setenv("VAULT_ADDR", client.VaultClient.Address())
+	t.Setenv("VAULT_TOKEN", "s.ambient")
+	creds, err := UnwrapJoinTicket(t.Context(), Config{KV: DefaultKVPaths()}, " s.ticket\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.Token != "K10abc::node:agent" || creds.ServerAddress != "10.0.0.1" || creds.ClusterID != "c1" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	if _, err := UnwrapJoinTicket(t.Context(), Config{KV: DefaultKVPaths()}, "s.ticket"); err == nil {
+		t.Error("expected a ticket to be redeemable only once")
+	}
+	if stub.unwraps != 2 {
+		t.Errorf("expected one unwrap request per redemption, got %d", stub.unwraps)
+	}
+}
+
+func TestJoinTicket_ServerIncludesScopedToken(t *testing.T) {
+	stub := newTicketStub()
+	stub.records["/v1/kv/data/rke2/c1/masters"]["vip"] = "10.0.0.100"
+	client := newStubClient(t, stub)
+
+	if _, err := client.CreateJoinTicket(t.Context(), "rke2", "c1", PolicyRoleServer, 30*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stub.wrapped["join_token"] != "K10abc::server:secret" || stub.wrapped["store_token"] != "s.server-scoped" {
+		t.Errorf("expected the server token and a scoped store token, got %v", stub.wrapped)
+	}
+	if stub.wrapped["server_address"] != "10.0.0.100" {
+		t.Errorf("expected the VIP as server address, got %v", stub.wrapped["server_address"])
+	}
+	if !strings.Contains(strings.Join(stub.requests, ","), "PUT /v1/sys/policies/acl/edgectl-rke2-c1-server") {
+		t.Errorf("expected the server policy to be written, got %v", stub.requests)
+	}
+}
+
+func TestJoinTicket_Errors(t *testing.T) {
+	client := newStubClient(t, newTicketStub())
+
+	if _, err := client.CreateJoinTicket(t.Context(), "rke2", "c1", PolicyRoleLB, time.Minute); err == nil {
+		t.Error("expected an error for the lb role")
+	}
+	if _, err := client.CreateJoinTicket(t.Context(), "rke2", "missing", PolicyRoleAgent, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown cluster, got %v", err)
+	}
+	if _, err := UnwrapJoinTicket(t.Context(), Config{}, "  "); err == nil {
+		t.Error("expected an error for an empty ticket")
+	}
+}
+
+func TestJoinCredentials_Validate(t *testing.T) {
+	valid := JoinCredentials{ClusterID: "c1", Role: PolicyRoleServer, Token: "t", StoreToken: "s"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	noStoreToken := valid
+	noStoreToken.StoreToken = ""
+	if err := noStoreToken.Validate(); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("expected a validation error without store token, got %v", err)
+	}
+}
+
+func TestJoinCredentials_Check(t *testing.T) {
+	creds := &JoinCredentials{Distro: "rke2", ClusterID: "c1", Role: PolicyRoleAgent}
+	if err := creds.Check("rke2", PolicyRoleAgent); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := creds.Check("k3s", PolicyRoleAgent); err == nil {
+		t.Error("expected an error for another distro")
+	}
+	if err := creds.Check("rke2", PolicyRoleServer); err == nil {
+		t.Error("expected an error for another role")
+	}
+}
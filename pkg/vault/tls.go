@@ -0,0 +1,146 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vault provides a client for interacting with OpenBao (Vault-compatible secret store).
+
+This file implements TLS and mutual TLS for the OpenBao connection:
+- TLSConfig: CA bundle, client certificate and key, server name and the skip-verify escape hatch
+- configureTLS: Applies the settings to the SDK client, failing early on unreadable files
+- checkTLS: Validates the server certificate at startup and explains why it was rejected
+
+The SDK reads the same BAO_* variables on its own; configuring them here also lets them live in
+the edgectl config file or on the command line (--tls-ca-cert, --tls-client-cert, ...). Without
+the startup check a certificate problem would only surface as an opaque x509 error from the
+first request, often after part of an install already ran.
+*/
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	vault "github.com/openbao/openbao/api/v2"
+	"github.com/spf13/viper"
+
+	"github.com/michielvha/edgectl/pkg/logger"
+)
+
+// TLSConfig holds the TLS settings for the OpenBao connection. Empty fields keep the SDK
+// defaults: the system roots, no client certificate and the host name of the address.
+type TLSConfig struct {
+	// CACert is a PEM bundle of the CAs that may sign the server certificate
+	CACert string
+	// ClientCert and ClientKey are the PEM certificate and key presented for mutual TLS;
+	// they must be set together
+	ClientCert string
+	ClientKey  string
+	// ServerName is the name the server certificate is verified against, when the address
+	// uses an IP or a name the certificate doesn't list
+	ServerName string
+	// SkipVerify disables server certificate verification. Only meant for testing.
+	SkipVerify bool
+}
+
+// configured reports whether any TLS setting is given.
+func (t TLSConfig) configured() bool {
+	return t != TLSConfig{}
+}
+
+// loadTLSConfig resolves the TLS settings from the config file, the --tls-* flags and the environment.
+func loadTLSConfig() TLSConfig {
+	return TLSConfig{
+		CACert:     setting("secretstore.tls.ca_cert", "BAO_CACERT"),
+		ClientCert: setting("secretstore.tls.client_cert", "BAO_CLIENT_CERT"),
+		ClientKey:  setting("secretstore.tls.client_key", "BAO_CLIENT_KEY"),
+		ServerName: setting("secretstore.tls.server_name", "BAO_TLS_SERVER_NAME"),
+		// A bound flag always has a value, so the environment can only turn this on
+		SkipVerify: viper.GetBool("secretstore.tls.skip_verify") || envBool("BAO_SKIP_VERIFY"),
+	}
+}
+
+// envBool reports whether the environment variable holds a true boolean.
+func envBool(env string) bool {
+	v, _ := strconv.ParseBool(vault.ReadBaoVariable(env))
+	return v
+}
+
+// configureTLS applies the TLS settings to the SDK configuration.
+func configureTLS(config *vault.Config, t TLSConfig) error {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("invalid secret store TLS settings: the client certificate and key must be set together (secretstore.tls.client_cert and client_key, or --tls-client-cert and --tls-client-key)")
+	}
+	if !t.configured() {
+		return nil
+	}
+	if strings.HasPrefix(config.Address, "http://") {
+		logger.Warn("TLS settings are ignored: the secret store address %s doesn't use https", config.Address)
+	}
+
+	err := config.ConfigureTLS(&vault.TLSConfig{
+		CACert:        t.CACert,
+		ClientCert:    t.ClientCert,
+		ClientKey:     t.ClientKey,
+		TLSServerName: t.ServerName,
+		Insecure:      t.SkipVerify,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid secret store TLS settings: %w", err)
+	}
+	return nil
+}
+
+// checkTLS connects to the secret store to verify its certificate (and that it accepts ours),
+// so a certificate problem fails right away with an explanation. Other failures, like an
+// unreachable server, are left to the requests that follow and their retries.
+func (c *Client) checkTLS(ctx context.Context, t TLSConfig) error {
+	address := c.VaultClient.Address()
+	if !strings.HasPrefix(address, "https://") {
+		return nil
+	}
+	if t.SkipVerify {
+		logger.Warn("Secret store certificate verification is disabled (tls skip_verify); use this for testing only")
+		return nil
+	}
+
+	err := c.attempt(ctx, func(ctx context.Context) error {
+		_, err := c.VaultClient.Sys().SealStatusWithContext(ctx)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	if tlsErr := describeTLSError(address, err); tlsErr != nil {
+		return tlsErr
+	}
+	logger.Debug("secret store TLS check inconclusive: %v", err)
+	return nil
+}
+
+// describeTLSError explains a TLS failure connecting to address and how to fix it.
+// It returns nil when err is not a TLS problem.
+func describeTLSError(address string, err error) error {
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &hostnameErr):
+		return fmt.Errorf("the secret store certificate isn't valid for %q: %w; connect using a name the certificate lists, or set the expected name with secretstore.tls.server_name (--tls-server-name)", hostnameErr.Host, err)
+	case errors.As(err, &authorityErr):
+		return fmt.Errorf("the secret store certificate is signed by an unknown authority: %w; set the CA bundle that issued it with secretstore.tls.ca_cert (--tls-ca-cert)", err)
+	case errors.As(err, &invalidErr):
+		return fmt.Errorf("the secret store certificate is not valid: %w", err)
+	case errors.As(err, &recordErr), strings.Contains(err.Error(), "server gave HTTP response to HTTPS client"):
+		return fmt.Errorf("the secret store at %s doesn't speak TLS: %w; use an http:// address or enable TLS on its listener", address, err)
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		return fmt.Errorf("the secret store rejected the TLS connection: %w; if it requires a client certificate, set secretstore.tls.client_cert and client_key (--tls-client-cert, --tls-client-key) to one signed by a CA it trusts", err)
+	}
+	return nil
+}
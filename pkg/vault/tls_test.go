@@ -0,0 +1,246 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for TLS tests and writes them as PEM files.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+	// certFile is the PEM bundle of the CA
+	certFile string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "edgectl test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.certFile = ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+// issue returns a certificate signed by the CA, and the files holding it and its key.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"bao.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	certFile := ca.write(t, name+".pem", "CERTIFICATE", der)
+	keyFile := ca.write(t, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair: %v", err)
+	}
+	return pair, certFile, keyFile
+}
+
+func (ca *testCA) write(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// newTLSServer starts an OpenBao stand-in serving the seal status over TLS with a certificate
+// for bao.test and 127.0.0.1. When clientCA is set, clients must present a certificate it signed.
+func newTLSServer(t *testing.T, ca *testCA, clientCA *testCA) *httptest.Server {
+	t.Helper()
+	serverCert, _, _ := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"type":"shamir","initialized":true,"sealed":false}`))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	// Rejected handshakes are what the tests are about
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA.cert)
+		srv.TLS.ClientCAs = pool
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// tlsTestConfig returns a token-authenticated Config for address.
+func tlsTestConfig(address string, tlsConfig TLSConfig) Config {
+	return Config{
+		Address: address,
+		TLS:     tlsConfig,
+		Auth:    AuthConfig{Method: AuthMethodToken, Token: "test-token"},
+		KV:      DefaultKVPaths(),
+		Retry:   RetryConfig{Timeout: 5 * time.Second},
+	}
+}
+
+func TestNewClientWithConfig_VerifiesServerCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTLSServer(t, ca, nil)
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{name: "trusted CA", tls: TLSConfig{CACert: ca.certFile}},
+		{name: "server name", tls: TLSConfig{CACert: ca.certFile, ServerName: "bao.test"}},
+		{name: "skip verify", tls: TLSConfig{SkipVerify: true}},
+		{name: "unknown authority", tls: TLSConfig{}, wantErr: "secretstore.tls.ca_cert"},
+		{name: "name mismatch", tls: TLSConfig{CACert: ca.certFile, ServerName: "other.test"}, wantErr: `isn't valid for "other.test"`},
+		{name: "other CA", tls: TLSConfig{CACert: newTestCA(t).certFile}, wantErr: "unknown authority"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithConfig(t.Context(), tlsTestConfig(srv.URL, tt.tls))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewClientWithConfig_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	clientCA := newTestCA(t)
+	srv := newTLSServer(t, ca, clientCA)
+
+	_, err := NewClientWithConfig(t.Context(), tlsTestConfig(srv.URL, TLSConfig{CACert: ca.certFile}))
+	if err == nil || !strings.Contains(err.Error(), "client certificate") {
+		t.Fatalf("expected the missing client certificate to be explained, got %v", err)
+	}
+
+	_, certFile, keyFile := clientCA.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	client, err := NewClientWithConfig(t.Context(), tlsTestConfig(srv.URL, TLSConfig{CACert: ca.certFile, ClientCert: certFile, ClientKey: keyFile}))
+	if err != nil {
+		t.Fatalf("expected the client certificate to be accepted, got %v", err)
+	}
+	client.Close()
+}
+
+func TestNewClientWithConfig_PlainHTTPServer(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	address := "https://" + strings.TrimPrefix(srv.URL, "http://")
+	_, err := NewClientWithConfig(t.Context(), tlsTestConfig(address, TLSConfig{}))
+	if err == nil || !strings.Contains(err.Error(), "doesn't speak TLS") {
+		t.Fatalf("expected a plain HTTP server to be reported, got %v", err)
+	}
+}
+
+func TestNewClientWithConfig_UnreachableServerIsNotATLSError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	address := "https://" + listener.Addr().String()
+	_ = listener.Close()
+
+	// Connection errors are left to the requests and their retries
+	client, err := NewClientWithConfig(t.Context(), tlsTestConfig(address, TLSConfig{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.Close()
+}
+
+func TestConfigureTLS_InvalidSettings(t *testing.T) {
+	ca := newTestCA(t)
+	_, certFile, keyFile := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{name: "certificate without key", tls: TLSConfig{ClientCert: certFile}, wantErr: "must be set together"},
+		{name: "key without certificate", tls: TLSConfig{ClientKey: keyFile}, wantErr: "must be set together"},
+		{name: "missing CA bundle", tls: TLSConfig{CACert: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: "invalid secret store TLS settings"},
+		{name: "unparsable key", tls: TLSConfig{ClientCert: certFile, ClientKey: ca.write(t, "bad-key.pem", "EC PRIVATE KEY", []byte("not a key"))}, wantErr: "invalid secret store TLS settings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newUnauthenticatedClient(tlsTestConfig("https://127.0.0.1:8200", tt.tls))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadTLSConfig_Environment(t *testing.T) {
+	t.Setenv("BAO_CACERT", "/etc/edgectl/ca.pem")
+	t.Setenv("BAO_TLS_SERVER_NAME", "bao.internal")
+	t.Setenv("BAO_SKIP_VERIFY", "true")
+
+	got := loadTLSConfig()
+	want := TLSConfig{CACert: "/etc/edgectl/ca.pem", ServerName: "bao.internal", SkipVerify: true}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
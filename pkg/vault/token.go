@@ -5,7 +5,14 @@ Package vault provides specialized handlers for cluster secrets management.
 
 This file handles the token management functionality for Kubernetes clusters:
 - StoreJoinToken: Saves a cluster join token in the secret store under a specific cluster ID
-- RetrieveJoinToken: Retrieves the join token for a given cluster ID
+- RetrieveJoinToken: Retrieves the join token record for a given cluster ID
+- RetrieveJoinTokenVersion: Retrieves an earlier version of the join token record
+- RotateJoinToken: Replaces the join token after a rotation, recording when and by whom
+- StoreAgentToken: Saves the agent-only join token of a cluster
+- RetrieveAgentToken: Retrieves the agent-only join token of a cluster
+
+Servers use the join token (the server token); agents only ever get the agent token, so a
+worker can't join a cluster as a control-plane node.
 
 These functions are critical for the cluster bootstrapping process, allowing
 servers and agents to securely join existing clusters without manual token handling.
@@ -13,26 +20,85 @@ servers and agents to securely join existing clusters without manual token handl
 package vault
 
 import (
+	"context"
 	"fmt"
+	"time"
 )
 
 // StoreJoinToken saves a token under a specific cluster path
-func (c *Client) StoreJoinToken(distro, clusterID, token string) error {
-	return c.StoreSecret(fmt.Sprintf("kv/data/%s/%s/token", distro, clusterID), map[string]interface{}{
-		"join_token": token,
-		"cluster":    clusterID,
+func (c *Client) StoreJoinToken(ctx context.Context, distro, clusterID, token string) error {
+	data, err := encodeRecord(&JoinToken{SchemaVersion: CurrentSchemaVersion, Token: token, ClusterID: clusterID})
+	if err != nil {
+		return err
+	}
+	return c.StoreSecret(ctx, c.paths.Data(distro, clusterID, "token"), data)
+}
+
+// RetrieveJoinToken loads the join token record using cluster ID
+func (c *Client) RetrieveJoinToken(ctx context.Context, distro, clusterID string) (*JoinToken, error) {
+	return c.RetrieveJoinTokenVersion(ctx, distro, clusterID, 0)
+}
+
+// RetrieveJoinTokenVersion loads a specific version of the join token record; version 0 is the current one
+func (c *Client) RetrieveJoinTokenVersion(ctx context.Context, distro, clusterID string, version int) (*JoinToken, error) {
+	path := c.paths.Data(distro, clusterID, "token")
+	data, err := c.RetrieveSecretVersion(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	token := &JoinToken{}
+	if err := decodeRecord(path, data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RotateJoinToken replaces the stored join token oldToken with newToken and records the rotation
+// time and host. The update uses check-and-set: if the stored token no longer equals oldToken
+// (another rotation happened in between), an error matching ErrConflict is returned and nothing is written.
+func (c *Client) RotateJoinToken(ctx context.Context, distro, clusterID, oldToken, newToken, rotatedBy string) error {
+	path := c.paths.Data(distro, clusterID, "token")
+	return c.updateSecretCAS(ctx, path, func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current == nil {
+			return nil, fmt.Errorf("%w at path: %s", ErrNotFound, path)
+		}
+		stored := &JoinToken{}
+		if err := decodeRecord(path, current, stored); err != nil {
+			return nil, err
+		}
+		if stored.Token != oldToken {
+			return nil, fmt.Errorf("%w: the join token at path '%s' was changed by someone else", ErrConflict, path)
+		}
+
+		return encodeRecord(&JoinToken{
+			SchemaVersion: CurrentSchemaVersion,
+			Token:         newToken,
+			ClusterID:     clusterID,
+			RotatedAt:     now().UTC().Format(time.RFC3339),
+			RotatedBy:     rotatedBy,
+		})
 	})
 }
 
-// RetrieveJoinToken loads a join token using cluster ID
-func (c *Client) RetrieveJoinToken(distro, clusterID string) (string, error) {
-	data, err := c.RetrieveSecret(fmt.Sprintf("kv/data/%s/%s/token", distro, clusterID))
+// StoreAgentToken saves the agent-only token under a specific cluster path
+func (c *Client) StoreAgentToken(ctx context.Context, distro, clusterID, token string) error {
+	data, err := encodeRecord(&AgentToken{SchemaVersion: CurrentSchemaVersion, Token: token, ClusterID: clusterID})
+	if err != nil {
+		return err
+	}
+	return c.StoreSecret(ctx, c.paths.Data(distro, clusterID, "agent-token"), data)
+}
+
+// RetrieveAgentToken loads the agent-only token record using cluster ID
+func (c *Client) RetrieveAgentToken(ctx context.Context, distro, clusterID string) (*AgentToken, error) {
+	path := c.paths.Data(distro, clusterID, "agent-token")
+	data, err := c.RetrieveSecret(ctx, path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	token, ok := data["join_token"].(string)
-	if !ok {
-		return "", fmt.Errorf("join_token not found for cluster %s", clusterID)
+	token := &AgentToken{}
+	if err := decodeRecord(path, data, token); err != nil {
+		return nil, err
 	}
 	return token, nil
 }
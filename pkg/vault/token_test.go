@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateJoinToken_RecordsRotation(t *testing.T) {
+	original := now
+	now = func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = original })
+
+	stub := newHistoryStub()
+	client := newStubClient(t, stub)
+
+	if err := client.RotateJoinToken(t.Context(), "rke2", "c1", "K10third", "K10fourth", "master-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stub.versions) != 4 {
+		t.Fatalf("expected a new version, got %d", len(stub.versions))
+	}
+
+	token, err := client.RetrieveJoinToken(t.Context(), "rke2", "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.Token != "K10fourth" || token.RotatedAt != "2025-06-01T12:00:00Z" || token.RotatedBy != "master-1" {
+		t.Errorf("unexpected rotated record: %+v", token)
+	}
+}
+
+func TestRotateJoinToken_StaleOldToken(t *testing.T) {
+	stub := newHistoryStub()
+	client := newStubClient(t, stub)
+
+	err := client.RotateJoinToken(t.Context(), "rke2", "c1", "K10second", "K10fourth", "master-1")
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+	if len(stub.versions) != 3 {
+		t.Errorf("expected nothing to be written, got %d versions", len(stub.versions))
+	}
+}
+
+func TestStoreRetrieveAgentToken(t *testing.T) {
+	client := newStubClient(t, &historyStubServer{deleted: map[int]bool{}})
+
+	if err := client.StoreAgentToken(t.Context(), "rke2", "c1", "K10abc::node:agentsecret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := client.RetrieveAgentToken(t.Context(), "rke2", "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.Token != "K10abc::node:agentsecret" || token.ClusterID != "c1" || token.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("unexpected agent token record: %+v", token)
+	}
+}
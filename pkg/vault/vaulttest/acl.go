@@ -0,0 +1,224 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vaulttest provides a fake OpenBao server for tests that can't run the real one (in Docker).
+
+This file implements ACL policies: sys/policies/acl/<name> stores them, and every request made
+with a token other than a root token is checked against the policies it carries. Policies use
+OpenBao's HCL form, limited to path blocks with a capabilities list:
+
+	path "kv/data/rke2/c1/*" {
+	  capabilities = ["read", "list"]
+	}
+
+A path ending in "*" matches everything below it and "+" matches one path segment. As in
+OpenBao, the most specific matching path decides; "deny" overrides the other capabilities.
+*/
+package vaulttest
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// policy is a parsed ACL policy.
+type policy struct {
+	name  string
+	text  string
+	rules []policyRule
+}
+
+// policyRule grants capabilities on a path pattern.
+type policyRule struct {
+	pattern      string
+	capabilities map[string]bool
+}
+
+var (
+	// policyBlock matches one path block of a policy
+	policyBlock = regexp.MustCompile(`path\s+"([^"]*)"\s*\{\s*capabilities\s*=\s*\[([^\]]*)\]\s*\}`)
+	// policyComment matches comment lines
+	policyComment = regexp.MustCompile(`(?m)^\s*#.*$`)
+	// policyCapability matches a quoted capability
+	policyCapability = regexp.MustCompile(`"([a-z]+)"`)
+)
+
+// defaultPolicy is attached to every token unless it is created without it; it lets the token
+// look itself up, as OpenBao's default policy does.
+var defaultPolicy = mustParsePolicy("default", `
+path "auth/token/lookup-self" {
+  capabilities = ["read"]
+}
+path "auth/token/renew-self" {
+  capabilities = ["update"]
+}
+path "auth/token/revoke-self" {
+  capabilities = ["update"]
+}
+`)
+
+// parsePolicy parses the HCL text of a policy.
+func parsePolicy(name, text string) (*policy, error) {
+	p := &policy{name: name, text: text}
+	rest := policyComment.ReplaceAllString(text, "")
+	for _, m := range policyBlock.FindAllStringSubmatch(rest, -1) {
+		rule := policyRule{pattern: m[1], capabilities: map[string]bool{}}
+		for _, c := range policyCapability.FindAllStringSubmatch(m[2], -1) {
+			rule.capabilities[c[1]] = true
+		}
+		p.rules = append(p.rules, rule)
+	}
+	if strings.TrimSpace(policyBlock.ReplaceAllString(rest, "")) != "" {
+		return nil, newError(http.StatusBadRequest, "failed to parse policy %q: only path blocks with capabilities are supported", name)
+	}
+	return p, nil
+}
+
+func mustParsePolicy(name, text string) *policy {
+	p, err := parsePolicy(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// matches reports whether path matches the rule's pattern, and how specific the match is
+// (the length of the pattern, with exact patterns above every glob).
+func (r policyRule) matches(path string) (bool, int) {
+	pattern, glob := strings.CutSuffix(r.pattern, "*")
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	if !glob && len(patternSegments) != len(pathSegments) {
+		return false, 0
+	}
+	if len(pathSegments) < len(patternSegments) {
+		return false, 0
+	}
+	for i, segment := range patternSegments {
+		last := i == len(patternSegments)-1
+		switch {
+		case segment == "+":
+		case last && glob:
+			if !strings.HasPrefix(pathSegments[i], segment) {
+				return false, 0
+			}
+		case segment != pathSegments[i]:
+			return false, 0
+		}
+	}
+	if !glob {
+		return true, 1 << 30
+	}
+	return true, len(pattern)
+}
+
+// allowed reports whether tok holds capability on path.
+func (s *Server) allowed(tok *token, path, capability string) bool {
+	best, bestPattern := -1, ""
+	granted := map[string]bool{}
+	for _, name := range tok.policies {
+		if name == "root" {
+			return true
+		}
+		p := s.policies[name]
+		if name == "default" {
+			p = defaultPolicy
+		}
+		if p == nil {
+			continue
+		}
+		for _, rule := range p.rules {
+			ok, score := rule.matches(path)
+			if !ok || score < best {
+				continue
+			}
+			if score > best || rule.pattern != bestPattern {
+				best, bestPattern = score, rule.pattern
+				granted = map[string]bool{}
+			}
+			for c := range rule.capabilities {
+				granted[c] = true
+			}
+		}
+	}
+	return !granted["deny"] && granted[capability]
+}
+
+func (s *Server) policyEndpoint(req *request) (int, map[string]interface{}, error) {
+	name := strings.ToLower(strings.TrimPrefix(req.path, "sys/policies/acl/"))
+	if name == "" || strings.Contains(name, "/") {
+		return 0, nil, newError(http.StatusBadRequest, "invalid policy name %q", name)
+	}
+
+	switch req.op {
+	case "read":
+		if err := s.authorize(req, "read"); err != nil {
+			return 0, nil, err
+		}
+		p, ok := s.policies[name]
+		if !ok {
+			return 0, nil, newError(http.StatusNotFound, "")
+		}
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"name": p.name, "policy": p.text}}, nil
+
+	case "write":
+		if err := s.authorize(req, "update"); err != nil {
+			return 0, nil, err
+		}
+		if name == "root" || name == "default" {
+			return 0, nil, newError(http.StatusBadRequest, "cannot update %s policy", name)
+		}
+		text, _ := req.body["policy"].(string)
+		p, err := parsePolicy(name, text)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.policies[name] = p
+		return 0, nil, nil
+
+	case "delete":
+		if err := s.authorize(req, "delete"); err != nil {
+			return 0, nil, err
+		}
+		delete(s.policies, name)
+		return 0, nil, nil
+	}
+	return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+}
+
+// capabilities lists the capabilities tok holds on path: ["root"] for root tokens, ["deny"] if none.
+func (s *Server) capabilities(tok *token, path string) []string {
+	if hasPolicy(tok.policies, "root") {
+		return []string{"root"}
+	}
+	var granted []string
+	for _, c := range []string{"create", "read", "update", "patch", "delete", "list", "sudo"} {
+		if s.allowed(tok, path, c) {
+			granted = append(granted, c)
+		}
+	}
+	if len(granted) == 0 {
+		return []string{"deny"}
+	}
+	return granted
+}
+
+// hasMountAccess reports whether tok holds any capability below a mount.
+func (s *Server) hasMountAccess(tok *token, mount string) bool {
+	for _, name := range tok.policies {
+		if name == "root" {
+			return true
+		}
+		p := s.policies[name]
+		if p == nil {
+			continue
+		}
+		for _, rule := range p.rules {
+			if strings.HasPrefix(rule.pattern, mount+"/") && !rule.capabilities["deny"] && len(rule.capabilities) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
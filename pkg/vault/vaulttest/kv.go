@@ -0,0 +1,247 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vaulttest provides a fake OpenBao server for tests that can't run the real one (in Docker).
+
+This file implements the KV v2 secrets engine with OpenBao's request and response shapes:
+- <mount>/data/<key>: read (?version=N), write (with options.cas) and soft delete
+- <mount>/metadata/<key>: read the version history, list keys and delete all versions
+
+A missing secret is a 404 with an empty error list; a deleted version is a 404 carrying its
+metadata, which is how the SDK and vault.Client tell the two apart.
+*/
+package vaulttest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kvMaxVersions is how many versions of a secret are kept, OpenBao's default.
+const kvMaxVersions = 10
+
+// kvMount is a KV v2 engine: its secrets by key.
+type kvMount struct {
+	secrets map[string]*kvSecret
+}
+
+// kvSecret holds the versions of a secret.
+type kvSecret struct {
+	current  int
+	created  time.Time
+	updated  time.Time
+	versions map[int]*kvVersion
+}
+
+// kvVersion is one version of a secret.
+type kvVersion struct {
+	data    map[string]interface{}
+	created time.Time
+	deleted time.Time
+}
+
+func newKVMount() *kvMount {
+	return &kvMount{secrets: map[string]*kvSecret{}}
+}
+
+// metadata returns the metadata of version number as OpenBao reports it.
+func (v *kvVersion) metadata(number int) map[string]interface{} {
+	return map[string]interface{}{
+		"created_time":    formatTime(v.created),
+		"custom_metadata": nil,
+		"deletion_time":   formatTime(v.deleted),
+		"destroyed":       false,
+		"version":         number,
+	}
+}
+
+func (s *Server) kvEndpoint(req *request, mount *kvMount, rest string) (int, map[string]interface{}, error) {
+	kind, key, _ := strings.Cut(rest, "/")
+	switch {
+	case kind == "data" && key != "":
+		switch req.op {
+		case "read":
+			if err := s.authorize(req, "read"); err != nil {
+				return 0, nil, err
+			}
+			return mount.read(key, req.query.Get("version"))
+		case "write":
+			capability := "create"
+			if _, ok := mount.secrets[key]; ok {
+				capability = "update"
+			}
+			if err := s.authorize(req, capability); err != nil {
+				return 0, nil, err
+			}
+			return mount.write(key, req.body)
+		case "delete":
+			if err := s.authorize(req, "delete"); err != nil {
+				return 0, nil, err
+			}
+			mount.softDelete(key)
+			return 0, nil, nil
+		}
+
+	case kind == "metadata":
+		switch req.op {
+		case "list":
+			if err := s.authorize(req, "list"); err != nil {
+				return 0, nil, err
+			}
+			return mount.list(key)
+		case "read":
+			if err := s.authorize(req, "read"); err != nil {
+				return 0, nil, err
+			}
+			return mount.history(key)
+		case "delete":
+			if err := s.authorize(req, "delete"); err != nil {
+				return 0, nil, err
+			}
+			delete(mount.secrets, key)
+			return 0, nil, nil
+		}
+	}
+	return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+}
+
+func (m *kvMount) read(key, rawVersion string) (int, map[string]interface{}, error) {
+	secret, ok := m.secrets[key]
+	if !ok {
+		return 0, nil, newError(http.StatusNotFound, "")
+	}
+	number := secret.current
+	if rawVersion != "" && rawVersion != "0" {
+		var err error
+		if number, err = strconv.Atoi(rawVersion); err != nil {
+			return 0, nil, newError(http.StatusBadRequest, "invalid version %q", rawVersion)
+		}
+	}
+	version, ok := secret.versions[number]
+	if !ok {
+		return 0, nil, newError(http.StatusNotFound, "")
+	}
+
+	body := map[string]interface{}{"data": map[string]interface{}{"data": version.data, "metadata": version.metadata(number)}}
+	if !version.deleted.IsZero() {
+		body["data"].(map[string]interface{})["data"] = nil
+		return http.StatusNotFound, body, nil
+	}
+	return http.StatusOK, body, nil
+}
+
+func (m *kvMount) write(key string, body map[string]interface{}) (int, map[string]interface{}, error) {
+	data, ok := body["data"].(map[string]interface{})
+	if !ok {
+		return 0, nil, newError(http.StatusBadRequest, "no data provided")
+	}
+
+	secret := m.secrets[key]
+	current := 0
+	if secret != nil {
+		current = secret.current
+	}
+	if options, ok := body["options"].(map[string]interface{}); ok {
+		if raw, ok := options["cas"]; ok {
+			cas, err := strconv.Atoi(fmt.Sprint(raw))
+			if err != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalid cas value %v", raw)
+			}
+			if cas != current {
+				return 0, nil, newError(http.StatusBadRequest, "check-and-set parameter did not match the current version")
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	if secret == nil {
+		secret = &kvSecret{created: now, versions: map[int]*kvVersion{}}
+		m.secrets[key] = secret
+	}
+	secret.current++
+	secret.updated = now
+	version := &kvVersion{data: data, created: now}
+	secret.versions[secret.current] = version
+	delete(secret.versions, secret.current-kvMaxVersions)
+
+	return http.StatusOK, map[string]interface{}{"data": version.metadata(secret.current)}, nil
+}
+
+func (m *kvMount) softDelete(key string) {
+	secret, ok := m.secrets[key]
+	if !ok {
+		return
+	}
+	if version, ok := secret.versions[secret.current]; ok && version.deleted.IsZero() {
+		version.deleted = time.Now().UTC()
+	}
+}
+
+func (m *kvMount) list(key string) (int, map[string]interface{}, error) {
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	seen := map[string]bool{}
+	keys := []string{}
+	for stored := range m.secrets {
+		rest, ok := strings.CutPrefix(stored, prefix)
+		if !ok {
+			continue
+		}
+		child := rest
+		if first, _, nested := strings.Cut(rest, "/"); nested {
+			child = first + "/"
+		}
+		if !seen[child] {
+			seen[child] = true
+			keys = append(keys, child)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil, newError(http.StatusNotFound, "")
+	}
+	sort.Strings(keys)
+	return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}}, nil
+}
+
+func (m *kvMount) history(key string) (int, map[string]interface{}, error) {
+	secret, ok := m.secrets[key]
+	if !ok || key == "" {
+		return 0, nil, newError(http.StatusNotFound, "")
+	}
+	versions := map[string]interface{}{}
+	oldest := secret.current
+	for number, v := range secret.versions {
+		fields := v.metadata(number)
+		delete(fields, "version")
+		delete(fields, "custom_metadata")
+		versions[strconv.Itoa(number)] = fields
+		if number < oldest {
+			oldest = number
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"cas_required":         false,
+		"created_time":         formatTime(secret.created),
+		"current_version":      secret.current,
+		"custom_metadata":      nil,
+		"delete_version_after": "0s",
+		"max_versions":         0,
+		"oldest_version":       oldest,
+		"updated_time":         formatTime(secret.updated),
+		"versions":             versions,
+	}}, nil
+}
+
+// formatTime formats t as OpenBao does; the zero time is an empty string.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,549 @@
+/*
+Copyright © 2025 VH & Co - contact@vhco.pro
+
+Package vaulttest provides a fake OpenBao server for tests that can't run the real one (in Docker).
+
+The fake speaks the parts of OpenBao's HTTP API edgectl uses, so the real vault.Client (and the
+OpenBao SDK under it) talks to it unchanged:
+  - KV v2 secrets engines: versioned reads and writes with check-and-set, soft deletes, metadata,
+    lists and 404 responses shaped like OpenBao's (see kv.go)
+  - sys/seal-status, sys/health, sys/mounts, sys/internal/ui/mounts and sys/policies/acl
+  - Token auth: auth/token/create and auth/token/lookup-self, with ACL policies enforced on every
+    request and reported by sys/capabilities-self (see acl.go)
+
+Like `bao server -dev`, it starts unsealed with a KV v2 engine at secret/ and a root token
+(RootToken). Everything is kept in memory and lost when the server is closed.
+*/
+package vaulttest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RootToken is the token of the root user, like the dev server's -dev-root-token-id.
+	RootToken = "root"
+	// Version is the OpenBao version the fake reports.
+	Version = "2.3.1"
+	// defaultTokenTTL is the TTL of tokens created without one, OpenBao's default of 32 days.
+	defaultTokenTTL = 768 * time.Hour
+)
+
+// Server is a fake OpenBao server listening on a local address.
+type Server struct {
+	// URL is the address of the server, to be used as VAULT_ADDR / BAO_ADDR
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	sealed   bool
+	mounts   map[string]*kvMount
+	policies map[string]*policy
+	tokens   map[string]*token
+}
+
+// token is an issued token. A zero ttl never expires (root tokens).
+type token struct {
+	id          string
+	accessor    string
+	displayName string
+	policies    []string
+	created     time.Time
+	ttl         time.Duration
+}
+
+// expiresAt returns when the token expires, or the zero time if it doesn't.
+func (t *token) expiresAt() time.Time {
+	if t.ttl == 0 {
+		return time.Time{}
+	}
+	return t.created.Add(t.ttl)
+}
+
+// apiError is an error response: the status code and the messages in its "errors" list.
+type apiError struct {
+	status   int
+	messages []string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d: %s", e.status, strings.Join(e.messages, "; "))
+}
+
+// newError returns an error response with one message; an empty message gives an empty list,
+// as OpenBao sends for missing secrets.
+func newError(status int, format string, args ...interface{}) *apiError {
+	if format == "" {
+		return &apiError{status: status, messages: []string{}}
+	}
+	return &apiError{status: status, messages: []string{fmt.Sprintf(format, args...)}}
+}
+
+// errPermissionDenied is returned for requests without a valid token or the capability they need.
+var errPermissionDenied = newError(http.StatusForbidden, "permission denied")
+
+// NewServer starts a fake OpenBao server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		mounts:   map[string]*kvMount{"secret": newKVMount()},
+		policies: map[string]*policy{},
+		tokens:   map[string]*token{},
+	}
+	s.tokens[RootToken] = &token{id: RootToken, accessor: newID(), policies: []string{"root"}, created: time.Now()}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetSealed seals or unseals the server. A sealed server answers every request but
+// sys/seal-status and sys/health with 503.
+func (s *Server) SetSealed(sealed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed = sealed
+}
+
+// EnableKV mounts a KV v2 engine at path, like `bao secrets enable -path=<path> kv-v2`.
+// Mounting an existing path is a no-op.
+func (s *Server) EnableKV(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path = strings.Trim(path, "/")
+	if _, ok := s.mounts[path]; !ok {
+		s.mounts[path] = newKVMount()
+	}
+}
+
+// request is a decoded API request.
+type request struct {
+	path  string
+	op    string // read, list, write or delete
+	query url.Values
+	body  map[string]interface{}
+	token *token
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	status, resp, err := s.handle(r)
+	if err != nil {
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			apiErr = newError(http.StatusInternalServerError, "%v", err)
+		}
+		writeJSON(w, apiErr.status, map[string]interface{}{"errors": apiErr.messages})
+		return
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, status, resp)
+}
+
+// handle answers a request with a status and a response body (nil: no content), or an error.
+func (s *Server) handle(r *http.Request) (int, map[string]interface{}, error) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/")
+	if !ok {
+		return 0, nil, newError(http.StatusNotFound, "unsupported path")
+	}
+	req := &request{path: strings.TrimSuffix(path, "/"), query: r.URL.Query()}
+	switch {
+	case r.Method == "LIST" || (r.Method == http.MethodGet && r.URL.Query().Get("list") == "true"):
+		req.op = "list"
+	case r.Method == http.MethodGet:
+		req.op = "read"
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		req.op = "write"
+		body, err := decodeBody(r.Body)
+		if err != nil {
+			return 0, nil, err
+		}
+		req.body = body
+	case r.Method == http.MethodDelete:
+		req.op = "delete"
+	default:
+		return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.path {
+	case "sys/seal-status":
+		return http.StatusOK, s.sealStatus(), nil
+	case "sys/health":
+		if s.sealed {
+			return http.StatusServiceUnavailable, s.health(), nil
+		}
+		return http.StatusOK, s.health(), nil
+	}
+	if s.sealed {
+		return 0, nil, newError(http.StatusServiceUnavailable, "Vault is sealed")
+	}
+
+	tok, err := s.authenticate(r.Header.Get("X-Vault-Token"))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.token = tok
+
+	switch {
+	case req.path == "auth/token/lookup-self":
+		return s.lookupSelf(req)
+	case req.path == "auth/token/create":
+		return s.createToken(req)
+	case req.path == "sys/mounts" || strings.HasPrefix(req.path, "sys/mounts/"):
+		return s.mountsEndpoint(req)
+	case strings.HasPrefix(req.path, "sys/internal/ui/mounts/"):
+		return s.uiMountEndpoint(req)
+	case req.path == "sys/capabilities-self":
+		return s.capabilitiesSelf(req)
+	case strings.HasPrefix(req.path, "sys/policies/acl/"):
+		return s.policyEndpoint(req)
+	}
+	if mount, rest, ok := s.findMount(req.path); ok {
+		return s.kvEndpoint(req, mount, rest)
+	}
+	return 0, nil, newError(http.StatusNotFound, "no handler for route %q. route entry not found.", req.path)
+}
+
+// authenticate returns the token of a request. Expired tokens are revoked.
+func (s *Server) authenticate(id string) (*token, error) {
+	tok, ok := s.tokens[id]
+	if !ok {
+		return nil, errPermissionDenied
+	}
+	if expires := tok.expiresAt(); !expires.IsZero() && time.Now().After(expires) {
+		delete(s.tokens, id)
+		return nil, errPermissionDenied
+	}
+	return tok, nil
+}
+
+// authorize checks that the token of req holds capability on req.path.
+func (s *Server) authorize(req *request, capability string) error {
+	if !s.allowed(req.token, req.path, capability) {
+		return errPermissionDenied
+	}
+	return nil
+}
+
+func (s *Server) sealStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"type":          "shamir",
+		"initialized":   true,
+		"sealed":        s.sealed,
+		"t":             1,
+		"n":             1,
+		"progress":      0,
+		"nonce":         "",
+		"version":       Version,
+		"build_date":    "2025-01-01T00:00:00Z",
+		"migration":     false,
+		"cluster_name":  "vaulttest",
+		"cluster_id":    "vaulttest",
+		"recovery_seal": false,
+		"storage_type":  "inmem",
+	}
+}
+
+func (s *Server) health() map[string]interface{} {
+	return map[string]interface{}{
+		"initialized":     true,
+		"sealed":          s.sealed,
+		"standby":         false,
+		"server_time_utc": time.Now().Unix(),
+		"version":         Version,
+		"cluster_name":    "vaulttest",
+		"cluster_id":      "vaulttest",
+	}
+}
+
+func (s *Server) lookupSelf(req *request) (int, map[string]interface{}, error) {
+	if req.op != "read" {
+		return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+	}
+	if err := s.authorize(req, "read"); err != nil {
+		return 0, nil, err
+	}
+	tok := req.token
+	var expireTime interface{}
+	ttl := 0
+	if expires := tok.expiresAt(); !expires.IsZero() {
+		expireTime = expires.UTC().Format(time.RFC3339Nano)
+		ttl = int(time.Until(expires).Seconds())
+	}
+	return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"accessor":         tok.accessor,
+		"creation_time":    tok.created.Unix(),
+		"creation_ttl":     int(tok.ttl.Seconds()),
+		"display_name":     tok.displayName,
+		"entity_id":        "",
+		"expire_time":      expireTime,
+		"explicit_max_ttl": int(tok.ttl.Seconds()),
+		"id":               tok.id,
+		"issue_time":       tok.created.UTC().Format(time.RFC3339Nano),
+		"meta":             nil,
+		"num_uses":         0,
+		"orphan":           tok.id == RootToken,
+		"path":             "auth/token/create",
+		"policies":         tok.policies,
+		"renewable":        tok.ttl > 0,
+		"ttl":              ttl,
+		"type":             "service",
+	}}, nil
+}
+
+func (s *Server) createToken(req *request) (int, map[string]interface{}, error) {
+	if req.op != "write" {
+		return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+	}
+	if err := s.authorize(req, "update"); err != nil {
+		return 0, nil, err
+	}
+
+	policies := stringList(req.body["policies"])
+	if len(policies) == 0 {
+		policies = append(policies, req.token.policies...)
+	}
+	if !hasPolicy(req.token.policies, "root") {
+		for _, p := range policies {
+			if p != "default" && !hasPolicy(req.token.policies, p) {
+				return 0, nil, newError(http.StatusBadRequest, "child policies must be subset of parent")
+			}
+		}
+	}
+	if noDefault, _ := req.body["no_default_policy"].(bool); !noDefault && !hasPolicy(policies, "root") && !hasPolicy(policies, "default") {
+		policies = append(policies, "default")
+	}
+	sort.Strings(policies)
+
+	ttl := defaultTokenTTL
+	for _, field := range []string{"ttl", "explicit_max_ttl"} {
+		raw, _ := req.body[field].(string)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return 0, nil, newError(http.StatusBadRequest, "invalid %s %q", field, raw)
+		}
+		if d > 0 && d < ttl {
+			ttl = d
+		}
+	}
+	if hasPolicy(policies, "root") {
+		ttl = 0
+	}
+
+	displayName := "token"
+	if name, _ := req.body["display_name"].(string); name != "" {
+		displayName = "token-" + name
+	}
+	tok := &token{id: "s." + newID(), accessor: newID(), displayName: displayName, policies: policies, created: time.Now(), ttl: ttl}
+	s.tokens[tok.id] = tok
+
+	return http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{
+		"client_token":   tok.id,
+		"accessor":       tok.accessor,
+		"policies":       tok.policies,
+		"token_policies": tok.policies,
+		"metadata":       nil,
+		"lease_duration": int(ttl.Seconds()),
+		"renewable":      ttl > 0,
+		"entity_id":      "",
+		"token_type":     "service",
+		"orphan":         false,
+	}}, nil
+}
+
+// uiMountEndpoint describes the mount of a path to any token with access to that mount, as the
+// bao CLI uses it to detect KV versions. Like OpenBao, it answers 403 for missing mounts as well.
+func (s *Server) uiMountEndpoint(req *request) (int, map[string]interface{}, error) {
+	if req.op != "read" {
+		return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+	}
+	path := strings.TrimPrefix(req.path, "sys/internal/ui/mounts/")
+	name := ""
+	for mount := range s.mounts {
+		if (path == mount || strings.HasPrefix(path, mount+"/")) && len(mount) > len(name) {
+			name = mount
+		}
+	}
+	if name == "" || !s.hasMountAccess(req.token, name) {
+		return 0, nil, newError(http.StatusForbidden, "preflight capability check returned 403, please ensure client's policies grant access to path %q", path+"/")
+	}
+	return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"type":        "kv",
+		"description": "",
+		"options":     map[string]interface{}{"version": "2"},
+		"path":        name + "/",
+	}}, nil
+}
+
+// capabilitiesSelf lists the capabilities the request's token holds on the requested paths.
+func (s *Server) capabilitiesSelf(req *request) (int, map[string]interface{}, error) {
+	if req.op != "write" {
+		return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+	}
+	paths := stringList(req.body["paths"])
+	if path, _ := req.body["path"].(string); path != "" {
+		paths = append(paths, path)
+	}
+	data := map[string]interface{}{}
+	for _, path := range paths {
+		data[path] = s.capabilities(req.token, strings.Trim(path, "/"))
+	}
+	if len(paths) == 1 {
+		data["capabilities"] = data[paths[0]]
+	}
+	return http.StatusOK, map[string]interface{}{"data": data}, nil
+}
+
+func (s *Server) mountsEndpoint(req *request) (int, map[string]interface{}, error) {
+	name := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(req.path, "sys/mounts"), "/"), "/")
+	describe := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":        "kv",
+			"description": "",
+			"options":     map[string]interface{}{"version": "2"},
+			"path":        name + "/",
+		}
+	}
+
+	switch {
+	case name == "" && req.op == "read":
+		if err := s.authorize(req, "read"); err != nil {
+			return 0, nil, err
+		}
+		mounts := map[string]interface{}{}
+		for mount := range s.mounts {
+			mounts[mount+"/"] = describe(mount)
+		}
+		return http.StatusOK, map[string]interface{}{"data": mounts}, nil
+
+	case name != "" && req.op == "read":
+		if err := s.authorize(req, "read"); err != nil {
+			return 0, nil, err
+		}
+		if _, ok := s.mounts[name]; !ok {
+			return 0, nil, newError(http.StatusBadRequest, "no mount found at %s/", name)
+		}
+		return http.StatusOK, map[string]interface{}{"data": describe(name)}, nil
+
+	case name != "" && req.op == "write":
+		if err := s.authorize(req, "update"); err != nil {
+			return 0, nil, err
+		}
+		if _, ok := s.mounts[name]; ok {
+			return 0, nil, newError(http.StatusBadRequest, "path is already in use at %s/", name)
+		}
+		kind, _ := req.body["type"].(string)
+		options, _ := req.body["options"].(map[string]interface{})
+		if kind != "kv-v2" && (kind != "kv" || fmt.Sprint(options["version"]) != "2") {
+			return 0, nil, newError(http.StatusBadRequest, "vaulttest only supports KV v2 mounts, got type %q", kind)
+		}
+		s.mounts[name] = newKVMount()
+		return 0, nil, nil
+
+	case name != "" && req.op == "delete":
+		if err := s.authorize(req, "delete"); err != nil {
+			return 0, nil, err
+		}
+		delete(s.mounts, name)
+		return 0, nil, nil
+	}
+	return 0, nil, newError(http.StatusMethodNotAllowed, "unsupported operation")
+}
+
+// findMount returns the KV mount path is under and the rest of the path.
+func (s *Server) findMount(path string) (*kvMount, string, bool) {
+	best := ""
+	for name := range s.mounts {
+		if strings.HasPrefix(path, name+"/") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return nil, "", false
+	}
+	return s.mounts[best], strings.TrimPrefix(path, best+"/"), true
+}
+
+// decodeBody decodes a JSON request body; numbers are kept as json.Number so they round-trip.
+func decodeBody(r io.Reader) (map[string]interface{}, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return body, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, newError(http.StatusBadRequest, "failed to parse JSON input: %v", err)
+	}
+	return body, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// stringList converts a JSON list of strings (or a comma-separated string) to a slice.
+func stringList(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func hasPolicy(policies []string, name string) bool {
+	for _, p := range policies {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newID returns a random identifier for tokens and accessors.
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
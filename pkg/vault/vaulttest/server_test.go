@@ -0,0 +1,235 @@
+package vaulttest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	vault "github.com/openbao/openbao/api/v2"
+)
+
+// newClient returns an OpenBao SDK client for a new server, authenticated with the root token.
+func newClient(t *testing.T) (*Server, *vault.Client) {
+	t.Helper()
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	config := vault.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+	client, err := vault.NewClient(config)
+	if err != nil {
+		t.Fatalf("vault.NewClient: %v", err)
+	}
+	client.SetToken(RootToken)
+	return server, client
+}
+
+// statusCode returns the HTTP status of an SDK error, or 0.
+func statusCode(err error) int {
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode
+	}
+	return 0
+}
+
+func TestServer_KVReadsLikeOpenBao(t *testing.T) {
+	_, client := newClient(t)
+	kv := client.Logical()
+
+	if secret, err := kv.Read("secret/data/app"); err != nil || secret != nil {
+		t.Fatalf("expected no secret before the first write, got %v (%v)", secret, err)
+	}
+	for _, value := range []string{"one", "two"} {
+		if _, err := kv.Write("secret/data/app", map[string]interface{}{"data": map[string]interface{}{"v": value}}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	_, err := kv.Write("secret/data/app", map[string]interface{}{"data": map[string]interface{}{"v": "three"}, "options": map[string]interface{}{"cas": 1}})
+	if statusCode(err) != http.StatusBadRequest {
+		t.Errorf("expected a check-and-set error, got %v", err)
+	}
+
+	first, err := kv.ReadWithData("secret/data/app", map[string][]string{"version": {"1"}})
+	if err != nil || first.Data["data"].(map[string]interface{})["v"] != "one" {
+		t.Errorf("expected version 1, got %v (%v)", first, err)
+	}
+
+	// A deleted version is a 404 that still carries its metadata
+	if _, err := kv.Delete("secret/data/app"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	deleted, err := kv.Read("secret/data/app")
+	if err != nil || deleted == nil || deleted.Data["data"] != nil {
+		t.Fatalf("expected the deleted version's metadata, got %v (%v)", deleted, err)
+	}
+	if metadata := deleted.Data["metadata"].(map[string]interface{}); metadata["deletion_time"] == "" {
+		t.Errorf("expected a deletion time, got %v", metadata)
+	}
+
+	keys, err := kv.List("secret/metadata/")
+	if err != nil || keys == nil || len(keys.Data["keys"].([]interface{})) != 1 {
+		t.Errorf("expected the soft-deleted key to be listed, got %v (%v)", keys, err)
+	}
+	if _, err := kv.Delete("secret/metadata/app"); err != nil {
+		t.Fatalf("Delete (metadata): %v", err)
+	}
+	if keys, err := kv.List("secret/metadata/"); err != nil || keys != nil {
+		t.Errorf("expected no keys after removing all versions, got %v (%v)", keys, err)
+	}
+}
+
+func TestServer_PoliciesScopeTokens(t *testing.T) {
+	_, client := newClient(t)
+	if err := client.Sys().PutPolicy("app", `
+# read the app secrets, but not the admin one
+path "secret/data/app/*" {
+  capabilities = ["read"]
+}
+path "secret/data/app/admin" {
+  capabilities = ["deny"]
+}`); err != nil {
+		t.Fatalf("PutPolicy: %v", err)
+	}
+	for _, key := range []string{"app/db", "app/admin", "other"} {
+		if _, err := client.Logical().Write("secret/data/"+key, map[string]interface{}{"data": map[string]interface{}{"k": "v"}}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	created, err := client.Auth().Token().Create(&vault.TokenCreateRequest{Policies: []string{"app"}, TTL: "10m"})
+	if err != nil {
+		t.Fatalf("Token().Create: %v", err)
+	}
+	if created.Auth.LeaseDuration != 600 {
+		t.Errorf("expected a 10 minute lease, got %d", created.Auth.LeaseDuration)
+	}
+	scoped, err := client.Clone()
+	if err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	scoped.SetToken(created.Auth.ClientToken)
+
+	if _, err := scoped.Logical().Read("secret/data/app/db"); err != nil {
+		t.Errorf("expected app/db to be readable, got %v", err)
+	}
+	for _, key := range []string{"app/admin", "other"} {
+		if _, err := scoped.Logical().Read("secret/data/" + key); statusCode(err) != http.StatusForbidden {
+			t.Errorf("expected %s to be denied, got %v", key, err)
+		}
+	}
+	if _, err := scoped.Logical().Write("secret/data/app/db", map[string]interface{}{"data": map[string]interface{}{"k": "x"}}); statusCode(err) != http.StatusForbidden {
+		t.Errorf("expected writes to be denied, got %v", err)
+	}
+
+	self, err := scoped.Auth().Token().LookupSelf()
+	if err != nil {
+		t.Fatalf("LookupSelf: %v", err)
+	}
+	if policies, _ := self.TokenPolicies(); len(policies) != 2 || policies[0] != "app" || policies[1] != "default" {
+		t.Errorf("expected the app and default policies, got %v", policies)
+	}
+	if ttl, _ := self.TokenTTL(); ttl <= 0 {
+		t.Errorf("expected a TTL, got %v", ttl)
+	}
+}
+
+func TestServer_Sealed(t *testing.T) {
+	server, client := newClient(t)
+	server.SetSealed(true)
+
+	status, err := client.Sys().SealStatus()
+	if err != nil || !status.Sealed || status.Version != Version {
+		t.Fatalf("expected a sealed status, got %+v (%v)", status, err)
+	}
+	if _, err := client.Logical().Read("secret/data/app"); statusCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("expected reads to fail while sealed, got %v", err)
+	}
+
+	server.SetSealed(false)
+	if _, err := client.Logical().Read("secret/data/app"); err != nil {
+		t.Errorf("expected reads to work after unsealing, got %v", err)
+	}
+}
+
+func TestServer_Mounts(t *testing.T) {
+	server, client := newClient(t)
+
+	data := map[string]interface{}{"data": map[string]interface{}{"k": "v"}}
+	if _, err := client.Logical().Write("kv/data/app", data); statusCode(err) != http.StatusNotFound {
+		t.Errorf("expected an unmounted path to be a 404, got %v", err)
+	}
+	if err := client.Sys().Mount("kv", &vault.MountInput{Type: "kv", Options: map[string]string{"version": "2"}}); err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+	if err := client.Sys().Mount("kv", &vault.MountInput{Type: "kv-v2"}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("expected mounting twice to fail, got %v", err)
+	}
+	if err := client.Sys().Mount("transit", &vault.MountInput{Type: "transit"}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("expected other engines to be refused, got %v", err)
+	}
+	if _, err := client.Logical().Write("kv/data/app", data); err != nil {
+		t.Errorf("expected writes to the new mount to work, got %v", err)
+	}
+	server.EnableKV("edge/")
+
+	mounts, err := client.Sys().ListMounts()
+	if err != nil || mounts["kv/"] == nil || mounts["edge/"] == nil || mounts["secret/"] == nil {
+		t.Errorf("expected the secret, kv and edge mounts, got %v (%v)", mounts, err)
+	}
+}
+
+func TestPolicyRule_Matches(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"kv/data/app", "kv/data/app", true},
+		{"kv/data/app", "kv/data/app/db", false},
+		{"kv/data/app/*", "kv/data/app/db/nested", true},
+		{"kv/data/app*", "kv/data/apple", true},
+		{"kv/data/app/*", "kv/data/app", false},
+		{"kv/+/app", "kv/metadata/app", true},
+		{"kv/+/app", "kv/metadata/other", false},
+	}
+	for _, tt := range tests {
+		if got, _ := (policyRule{pattern: tt.pattern}).matches(tt.path); got != tt.want {
+			t.Errorf("%q matching %q: expected %v, got %v", tt.pattern, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestServer_CapabilitiesAndUIMounts(t *testing.T) {
+	_, client := newClient(t)
+	if err := client.Sys().PutPolicy("app", `
+path "secret/data/app/*" {
+  capabilities = ["read", "list"]
+}`); err != nil {
+		t.Fatalf("PutPolicy: %v", err)
+	}
+	created, err := client.Auth().Token().Create(&vault.TokenCreateRequest{Policies: []string{"app"}})
+	if err != nil {
+		t.Fatalf("Token().Create: %v", err)
+	}
+	scoped, _ := client.Clone()
+	scoped.SetToken(created.Auth.ClientToken)
+
+	if caps, err := client.Sys().CapabilitiesSelf("secret/data/app/db"); err != nil || len(caps) != 1 || caps[0] != "root" {
+		t.Errorf("expected root capabilities, got %v (%v)", caps, err)
+	}
+	if caps, err := scoped.Sys().CapabilitiesSelf("secret/data/app/db"); err != nil || len(caps) != 2 || caps[0] != "read" || caps[1] != "list" {
+		t.Errorf("expected read and list, got %v (%v)", caps, err)
+	}
+	if caps, err := scoped.Sys().CapabilitiesSelf("secret/data/other"); err != nil || len(caps) != 1 || caps[0] != "deny" {
+		t.Errorf("expected deny, got %v (%v)", caps, err)
+	}
+
+	mount, err := scoped.Logical().Read("sys/internal/ui/mounts/secret/app")
+	if err != nil || mount.Data["path"] != "secret/" || mount.Data["type"] != "kv" {
+		t.Errorf("expected the secret/ mount, got %v (%v)", mount, err)
+	}
+	if _, err := scoped.Logical().Read("sys/internal/ui/mounts/kv"); statusCode(err) != http.StatusForbidden {
+		t.Errorf("expected a missing mount to be a 403, got %v", err)
+	}
+}